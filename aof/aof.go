@@ -40,7 +40,7 @@ type AOF struct {
 	aofFsync    string
 	lastDBIndex int
 
-	aofChan chan aofRecord
+	aofChan chan []aofRecord
 	mu      sync.Mutex
 
 	aofFinished chan struct{}
@@ -54,7 +54,7 @@ func NewAOF(aofFileName string, engine iface.Engine, fsync string) (*AOF, error)
 	aof := &AOF{}
 	aof.aofFileName = aofFileName
 	aof.aofFsync = strings.ToLower(fsync)
-	aof.aofChan = make(chan aofRecord)
+	aof.aofChan = make(chan []aofRecord)
 	aof.close = make(chan struct{})
 	aof.aofFinished = make(chan struct{})
 	aof.engine = engine
@@ -75,16 +75,31 @@ func NewAOF(aofFileName string, engine iface.Engine, fsync string) (*AOF, error)
 }
 
 func (a *AOF) watchAofChan() {
-	for record := range a.aofChan {
-		a.writeAofRecord(record)
+	for {
+		select {
+		case records := <-a.aofChan:
+			a.writeAofRecords(records...)
+		case <-a.close:
+			a.aofFinished <- struct{}{}
+			return
+		}
 	}
-	a.aofFinished <- struct{}{}
 }
 
-func (a *AOF) writeAofRecord(record aofRecord) {
+// 多条记录在一次加锁中连续写入，中间不会插入其他记录
+func (a *AOF) writeAofRecords(records ...aofRecord) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	for _, record := range records {
+		a.writeAofRecord(record)
+	}
+	if a.aofFsync == FsyncAlways {
+		a.aofFile.Sync()
+	}
+}
+
+func (a *AOF) writeAofRecord(record aofRecord) {
 	if record.dbIndex != a.lastDBIndex {
 		// 记录该次命令的db
 		selectCmd := Command{[]byte("select"), []byte(strconv.Itoa(record.dbIndex))}
@@ -103,9 +118,6 @@ func (a *AOF) writeAofRecord(record aofRecord) {
 		logger.Warn("write aof record error:", err)
 	}
 	logger.Debugf("write aof command: %q", data)
-	if a.aofFsync == FsyncAlways {
-		a.aofFile.Sync()
-	}
 }
 
 func (a *AOF) fsyncEverySec() {
@@ -186,18 +198,57 @@ func (a *AOF) LoadAof(maxBytes int) {
 }
 
 func (a *AOF) SaveGedisCommand(index int, command [][]byte) {
+	a.saveRecords([]aofRecord{{dbIndex: index, command: command}})
+}
+
+// 一条命令产生的多条记录，连续写入
+func (a *AOF) SaveCommands(indexes []int, commands []Command) {
+	if len(commands) == 0 {
+		return
+	}
+	records := make([]aofRecord, len(commands))
+	for i, command := range commands {
+		records[i] = aofRecord{dbIndex: indexes[i], command: command}
+	}
+	a.saveRecords(records)
+}
+
+// 事务中的命令，前后加上MULTI和EXEC作为一个整体写入
+func (a *AOF) SaveTransaction(indexes []int, commands []Command) {
+	if len(commands) == 0 {
+		return
+	}
+	records := make([]aofRecord, 0, len(commands)+2)
+	records = append(records, aofRecord{dbIndex: indexes[0], command: Command{[]byte("MULTI")}})
+	for i, command := range commands {
+		records = append(records, aofRecord{dbIndex: indexes[i], command: command})
+	}
+	records = append(records, aofRecord{dbIndex: indexes[len(indexes)-1], command: Command{[]byte("EXEC")}})
+	a.saveRecords(records)
+}
+
+func (a *AOF) saveRecords(records []aofRecord) {
 	if a.atomicClose.Load() {
 		return
 	}
 	if a.aofFsync == FsyncAlways {
-		a.writeAofRecord(aofRecord{
-			dbIndex: index,
-			command: command,
-		})
+		a.writeAofRecords(records...)
 		return
 	}
-	a.aofChan <- aofRecord{
-		dbIndex: index,
-		command: command,
+	select {
+	case a.aofChan <- records:
+	case <-a.close:
+	}
+}
+
+// Close 停止写入，等待后台写完已经提交的记录后关闭文件
+func (a *AOF) Close() {
+	a.atomicClose.Store(true)
+	close(a.close)
+	<-a.aofFinished
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.aofFile.Close(); err != nil {
+		logger.Warn("close aof file error:", err)
 	}
 }
@@ -2,6 +2,7 @@ package aof
 
 import (
 	"strconv"
+	"time"
 )
 
 func buildCmdLine(cmdName string, args ...[]byte) [][]byte {
@@ -17,10 +18,247 @@ func SetCmd(args ...[]byte) [][]byte {
 	return buildCmdLine("SET", args...)
 }
 
-func ExpireAtCmd(key string, ttl int64) [][]byte {
-	return buildCmdLine("EXPIRE", []byte(key), []byte(strconv.Itoa(int(ttl))))
+// 过期时间统一记录为毫秒级的绝对时间，保证回放结果一致
+func PExpireAtCmd(key string, expireAt time.Time) [][]byte {
+	return buildCmdLine("PEXPIREAT", []byte(key), []byte(strconv.FormatInt(expireAt.UnixMilli(), 10)))
+}
+
+func PersistCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("PERSIST", args...)
 }
 
 func ZAddCmd(args ...[]byte) [][]byte {
 	return buildCmdLine("ZADD", args...)
 }
+
+func HSetCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("HSET", args...)
+}
+
+func HSetNXCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("HSETNX", args...)
+}
+
+func HDelCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("HDEL", args...)
+}
+
+func HIncrByCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("HINCRBY", args...)
+}
+
+func LPushCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("LPUSH", args...)
+}
+
+func RPushCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("RPUSH", args...)
+}
+
+func LPopCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("LPOP", args...)
+}
+
+func RPopCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("RPOP", args...)
+}
+
+func LSetCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("LSET", args...)
+}
+
+func LInsertCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("LINSERT", args...)
+}
+
+func LRemCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("LREM", args...)
+}
+
+func LTrimCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("LTRIM", args...)
+}
+
+func LMoveCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("LMOVE", args...)
+}
+
+func SAddCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("SADD", args...)
+}
+
+func SRemCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("SREM", args...)
+}
+
+func SMoveCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("SMOVE", args...)
+}
+
+func SInterStoreCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("SINTERSTORE", args...)
+}
+
+func SUnionStoreCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("SUNIONSTORE", args...)
+}
+
+func SDiffStoreCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("SDIFFSTORE", args...)
+}
+
+func ZRemCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZREM", args...)
+}
+
+func ZIncrByCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZINCRBY", args...)
+}
+
+func ZRangeStoreCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZRANGESTORE", args...)
+}
+
+func ZRemRangeByRankCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZREMRANGEBYRANK", args...)
+}
+
+func ZRemRangeByScoreCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZREMRANGEBYSCORE", args...)
+}
+
+func ZRemRangeByLexCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZREMRANGEBYLEX", args...)
+}
+
+func ZPopMinCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZPOPMIN", args...)
+}
+
+func ZPopMaxCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZPOPMAX", args...)
+}
+
+func ZUnionStoreCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZUNIONSTORE", args...)
+}
+
+func ZInterStoreCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZINTERSTORE", args...)
+}
+
+func ZDiffStoreCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("ZDIFFSTORE", args...)
+}
+
+func IncrCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("INCR", args...)
+}
+
+func DecrCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("DECR", args...)
+}
+
+func IncrByCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("INCRBY", args...)
+}
+
+func DecrByCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("DECRBY", args...)
+}
+
+func MSetCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("MSET", args...)
+}
+
+func GetDelCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("GETDEL", args...)
+}
+
+func AppendCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("APPEND", args...)
+}
+
+func SetRangeCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("SETRANGE", args...)
+}
+
+func SetBitCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("SETBIT", args...)
+}
+
+func BitOpCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("BITOP", args...)
+}
+
+func BitFieldCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("BITFIELD", args...)
+}
+
+func PFAddCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("PFADD", args...)
+}
+
+func PFMergeCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("PFMERGE", args...)
+}
+
+func GeoSearchStoreCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("GEOSEARCHSTORE", args...)
+}
+
+func XAddCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("XADD", args...)
+}
+
+func XDelCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("XDEL", args...)
+}
+
+func XTrimCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("XTRIM", args...)
+}
+
+func XGroupCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("XGROUP", args...)
+}
+
+func XClaimCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("XCLAIM", args...)
+}
+
+func XAckCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("XACK", args...)
+}
+
+func DelCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("DEL", args...)
+}
+
+func RenameCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("RENAME", args...)
+}
+
+func RenameNXCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("RENAMENX", args...)
+}
+
+func FlushDBCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("FLUSHDB", args...)
+}
+
+func FlushAllCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("FLUSHALL", args...)
+}
+
+func SwapDBCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("SWAPDB", args...)
+}
+
+func MoveCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("MOVE", args...)
+}
+
+func CopyCmd(args ...[]byte) [][]byte {
+	return buildCmdLine("COPY", args...)
+}
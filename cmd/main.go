@@ -1,11 +1,21 @@
 package main
 
 import (
+	"gedis/config"
 	"gedis/gedis"
 	"gedis/server"
+	"gedis/tool/logger"
+	"os"
 )
 
 func main() {
+	// 第一个参数为配置文件路径
+	if len(os.Args) > 1 {
+		if err := config.SetupConfig(os.Args[1]); err != nil {
+			logger.Error("load config fail: ", err)
+			return
+		}
+	}
 	s := server.NewServer(":9000", gedis.NewGedisHandler())
 	s.Start()
 }
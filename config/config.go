@@ -0,0 +1,101 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ServerProperties 服务配置，cfg标签为配置文件中的名称
+type ServerProperties struct {
+	// 每秒执行后台任务（例如主动过期）的次数
+	Hz int `cfg:"hz"`
+	// 主动过期的力度，取值1~10，越大每次清理的key越多，占用的CPU也越多
+	ActiveExpireEffort int `cfg:"active-expire-effort"`
+	// 启动时加载的模块，每一行为模块名以及参数，可以出现多次
+	LoadModule []string `cfg:"loadmodule"`
+}
+
+var Properties = defaultProperties()
+
+func defaultProperties() *ServerProperties {
+	return &ServerProperties{
+		Hz:                 10,
+		ActiveExpireEffort: 1,
+	}
+}
+
+// 从文件加载配置，没有出现在文件中的配置项保持默认值
+func SetupConfig(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	properties, err := Parse(file)
+	if err != nil {
+		return err
+	}
+	Properties = properties
+	return nil
+}
+
+// 解析 name value 格式的配置，#开头的行为注释
+func Parse(reader io.Reader) (*ServerProperties, error) {
+	properties := defaultProperties()
+	fields := make(map[string]reflect.Value)
+	v := reflect.ValueOf(properties).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := t.Field(i).Tag.Lookup("cfg"); ok {
+			fields[name] = v.Field(i)
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name, value, _ := strings.Cut(line, " ")
+		name = strings.ToLower(name)
+		value = strings.TrimSpace(value)
+		field, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown config %s", lineNum, name)
+		}
+		if err := setField(field, value); err != nil {
+			return nil, fmt.Errorf("line %d: invalid value for %s: %s", lineNum, name, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return properties, nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		field.SetBool(value == "yes")
+	case reflect.Slice:
+		// 可以出现多次的配置项
+		field.Set(reflect.Append(field, reflect.ValueOf(value)))
+	default:
+		return fmt.Errorf("unsupported config type %s", field.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	properties, err := Parse(strings.NewReader("# comment\n\nhz 20\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if properties.Hz != 20 || properties.ActiveExpireEffort != 1 {
+		t.Errorf("unexpected properties: %+v", properties)
+	}
+	properties, err = Parse(strings.NewReader("loadmodule counter 10\nloadmodule bloom\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(properties.LoadModule) != 2 || properties.LoadModule[0] != "counter 10" || properties.LoadModule[1] != "bloom" {
+		t.Errorf("unexpected modules: %q", properties.LoadModule)
+	}
+	if _, err = Parse(strings.NewReader("hz abc")); err == nil {
+		t.Error("expect error for invalid value")
+	}
+	if _, err = Parse(strings.NewReader("unknown 1")); err == nil {
+		t.Error("expect error for unknown config")
+	}
+}
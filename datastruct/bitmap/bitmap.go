@@ -0,0 +1,109 @@
+package bitmap
+
+import "math/bits"
+
+// BitMap 以字符串形式存储的位图，与Redis一致，每个字节的最高位对应最小的偏移
+type BitMap []byte
+
+// 扩展到至少能容纳bitSize个位，不足的部分用0填充
+// 容量足够时在原来的数组上扩展，不会复制已有的数据
+func (b BitMap) Grow(bitSize int64) BitMap {
+	need := (bitSize + 7) / 8
+	if need <= int64(len(b)) {
+		return b
+	}
+	return append(b, make([]byte, need-int64(len(b)))...)
+}
+
+// 返回一个至少能容纳bitSize个位的副本，不足的部分用0填充
+func (b BitMap) Clone(bitSize int64) BitMap {
+	size := int64(len(b))
+	if need := (bitSize + 7) / 8; need > size {
+		size = need
+	}
+	newMap := make(BitMap, size)
+	copy(newMap, b)
+	return newMap
+}
+
+func (b BitMap) BitSize() int64 {
+	return int64(len(b)) * 8
+}
+
+func (b BitMap) GetBit(offset int64) byte {
+	idx := offset / 8
+	if idx >= int64(len(b)) {
+		return 0
+	}
+	return (b[idx] >> (7 - offset%8)) & 1
+}
+
+// 调用方需要保证offset在范围内
+func (b BitMap) SetBit(offset int64, value byte) {
+	idx := offset / 8
+	mask := byte(1) << (7 - offset%8)
+	if value == 0 {
+		b[idx] &^= mask
+	} else {
+		b[idx] |= mask
+	}
+}
+
+// 统计 [start, end] 位区间内1的个数
+func (b BitMap) Count(start, end int64) int64 {
+	if end >= b.BitSize() {
+		end = b.BitSize() - 1
+	}
+	var count int64
+	for start <= end {
+		// 字节对齐的部分整字节统计
+		if start%8 == 0 && start+7 <= end {
+			count += int64(bits.OnesCount8(b[start/8]))
+			start += 8
+			continue
+		}
+		count += int64(b.GetBit(start))
+		start++
+	}
+	return count
+}
+
+// 查找 [start, end] 位区间内第一个值为bit的位置，找不到返回-1
+func (b BitMap) Pos(bit byte, start, end int64) int64 {
+	if end >= b.BitSize() {
+		end = b.BitSize() - 1
+	}
+	// 整个字节都不满足时可以直接跳过
+	skip := byte(0x00)
+	if bit == 0 {
+		skip = 0xff
+	}
+	for start <= end {
+		if start%8 == 0 && start+7 <= end && b[start/8] == skip {
+			start += 8
+			continue
+		}
+		if b.GetBit(start) == bit {
+			return start
+		}
+		start++
+	}
+	return -1
+}
+
+// 读取从offset开始的width个位，作为无符号整数返回
+func (b BitMap) GetBits(offset int64, width int) uint64 {
+	var value uint64
+	for i := 0; i < width; i++ {
+		value = value<<1 | uint64(b.GetBit(offset+int64(i)))
+	}
+	return value
+}
+
+// 将value的低width位写入从offset开始的位置，调用方需要保证空间足够
+func (b BitMap) SetBits(offset int64, width int, value uint64) {
+	for i := 0; i < width; i++ {
+		bit := byte(value>>(width-1-i)) & 1
+		b.SetBit(offset+int64(i), bit)
+	}
+}
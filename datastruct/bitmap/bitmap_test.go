@@ -0,0 +1,32 @@
+package bitmap
+
+import "testing"
+
+func TestBitMap(t *testing.T) {
+	var bm BitMap
+	bm = bm.Grow(20)
+	if len(bm) != 3 {
+		t.Fatalf("expected 3 bytes, actual %d", len(bm))
+	}
+	bm.SetBit(0, 1)
+	bm.SetBit(9, 1)
+	bm.SetBit(19, 1)
+	if bm[0] != 0x80 || bm[1] != 0x40 || bm[2] != 0x10 {
+		t.Fatalf("unexpected bytes %x", []byte(bm))
+	}
+	if bm.Count(0, bm.BitSize()-1) != 3 || bm.Count(1, 18) != 1 {
+		t.Fatal("wrong count")
+	}
+	if bm.Pos(1, 1, bm.BitSize()-1) != 9 || bm.Pos(0, 0, 0) != -1 {
+		t.Fatal("wrong pos")
+	}
+
+	bm.SetBits(3, 12, 0xabc)
+	if bm.GetBits(3, 12) != 0xabc {
+		t.Fatalf("expected abc, actual %x", bm.GetBits(3, 12))
+	}
+	// 越界读取视为0
+	if bm.GetBit(1000) != 0 {
+		t.Fatal("out of range bit should be 0")
+	}
+}
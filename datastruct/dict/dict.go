@@ -93,3 +93,61 @@ func (d *ConcurrentDict) Put(key string, value any) int {
 	shard.m[key] = value
 	return 1
 }
+
+// 分片个数
+func (d *ConcurrentDict) ShardCount() int {
+	return len(d.shds)
+}
+
+// 遍历所有元素，consumer返回false时停止遍历
+// 遍历时持有分片的读锁，consumer中不能修改字典
+func (d *ConcurrentDict) ForEach(consumer func(key string, val any) bool) {
+	for _, shard := range d.shds {
+		if !shard.forEach(consumer) {
+			return
+		}
+	}
+}
+
+func (s *shard) forEach(consumer func(key string, val any) bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, val := range s.m {
+		if !consumer(key, val) {
+			return false
+		}
+	}
+	return true
+}
+
+// 返回所有的key
+func (d *ConcurrentDict) Keys() []string {
+	keys := make([]string, 0, d.Count())
+	d.ForEach(func(key string, val any) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// 以分片下标作为游标遍历，每次至少读取count个key（读取完整的分片），返回下一次的游标，0表示遍历结束
+// 分片个数不会变化，所以遍历期间一直存在的key至少会返回一次
+func (d *ConcurrentDict) Scan(cursor int, count int) ([]string, int) {
+	return d.ScanShards(cursor, count, len(d.shds))
+}
+
+// 与Scan相同，但最多访问maxShards个分片，key很少时不会为了凑够count遍历大量空的分片
+func (d *ConcurrentDict) ScanShards(cursor int, count int, maxShards int) ([]string, int) {
+	keys := make([]string, 0, count)
+	for visited := 0; cursor < len(d.shds) && len(keys) < count && visited < maxShards; visited++ {
+		d.shds[cursor].forEach(func(key string, val any) bool {
+			keys = append(keys, key)
+			return true
+		})
+		cursor++
+	}
+	if cursor >= len(d.shds) {
+		cursor = 0
+	}
+	return keys, cursor
+}
@@ -0,0 +1,248 @@
+package geohash
+
+import "math"
+
+// 与Redis一致，经纬度交错编码为52位整数，作为有序集合的分数保存
+const (
+	LonMin = -180.0
+	LonMax = 180.0
+	// 墨卡托投影能表示的纬度范围
+	LatMin = -85.05112878
+	LatMax = 85.05112878
+
+	// 每个维度使用26位，总共52位
+	MaxStep = 26
+
+	// 地球半径，单位米
+	EarthRadius = 6372797.560856
+	// 墨卡托投影下赤道的一半长度
+	mercatorMax = 20037726.37
+)
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+type Range struct {
+	Min float64
+	Max float64
+}
+
+// Area 一个geohash对应的矩形区域
+type Area struct {
+	Bits uint64
+	Step uint
+	Lon  Range
+	Lat  Range
+}
+
+func ValidCoordinate(lon, lat float64) bool {
+	return lon >= LonMin && lon <= LonMax && lat >= LatMin && lat <= LatMax
+}
+
+// 将x的低32位分散到偶数位上
+func spread(x uint64) uint64 {
+	x &= 0xffffffff
+	x = (x | x<<16) & 0x0000ffff0000ffff
+	x = (x | x<<8) & 0x00ff00ff00ff00ff
+	x = (x | x<<4) & 0x0f0f0f0f0f0f0f0f
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+// 把偶数位收拢到低32位
+func squash(x uint64) uint64 {
+	x &= 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0f0f0f0f0f0f0f0f
+	x = (x | x>>4) & 0x00ff00ff00ff00ff
+	x = (x | x>>8) & 0x0000ffff0000ffff
+	x = (x | x>>16) & 0x00000000ffffffff
+	return x
+}
+
+// 纬度在偶数位，经度在奇数位
+func interleave(latIdx, lonIdx uint64) uint64 {
+	return spread(latIdx) | spread(lonIdx)<<1
+}
+
+func deinterleave(bits uint64) (latIdx, lonIdx uint64) {
+	return squash(bits), squash(bits >> 1)
+}
+
+func encodeWithRange(lon, lat float64, lonRange, latRange Range, step uint) uint64 {
+	latOffset := (lat - latRange.Min) / (latRange.Max - latRange.Min)
+	lonOffset := (lon - lonRange.Min) / (lonRange.Max - lonRange.Min)
+	cells := float64(uint64(1) << step)
+	latIdx := uint64(latOffset * cells)
+	lonIdx := uint64(lonOffset * cells)
+	// 正好落在最大值上时归到最后一个格子
+	if latIdx >= uint64(1)<<step {
+		latIdx = uint64(1)<<step - 1
+	}
+	if lonIdx >= uint64(1)<<step {
+		lonIdx = uint64(1)<<step - 1
+	}
+	return interleave(latIdx, lonIdx)
+}
+
+// 按照指定精度编码，step为每个维度使用的位数
+func EncodeStep(lon, lat float64, step uint) uint64 {
+	return encodeWithRange(lon, lat, Range{LonMin, LonMax}, Range{LatMin, LatMax}, step)
+}
+
+// 编码为52位的分数
+func Encode(lon, lat float64) uint64 {
+	return EncodeStep(lon, lat, MaxStep)
+}
+
+// 解码出geohash对应的矩形区域
+func DecodeArea(bits uint64, step uint) *Area {
+	latIdx, lonIdx := deinterleave(bits)
+	cells := float64(uint64(1) << step)
+	latScale := LatMax - LatMin
+	lonScale := LonMax - LonMin
+	return &Area{
+		Bits: bits,
+		Step: step,
+		Lat: Range{
+			Min: LatMin + float64(latIdx)/cells*latScale,
+			Max: LatMin + float64(latIdx+1)/cells*latScale,
+		},
+		Lon: Range{
+			Min: LonMin + float64(lonIdx)/cells*lonScale,
+			Max: LonMin + float64(lonIdx+1)/cells*lonScale,
+		},
+	}
+}
+
+// 解码52位分数，返回区域中心的经纬度
+func Decode(bits uint64) (lon, lat float64) {
+	area := DecodeArea(bits, MaxStep)
+	lon = (area.Lon.Min + area.Lon.Max) / 2
+	lat = (area.Lat.Min + area.Lat.Max) / 2
+	lon = math.Max(LonMin, math.Min(LonMax, lon))
+	lat = math.Max(LatMin, math.Min(LatMax, lat))
+	return lon, lat
+}
+
+// 转换为标准的11位geohash字符串，标准geohash的纬度范围是 [-90, 90]
+func ToString(bits uint64) string {
+	lon, lat := Decode(bits)
+	bits = encodeWithRange(lon, lat, Range{-180, 180}, Range{-90, 90}, MaxStep)
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0
+		// 52位只够10个字符，最后一个字符补0
+		if i < 10 {
+			idx = int(bits>>(52-(i+1)*5)) & 0x1f
+		}
+		buf[i] = base32[idx]
+	}
+	return string(buf)
+}
+
+// 返回geohash在分数上对应的区间 [min, max)
+func (a *Area) ScoreRange() (min, max uint64) {
+	shift := 2 * (MaxStep - a.Step)
+	return a.Bits << shift, (a.Bits + 1) << shift
+}
+
+// 返回自身以及周围8个区域，经度越过±180时回绕，纬度越界的区域被忽略
+func (a *Area) Neighbors() []*Area {
+	latIdx, lonIdx := deinterleave(a.Bits)
+	cells := int64(1) << a.Step
+	seen := make(map[uint64]struct{})
+	areas := make([]*Area, 0, 9)
+	for dLat := int64(-1); dLat <= 1; dLat++ {
+		lat := int64(latIdx) + dLat
+		if lat < 0 || lat >= cells {
+			continue
+		}
+		for dLon := int64(-1); dLon <= 1; dLon++ {
+			lon := (int64(lonIdx) + dLon + cells) % cells
+			bits := interleave(uint64(lat), uint64(lon))
+			if _, ok := seen[bits]; ok {
+				continue
+			}
+			seen[bits] = struct{}{}
+			areas = append(areas, DecodeArea(bits, a.Step))
+		}
+	}
+	return areas
+}
+
+// 根据搜索半径估算合适的精度
+func EstimateStep(radius, lat float64) uint {
+	if radius == 0 {
+		return MaxStep
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	// 留出余量，保证周围8个区域能覆盖搜索范围
+	step -= 2
+	// 高纬度地区经度方向的格子更窄
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > MaxStep {
+		step = MaxStep
+	}
+	return uint(step)
+}
+
+// 计算以 (lon, lat) 为中心，能够覆盖 [lon±lonDelta, lat±latDelta] 的区域
+func CoverAreas(lon, lat, radius, lonDelta, latDelta float64) []*Area {
+	step := EstimateStep(radius, lat)
+	for {
+		center := DecodeArea(EncodeStep(lon, lat, step), step)
+		width := center.Lon.Max - center.Lon.Min
+		height := center.Lat.Max - center.Lat.Min
+		covered := lon-lonDelta >= center.Lon.Min-width && lon+lonDelta <= center.Lon.Max+width &&
+			(lat-latDelta >= center.Lat.Min-height || center.Lat.Min <= LatMin) &&
+			(lat+latDelta <= center.Lat.Max+height || center.Lat.Max >= LatMax)
+		if covered || step == 1 {
+			return center.Neighbors()
+		}
+		step--
+	}
+}
+
+func degToRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radToDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// 计算两点之间的球面距离，单位米
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r := degToRad(lat1)
+	lat2r := degToRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin(degToRad(lon2-lon1) / 2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// 两个纬度之间的距离
+func LatDistance(lat1, lat2 float64) float64 {
+	return EarthRadius * math.Abs(degToRad(lat2)-degToRad(lat1))
+}
+
+// 距离对应的经纬度跨度，用于计算需要搜索的范围
+func BoundingDelta(lat, width, height float64) (lonDelta, latDelta float64) {
+	latDelta = radToDeg(height / 2 / EarthRadius)
+	// 取离赤道更远的纬度，经度方向的跨度更大
+	farLat := math.Min(math.Abs(lat)+latDelta, 89.9)
+	lonDelta = radToDeg(width / 2 / EarthRadius / math.Cos(degToRad(farLat)))
+	return lonDelta, latDelta
+}
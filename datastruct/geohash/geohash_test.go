@@ -0,0 +1,38 @@
+package geohash
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	bits := Encode(13.361389, 38.115556)
+	if bits != 3479099956230698 {
+		t.Fatalf("unexpected geohash %d", bits)
+	}
+	lon, lat := Decode(bits)
+	if math.Abs(lon-13.361389) > 1e-5 || math.Abs(lat-38.115556) > 1e-5 {
+		t.Fatalf("unexpected position %f,%f", lon, lat)
+	}
+	if s := ToString(bits); s != "sqc8b49rny0" {
+		t.Fatalf("unexpected geohash string %s", s)
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	// 经度在±180处回绕
+	area := DecodeArea(EncodeStep(179.9, 0, 10), 10)
+	areas := area.Neighbors()
+	if len(areas) != 9 {
+		t.Fatalf("expected 9 areas, actual %d", len(areas))
+	}
+	wrapped := false
+	for _, a := range areas {
+		if a.Lon.Min == LonMin {
+			wrapped = true
+		}
+	}
+	if !wrapped {
+		t.Fatal("neighbors should wrap around the antimeridian")
+	}
+}
@@ -0,0 +1,96 @@
+package hash
+
+import "math/rand"
+
+type Consumer func(field string, value []byte) bool
+
+// Hash 字段到值的映射
+type Hash struct {
+	m map[string][]byte
+}
+
+func NewHash() *Hash {
+	return &Hash{m: make(map[string][]byte)}
+}
+
+func (h *Hash) Get(field string) ([]byte, bool) {
+	val, ok := h.m[field]
+	return val, ok
+}
+
+// 返回1表示新增字段，0表示覆盖已有字段
+func (h *Hash) Set(field string, value []byte) int {
+	_, exist := h.m[field]
+	h.m[field] = value
+	if exist {
+		return 0
+	}
+	return 1
+}
+
+func (h *Hash) Delete(field string) int {
+	_, exist := h.m[field]
+	if !exist {
+		return 0
+	}
+	delete(h.m, field)
+	return 1
+}
+
+func (h *Hash) Exists(field string) bool {
+	_, exist := h.m[field]
+	return exist
+}
+
+func (h *Hash) Len() int {
+	return len(h.m)
+}
+
+func (h *Hash) ForEach(consumer Consumer) {
+	for field, value := range h.m {
+		if !consumer(field, value) {
+			break
+		}
+	}
+}
+
+func (h *Hash) Fields() []string {
+	fields := make([]string, 0, len(h.m))
+	for field := range h.m {
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// 随机取count个字段，允许重复
+func (h *Hash) RandomFields(count int) []string {
+	fields := h.Fields()
+	if len(fields) == 0 {
+		return fields
+	}
+	result := make([]string, count)
+	for i := 0; i < count; i++ {
+		result[i] = fields[rand.Intn(len(fields))]
+	}
+	return result
+}
+
+// 随机取最多count个不重复的字段
+func (h *Hash) RandomDistinctFields(count int) []string {
+	fields := h.Fields()
+	if count >= len(fields) {
+		return fields
+	}
+	rand.Shuffle(len(fields), func(i, j int) {
+		fields[i], fields[j] = fields[j], fields[i]
+	})
+	return fields[:count]
+}
+
+func (h *Hash) Clone() *Hash {
+	clone := &Hash{m: make(map[string][]byte, len(h.m))}
+	for field, value := range h.m {
+		clone.m[field] = append([]byte(nil), value...)
+	}
+	return clone
+}
@@ -0,0 +1,43 @@
+package hash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashRandomFields(t *testing.T) {
+	h := NewHash()
+	if fields := h.RandomFields(3); len(fields) != 0 {
+		t.Fatal("empty hash should return no fields")
+	}
+	for i := 0; i < 10; i++ {
+		h.Set(strconv.Itoa(i), []byte("v"))
+	}
+	if fields := h.RandomFields(20); len(fields) != 20 {
+		t.Fatalf("expected 20 fields, actual %d", len(fields))
+	}
+	fields := h.RandomDistinctFields(5)
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		if seen[field] || !h.Exists(field) {
+			t.Fatalf("unexpected field %s", field)
+		}
+		seen[field] = true
+	}
+	if len(fields) != 5 || len(h.RandomDistinctFields(20)) != 10 {
+		t.Fatal("wrong distinct field count")
+	}
+}
+
+func TestHashClone(t *testing.T) {
+	h := NewHash()
+	if h.Set("a", []byte("1")) != 1 || h.Set("a", []byte("2")) != 0 {
+		t.Fatal("wrong set result")
+	}
+	clone := h.Clone()
+	h.Set("b", []byte("3"))
+	h.Delete("a")
+	if value, ok := clone.Get("a"); !ok || string(value) != "2" || clone.Exists("b") {
+		t.Fatal("clone shares data with the original")
+	}
+}
@@ -0,0 +1,356 @@
+package hyperloglog
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// 与Redis保持一致的HyperLogLog实现，序列化后的格式可以直接和Redis互通
+//
+// 头部16字节：
+// +------+---+-----+----------+
+// | HYLL | E | N/U | Cardin.  |
+// +------+---+-----+----------+
+// E为编码方式，N/U保留未使用，Cardin.为小端序缓存的基数，最高位为1表示缓存失效
+const (
+	hllP         = 14
+	hllQ         = 64 - hllP
+	hllRegisters = 1 << hllP
+	hllPMask     = hllRegisters - 1
+	hllBits      = 6
+	hllRegMax    = 1<<hllBits - 1
+
+	hllHeaderSize = 16
+	hllDenseSize  = hllHeaderSize + (hllRegisters*hllBits+7)/8
+
+	hllDense  = 0
+	hllSparse = 1
+
+	// 稀疏编码能表示的最大寄存器值
+	sparseValMax = 32
+	// 稀疏编码超过该长度时转换为密集编码
+	sparseMaxBytes = 3000
+
+	alphaInf = 0.721347520444481703680
+)
+
+var magic = []byte("HYLL")
+
+var (
+	ErrInvalid   = errors.New("not a valid HyperLogLog string value")
+	ErrCorrupted = errors.New("corrupted HLL object detected")
+)
+
+type HyperLogLog struct {
+	registers [hllRegisters]uint8
+	dense     bool
+	// 缓存的基数，cacheValid为false时需要重新计算
+	card       uint64
+	cacheValid bool
+}
+
+// 新建的HyperLogLog使用稀疏编码
+func New() *HyperLogLog {
+	return &HyperLogLog{cacheValid: true}
+}
+
+// 判断是否为HyperLogLog格式的字符串
+func IsHyperLogLog(data []byte) bool {
+	if len(data) < hllHeaderSize || string(data[:4]) != string(magic) {
+		return false
+	}
+	switch data[4] {
+	case hllDense:
+		return len(data) == hllDenseSize
+	case hllSparse:
+		return true
+	}
+	return false
+}
+
+func Parse(data []byte) (*HyperLogLog, error) {
+	if !IsHyperLogLog(data) {
+		return nil, ErrInvalid
+	}
+	h := &HyperLogLog{}
+	cache := data[8:hllHeaderSize]
+	h.cacheValid = cache[7]&(1<<7) == 0
+	if h.cacheValid {
+		h.card = binary.LittleEndian.Uint64(cache)
+	}
+
+	body := data[hllHeaderSize:]
+	if data[4] == hllDense {
+		h.dense = true
+		for i := 0; i < hllRegisters; i++ {
+			h.registers[i] = getDenseRegister(body, i)
+		}
+		return h, nil
+	}
+	if err := decodeSparse(body, &h.registers); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// 添加元素，返回是否有寄存器发生变化
+func (h *HyperLogLog) Add(element []byte) bool {
+	index, count := patternLen(element)
+	if h.registers[index] >= count {
+		return false
+	}
+	h.registers[index] = count
+	h.cacheValid = false
+	return true
+}
+
+// 将other合并进来，每个寄存器取最大值
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, v := range other.registers {
+		if v > h.registers[i] {
+			h.registers[i] = v
+			h.cacheValid = false
+		}
+	}
+}
+
+// 估算基数，结果会被缓存直到下一次修改
+func (h *HyperLogLog) Count() uint64 {
+	if h.cacheValid {
+		return h.card
+	}
+	h.card = estimate(&h.registers)
+	h.cacheValid = true
+	return h.card
+}
+
+// 缓存是否有效
+func (h *HyperLogLog) CacheValid() bool {
+	return h.cacheValid
+}
+
+// 序列化为Redis格式，稀疏编码放不下时自动转换为密集编码
+func (h *HyperLogLog) Bytes() []byte {
+	var body []byte
+	if !h.dense {
+		var ok bool
+		body, ok = encodeSparse(&h.registers)
+		if !ok {
+			h.dense = true
+		}
+	}
+	if h.dense {
+		body = make([]byte, hllDenseSize-hllHeaderSize)
+		for i, v := range h.registers {
+			setDenseRegister(body, i, v)
+		}
+	}
+
+	data := make([]byte, hllHeaderSize, hllHeaderSize+len(body))
+	copy(data, magic)
+	if h.dense {
+		data[4] = hllDense
+	} else {
+		data[4] = hllSparse
+	}
+	if h.cacheValid {
+		binary.LittleEndian.PutUint64(data[8:], h.card)
+	} else {
+		data[15] |= 1 << 7
+	}
+	return append(data, body...)
+}
+
+// 密集编码中每个寄存器占6位，低位在前
+func getDenseRegister(body []byte, i int) uint8 {
+	b := i * hllBits / 8
+	fb := uint(i * hllBits & 7)
+	b0 := uint(body[b])
+	var b1 uint
+	if b+1 < len(body) {
+		b1 = uint(body[b+1])
+	}
+	return uint8((b0>>fb | b1<<(8-fb)) & hllRegMax)
+}
+
+func setDenseRegister(body []byte, i int, v uint8) {
+	b := i * hllBits / 8
+	fb := uint(i * hllBits & 7)
+	body[b] &^= byte(hllRegMax << fb)
+	body[b] |= v << fb
+	if b+1 < len(body) {
+		body[b+1] &^= byte(hllRegMax >> (8 - fb))
+		body[b+1] |= v >> (8 - fb)
+	}
+}
+
+// 稀疏编码由三种操作码组成：
+// ZERO  00xxxxxx          连续xxxxxx+1个0
+// XZERO 01xxxxxx yyyyyyyy 连续xxxxxxyyyyyyyy+1个0
+// VAL   1vvvvvxx          连续xx+1个值为vvvvv+1的寄存器
+func decodeSparse(body []byte, registers *[hllRegisters]uint8) error {
+	idx := 0
+	for i := 0; i < len(body); i++ {
+		op := body[i]
+		switch {
+		case op&0xc0 == 0x00:
+			idx += int(op&0x3f) + 1
+		case op&0xc0 == 0x40:
+			if i+1 >= len(body) {
+				return ErrCorrupted
+			}
+			idx += (int(op&0x3f)<<8 | int(body[i+1])) + 1
+			i++
+		default:
+			value := (op>>2)&0x1f + 1
+			runLen := int(op&0x03) + 1
+			if idx+runLen > hllRegisters {
+				return ErrCorrupted
+			}
+			for j := 0; j < runLen; j++ {
+				registers[idx+j] = value
+			}
+			idx += runLen
+		}
+		if idx > hllRegisters {
+			return ErrCorrupted
+		}
+	}
+	if idx != hllRegisters {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// 编码为稀疏格式，寄存器值过大或结果过长时返回false
+func encodeSparse(registers *[hllRegisters]uint8) ([]byte, bool) {
+	body := make([]byte, 0, 16)
+	for i := 0; i < hllRegisters; {
+		value := registers[i]
+		runLen := 1
+		for i+runLen < hllRegisters && registers[i+runLen] == value {
+			runLen++
+		}
+		i += runLen
+
+		if value == 0 {
+			for runLen > 0 {
+				if runLen <= 64 {
+					body = append(body, byte(runLen-1))
+					runLen = 0
+				} else {
+					n := min(runLen, hllRegisters)
+					body = append(body, 0x40|byte((n-1)>>8), byte((n-1)&0xff))
+					runLen -= n
+				}
+			}
+		} else {
+			if value > sparseValMax {
+				return nil, false
+			}
+			for runLen > 0 {
+				n := min(runLen, 4)
+				body = append(body, 0x80|(value-1)<<2|byte(n-1))
+				runLen -= n
+			}
+		}
+		if hllHeaderSize+len(body) > sparseMaxBytes {
+			return nil, false
+		}
+	}
+	return body, true
+}
+
+// 返回元素对应的寄存器以及哈希值中第一个1出现的位置
+func patternLen(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, 0xadc83b19)
+	index := int(hash & hllPMask)
+	hash >>= hllP
+	// 保证循环能够结束
+	hash |= 1 << hllQ
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ uint64(len(key))*m
+
+	n := len(key) / 8 * 8
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(key[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+
+	tail := key[n:]
+	if len(tail) > 0 {
+		for i := len(tail) - 1; i >= 0; i-- {
+			h ^= uint64(tail[i]) << (8 * i)
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// 基于寄存器值分布的基数估算，参考 Otmar Ertl 的改进算法
+func estimate(registers *[hllRegisters]uint8) uint64 {
+	var histogram [64]int
+	for _, v := range registers {
+		histogram[v]++
+	}
+	m := float64(hllRegisters)
+	z := m * tau((m-float64(histogram[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
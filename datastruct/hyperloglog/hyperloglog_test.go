@@ -0,0 +1,49 @@
+package hyperloglog
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	h := New()
+	for i := 0; i < 100; i++ {
+		h.Add([]byte(strconv.Itoa(i)))
+	}
+	data := h.Bytes()
+	if data[4] != hllSparse {
+		t.Fatal("expected sparse encoding")
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.registers != h.registers {
+		t.Fatal("registers changed after sparse round trip")
+	}
+
+	// 元素较多时转换为密集编码
+	for i := 100; i < 100000; i++ {
+		h.Add([]byte(strconv.Itoa(i)))
+	}
+	data = h.Bytes()
+	if data[4] != hllDense || len(data) != hllDenseSize {
+		t.Fatal("expected dense encoding")
+	}
+	parsed, err = Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.registers != h.registers {
+		t.Fatal("registers changed after dense round trip")
+	}
+	count := parsed.Count()
+	if math.Abs(float64(count)-100000)/100000 > 0.02 {
+		t.Fatalf("estimate %d is too far from 100000", count)
+	}
+
+	if _, err := Parse([]byte("HYLL")); err != ErrInvalid {
+		t.Fatal("expected invalid error")
+	}
+}
@@ -0,0 +1,378 @@
+package list
+
+import (
+	"container/list"
+	"errors"
+)
+
+// 每个节点最多存放的元素个数
+const pageSize = 128
+
+// QuickList 由多个紧凑的切片节点组成的链表
+// 按下标查找时只需要逐个节点跳过，而不是逐个元素
+type QuickList struct {
+	pages *list.List // 元素类型是 []any
+	size  int
+}
+
+func NewQuickList() *QuickList {
+	return &QuickList{pages: list.New()}
+}
+
+// 指向某个元素的游标
+type iterator struct {
+	page   *list.Element
+	offset int
+	ql     *QuickList
+}
+
+func (it *iterator) values() []any {
+	return it.page.Value.([]any)
+}
+
+func (it *iterator) get() any {
+	return it.values()[it.offset]
+}
+
+func (it *iterator) set(val any) {
+	it.values()[it.offset] = val
+}
+
+// 移动到下一个元素，到达末尾返回false
+func (it *iterator) next() bool {
+	if it.offset < len(it.values())-1 {
+		it.offset++
+		return true
+	}
+	if it.page.Next() == nil {
+		it.offset = len(it.values())
+		return false
+	}
+	it.page = it.page.Next()
+	it.offset = 0
+	return true
+}
+
+// 移动到上一个元素，到达开头返回false
+func (it *iterator) prev() bool {
+	if it.offset > 0 {
+		it.offset--
+		return true
+	}
+	if it.page.Prev() == nil {
+		it.offset = -1
+		return false
+	}
+	it.page = it.page.Prev()
+	it.offset = len(it.values()) - 1
+	return true
+}
+
+func (it *iterator) atEnd() bool {
+	if it.ql.pages.Len() == 0 {
+		return true
+	}
+	if it.page.Next() != nil {
+		return false
+	}
+	return it.offset >= len(it.values())
+}
+
+func (it *iterator) atBegin() bool {
+	return it.ql.pages.Len() == 0 || it.offset < 0
+}
+
+// 删除当前元素，游标指向被删除元素的后一个
+func (it *iterator) remove() any {
+	values := it.values()
+	val := values[it.offset]
+	values = append(values[:it.offset], values[it.offset+1:]...)
+	it.ql.size--
+	if len(values) > 0 {
+		it.page.Value = values
+		if it.offset == len(values) && it.page.Next() != nil {
+			it.page = it.page.Next()
+			it.offset = 0
+		}
+		return val
+	}
+	// 节点为空时移除整个节点
+	next := it.page.Next()
+	it.ql.pages.Remove(it.page)
+	if next == nil {
+		it.page = it.ql.pages.Back()
+		if it.page != nil {
+			it.offset = len(it.values())
+		}
+		return val
+	}
+	it.page = next
+	it.offset = 0
+	return val
+}
+
+// 定位下标，从距离近的一端开始按节点跳跃
+func (ql *QuickList) find(idx int) *iterator {
+	if idx < ql.size/2 {
+		page := ql.pages.Front()
+		offset := 0
+		for {
+			values := page.Value.([]any)
+			if offset+len(values) > idx {
+				break
+			}
+			offset += len(values)
+			page = page.Next()
+		}
+		return &iterator{page: page, offset: idx - offset, ql: ql}
+	}
+	page := ql.pages.Back()
+	offset := ql.size
+	for {
+		values := page.Value.([]any)
+		offset -= len(values)
+		if offset <= idx {
+			break
+		}
+		page = page.Prev()
+	}
+	return &iterator{page: page, offset: idx - offset, ql: ql}
+}
+
+func (ql *QuickList) Add(val any) {
+	ql.size++
+	back := ql.pages.Back()
+	if back == nil || len(back.Value.([]any)) >= pageSize {
+		page := make([]any, 0, pageSize)
+		ql.pages.PushBack(append(page, val))
+		return
+	}
+	back.Value = append(back.Value.([]any), val)
+}
+
+func (ql *QuickList) AddFirst(val any) {
+	ql.size++
+	front := ql.pages.Front()
+	if front == nil || len(front.Value.([]any)) >= pageSize {
+		page := make([]any, 0, pageSize)
+		ql.pages.PushFront(append(page, val))
+		return
+	}
+	values := front.Value.([]any)
+	values = append(values, nil)
+	copy(values[1:], values)
+	values[0] = val
+	front.Value = values
+}
+
+// 在idx位置插入元素，idx == Len() 时追加到末尾
+func (ql *QuickList) Insert(idx int, val any) error {
+	if idx < 0 || idx > ql.size {
+		return errors.New("idx error")
+	}
+	if idx == ql.size {
+		ql.Add(val)
+		return nil
+	}
+	it := ql.find(idx)
+	values := it.values()
+	if len(values) < pageSize {
+		values = append(values, nil)
+		copy(values[it.offset+1:], values[it.offset:])
+		values[it.offset] = val
+		it.page.Value = values
+		ql.size++
+		return nil
+	}
+	// 节点已满，拆分成两个
+	half := pageSize / 2
+	front := make([]any, half, pageSize)
+	back := make([]any, pageSize-half, pageSize)
+	copy(front, values[:half])
+	copy(back, values[half:])
+	if it.offset < half {
+		front = append(front[:it.offset+1], front[it.offset:]...)
+		front[it.offset] = val
+	} else {
+		offset := it.offset - half
+		back = append(back[:offset+1], back[offset:]...)
+		back[offset] = val
+	}
+	it.page.Value = front
+	ql.pages.InsertAfter(back, it.page)
+	ql.size++
+	return nil
+}
+
+func (ql *QuickList) Get(idx int) (any, error) {
+	if idx < 0 || idx >= ql.size {
+		return nil, errors.New("idx error")
+	}
+	return ql.find(idx).get(), nil
+}
+
+func (ql *QuickList) Update(idx int, val any) error {
+	if idx < 0 || idx >= ql.size {
+		return errors.New("idx error")
+	}
+	ql.find(idx).set(val)
+	return nil
+}
+
+func (ql *QuickList) Del(idx int) (any, error) {
+	if idx < 0 || idx >= ql.size {
+		return nil, errors.New("idx error")
+	}
+	return ql.find(idx).remove(), nil
+}
+
+func (ql *QuickList) RemoveFirst() (any, error) {
+	return ql.Del(0)
+}
+
+func (ql *QuickList) RemoveLast() (any, error) {
+	return ql.Del(ql.size - 1)
+}
+
+func (ql *QuickList) Len() int {
+	return ql.size
+}
+
+func (ql *QuickList) ForEach(consumer Consumer) {
+	if ql.size == 0 {
+		return
+	}
+	it := &iterator{page: ql.pages.Front(), ql: ql}
+	i := 0
+	for {
+		if !consumer(i, it.get()) || !it.next() {
+			break
+		}
+		i++
+	}
+}
+
+// 从后往前遍历，下标仍然是正向的下标
+func (ql *QuickList) ReverseForEach(consumer Consumer) {
+	if ql.size == 0 {
+		return
+	}
+	it := ql.find(ql.size - 1)
+	i := ql.size - 1
+	for {
+		if !consumer(i, it.get()) || !it.prev() {
+			break
+		}
+		i--
+	}
+}
+
+// 返回 [start, stop) 区间的元素
+func (ql *QuickList) Range(start, stop int) []any {
+	if start < 0 || start >= ql.size || stop <= start {
+		return nil
+	}
+	if stop > ql.size {
+		stop = ql.size
+	}
+	result := make([]any, 0, stop-start)
+	it := ql.find(start)
+	for i := start; i < stop; i++ {
+		result = append(result, it.get())
+		it.next()
+	}
+	return result
+}
+
+func (ql *QuickList) Contain(except Except) bool {
+	var result bool
+	ql.ForEach(func(idx int, val any) bool {
+		if except(val) {
+			result = true
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+// 从前往后删除最多count个满足条件的元素，count <= 0 表示全部删除
+func (ql *QuickList) DelByVal(except Except, count int) int {
+	if ql.size == 0 {
+		return 0
+	}
+	var removed int
+	it := &iterator{page: ql.pages.Front(), ql: ql}
+	for !it.atEnd() {
+		if except(it.get()) {
+			it.remove()
+			removed++
+			if count > 0 && removed == count {
+				break
+			}
+		} else {
+			it.next()
+		}
+	}
+	return removed
+}
+
+// 从后往前删除最多count个满足条件的元素，count <= 0 表示全部删除
+func (ql *QuickList) ReverseDelByVal(except Except, count int) int {
+	if ql.size == 0 {
+		return 0
+	}
+	var removed int
+	it := ql.find(ql.size - 1)
+	for !it.atBegin() {
+		if except(it.get()) {
+			it.remove()
+			removed++
+			if count > 0 && removed == count {
+				break
+			}
+			if ql.size == 0 {
+				break
+			}
+			// remove之后游标指向后一个元素，需要回退一位
+			it.prev()
+		} else {
+			it.prev()
+		}
+	}
+	return removed
+}
+
+// 只保留 [start, stop) 区间的元素
+func (ql *QuickList) Trim(start, stop int) {
+	if start < 0 {
+		start = 0
+	}
+	if stop > ql.size {
+		stop = ql.size
+	}
+	if start >= stop {
+		ql.pages.Init()
+		ql.size = 0
+		return
+	}
+	values := ql.Range(start, stop)
+	ql.pages.Init()
+	ql.size = 0
+	for _, val := range values {
+		ql.Add(val)
+	}
+}
+
+// 复制整个列表，[]byte类型的元素也会复制
+func (ql *QuickList) Clone() *QuickList {
+	clone := NewQuickList()
+	ql.ForEach(func(i int, val any) bool {
+		if b, ok := val.([]byte); ok {
+			val = append([]byte(nil), b...)
+		}
+		clone.Add(val)
+		return true
+	})
+	return clone
+}
@@ -0,0 +1,106 @@
+package list
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func checkQuickList(t *testing.T, ql *QuickList, expected []int) {
+	t.Helper()
+	if ql.Len() != len(expected) {
+		t.Fatalf("expected len %d, actual %d", len(expected), ql.Len())
+	}
+	ql.ForEach(func(idx int, val any) bool {
+		if val.(int) != expected[idx] {
+			t.Fatalf("index %d: expected %d, actual %d", idx, expected[idx], val.(int))
+		}
+		return true
+	})
+	for i := range expected {
+		val, err := ql.Get(i)
+		if err != nil || val.(int) != expected[i] {
+			t.Fatalf("get %d: expected %d, actual %v", i, expected[i], val)
+		}
+	}
+}
+
+func TestQuickListRandomOps(t *testing.T) {
+	ql := NewQuickList()
+	var expected []int
+	for i := 0; i < 5000; i++ {
+		switch rand.Intn(6) {
+		case 0:
+			ql.Add(i)
+			expected = append(expected, i)
+		case 1:
+			ql.AddFirst(i)
+			expected = append([]int{i}, expected...)
+		case 2:
+			idx := rand.Intn(len(expected) + 1)
+			if err := ql.Insert(idx, i); err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected[:idx], append([]int{i}, expected[idx:]...)...)
+		case 3:
+			if len(expected) == 0 {
+				continue
+			}
+			idx := rand.Intn(len(expected))
+			val, err := ql.Del(idx)
+			if err != nil || val.(int) != expected[idx] {
+				t.Fatalf("del %d: expected %d, actual %v", idx, expected[idx], val)
+			}
+			expected = append(expected[:idx], expected[idx+1:]...)
+		case 4:
+			if len(expected) == 0 {
+				continue
+			}
+			idx := rand.Intn(len(expected))
+			ql.Update(idx, -i)
+			expected[idx] = -i
+		case 5:
+			ql.AddFirst(i % 7)
+			expected = append([]int{i % 7}, expected...)
+		}
+	}
+	checkQuickList(t, ql, expected)
+}
+
+func TestQuickListDelByVal(t *testing.T) {
+	ql := NewQuickList()
+	var expected []int
+	for i := 0; i < 1000; i++ {
+		ql.Add(i % 3)
+		expected = append(expected, i%3)
+	}
+	isOne := func(val any) bool { return val.(int) == 1 }
+
+	removed := ql.DelByVal(isOne, 10)
+	if removed != 10 {
+		t.Fatalf("expected 10 removed, actual %d", removed)
+	}
+	removed = ql.ReverseDelByVal(isOne, 10)
+	if removed != 10 {
+		t.Fatalf("expected 10 removed, actual %d", removed)
+	}
+	var filtered []int
+	ones := 0
+	for _, v := range expected {
+		if v == 1 {
+			ones++
+			if ones <= 10 || ones > 333-10 {
+				continue
+			}
+		}
+		filtered = append(filtered, v)
+	}
+	checkQuickList(t, ql, filtered)
+
+	ql.Trim(100, 200)
+	checkQuickList(t, ql, filtered[100:200])
+
+	removed = ql.ReverseDelByVal(func(val any) bool { return true }, 0)
+	if removed != 100 || ql.Len() != 0 {
+		t.Fatalf("expected empty list, actual len %d", ql.Len())
+	}
+}
@@ -0,0 +1,65 @@
+package set
+
+import "sort"
+
+// IntSet 有序的整数集合，元素较少时比哈希表更节省内存
+type IntSet struct {
+	values []int64
+}
+
+func NewIntSet() *IntSet {
+	return &IntSet{}
+}
+
+// 二分查找，返回元素位置以及是否存在
+func (s *IntSet) search(value int64) (int, bool) {
+	idx := sort.Search(len(s.values), func(i int) bool {
+		return s.values[i] >= value
+	})
+	return idx, idx < len(s.values) && s.values[idx] == value
+}
+
+func (s *IntSet) Add(value int64) bool {
+	idx, exist := s.search(value)
+	if exist {
+		return false
+	}
+	s.values = append(s.values, 0)
+	copy(s.values[idx+1:], s.values[idx:])
+	s.values[idx] = value
+	return true
+}
+
+func (s *IntSet) Remove(value int64) bool {
+	idx, exist := s.search(value)
+	if !exist {
+		return false
+	}
+	s.values = append(s.values[:idx], s.values[idx+1:]...)
+	return true
+}
+
+func (s *IntSet) Contains(value int64) bool {
+	_, exist := s.search(value)
+	return exist
+}
+
+func (s *IntSet) Get(idx int) int64 {
+	return s.values[idx]
+}
+
+func (s *IntSet) Len() int {
+	return len(s.values)
+}
+
+func (s *IntSet) ForEach(consumer func(value int64) bool) {
+	for _, value := range s.values {
+		if !consumer(value) {
+			break
+		}
+	}
+}
+
+func (s *IntSet) Clone() *IntSet {
+	return &IntSet{values: append([]int64(nil), s.values...)}
+}
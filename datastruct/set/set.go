@@ -0,0 +1,240 @@
+package set
+
+import (
+	"math/rand"
+	"strconv"
+)
+
+const (
+	EncodingIntSet    = "intset"
+	EncodingHashTable = "hashtable"
+
+	// intset编码允许的最大元素个数
+	maxIntSetEntries = 512
+)
+
+type Consumer func(member string) bool
+
+// Set 无序集合，元素全是整数且数量较少时使用intset编码，否则升级为哈希表
+type Set struct {
+	intset *IntSet
+	dict   map[string]struct{}
+}
+
+func NewSet() *Set {
+	return &Set{intset: NewIntSet()}
+}
+
+// 只有能够无损转换回原字符串的整数才可以放进intset
+func parseInt(member string) (int64, bool) {
+	value, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(value, 10) != member {
+		return 0, false
+	}
+	return value, true
+}
+
+// 升级为哈希表编码
+func (s *Set) upgrade() {
+	s.dict = make(map[string]struct{}, s.intset.Len())
+	s.intset.ForEach(func(value int64) bool {
+		s.dict[strconv.FormatInt(value, 10)] = struct{}{}
+		return true
+	})
+	s.intset = nil
+}
+
+// IntSet 使用intset编码时返回底层的intset，否则返回nil
+func (s *Set) IntSet() *IntSet {
+	return s.intset
+}
+
+// Downgrade 恢复为升级前的intset编码，用于撤销触发升级的添加
+func (s *Set) Downgrade(intset *IntSet) {
+	s.intset = intset
+	s.dict = nil
+}
+
+func (s *Set) Encoding() string {
+	if s.intset != nil {
+		return EncodingIntSet
+	}
+	return EncodingHashTable
+}
+
+func (s *Set) Add(member string) int {
+	if s.intset != nil {
+		if value, ok := parseInt(member); ok {
+			if !s.intset.Add(value) {
+				return 0
+			}
+			if s.intset.Len() > maxIntSetEntries {
+				s.upgrade()
+			}
+			return 1
+		}
+		s.upgrade()
+	}
+	if _, exist := s.dict[member]; exist {
+		return 0
+	}
+	s.dict[member] = struct{}{}
+	return 1
+}
+
+func (s *Set) Remove(member string) int {
+	if s.intset != nil {
+		value, ok := parseInt(member)
+		if ok && s.intset.Remove(value) {
+			return 1
+		}
+		return 0
+	}
+	if _, exist := s.dict[member]; !exist {
+		return 0
+	}
+	delete(s.dict, member)
+	return 1
+}
+
+func (s *Set) Contains(member string) bool {
+	if s.intset != nil {
+		value, ok := parseInt(member)
+		return ok && s.intset.Contains(value)
+	}
+	_, exist := s.dict[member]
+	return exist
+}
+
+func (s *Set) Len() int {
+	if s.intset != nil {
+		return s.intset.Len()
+	}
+	return len(s.dict)
+}
+
+func (s *Set) ForEach(consumer Consumer) {
+	if s.intset != nil {
+		s.intset.ForEach(func(value int64) bool {
+			return consumer(strconv.FormatInt(value, 10))
+		})
+		return
+	}
+	for member := range s.dict {
+		if !consumer(member) {
+			break
+		}
+	}
+}
+
+func (s *Set) Members() []string {
+	members := make([]string, 0, s.Len())
+	s.ForEach(func(member string) bool {
+		members = append(members, member)
+		return true
+	})
+	return members
+}
+
+// 随机取count个元素，允许重复
+func (s *Set) RandomMembers(count int) []string {
+	if s.Len() == 0 {
+		return nil
+	}
+	result := make([]string, count)
+	if s.intset != nil {
+		for i := range result {
+			result[i] = strconv.FormatInt(s.intset.Get(rand.Intn(s.intset.Len())), 10)
+		}
+		return result
+	}
+	members := s.Members()
+	for i := range result {
+		result[i] = members[rand.Intn(len(members))]
+	}
+	return result
+}
+
+// 随机取最多count个不重复的元素
+func (s *Set) RandomDistinctMembers(count int) []string {
+	members := s.Members()
+	if count >= len(members) {
+		return members
+	}
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	return members[:count]
+}
+
+// 求交集，nil视为空集合
+func Intersect(sets ...*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 {
+		return result
+	}
+	// 从最小的集合开始遍历
+	smallest := 0
+	for i, s := range sets {
+		if s == nil || s.Len() == 0 {
+			return result
+		}
+		if s.Len() < sets[smallest].Len() {
+			smallest = i
+		}
+	}
+	sets[smallest].ForEach(func(member string) bool {
+		for i, s := range sets {
+			if i != smallest && !s.Contains(member) {
+				return true
+			}
+		}
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// 求并集，nil视为空集合
+func Union(sets ...*Set) *Set {
+	result := NewSet()
+	for _, s := range sets {
+		if s == nil {
+			continue
+		}
+		s.ForEach(func(member string) bool {
+			result.Add(member)
+			return true
+		})
+	}
+	return result
+}
+
+// 求第一个集合与其余集合的差集，nil视为空集合
+func Diff(sets ...*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 || sets[0] == nil {
+		return result
+	}
+	sets[0].ForEach(func(member string) bool {
+		for _, s := range sets[1:] {
+			if s != nil && s.Contains(member) {
+				return true
+			}
+		}
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+func (s *Set) Clone() *Set {
+	if s.intset != nil {
+		return &Set{intset: s.intset.Clone()}
+	}
+	clone := &Set{dict: make(map[string]struct{}, len(s.dict))}
+	for member := range s.dict {
+		clone.dict[member] = struct{}{}
+	}
+	return clone
+}
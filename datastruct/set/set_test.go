@@ -0,0 +1,56 @@
+package set
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSetEncodingUpgrade(t *testing.T) {
+	s := NewSet()
+	for i := 0; i < maxIntSetEntries; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+	if s.Encoding() != EncodingIntSet {
+		t.Fatalf("expected intset, actual %s", s.Encoding())
+	}
+	// 非规范的整数不能放进intset
+	if s.Contains("007") {
+		t.Fatal("007 should not be a member")
+	}
+	s.Add(strconv.Itoa(maxIntSetEntries))
+	if s.Encoding() != EncodingHashTable {
+		t.Fatalf("expected hashtable, actual %s", s.Encoding())
+	}
+	if s.Len() != maxIntSetEntries+1 || !s.Contains("0") || !s.Contains(strconv.Itoa(maxIntSetEntries)) {
+		t.Fatal("members lost after upgrade")
+	}
+
+	s = NewSet()
+	s.Add("1")
+	s.Add("a")
+	if s.Encoding() != EncodingHashTable || !s.Contains("1") || !s.Contains("a") {
+		t.Fatal("non-integer member should upgrade the set")
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	a, b := NewSet(), NewSet()
+	for _, m := range []string{"1", "2", "3", "x"} {
+		a.Add(m)
+	}
+	for _, m := range []string{"2", "3", "4"} {
+		b.Add(m)
+	}
+	if r := Intersect(a, b); r.Len() != 2 || !r.Contains("2") || !r.Contains("3") {
+		t.Fatalf("unexpected intersect %v", r.Members())
+	}
+	if r := Union(a, b, nil); r.Len() != 5 {
+		t.Fatalf("unexpected union %v", r.Members())
+	}
+	if r := Diff(a, b); r.Len() != 2 || !r.Contains("1") || !r.Contains("x") {
+		t.Fatalf("unexpected diff %v", r.Members())
+	}
+	if r := Intersect(a, nil); r.Len() != 0 {
+		t.Fatalf("intersect with empty set should be empty")
+	}
+}
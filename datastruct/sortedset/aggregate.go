@@ -0,0 +1,119 @@
+package sortedset
+
+import "math"
+
+// Aggregate 多个有序集合中同一个成员的分数合并方式
+type Aggregate func(a, b float64) float64
+
+func AggregateSum(a, b float64) float64 {
+	sum := a + b
+	// inf + -inf 视为0
+	if math.IsNaN(sum) {
+		return 0
+	}
+	return sum
+}
+
+func AggregateMin(a, b float64) float64 {
+	return math.Min(a, b)
+}
+
+func AggregateMax(a, b float64) float64 {
+	return math.Max(a, b)
+}
+
+func weightedScore(score float64, weights []float64, i int) float64 {
+	if weights == nil {
+		return score
+	}
+	result := score * weights[i]
+	// inf * 0 视为0
+	if math.IsNaN(result) {
+		return 0
+	}
+	return result
+}
+
+// 求并集，nil视为空集合，weights为nil时权重都是1
+func Union(sets []*SortedSet, weights []float64, aggregate Aggregate) *SortedSet {
+	result := NewSortedSet()
+	for i, s := range sets {
+		if s == nil {
+			continue
+		}
+		s.dict.forEach(func(member string, pair *Pair) bool {
+			score := weightedScore(pair.Score, weights, i)
+			if current, exist := result.dict.get(member); exist {
+				score = aggregate(current.Score, score)
+			}
+			result.Add(member, score)
+			return true
+		})
+	}
+	return result
+}
+
+// 求交集，nil视为空集合，weights为nil时权重都是1
+func Inter(sets []*SortedSet, weights []float64, aggregate Aggregate) *SortedSet {
+	result := NewSortedSet()
+	if len(sets) == 0 {
+		return result
+	}
+	// 从最小的集合开始遍历
+	smallest := 0
+	for i, s := range sets {
+		if s == nil || s.Len() == 0 {
+			return result
+		}
+		if s.Len() < sets[smallest].Len() {
+			smallest = i
+		}
+	}
+	sets[smallest].dict.forEach(func(member string, _ *Pair) bool {
+		var score float64
+		matched := true
+		for i, s := range sets {
+			pair, exist := s.dict.get(member)
+			if !exist {
+				matched = false
+				break
+			}
+			weighted := weightedScore(pair.Score, weights, i)
+			if i == 0 {
+				score = weighted
+			} else {
+				score = aggregate(score, weighted)
+			}
+		}
+		if matched {
+			result.Add(member, score)
+		}
+		return true
+	})
+	return result
+}
+
+// 求第一个集合与其余集合的差集，nil视为空集合
+func Diff(sets []*SortedSet) *SortedSet {
+	result := NewSortedSet()
+	if len(sets) == 0 || sets[0] == nil {
+		return result
+	}
+	sets[0].dict.forEach(func(member string, pair *Pair) bool {
+		found := false
+		for _, s := range sets[1:] {
+			if s == nil {
+				continue
+			}
+			if _, exist := s.dict.get(member); exist {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.Add(member, pair.Score)
+		}
+		return true
+	})
+	return result
+}
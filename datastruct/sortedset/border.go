@@ -0,0 +1,164 @@
+package sortedset
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+const (
+	negativeInf int8 = -1
+	positiveInf int8 = 1
+)
+
+// Border 范围查询的边界，可以是分数边界也可以是字典序边界
+type Border interface {
+	// 作为下边界时pair是否满足
+	minMatch(p *Pair) bool
+	// 作为上边界时pair是否满足
+	maxMatch(p *Pair) bool
+	// 以当前边界为下边界，max为上边界的区间是否为空
+	isEmpty(max Border) bool
+}
+
+// ScoreBorder 分数边界，支持 (1.5 表示不包含，以及 -inf/+inf
+type ScoreBorder struct {
+	Inf     int8
+	Value   float64
+	Exclude bool
+}
+
+func (b *ScoreBorder) minMatch(p *Pair) bool {
+	if b.Inf == negativeInf {
+		return true
+	}
+	if b.Inf == positiveInf {
+		return false
+	}
+	if b.Exclude {
+		return p.Score > b.Value
+	}
+	return p.Score >= b.Value
+}
+
+func (b *ScoreBorder) maxMatch(p *Pair) bool {
+	if b.Inf == positiveInf {
+		return true
+	}
+	if b.Inf == negativeInf {
+		return false
+	}
+	if b.Exclude {
+		return p.Score < b.Value
+	}
+	return p.Score <= b.Value
+}
+
+func (b *ScoreBorder) isEmpty(max Border) bool {
+	maxBorder := max.(*ScoreBorder)
+	if b.Inf == positiveInf || maxBorder.Inf == negativeInf {
+		return true
+	}
+	if b.Inf == negativeInf || maxBorder.Inf == positiveInf {
+		return false
+	}
+	if b.Value > maxBorder.Value {
+		return true
+	}
+	return b.Value == maxBorder.Value && (b.Exclude || maxBorder.Exclude)
+}
+
+var errScoreBorder = errors.New("min or max is not a float")
+
+func ParseScoreBorder(s string) (*ScoreBorder, error) {
+	switch s {
+	case "-inf":
+		return &ScoreBorder{Inf: negativeInf}, nil
+	case "inf", "+inf":
+		return &ScoreBorder{Inf: positiveInf}, nil
+	}
+	exclude := false
+	if len(s) > 0 && s[0] == '(' {
+		exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return nil, errScoreBorder
+	}
+	border := &ScoreBorder{Value: value, Exclude: exclude}
+	if math.IsInf(value, 1) {
+		border.Inf = positiveInf
+	} else if math.IsInf(value, -1) {
+		border.Inf = negativeInf
+	}
+	return border, nil
+}
+
+// LexBorder 字典序边界，[a 表示包含，(a 表示不包含，-/+ 表示无穷
+type LexBorder struct {
+	Inf     int8
+	Value   string
+	Exclude bool
+}
+
+func (b *LexBorder) minMatch(p *Pair) bool {
+	if b.Inf == negativeInf {
+		return true
+	}
+	if b.Inf == positiveInf {
+		return false
+	}
+	if b.Exclude {
+		return p.Member > b.Value
+	}
+	return p.Member >= b.Value
+}
+
+func (b *LexBorder) maxMatch(p *Pair) bool {
+	if b.Inf == positiveInf {
+		return true
+	}
+	if b.Inf == negativeInf {
+		return false
+	}
+	if b.Exclude {
+		return p.Member < b.Value
+	}
+	return p.Member <= b.Value
+}
+
+func (b *LexBorder) isEmpty(max Border) bool {
+	maxBorder := max.(*LexBorder)
+	if b.Inf == positiveInf || maxBorder.Inf == negativeInf {
+		return true
+	}
+	if b.Inf == negativeInf || maxBorder.Inf == positiveInf {
+		return false
+	}
+	if b.Value > maxBorder.Value {
+		return true
+	}
+	return b.Value == maxBorder.Value && (b.Exclude || maxBorder.Exclude)
+}
+
+var errLexBorder = errors.New("min or max not valid string range item")
+
+func ParseLexBorder(s string) (*LexBorder, error) {
+	switch s {
+	case "-":
+		return &LexBorder{Inf: negativeInf}, nil
+	case "+":
+		return &LexBorder{Inf: positiveInf}, nil
+	}
+	if len(s) == 0 {
+		return nil, errLexBorder
+	}
+	switch s[0] {
+	case '[':
+		return &LexBorder{Value: s[1:]}, nil
+	case '(':
+		return &LexBorder{Value: s[1:], Exclude: true}, nil
+	}
+	return nil, errLexBorder
+}
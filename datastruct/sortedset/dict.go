@@ -0,0 +1,96 @@
+package sortedset
+
+import (
+	"gedis/util"
+	"math/bits"
+)
+
+const (
+	// 平均每个桶的成员超过这个数量时扩容
+	maxBucketLoad = 8
+	// 平均每个桶的成员少于这个数量时缩容
+	minBucketLoad = 2
+)
+
+// 成员到分数的映射，按成员名的hash分桶，以便用桶下标作为游标遍历
+type memberDict struct {
+	buckets []map[string]*Pair
+	mask    uint64
+	count   int
+}
+
+func newMemberDict() *memberDict {
+	return &memberDict{buckets: []map[string]*Pair{make(map[string]*Pair)}}
+}
+
+func (d *memberDict) bucket(member string) map[string]*Pair {
+	return d.buckets[uint64(util.Fnv32(member))&d.mask]
+}
+
+func (d *memberDict) get(member string) (*Pair, bool) {
+	pair, ok := d.bucket(member)[member]
+	return pair, ok
+}
+
+func (d *memberDict) put(member string, pair *Pair) {
+	bucket := d.bucket(member)
+	if _, ok := bucket[member]; !ok {
+		d.count++
+	}
+	bucket[member] = pair
+	if d.count > maxBucketLoad*len(d.buckets) {
+		d.resize(len(d.buckets) * 2)
+	}
+}
+
+func (d *memberDict) remove(member string) {
+	bucket := d.bucket(member)
+	if _, ok := bucket[member]; !ok {
+		return
+	}
+	delete(bucket, member)
+	d.count--
+	if len(d.buckets) > 1 && d.count < minBucketLoad*len(d.buckets) {
+		d.resize(len(d.buckets) / 2)
+	}
+}
+
+func (d *memberDict) resize(size int) {
+	old := d.buckets
+	d.buckets = make([]map[string]*Pair, size)
+	for i := range d.buckets {
+		d.buckets[i] = make(map[string]*Pair)
+	}
+	d.mask = uint64(size - 1)
+	for _, bucket := range old {
+		for member, pair := range bucket {
+			d.bucket(member)[member] = pair
+		}
+	}
+}
+
+func (d *memberDict) forEach(consumer func(member string, pair *Pair) bool) {
+	for _, bucket := range d.buckets {
+		for member, pair := range bucket {
+			if !consumer(member, pair) {
+				return
+			}
+		}
+	}
+}
+
+// 与Redis的SCAN一样按二进制逆序递增游标，桶的数量翻倍或者减半后，
+// 已经遍历过的桶对应的新桶仍然在游标之前，遍历期间一直存在的成员至少会返回一次
+func (d *memberDict) scan(cursor uint64, count int) ([]*Pair, uint64) {
+	result := make([]*Pair, 0, count)
+	for {
+		for _, pair := range d.buckets[cursor&d.mask] {
+			result = append(result, pair)
+		}
+		cursor |= ^d.mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		if cursor == 0 || len(result) >= count {
+			return result, cursor
+		}
+	}
+}
@@ -170,30 +170,31 @@ func (s *skiplist) removeNode(n *node, beforeNode []*node) {
 	s.length--
 }
 
+// 获取节点排名，排名从1开始，不存在时返回0
 func (s *skiplist) getRank(member string, score float64) int64 {
-	var nodeOrder int64
+	var rank int64
 	n := s.header
 	for i := s.maxLevel - 1; i >= 0; i-- {
 		for n.levels[i].forward != nil &&
-			(n.levels[i].forward.Score < score || (n.levels[i].forward.Score == score && n.levels[i].forward.Member < member)) {
-			nodeOrder += n.levels[i].span
-			nodeOrder += n.levels[i].span
+			(n.levels[i].forward.Score < score || (n.levels[i].forward.Score == score && n.levels[i].forward.Member <= member)) {
+			rank += n.levels[i].span
 			n = n.levels[i].forward
 		}
 		if n != s.header && n.Score == score && n.Member == member {
-			return nodeOrder
+			return rank
 		}
 	}
 	return 0
 }
 
+// 根据排名获取节点，排名从1开始
 func (s *skiplist) getByRank(rank int64) *node {
 	var order int64
 	n := s.header
 	for i := s.maxLevel - 1; i >= 0; i-- {
-		if n.levels[i].forward != nil && (order+n.levels[i].span <= order) {
-			n = n.levels[i].forward
+		for n.levels[i].forward != nil && order+n.levels[i].span <= rank {
 			order += n.levels[i].span
+			n = n.levels[i].forward
 		}
 		if order == rank {
 			return n
@@ -201,3 +202,107 @@ func (s *skiplist) getByRank(rank int64) *node {
 	}
 	return nil
 }
+
+// 跳表中是否存在位于 [min, max] 之间的节点
+func (s *skiplist) hasInRange(min, max Border) bool {
+	if min.isEmpty(max) {
+		return false
+	}
+	// 最大的节点不满足下边界
+	n := s.tailer
+	if n == nil || !min.minMatch(&n.Pair) {
+		return false
+	}
+	// 最小的节点不满足上边界
+	n = s.header.levels[0].forward
+	if n == nil || !max.maxMatch(&n.Pair) {
+		return false
+	}
+	return true
+}
+
+func (s *skiplist) getFirstInRange(min, max Border) *node {
+	if !s.hasInRange(min, max) {
+		return nil
+	}
+	n := s.header
+	for i := s.maxLevel - 1; i >= 0; i-- {
+		for n.levels[i].forward != nil && !min.minMatch(&n.levels[i].forward.Pair) {
+			n = n.levels[i].forward
+		}
+	}
+	n = n.levels[0].forward
+	if n == nil || !max.maxMatch(&n.Pair) {
+		return nil
+	}
+	return n
+}
+
+func (s *skiplist) getLastInRange(min, max Border) *node {
+	if !s.hasInRange(min, max) {
+		return nil
+	}
+	n := s.header
+	for i := s.maxLevel - 1; i >= 0; i-- {
+		for n.levels[i].forward != nil && max.maxMatch(&n.levels[i].forward.Pair) {
+			n = n.levels[i].forward
+		}
+	}
+	if n == s.header || !min.minMatch(&n.Pair) {
+		return nil
+	}
+	return n
+}
+
+// 删除 [min, max] 之间的节点，limit <= 0 表示全部删除
+func (s *skiplist) RemoveRange(min, max Border, limit int) []*Pair {
+	beforeNode := make([]*node, defaultMaxLevel)
+	n := s.header
+	for i := s.maxLevel - 1; i >= 0; i-- {
+		for n.levels[i].forward != nil && !min.minMatch(&n.levels[i].forward.Pair) {
+			n = n.levels[i].forward
+		}
+		beforeNode[i] = n
+	}
+
+	removed := make([]*Pair, 0)
+	n = n.levels[0].forward
+	for n != nil && max.maxMatch(&n.Pair) {
+		next := n.levels[0].forward
+		pair := n.Pair
+		removed = append(removed, &pair)
+		s.removeNode(n, beforeNode)
+		if limit > 0 && len(removed) == limit {
+			break
+		}
+		n = next
+	}
+	return removed
+}
+
+// 删除排名在 [start, stop) 之间的节点，排名从1开始
+func (s *skiplist) RemoveRangeByRank(start, stop int64) []*Pair {
+	beforeNode := make([]*node, defaultMaxLevel)
+	var rank int64
+	n := s.header
+	for i := s.maxLevel - 1; i >= 0; i-- {
+		for n.levels[i].forward != nil && rank+n.levels[i].span < start {
+			rank += n.levels[i].span
+			n = n.levels[i].forward
+		}
+		beforeNode[i] = n
+	}
+
+	removed := make([]*Pair, 0)
+	rank++
+	n = n.levels[0].forward
+	for n != nil && rank < stop {
+		next := n.levels[0].forward
+		pair := n.Pair
+		removed = append(removed, &pair)
+		s.removeNode(n, beforeNode)
+		n = next
+		rank++
+	}
+	return removed
+}
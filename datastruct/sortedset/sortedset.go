@@ -1,53 +1,58 @@
 package sortedset
 
+import "math/rand"
+
+type Consumer func(pair *Pair) bool
+
 type SortedSet struct {
-	dict map[string]*Pair
+	dict *memberDict
 	skl  *skiplist
 }
 
 func NewSortedSet() *SortedSet {
 	s := &SortedSet{}
-	s.dict = make(map[string]*Pair)
+	s.dict = newMemberDict()
 	s.skl = newSkipList()
 	return s
 }
 
+// 返回true表示新增了成员，更新已有成员的分数返回false
 func (s *SortedSet) Add(member string, score float64) bool {
-	pair, ok := s.dict[member]
+	pair, ok := s.dict.get(member)
+	s.dict.put(member, &Pair{member, score})
 	if ok {
-		if pair.Score == score {
-			return false
+		if pair.Score != score {
+			s.skl.Remove(member, pair.Score)
+			s.skl.Insert(member, score)
 		}
-		s.skl.Remove(member, score)
-		s.skl.Insert(member, score)
+		return false
 	}
 	s.skl.Insert(member, score)
-	s.dict[member] = &Pair{member, score}
 	return true
 }
 
 func (s *SortedSet) Remove(member string) bool {
-	pair, ok := s.dict[member]
+	pair, ok := s.dict.get(member)
 	if !ok {
 		return false
 	}
 	s.skl.Remove(member, pair.Score)
-	delete(s.dict, member)
+	s.dict.remove(member)
 	return true
 }
 
 func (s *SortedSet) Get(member string) (*Pair, bool) {
-	pair, ok := s.dict[member]
+	pair, ok := s.dict.get(member)
 	return pair, ok
 }
 
 func (s *SortedSet) Len() int64 {
-	return int64(len(s.dict))
+	return int64(s.dict.count)
 }
 
 // 获取在跳表中的索引序号
 func (s *SortedSet) GetRank(member string, desc bool) int64 {
-	pair, ok := s.dict[member]
+	pair, ok := s.dict.get(member)
 	if !ok {
 		return -1
 	}
@@ -59,3 +64,178 @@ func (s *SortedSet) GetRank(member string, desc bool) int64 {
 	}
 	return rank
 }
+
+// 按排名遍历 [start, stop) 区间，排名从0开始
+func (s *SortedSet) ForEachByRank(start, stop int64, desc bool, consumer Consumer) {
+	if start < 0 || start >= stop || start >= s.skl.length {
+		return
+	}
+	var n *node
+	if desc {
+		n = s.skl.getByRank(s.skl.length - start)
+	} else {
+		n = s.skl.getByRank(start + 1)
+	}
+	for i := start; i < stop && n != nil; i++ {
+		if !consumer(&n.Pair) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.levels[0].forward
+		}
+	}
+}
+
+// 返回排名在 [start, stop) 区间的成员，排名从0开始
+func (s *SortedSet) RangeByRank(start, stop int64, desc bool) []*Pair {
+	result := make([]*Pair, 0)
+	s.ForEachByRank(start, stop, desc, func(pair *Pair) bool {
+		p := *pair
+		result = append(result, &p)
+		return true
+	})
+	return result
+}
+
+// 遍历 [min, max] 区间内的成员，跳过前offset个，limit < 0 表示不限制个数
+func (s *SortedSet) ForEach(min, max Border, offset, limit int64, desc bool, consumer Consumer) {
+	var n *node
+	if desc {
+		n = s.skl.getLastInRange(min, max)
+	} else {
+		n = s.skl.getFirstInRange(min, max)
+	}
+	for n != nil && offset > 0 {
+		if desc {
+			n = n.backward
+		} else {
+			n = n.levels[0].forward
+		}
+		offset--
+	}
+	for n != nil && limit != 0 {
+		if !min.minMatch(&n.Pair) || !max.maxMatch(&n.Pair) {
+			break
+		}
+		if !consumer(&n.Pair) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.levels[0].forward
+		}
+		if limit > 0 {
+			limit--
+		}
+	}
+}
+
+// 返回 [min, max] 区间内的成员
+func (s *SortedSet) Range(min, max Border, offset, limit int64, desc bool) []*Pair {
+	result := make([]*Pair, 0)
+	s.ForEach(min, max, offset, limit, desc, func(pair *Pair) bool {
+		p := *pair
+		result = append(result, &p)
+		return true
+	})
+	return result
+}
+
+// 统计 [min, max] 区间内的成员个数
+func (s *SortedSet) Count(min, max Border) int64 {
+	first := s.skl.getFirstInRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := s.skl.getLastInRange(min, max)
+	return s.skl.getRank(last.Member, last.Score) - s.skl.getRank(first.Member, first.Score) + 1
+}
+
+// 删除 [min, max] 区间内的成员
+func (s *SortedSet) RemoveRange(min, max Border) []*Pair {
+	removed := s.skl.RemoveRange(min, max, 0)
+	for _, pair := range removed {
+		s.dict.remove(pair.Member)
+	}
+	return removed
+}
+
+// 删除排名在 [start, stop) 区间的成员，排名从0开始
+func (s *SortedSet) RemoveByRank(start, stop int64) []*Pair {
+	removed := s.skl.RemoveRangeByRank(start+1, stop+1)
+	for _, pair := range removed {
+		s.dict.remove(pair.Member)
+	}
+	return removed
+}
+
+// 弹出分数最小的count个成员
+func (s *SortedSet) PopMin(count int64) []*Pair {
+	return s.RemoveByRank(0, count)
+}
+
+// 弹出分数最大的count个成员
+func (s *SortedSet) PopMax(count int64) []*Pair {
+	removed := s.RangeByRank(0, count, true)
+	for _, pair := range removed {
+		s.Remove(pair.Member)
+	}
+	return removed
+}
+
+// 按分数从小到大遍历所有成员
+func (s *SortedSet) ForEachAll(consumer Consumer) {
+	for n := s.skl.header.levels[0].forward; n != nil; n = n.levels[0].forward {
+		if !consumer(&n.Pair) {
+			break
+		}
+	}
+}
+
+// 随机取count个成员，distinct为true时不重复
+func (s *SortedSet) RandomPairs(count int64, distinct bool) []*Pair {
+	length := s.skl.length
+	if length == 0 || count <= 0 {
+		return nil
+	}
+	var ranks []int64
+	if distinct {
+		if count >= length {
+			return s.RangeByRank(0, length, false)
+		}
+		perm := rand.Perm(int(length))
+		ranks = make([]int64, count)
+		for i := range ranks {
+			ranks[i] = int64(perm[i])
+		}
+	} else {
+		ranks = make([]int64, count)
+		for i := range ranks {
+			ranks[i] = rand.Int63n(length)
+		}
+	}
+	result := make([]*Pair, len(ranks))
+	for i, rank := range ranks {
+		p := s.skl.getByRank(rank + 1).Pair
+		result[i] = &p
+	}
+	return result
+}
+
+// 以成员名的hash所在的桶作为游标遍历，每次至少返回count个成员（读取完整的桶），返回下一次的游标，0表示遍历结束
+// 遍历期间一直存在的成员至少会返回一次
+func (s *SortedSet) Scan(cursor uint64, count int) ([]*Pair, uint64) {
+	return s.dict.scan(cursor, count)
+}
+
+func (s *SortedSet) Clone() *SortedSet {
+	clone := NewSortedSet()
+	s.ForEachAll(func(pair *Pair) bool {
+		clone.Add(pair.Member, pair.Score)
+		return true
+	})
+	return clone
+}
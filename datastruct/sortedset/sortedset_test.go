@@ -0,0 +1,117 @@
+package sortedset
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func sortedPairs(m map[string]float64) []Pair {
+	pairs := make([]Pair, 0, len(m))
+	for member, score := range m {
+		pairs = append(pairs, Pair{member, score})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Score == pairs[j].Score {
+			return pairs[i].Member < pairs[j].Member
+		}
+		return pairs[i].Score < pairs[j].Score
+	})
+	return pairs
+}
+
+func TestSortedSetRank(t *testing.T) {
+	s := NewSortedSet()
+	expected := make(map[string]float64)
+	for i := 0; i < 2000; i++ {
+		member := strconv.Itoa(rand.Intn(500))
+		if rand.Intn(4) == 0 {
+			s.Remove(member)
+			delete(expected, member)
+			continue
+		}
+		score := float64(rand.Intn(100))
+		s.Add(member, score)
+		expected[member] = score
+	}
+
+	pairs := sortedPairs(expected)
+	if s.Len() != int64(len(pairs)) {
+		t.Fatalf("expected len %d, actual %d", len(pairs), s.Len())
+	}
+	for i, pair := range pairs {
+		if rank := s.GetRank(pair.Member, false); rank != int64(i) {
+			t.Fatalf("member %s: expected rank %d, actual %d", pair.Member, i, rank)
+		}
+		if rank := s.GetRank(pair.Member, true); rank != int64(len(pairs)-1-i) {
+			t.Fatalf("member %s: expected rev rank %d, actual %d", pair.Member, len(pairs)-1-i, rank)
+		}
+	}
+	ranged := s.RangeByRank(10, 20, false)
+	for i, pair := range ranged {
+		if *pair != pairs[10+i] {
+			t.Fatalf("rank %d: expected %v, actual %v", 10+i, pairs[10+i], *pair)
+		}
+	}
+}
+
+func TestSortedSetScoreRange(t *testing.T) {
+	s := NewSortedSet()
+	for i := 0; i < 100; i++ {
+		s.Add(strconv.Itoa(i), float64(i))
+	}
+	min, _ := ParseScoreBorder("(10")
+	max, _ := ParseScoreBorder("20")
+	if count := s.Count(min, max); count != 10 {
+		t.Fatalf("expected count 10, actual %d", count)
+	}
+	pairs := s.Range(min, max, 2, 3, true)
+	if len(pairs) != 3 || pairs[0].Score != 18 || pairs[2].Score != 16 {
+		t.Fatalf("unexpected range result %v", pairs)
+	}
+	inf, _ := ParseScoreBorder("+inf")
+	removed := s.RemoveRange(max, inf)
+	if len(removed) != 80 || s.Len() != 20 {
+		t.Fatalf("expected 80 removed, actual %d", len(removed))
+	}
+	popped := s.PopMax(2)
+	if len(popped) != 2 || popped[0].Score != 19 || s.Len() != 18 {
+		t.Fatalf("unexpected pop result %v", popped)
+	}
+	removed = s.RemoveByRank(0, 5)
+	if len(removed) != 5 || removed[4].Score != 4 || s.GetRank("5", false) != 0 {
+		t.Fatalf("unexpected remove by rank result %v", removed)
+	}
+}
+
+func TestSortedSetScan(t *testing.T) {
+	s := NewSortedSet()
+	for i := 0; i < 1000; i++ {
+		s.Add(strconv.Itoa(i), float64(i))
+	}
+	seen := make(map[string]bool)
+	cursor := uint64(0)
+	for {
+		var pairs []*Pair
+		pairs, cursor = s.Scan(cursor, 10)
+		for _, p := range pairs {
+			seen[p.Member] = true
+		}
+		// 遍历过程中增删成员，不影响一直存在的成员
+		s.Remove(strconv.Itoa(1000 + rand.Intn(100)))
+		s.Add(strconv.Itoa(1000+rand.Intn(100)), 0)
+		// 成员数量变化导致桶的数量翻倍
+		for i := 0; i < 50; i++ {
+			s.Add("grow"+strconv.Itoa(rand.Int()), 0)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if !seen[strconv.Itoa(i)] {
+			t.Fatalf("member %d not returned", i)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package stream
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// PendingEntry 已经投递但还没有被确认的消息
+type PendingEntry struct {
+	ID       ID
+	Consumer *Consumer
+	// 最后一次投递的时间，毫秒时间戳
+	DeliveryTime int64
+	// 投递次数
+	DeliveryCount uint64
+}
+
+type Consumer struct {
+	Name string
+	// 最后一次尝试交互的时间
+	SeenTime int64
+	// 最后一次成功交互的时间，-1表示从未成功
+	ActiveTime int64
+
+	pending map[ID]*PendingEntry
+}
+
+func (c *Consumer) PendingLen() int {
+	return len(c.pending)
+}
+
+// 按ID升序返回大于等于start的待确认消息，count <= 0 表示不限制个数
+func (c *Consumer) PendingFrom(start ID, count int) []*PendingEntry {
+	return sortPending(c.pending, start, MaxID, count)
+}
+
+type Group struct {
+	Name string
+	// 最后投递给消费者的ID
+	LastID ID
+	// 已经读取的消息数，-1表示无法确定
+	EntriesRead int64
+
+	pending   map[ID]*PendingEntry
+	consumers map[string]*Consumer
+}
+
+func newGroup(name string, lastID ID, entriesRead int64) *Group {
+	return &Group{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		pending:     make(map[ID]*PendingEntry),
+		consumers:   make(map[string]*Consumer),
+	}
+}
+
+func (g *Group) Consumer(name string) *Consumer {
+	return g.consumers[name]
+}
+
+// 创建消费者，已存在时返回已有的消费者以及false
+func (g *Group) CreateConsumer(name string, now int64) (*Consumer, bool) {
+	if consumer, ok := g.consumers[name]; ok {
+		return consumer, false
+	}
+	consumer := &Consumer{
+		Name:       name,
+		SeenTime:   now,
+		ActiveTime: -1,
+		pending:    make(map[ID]*PendingEntry),
+	}
+	g.consumers[name] = consumer
+	return consumer, true
+}
+
+// 删除消费者以及它所有的待确认消息，返回删除的待确认消息数
+func (g *Group) DeleteConsumer(name string) (int, bool) {
+	consumer, ok := g.consumers[name]
+	if !ok {
+		return 0, false
+	}
+	for id := range consumer.pending {
+		delete(g.pending, id)
+	}
+	delete(g.consumers, name)
+	return len(consumer.pending), true
+}
+
+// 放回被删除的消费者以及它的待确认消息，用于撤销删除
+func (g *Group) RestoreConsumer(consumer *Consumer) {
+	g.consumers[consumer.Name] = consumer
+	for id, entry := range consumer.pending {
+		g.pending[id] = entry
+	}
+}
+
+// 消费者按名称排序
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, consumer := range g.consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+func (g *Group) PendingLen() int {
+	return len(g.pending)
+}
+
+func (g *Group) Pending(id ID) (*PendingEntry, bool) {
+	entry, ok := g.pending[id]
+	return entry, ok
+}
+
+// 按ID升序返回 [start, end] 区间内的待确认消息，count <= 0 表示不限制个数
+func (g *Group) PendingRange(start, end ID, count int) []*PendingEntry {
+	return sortPending(g.pending, start, end, count)
+}
+
+// 将消息交给consumer处理，已经在其他消费者的待确认列表中时转移过来
+func (g *Group) Claim(id ID, consumer *Consumer, deliveryTime int64, deliveryCount uint64) *PendingEntry {
+	entry, ok := g.pending[id]
+	if ok {
+		delete(entry.Consumer.pending, id)
+	} else {
+		entry = &PendingEntry{ID: id}
+		g.pending[id] = entry
+	}
+	entry.Consumer = consumer
+	entry.DeliveryTime = deliveryTime
+	entry.DeliveryCount = deliveryCount
+	consumer.pending[id] = entry
+	return entry
+}
+
+// 确认消息，返回消息是否在待确认列表中
+func (g *Group) Ack(id ID) bool {
+	entry, ok := g.pending[id]
+	if !ok {
+		return false
+	}
+	delete(entry.Consumer.pending, id)
+	delete(g.pending, id)
+	return true
+}
+
+func sortPending(pending map[ID]*PendingEntry, start, end ID, count int) []*PendingEntry {
+	if count > 0 && count < len(pending) {
+		return smallestPending(pending, start, end, count)
+	}
+	result := make([]*PendingEntry, 0)
+	for id, entry := range pending {
+		if !id.Less(start) && !end.Less(id) {
+			result = append(result, entry)
+		}
+	}
+	sortPendingByID(result)
+	return result
+}
+
+// 只保留区间内ID最小的count条，用大顶堆淘汰较大的ID，不需要复制和排序整个待确认列表
+func smallestPending(pending map[ID]*PendingEntry, start, end ID, count int) []*PendingEntry {
+	h := make(pendingHeap, 0, count)
+	for id, entry := range pending {
+		if id.Less(start) || end.Less(id) {
+			continue
+		}
+		if len(h) < count {
+			heap.Push(&h, entry)
+		} else if id.Less(h[0].ID) {
+			h[0] = entry
+			heap.Fix(&h, 0)
+		}
+	}
+	result := []*PendingEntry(h)
+	sortPendingByID(result)
+	return result
+}
+
+func sortPendingByID(entries []*PendingEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID.Less(entries[j].ID)
+	})
+}
+
+// 按ID排列的大顶堆
+type pendingHeap []*PendingEntry
+
+func (h pendingHeap) Len() int           { return len(h) }
+func (h pendingHeap) Less(i, j int) bool { return h[j].ID.Less(h[i].ID) }
+func (h pendingHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *pendingHeap) Push(x any) {
+	*h = append(*h, x.(*PendingEntry))
+}
+
+func (h *pendingHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+func (g *Group) clone() *Group {
+	clone := newGroup(g.Name, g.LastID, g.EntriesRead)
+	for name, consumer := range g.consumers {
+		clone.consumers[name] = &Consumer{
+			Name:       consumer.Name,
+			SeenTime:   consumer.SeenTime,
+			ActiveTime: consumer.ActiveTime,
+			pending:    make(map[ID]*PendingEntry, len(consumer.pending)),
+		}
+	}
+	for id, entry := range g.pending {
+		consumer := clone.consumers[entry.Consumer.Name]
+		pending := &PendingEntry{
+			ID:            id,
+			Consumer:      consumer,
+			DeliveryTime:  entry.DeliveryTime,
+			DeliveryCount: entry.DeliveryCount,
+		}
+		clone.pending[id] = pending
+		consumer.pending[id] = pending
+	}
+	return clone
+}
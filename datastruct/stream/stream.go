@@ -0,0 +1,390 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidID = errors.New("Invalid stream ID specified as stream command argument")
+
+// ID 消息ID，由毫秒时间戳和序号组成
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	MinID = ID{}
+	MaxID = ID{math.MaxUint64, math.MaxUint64}
+)
+
+// 解析 ms-seq 格式的ID，省略seq时使用missingSeq
+func ParseID(s string, missingSeq uint64) (ID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	if !hasSeq {
+		return ID{ms, missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	return ID{ms, seq}, nil
+}
+
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id ID) Compare(other ID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+func (id ID) Less(other ID) bool {
+	return id.Compare(other) < 0
+}
+
+func (id ID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+// 返回比当前ID大的最小ID，已经是最大ID时返回false
+func (id ID) Next() (ID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return ID{id.Ms, id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return ID{id.Ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// 返回比当前ID小的最大ID，已经是最小ID时返回false
+func (id ID) Prev() (ID, bool) {
+	if id.Seq > 0 {
+		return ID{id.Ms, id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return ID{id.Ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// Entry 一条消息，Fields为 field value 交替排列
+type Entry struct {
+	ID     ID
+	Fields [][]byte
+	// 已经被XDEL删除，等待压缩
+	deleted bool
+}
+
+// 被删除的消息超过一半并且不少于这个数量时压缩数组
+const compactThreshold = 64
+
+type Stream struct {
+	// 按ID升序排列，head之前的消息已经被删除，
+	// 中间被删除的消息只做标记，等删除的数量足够多时再整体压缩，避免每次删除都移动后面的消息
+	entries []*Entry
+	head    int
+	// head之后被标记删除的消息数量
+	deleted int
+	// 最后生成的ID，消息被删除后也不会变小
+	LastID ID
+	// 被删除的消息中最大的ID
+	MaxDeletedID ID
+	// 历史上添加过的消息总数
+	EntriesAdded uint64
+
+	groups map[string]*Group
+}
+
+func NewStream() *Stream {
+	return &Stream{groups: make(map[string]*Group)}
+}
+
+func (s *Stream) Len() int {
+	return len(s.entries) - s.head - s.deleted
+}
+
+// 根据当前时间生成下一个ID，ID耗尽时返回false
+func (s *Stream) NextID(nowMs uint64) (ID, bool) {
+	if nowMs > s.LastID.Ms {
+		return ID{nowMs, 0}, true
+	}
+	return s.LastID.Next()
+}
+
+// 追加消息，调用方需要保证id比LastID大
+func (s *Stream) Add(id ID, fields [][]byte) {
+	s.entries = append(s.entries, &Entry{ID: id, Fields: fields})
+	s.LastID = id
+	s.EntriesAdded++
+}
+
+// 第一个ID不小于id的消息下标，包括被标记删除的消息
+func (s *Stream) search(id ID) int {
+	return s.head + sort.Search(len(s.entries)-s.head, func(i int) bool {
+		return !s.entries[s.head+i].ID.Less(id)
+	})
+}
+
+func (s *Stream) Get(id ID) (*Entry, bool) {
+	idx := s.search(id)
+	if idx < len(s.entries) && s.entries[idx].ID == id && !s.entries[idx].deleted {
+		return s.entries[idx], true
+	}
+	return nil, false
+}
+
+// 两端被标记删除的消息会被立即移除，所以首尾的消息一定有效
+func (s *Stream) First() *Entry {
+	if s.head == len(s.entries) {
+		return nil
+	}
+	return s.entries[s.head]
+}
+
+func (s *Stream) Last() *Entry {
+	if s.head == len(s.entries) {
+		return nil
+	}
+	return s.entries[len(s.entries)-1]
+}
+
+// 返回 [start, end] 区间内的消息，count <= 0 表示不限制个数
+func (s *Stream) Range(start, end ID, count int, rev bool) []*Entry {
+	result := make([]*Entry, 0)
+	if end.Less(start) {
+		return result
+	}
+	from := s.search(start)
+	to := s.search(end)
+	if to < len(s.entries) && s.entries[to].ID == end {
+		to++
+	}
+	if rev {
+		for i := to - 1; i >= from && (count <= 0 || len(result) < count); i-- {
+			if !s.entries[i].deleted {
+				result = append(result, s.entries[i])
+			}
+		}
+		return result
+	}
+	for i := from; i < to && (count <= 0 || len(result) < count); i++ {
+		if !s.entries[i].deleted {
+			result = append(result, s.entries[i])
+		}
+	}
+	return result
+}
+
+func (s *Stream) markDeleted(id ID) {
+	if s.MaxDeletedID.Less(id) {
+		s.MaxDeletedID = id
+	}
+}
+
+func (s *Stream) Delete(id ID) bool {
+	idx := s.search(id)
+	if idx >= len(s.entries) || s.entries[idx].ID != id || s.entries[idx].deleted {
+		return false
+	}
+	s.entries[idx].deleted = true
+	s.deleted++
+	s.markDeleted(id)
+	s.dropDeleted()
+	return true
+}
+
+// 移除两端被标记删除的消息，删除的消息较多时压缩数组
+func (s *Stream) dropDeleted() {
+	for s.head < len(s.entries) && s.entries[s.head].deleted {
+		s.entries[s.head] = nil
+		s.head++
+		s.deleted--
+	}
+	for len(s.entries) > s.head && s.entries[len(s.entries)-1].deleted {
+		s.entries[len(s.entries)-1] = nil
+		s.entries = s.entries[:len(s.entries)-1]
+		s.deleted--
+	}
+	dead := s.head + s.deleted
+	if dead < compactThreshold || dead*2 < len(s.entries) {
+		return
+	}
+	// 复制一份，避免底层数组一直持有已删除的消息
+	entries := make([]*Entry, 0, s.Len())
+	for _, entry := range s.entries[s.head:] {
+		if !entry.deleted {
+			entries = append(entries, entry)
+		}
+	}
+	s.entries = entries
+	s.head = 0
+	s.deleted = 0
+}
+
+// 从头开始删除最多n条消息，遇到before返回false的消息时停止，返回被删除的消息
+func (s *Stream) removeFirst(n int, before func(id ID) bool) []*Entry {
+	var removed []*Entry
+	for len(removed) < n && s.head < len(s.entries) && before(s.entries[s.head].ID) {
+		// 被标记删除的消息在dropDeleted中已经跳过，head处的消息一定有效
+		entry := s.entries[s.head]
+		s.markDeleted(entry.ID)
+		s.entries[s.head] = nil
+		s.head++
+		removed = append(removed, entry)
+		s.dropDeleted()
+	}
+	return removed
+}
+
+// 只保留最新的maxLen条消息，limit > 0 时最多删除limit条
+func (s *Stream) TrimByLen(maxLen int, limit int) []*Entry {
+	n := s.Len() - maxLen
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	return s.removeFirst(n, func(ID) bool { return true })
+}
+
+// 删除ID小于minID的消息，limit > 0 时最多删除limit条
+func (s *Stream) TrimByMinID(minID ID, limit int) []*Entry {
+	n := s.Len()
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	return s.removeFirst(n, func(id ID) bool { return id.Less(minID) })
+}
+
+// 把被删除的消息放回原来的位置，用于撤销删除和裁剪，不会修改LastID等状态
+func (s *Stream) Restore(entries []*Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	restored := make([]*Entry, len(entries))
+	copy(restored, entries)
+	sort.Slice(restored, func(i, j int) bool {
+		return restored[i].ID.Less(restored[j].ID)
+	})
+	merged := make([]*Entry, 0, s.Len()+len(restored))
+	i := 0
+	for _, entry := range s.entries[s.head:] {
+		if entry.deleted {
+			continue
+		}
+		for ; i < len(restored) && restored[i].ID.Less(entry.ID); i++ {
+			restored[i].deleted = false
+			merged = append(merged, restored[i])
+		}
+		merged = append(merged, entry)
+	}
+	for ; i < len(restored); i++ {
+		restored[i].deleted = false
+		merged = append(merged, restored[i])
+	}
+	s.entries = merged
+	s.head = 0
+	s.deleted = 0
+}
+
+// 估算从第一条消息到id（包含）为止一共添加过多少条消息，无法确定时返回false
+func (s *Stream) EstimateEntriesRead(id ID) (int64, bool) {
+	if s.EntriesAdded == 0 {
+		return 0, true
+	}
+	if !id.Less(s.LastID) {
+		return int64(s.EntriesAdded), true
+	}
+	// 被删除的消息都不大于id时，大于id的消息都还在
+	if !id.Less(s.MaxDeletedID) {
+		idx := s.search(id)
+		// 被标记删除的消息都不大于id，idx之后只可能有id本身是被删除的
+		after := len(s.entries) - idx
+		if idx < len(s.entries) && s.entries[idx].ID == id {
+			after--
+		}
+		return int64(s.EntriesAdded) - int64(after), true
+	}
+	return 0, false
+}
+
+// 消费者组按名称排序
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+func (s *Stream) Group(name string) *Group {
+	return s.groups[name]
+}
+
+// 创建消费者组，已存在时返回nil
+func (s *Stream) CreateGroup(name string, lastID ID, entriesRead int64) *Group {
+	if _, ok := s.groups[name]; ok {
+		return nil
+	}
+	group := newGroup(name, lastID, entriesRead)
+	s.groups[name] = group
+	return group
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// 放回被删除的消费者组，用于撤销删除
+func (s *Stream) RestoreGroup(group *Group) {
+	s.groups[group.Name] = group
+}
+
+// 复制消息以及所有的消费者组
+func (s *Stream) Clone() *Stream {
+	clone := &Stream{
+		entries:      make([]*Entry, 0, s.Len()),
+		LastID:       s.LastID,
+		MaxDeletedID: s.MaxDeletedID,
+		EntriesAdded: s.EntriesAdded,
+		groups:       make(map[string]*Group, len(s.groups)),
+	}
+	for _, entry := range s.entries[s.head:] {
+		if entry.deleted {
+			continue
+		}
+		fields := make([][]byte, len(entry.Fields))
+		for j, field := range entry.Fields {
+			fields[j] = append([]byte(nil), field...)
+		}
+		clone.entries = append(clone.entries, &Entry{ID: entry.ID, Fields: fields})
+	}
+	for name, group := range s.groups {
+		clone.groups[name] = group.clone()
+	}
+	return clone
+}
@@ -0,0 +1,118 @@
+package stream
+
+import "testing"
+
+func TestStreamRangeAndTrim(t *testing.T) {
+	s := NewStream()
+	for i := uint64(1); i <= 10; i++ {
+		s.Add(ID{Ms: i}, [][]byte{[]byte("k"), []byte("v")})
+	}
+	entries := s.Range(ID{Ms: 3}, ID{Ms: 5}, 0, false)
+	if len(entries) != 3 || entries[0].ID.Ms != 3 || entries[2].ID.Ms != 5 {
+		t.Fatal("wrong range result")
+	}
+	entries = s.Range(MinID, MaxID, 2, true)
+	if len(entries) != 2 || entries[0].ID.Ms != 10 {
+		t.Fatal("wrong reverse range result")
+	}
+
+	if n := len(s.TrimByLen(8, 0)); n != 2 || s.First().ID.Ms != 3 {
+		t.Fatalf("trim by len removed %d", n)
+	}
+	if n := len(s.TrimByMinID(ID{Ms: 6}, 1)); n != 1 || s.First().ID.Ms != 4 {
+		t.Fatalf("trim by min id removed %d", n)
+	}
+	if !s.Delete(ID{Ms: 7}) || s.Delete(ID{Ms: 7}) {
+		t.Fatal("wrong delete result")
+	}
+	if s.MaxDeletedID != (ID{Ms: 7}) || s.EntriesAdded != 10 || s.Len() != 6 {
+		t.Fatal("wrong stream state")
+	}
+	// 被删除的消息都不大于id时可以精确计算
+	if n, ok := s.EstimateEntriesRead(ID{Ms: 8}); !ok || n != 8 {
+		t.Fatalf("expected 8 entries read, actual %d", n)
+	}
+	if _, ok := s.EstimateEntriesRead(ID{Ms: 5}); ok {
+		t.Fatal("entries read should be unknown")
+	}
+}
+
+func TestGroupClaim(t *testing.T) {
+	g := newGroup("g", MinID, 0)
+	alice, _ := g.CreateConsumer("alice", 0)
+	bob, _ := g.CreateConsumer("bob", 0)
+	g.Claim(ID{Ms: 1}, alice, 0, 1)
+	g.Claim(ID{Ms: 2}, alice, 0, 1)
+	g.Claim(ID{Ms: 1}, bob, 0, 2)
+	if alice.PendingLen() != 1 || bob.PendingLen() != 1 || g.PendingLen() != 2 {
+		t.Fatal("wrong pending count after claim")
+	}
+	if !g.Ack(ID{Ms: 1}) || g.Ack(ID{Ms: 1}) || bob.PendingLen() != 0 {
+		t.Fatal("wrong ack result")
+	}
+	if n, ok := g.DeleteConsumer("alice"); !ok || n != 1 || g.PendingLen() != 0 {
+		t.Fatal("wrong delete consumer result")
+	}
+}
+
+func TestPendingRange(t *testing.T) {
+	g := newGroup("g", MinID, 0)
+	alice, _ := g.CreateConsumer("alice", 0)
+	for _, ms := range []uint64{7, 3, 9, 1, 5, 8, 2} {
+		g.Claim(ID{Ms: ms}, alice, 0, 1)
+	}
+	check := func(entries []*PendingEntry, want ...uint64) {
+		t.Helper()
+		if len(entries) != len(want) {
+			t.Fatalf("expected %v, actual %d entries", want, len(entries))
+		}
+		for i, entry := range entries {
+			if entry.ID.Ms != want[i] {
+				t.Fatalf("expected %v, actual %v at %d", want, entry.ID, i)
+			}
+		}
+	}
+	check(g.PendingRange(MinID, MaxID, 0), 1, 2, 3, 5, 7, 8, 9)
+	check(g.PendingRange(MinID, MaxID, 3), 1, 2, 3)
+	check(g.PendingRange(ID{Ms: 4}, MaxID, 2), 5, 7)
+	check(g.PendingRange(ID{Ms: 4}, ID{Ms: 8}, 10), 5, 7, 8)
+	check(g.PendingRange(ID{Ms: 2}, ID{Ms: 8}, 6), 2, 3, 5, 7, 8)
+	check(alice.PendingFrom(ID{Ms: 8}, 1), 8)
+}
+
+func TestStreamDeleteAndCompact(t *testing.T) {
+	s := NewStream()
+	for i := uint64(1); i <= 200; i++ {
+		s.Add(ID{Ms: i}, nil)
+	}
+	// 删除中间的消息只做标记
+	for i := uint64(2); i <= 100; i += 2 {
+		s.Delete(ID{Ms: i})
+	}
+	if s.Len() != 150 || len(s.Range(ID{Ms: 1}, ID{Ms: 10}, 0, false)) != 5 {
+		t.Fatal("wrong length after delete")
+	}
+	if _, ok := s.Get(ID{Ms: 4}); ok {
+		t.Fatal("deleted entry still exists")
+	}
+	trimmed := s.TrimByLen(100, 0)
+	if len(trimmed) != 50 || s.First().ID.Ms != 101 {
+		t.Fatalf("trim by len removed %d, first %v", len(trimmed), s.First().ID)
+	}
+	if s.Len() != 100 || s.Last().ID.Ms != 200 {
+		t.Fatal("wrong stream state after trim")
+	}
+	if !s.Delete(ID{Ms: 200}) || s.Last().ID.Ms != 199 {
+		t.Fatal("wrong last entry after delete")
+	}
+	// 撤销裁剪和删除，消息回到原来的位置
+	last, _ := s.Get(ID{Ms: 199})
+	s.Delete(ID{Ms: 199})
+	s.Restore(append(trimmed, last))
+	if s.Len() != 149 || s.First().ID.Ms != 1 || s.Last().ID.Ms != 199 {
+		t.Fatal("wrong stream state after restore")
+	}
+	if entries := s.Range(ID{Ms: 98}, ID{Ms: 102}, 0, false); len(entries) != 3 || entries[0].ID.Ms != 99 {
+		t.Fatal("wrong range after restore")
+	}
+}
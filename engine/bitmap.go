@@ -0,0 +1,572 @@
+package engine
+
+import (
+	"gedis/aof"
+	"gedis/datastruct/bitmap"
+	"gedis/engine/entity"
+	"gedis/gedis/proto"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// 位图最大为512MB
+	maxBitSize = int64(maxStringSize) * 8
+)
+
+func parseBitOffset(arg []byte) (int64, proto.Reply) {
+	offset, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || offset < 0 || offset >= maxBitSize {
+		return 0, proto.NewGenericErrReply("bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// 获取可以原地修改的位图，长度不足bitSize个位时用0扩展
+// 字符串可能被其他地方引用，第一次修改时复制一份，之后归该key所有
+func (d *DB) getWritableBitmap(key string, bitSize int64) (bitmap.BitMap, proto.Reply) {
+	dataEntity, exist := d.GetEntity(key)
+	if !exist {
+		bm := bitmap.BitMap(nil).Grow(bitSize)
+		d.PutEntity(key, &entity.DataEntity{Object: bm})
+		return bm, nil
+	}
+	switch obj := dataEntity.Object.(type) {
+	case bitmap.BitMap:
+		bm := obj.Grow(bitSize)
+		// 扩展后替换为新的对象，撤销时换回原来长度的位图
+		if len(bm) != len(obj) {
+			d.PutEntity(key, &entity.DataEntity{Object: bm})
+		}
+		return bm, nil
+	case []byte:
+		bm := bitmap.BitMap(obj).Clone(bitSize)
+		d.PutEntity(key, &entity.DataEntity{Object: bm})
+		return bm, nil
+	}
+	return nil, proto.NewWrongTypeErrReply()
+}
+
+// 原地写入从offset开始的width个位，只记录被改动的字节用于撤销
+func (d *DB) setBitmapBits(key string, bm bitmap.BitMap, offset int64, width int, value uint64) {
+	first, last := offset/8, (offset+int64(width)-1)/8
+	old := append([]byte(nil), bm[first:last+1]...)
+	bm.SetBits(offset, width, value)
+	d.Modified(key, func() {
+		copy(bm[first:], old)
+	})
+}
+
+// SETBIT key offset value
+func cmdSetBit(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	offset, reply := parseBitOffset(args[1])
+	if reply != nil {
+		return reply
+	}
+	var bit byte
+	switch string(args[2]) {
+	case "0":
+		bit = 0
+	case "1":
+		bit = 1
+	default:
+		return proto.NewGenericErrReply("bit is not an integer or out of range")
+	}
+	bm, reply := db.getWritableBitmap(key, offset+1)
+	if reply != nil {
+		return reply
+	}
+	old := bm.GetBit(offset)
+	db.setBitmapBits(key, bm, offset, 1, uint64(bit))
+	db.writeAof(aof.SetBitCmd(args...))
+	return proto.NewIntegerReply(int64(old))
+}
+
+// GETBIT key offset
+func cmdGetBit(db *DB, args [][]byte) proto.Reply {
+	offset, reply := parseBitOffset(args[1])
+	if reply != nil {
+		return reply
+	}
+	value, reply := db.getStringView(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	return proto.NewIntegerReply(int64(bitmap.BitMap(value).GetBit(offset)))
+}
+
+// 解析 start end [BYTE | BIT]，返回位区间 [start, end]，区间为空时ok为false
+func parseBitRange(args [][]byte, byteSize int64) (start, end int64, ok bool, reply proto.Reply) {
+	var err1, err2 error
+	start, err1 = strconv.ParseInt(string(args[0]), 10, 64)
+	end, err2 = strconv.ParseInt(string(args[1]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false, proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	isBit := false
+	if len(args) == 3 {
+		switch strings.ToUpper(string(args[2])) {
+		case "BYTE":
+		case "BIT":
+			isBit = true
+		default:
+			return 0, 0, false, proto.NewSyntaxErrReply()
+		}
+	}
+	total := byteSize
+	if isBit {
+		total = byteSize * 8
+	}
+	if start < 0 && end < 0 && start > end {
+		return 0, 0, false, nil
+	}
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= total {
+		end = total - 1
+	}
+	if start > end {
+		return 0, 0, false, nil
+	}
+	if !isBit {
+		start, end = start*8, end*8+7
+	}
+	return start, end, true, nil
+}
+
+// BITCOUNT key [start end [BYTE | BIT]]
+func cmdBitCount(db *DB, args [][]byte) proto.Reply {
+	if len(args) != 1 && len(args) != 3 && len(args) != 4 {
+		return proto.NewSyntaxErrReply()
+	}
+	value, reply := db.getStringView(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	bm := bitmap.BitMap(value)
+	start, end := int64(0), bm.BitSize()-1
+	if len(args) > 1 {
+		var ok bool
+		start, end, ok, reply = parseBitRange(args[1:], int64(len(value)))
+		if reply != nil {
+			return reply
+		}
+		if !ok {
+			return proto.NewIntegerReply(0)
+		}
+	}
+	return proto.NewIntegerReply(bm.Count(start, end))
+}
+
+// BITPOS key bit [start [end [BYTE | BIT]]]
+func cmdBitPos(db *DB, args [][]byte) proto.Reply {
+	if len(args) > 5 {
+		return proto.NewSyntaxErrReply()
+	}
+	var bit byte
+	switch string(args[1]) {
+	case "0":
+		bit = 0
+	case "1":
+		bit = 1
+	default:
+		return proto.NewGenericErrReply("The bit argument must be 1 or 0.")
+	}
+	value, reply := db.getStringView(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if value == nil {
+		if bit == 0 {
+			return proto.NewIntegerReply(0)
+		}
+		return proto.NewIntegerReply(-1)
+	}
+
+	bm := bitmap.BitMap(value)
+	rangeArgs := args[2:]
+	endGiven := len(rangeArgs) >= 2
+	if len(rangeArgs) == 1 {
+		// 只给出start时end默认为最后一个字节
+		rangeArgs = [][]byte{rangeArgs[0], []byte("-1")}
+	}
+	start, end := int64(0), bm.BitSize()-1
+	if len(rangeArgs) > 0 {
+		var ok bool
+		start, end, ok, reply = parseBitRange(rangeArgs, int64(len(value)))
+		if reply != nil {
+			return reply
+		}
+		if !ok {
+			return proto.NewIntegerReply(-1)
+		}
+	}
+	pos := bm.Pos(bit, start, end)
+	// 查找0且没有指定结束位置时，字符串右侧视为用0填充
+	if pos < 0 && bit == 0 && !endGiven {
+		pos = end + 1
+	}
+	return proto.NewIntegerReply(pos)
+}
+
+type bitOperation func(a, b byte) byte
+
+// BITOP的目标key为写，源key为读
+func bitOpKeys(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return []string{string(args[1])}, toStrings(args[2:])
+}
+
+// BITOP <AND | OR | XOR | NOT> destkey key [key ...]
+func cmdBitOp(db *DB, args [][]byte) proto.Reply {
+	op := strings.ToUpper(string(args[0]))
+	dest := string(args[1])
+	keys := toStrings(args[2:])
+	var operation bitOperation
+	switch op {
+	case "AND":
+		operation = func(a, b byte) byte { return a & b }
+	case "OR":
+		operation = func(a, b byte) byte { return a | b }
+	case "XOR":
+		operation = func(a, b byte) byte { return a ^ b }
+	case "NOT":
+		if len(keys) != 1 {
+			return proto.NewGenericErrReply("BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return proto.NewSyntaxErrReply()
+	}
+
+	values := make([][]byte, len(keys))
+	maxLen := 0
+	for i, key := range keys {
+		value, reply := db.getStringView(key)
+		if reply != nil {
+			return reply
+		}
+		values[i] = value
+		if len(value) > maxLen {
+			maxLen = len(value)
+		}
+	}
+
+	result := make([]byte, maxLen)
+	if op == "NOT" {
+		for i, b := range values[0] {
+			result[i] = ^b
+		}
+	} else {
+		// 较短的字符串视为用0填充
+		copy(result, values[0])
+		for _, value := range values[1:] {
+			for i := range result {
+				var b byte
+				if i < len(value) {
+					b = value[i]
+				}
+				result[i] = operation(result[i], b)
+			}
+		}
+	}
+
+	db.Remove(dest)
+	if maxLen > 0 {
+		db.PutEntity(dest, &entity.DataEntity{Object: result})
+	}
+	db.writeAof(aof.BitOpCmd(args...))
+	return proto.NewIntegerReply(int64(maxLen))
+}
+
+const (
+	overflowWrap = iota
+	overflowSat
+	overflowFail
+)
+
+const (
+	bitFieldGet = iota
+	bitFieldSet
+	bitFieldIncrBy
+)
+
+type bitFieldOp struct {
+	kind     int
+	signed   bool
+	width    int
+	offset   int64
+	value    int64
+	overflow int
+}
+
+func parseBitFieldType(arg []byte) (signed bool, width int, ok bool) {
+	s := strings.ToLower(string(arg))
+	if len(s) < 2 || (s[0] != 'i' && s[0] != 'u') {
+		return false, 0, false
+	}
+	signed = s[0] == 'i'
+	width, err := strconv.Atoi(s[1:])
+	if err != nil || width < 1 || (signed && width > 64) || (!signed && width > 63) {
+		return false, 0, false
+	}
+	return signed, width, true
+}
+
+// 偏移量支持 #N 的形式，表示第N个该类型的整数
+func parseBitFieldOffset(arg []byte, width int) (int64, bool) {
+	s := string(arg)
+	multiply := false
+	if strings.HasPrefix(s, "#") {
+		multiply = true
+		s = s[1:]
+	}
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, false
+	}
+	if multiply {
+		if offset > maxBitSize/int64(width) {
+			return 0, false
+		}
+		offset *= int64(width)
+	}
+	if offset+int64(width) > maxBitSize {
+		return 0, false
+	}
+	return offset, true
+}
+
+func parseBitFieldOps(args [][]byte, readonly bool) ([]*bitFieldOp, proto.Reply) {
+	ops := make([]*bitFieldOp, 0)
+	overflow := overflowWrap
+	for i := 0; i < len(args); i++ {
+		subCommand := strings.ToUpper(string(args[i]))
+		if subCommand == "OVERFLOW" {
+			if i+1 >= len(args) {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			switch strings.ToUpper(string(args[i+1])) {
+			case "WRAP":
+				overflow = overflowWrap
+			case "SAT":
+				overflow = overflowSat
+			case "FAIL":
+				overflow = overflowFail
+			default:
+				return nil, proto.NewGenericErrReply("Invalid OVERFLOW type specified")
+			}
+			i++
+			continue
+		}
+
+		op := &bitFieldOp{overflow: overflow}
+		argNum := 3
+		switch subCommand {
+		case "GET":
+			op.kind = bitFieldGet
+			argNum = 2
+		case "SET":
+			op.kind = bitFieldSet
+		case "INCRBY":
+			op.kind = bitFieldIncrBy
+		default:
+			return nil, proto.NewSyntaxErrReply()
+		}
+		if i+argNum >= len(args) {
+			return nil, proto.NewSyntaxErrReply()
+		}
+		var ok bool
+		op.signed, op.width, ok = parseBitFieldType(args[i+1])
+		if !ok {
+			return nil, proto.NewGenericErrReply("Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+		}
+		op.offset, ok = parseBitFieldOffset(args[i+2], op.width)
+		if !ok {
+			return nil, proto.NewGenericErrReply("bit offset is not an integer or out of range")
+		}
+		if op.kind != bitFieldGet {
+			if readonly {
+				return nil, proto.NewGenericErrReply("BITFIELD_RO only supports the GET subcommand")
+			}
+			var err error
+			op.value, err = strconv.ParseInt(string(args[i+3]), 10, 64)
+			if err != nil {
+				return nil, proto.NewGenericErrReply("value is not an integer or out of range")
+			}
+		}
+		ops = append(ops, op)
+		i += argNum
+	}
+	return ops, nil
+}
+
+// 计算有符号整数 value+incr 的结果，溢出时按照overflow处理，FAIL时ok为false
+func signedOverflow(value, incr int64, width int, overflow int) (result int64, ok bool) {
+	max := int64(math.MaxInt64)
+	if width < 64 {
+		max = int64(1)<<(width-1) - 1
+	}
+	min := -max - 1
+	maxIncr := max - value
+	minIncr := min - value
+
+	isOverflow := value > max || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr)
+	isUnderflow := value < min || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr)
+	if !isOverflow && !isUnderflow {
+		return value + incr, true
+	}
+	switch overflow {
+	case overflowWrap:
+		// 截取低width位后做符号扩展
+		res := uint64(value) + uint64(incr)
+		if width < 64 {
+			mask := ^uint64(0) << width
+			if res&(uint64(1)<<(width-1)) != 0 {
+				res |= mask
+			} else {
+				res &^= mask
+			}
+		}
+		return int64(res), true
+	case overflowSat:
+		if isOverflow {
+			return max, true
+		}
+		return min, true
+	}
+	return 0, false
+}
+
+// 计算无符号整数 value+incr 的结果，溢出时按照overflow处理，FAIL时ok为false
+func unsignedOverflow(value uint64, incr int64, width int, overflow int) (result uint64, ok bool) {
+	max := uint64(1)<<width - 1
+	maxIncr := int64(max - value)
+	minIncr := -int64(value)
+
+	isOverflow := value > max || (incr > 0 && incr > maxIncr)
+	isUnderflow := !isOverflow && incr < 0 && incr < minIncr
+	if !isOverflow && !isUnderflow {
+		return uint64(int64(value) + incr), true
+	}
+	switch overflow {
+	case overflowWrap:
+		return (value + uint64(incr)) & max, true
+	case overflowSat:
+		if isOverflow {
+			return max, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// 按类型读取整数，有符号类型需要做符号扩展
+func getBitField(bm bitmap.BitMap, op *bitFieldOp) int64 {
+	value := bm.GetBits(op.offset, op.width)
+	if op.signed && op.width < 64 && value&(uint64(1)<<(op.width-1)) != 0 {
+		value |= ^uint64(0) << op.width
+	}
+	return int64(value)
+}
+
+func execBitField(db *DB, args [][]byte, readonly bool) proto.Reply {
+	key := string(args[0])
+	ops, reply := parseBitFieldOps(args[1:], readonly)
+	if reply != nil {
+		return reply
+	}
+	value, reply := db.getStringView(key)
+	if reply != nil {
+		return reply
+	}
+
+	bm := bitmap.BitMap(value)
+	var bitSize int64
+	for _, op := range ops {
+		if op.kind != bitFieldGet && op.offset+int64(op.width) > bitSize {
+			bitSize = op.offset + int64(op.width)
+		}
+	}
+
+	changed := false
+	result := make([]proto.Reply, len(ops))
+	for i, op := range ops {
+		old := getBitField(bm, op)
+		if op.kind == bitFieldGet {
+			result[i] = proto.NewIntegerReply(old)
+			continue
+		}
+
+		var newValue int64
+		var ok bool
+		if op.signed {
+			if op.kind == bitFieldSet {
+				newValue, ok = signedOverflow(op.value, 0, op.width, op.overflow)
+			} else {
+				newValue, ok = signedOverflow(old, op.value, op.width, op.overflow)
+			}
+		} else {
+			var unsigned uint64
+			if op.kind == bitFieldSet {
+				unsigned, ok = unsignedOverflow(uint64(op.value), 0, op.width, op.overflow)
+			} else {
+				unsigned, ok = unsignedOverflow(uint64(old), op.value, op.width, op.overflow)
+			}
+			newValue = int64(unsigned)
+		}
+		if !ok {
+			result[i] = proto.NewNullBulkReply()
+			continue
+		}
+		// 第一次写入时才扩展，全部溢出失败时不修改key
+		if !changed {
+			bm, _ = db.getWritableBitmap(key, bitSize)
+		}
+		db.setBitmapBits(key, bm, op.offset, op.width, uint64(newValue))
+		changed = true
+		if op.kind == bitFieldSet {
+			result[i] = proto.NewIntegerReply(old)
+		} else {
+			result[i] = proto.NewIntegerReply(newValue)
+		}
+	}
+
+	if changed {
+		db.writeAof(aof.BitFieldCmd(args...))
+	}
+	return proto.NewMixReply(result...)
+}
+
+// BITFIELD key [GET encoding offset | [OVERFLOW <WRAP | SAT | FAIL>] <SET encoding offset value | INCRBY encoding offset increment> ...]
+func cmdBitField(db *DB, args [][]byte) proto.Reply {
+	return execBitField(db, args, false)
+}
+
+// BITFIELD_RO key [GET encoding offset ...]
+func cmdBitFieldRO(db *DB, args [][]byte) proto.Reply {
+	return execBitField(db, args, true)
+}
+
+func init() {
+	registerCommand("SetBit", cmdSetBit, writeFirstKey, 4)
+	registerCommand("GetBit", cmdGetBit, readFirstKey, 3)
+	registerCommand("BitCount", cmdBitCount, readFirstKey, -2)
+	registerCommand("BitPos", cmdBitPos, readFirstKey, -3)
+	registerCommand("BitOp", cmdBitOp, bitOpKeys, -4)
+	registerCommand("BitField", cmdBitField, writeFirstKey, -2)
+	registerCommand("BitField_RO", cmdBitFieldRO, readFirstKey, -2)
+}
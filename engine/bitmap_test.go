@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+func TestSetBitGetBit(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	// 'a' = 0b01100001
+	expectReply(t, e, c, "SETBIT k 1 1", ":0")
+	expectReply(t, e, c, "SETBIT k 2 1", ":0")
+	expectReply(t, e, c, "SETBIT k 7 1", ":0")
+	expectReply(t, e, c, "SETBIT k 7 1", ":1")
+	expectReply(t, e, c, "GET k", "$1 a")
+	expectReply(t, e, c, "GETBIT k 2", ":1")
+	expectReply(t, e, c, "GETBIT k 3", ":0")
+	expectReply(t, e, c, "GETBIT k 100", ":0")
+	expectReply(t, e, c, "GETBIT none 0", ":0")
+	// 超出长度时用0扩展
+	expectReply(t, e, c, "SETBIT k 23 0", ":0")
+	expectReply(t, e, c, "STRLEN k", ":3")
+	expectReply(t, e, c, "SETBIT k 8 1", ":0")
+	expectReply(t, e, c, "SETBIT k 8 0", ":1")
+	expectReply(t, e, c, "TYPE k", "+string")
+	expectReply(t, e, c, "OBJECT ENCODING k", "$3 raw")
+	expectReply(t, e, c, "APPEND k b", ":4")
+	expectReply(t, e, c, "GETRANGE k 0 0", "$1 a")
+	expectReply(t, e, c, "SETRANGE k 1 xyz", ":4")
+	expectReply(t, e, c, "GET k", "$4 axyz")
+
+	expectReply(t, e, c, "SETBIT k 1 2", "-ERR bit is not an integer or out of range")
+	expectReply(t, e, c, "SETBIT k -1 1", "-ERR bit offset is not an integer or out of range")
+	expectReply(t, e, c, "SETBIT k 4294967296 1", "-ERR bit offset is not an integer or out of range")
+	expectReply(t, e, c, "GETBIT k x", "-ERR bit offset is not an integer or out of range")
+	expectReply(t, e, c, "RPUSH l a", ":1")
+	expectReply(t, e, c, "SETBIT l 0 1", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "GET k", "$4 axyz")
+}
+
+// 位图原地修改，不会影响其他地方引用的字符串
+func TestSetBitInPlace(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	// SET保存的是命令中的参数
+	command := [][]byte{[]byte("SET"), []byte("k"), []byte("a")}
+	e.Exec(c, command)
+	expectReply(t, e, c, "SETBIT k 6 1", ":0")
+	if string(command[2]) != "a" {
+		t.Errorf("argument of SET is modified: %q", command[2])
+	}
+	get := e.Exec(c, [][]byte{[]byte("GET"), []byte("k")})
+	getRange := e.Exec(c, [][]byte{[]byte("GETRANGE"), []byte("k"), []byte("0"), []byte("0")})
+	expectReply(t, e, c, "COPY k k2", ":1")
+	expectReply(t, e, c, "SETBIT k 7 0", ":1")
+	expectReply(t, e, c, "BITFIELD k SET u8 0 98", "*1 :98")
+	if string(get.Bytes()) != "$1\r\nc\r\n" || string(getRange.Bytes()) != "$1\r\nc\r\n" {
+		t.Errorf("reply is modified: %q %q", get.Bytes(), getRange.Bytes())
+	}
+	expectReply(t, e, c, "MGET k k2", "*2 $1 b $1 c")
+
+	// 修改已有的位不会复制整个字符串
+	expectReply(t, e, c, "SETBIT big 8388607 1", ":0")
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 100; i++ {
+		testExec(e, c, "SETBIT big 100 1")
+		testExec(e, c, "BITFIELD big INCRBY u8 16 1")
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 10<<20 {
+		t.Errorf("%d bytes allocated by 200 writes to a 1MB bitmap", allocated)
+	}
+	expectReply(t, e, c, "BITFIELD big GET u8 16", "*1 :100")
+	expectReply(t, e, c, "BITCOUNT big", ":5")
+}
+
+func TestBitCount(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET s foobar", "+ok")
+	expectReply(t, e, c, "BITCOUNT s", ":26")
+	expectReply(t, e, c, "BITCOUNT s 0 0", ":4")
+	expectReply(t, e, c, "BITCOUNT s 1 1", ":6")
+	expectReply(t, e, c, "BITCOUNT s 1 1 BYTE", ":6")
+	expectReply(t, e, c, "BITCOUNT s 5 30 BIT", ":17")
+	expectReply(t, e, c, "BITCOUNT s -2 -1", ":7")
+	expectReply(t, e, c, "BITCOUNT s 4 2", ":0")
+	expectReply(t, e, c, "BITCOUNT s 0 100", ":26")
+	expectReply(t, e, c, "BITCOUNT none", ":0")
+	expectReply(t, e, c, "BITCOUNT s 0", "-ERR syntax error")
+	expectReply(t, e, c, "BITCOUNT s 0 1 WORD", "-ERR syntax error")
+	expectReply(t, e, c, "BITCOUNT s a 1", "-ERR value is not an integer or out of range")
+}
+
+func TestBitPos(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	// "\xff\xf0\x00"
+	expectReply(t, e, c, "BITFIELD k SET u8 0 255 SET u8 8 240", "*2 :0 :0")
+	expectReply(t, e, c, "SETBIT k 23 0", ":0")
+	expectReply(t, e, c, "BITPOS k 0", ":12")
+	expectReply(t, e, c, "BITPOS k 1 2", ":-1")
+	// "\x00\xff\xf0"
+	expectReply(t, e, c, "BITFIELD p SET u8 8 255 SET u8 16 240", "*2 :0 :0")
+	expectReply(t, e, c, "BITPOS p 1 0", ":8")
+	expectReply(t, e, c, "BITPOS p 1 2", ":16")
+	expectReply(t, e, c, "BITPOS p 1 2 -1 BYTE", ":16")
+	expectReply(t, e, c, "BITPOS p 1 7 15 BIT", ":8")
+	expectReply(t, e, c, "BITPOS p 0 8 15 BIT", ":-1")
+	// 全是1时没有指定结束位置，视为右边用0填充
+	expectReply(t, e, c, "BITFIELD f SET u16 0 65535", "*1 :0")
+	expectReply(t, e, c, "BITPOS f 0", ":16")
+	expectReply(t, e, c, "BITPOS f 0 0 -1", ":-1")
+	expectReply(t, e, c, "BITPOS none 0", ":0")
+	expectReply(t, e, c, "BITPOS none 1", ":-1")
+	expectReply(t, e, c, "BITPOS p 2", "-ERR The bit argument must be 1 or 0.")
+	expectReply(t, e, c, "BITPOS p 1 0 1 WORD", "-ERR syntax error")
+}
+
+func TestBitOp(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MSET k1 foobar k2 abcdef k3 ab", "+ok")
+	expectReply(t, e, c, "BITOP AND dest k1 k2", ":6")
+	expectReply(t, e, c, "GET dest", "$6 `bc`ab")
+	expectReply(t, e, c, "BITOP OR dest k1 k2", ":6")
+	expectReply(t, e, c, "GET dest", "$6 goofev")
+	// 较短的字符串视为用0填充
+	expectReply(t, e, c, "BITOP OR dest k3 k1", ":6")
+	expectReply(t, e, c, "GET dest", "$6 goobar")
+	expectReply(t, e, c, "BITOP XOR dest k1 k1", ":6")
+	expectReply(t, e, c, "BITCOUNT dest", ":0")
+	expectReply(t, e, c, "BITOP NOT dest k1", ":6")
+	expectReply(t, e, c, "BITOP NOT dest dest", ":6")
+	expectReply(t, e, c, "GET dest", "$6 foobar")
+	// 源key都不存在时删除目标key
+	expectReply(t, e, c, "BITOP AND dest none", ":0")
+	expectReply(t, e, c, "EXISTS dest", ":0")
+
+	expectReply(t, e, c, "BITOP NOT dest k1 k2", "-ERR BITOP NOT must be called with a single source key.")
+	expectReply(t, e, c, "BITOP NAND dest k1 k2", "-ERR syntax error")
+	expectReply(t, e, c, "RPUSH l a", ":1")
+	expectReply(t, e, c, "BITOP AND dest k1 l", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	expectReply(t, e, c, "BITOP OR dest k3 k1", ":6")
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "GET dest", "$6 goobar")
+}
+
+func TestBitField(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "BITFIELD k INCRBY i5 100 1 GET u4 0", "*2 :1 :0")
+	expectReply(t, e, c, "BITFIELD k SET i8 0 -100 GET i8 0", "*2 :0 :-100")
+	expectReply(t, e, c, "BITFIELD_RO k GET u8 0 GET i8 #0", "*2 :156 :-100")
+	// 溢出处理
+	for _, want := range []string{"*2 :1 :1", "*2 :2 :2", "*2 :3 :3", "*2 :0 :3"} {
+		expectReply(t, e, c, "BITFIELD o INCRBY u2 100 1 OVERFLOW SAT INCRBY u2 102 1", want)
+	}
+	expectReply(t, e, c, "BITFIELD o OVERFLOW FAIL INCRBY u2 102 1", "*1 $-1")
+	expectReply(t, e, c, "BITFIELD o OVERFLOW WRAP INCRBY i8 0 200", "*1 :-56")
+	expectReply(t, e, c, "BITFIELD o OVERFLOW SAT SET i8 0 200", "*1 :-56")
+	expectReply(t, e, c, "BITFIELD o GET i8 0", "*1 :127")
+	// 全部溢出失败时不创建key
+	expectReply(t, e, c, "BITFIELD nf OVERFLOW FAIL INCRBY u2 100 5", "*1 $-1")
+	expectReply(t, e, c, "EXISTS nf", ":0")
+	expectReply(t, e, c, "BITFIELD nf GET u8 0", "*1 :0")
+	expectReply(t, e, c, "EXISTS nf", ":0")
+
+	expectReply(t, e, c, "BITFIELD k GET u64 0", "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	expectReply(t, e, c, "BITFIELD k GET x8 0", "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	expectReply(t, e, c, "BITFIELD k GET u8 -1", "-ERR bit offset is not an integer or out of range")
+	expectReply(t, e, c, "BITFIELD k SET u8 0 x", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "BITFIELD k OVERFLOW NONE GET u8 0", "-ERR Invalid OVERFLOW type specified")
+	expectReply(t, e, c, "BITFIELD k GET u8", "-ERR syntax error")
+	expectReply(t, e, c, "BITFIELD_RO k SET u8 0 1", "-ERR BITFIELD_RO only supports the GET subcommand")
+
+	aof := readAof(t)
+	if strings.Count(aof, "\r\nbitfield\r\n") != 8 {
+		t.Errorf("unexpected bitfield commands in aof:\n%q", aof)
+	}
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "BITFIELD_RO k GET i8 0 GET u4 100", "*2 :-100 :0")
+	expectReply(t, e, c, "BITFIELD o GET i8 0 GET u2 100 GET u2 102", "*3 :127 :0 :3")
+	expectReply(t, e, c, "EXISTS nf", ":0")
+}
+
+// 位图的修改只撤销改动的字节，扩展的长度同样会被撤销
+func TestBitmapUndo(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SETBIT k 6 1", ":0")
+	expectReply(t, e, c, "EXPIRE k 100", ":1")
+	t.Run("setbit", func(t *testing.T) {
+		injectPanic(t, "setbit")
+		expectReply(t, e, c, "SETBIT k 7 1", "-ERR injected panic")
+		expectReply(t, e, c, "SETBIT k 100 1", "-ERR injected panic")
+	})
+	expectReply(t, e, c, "GET k", "$1 \x02")
+	expectTTL(t, e, c, "k", 100)
+	t.Run("bitfield", func(t *testing.T) {
+		injectPanic(t, "bitfield")
+		expectReply(t, e, c, "BITFIELD k SET u8 0 255 SET u16 20 65535", "-ERR injected panic")
+	})
+	expectReply(t, e, c, "GET k", "$1 \x02")
+
+	// 事务中的多次修改一起撤销
+	expectReply(t, e, c, "SET s a", "+ok")
+	t.Run("multi", func(t *testing.T) {
+		injectPanic(t, "lpush")
+		expectReply(t, e, c, "MULTI", "+ok")
+		expectReply(t, e, c, "SETBIT s 7 0", "+QUEUED")
+		expectReply(t, e, c, "SETBIT s 15 1", "+QUEUED")
+		expectReply(t, e, c, "SETBIT s 6 1", "+QUEUED")
+		expectReply(t, e, c, "BITFIELD s SET u8 24 66", "+QUEUED")
+		expectReply(t, e, c, "LPUSH l x", "+QUEUED")
+		expectReply(t, e, c, "EXEC", "-ERR injected panic")
+	})
+	expectReply(t, e, c, "GET s", "$1 a")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "MGET k s", "*2 $1 \x02 $1 a")
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"gedis/gedis/proto"
+	"gedis/iface"
+	"sync"
+	"time"
+)
+
+const (
+	// 阻塞期间检查连接是否关闭的间隔
+	blockingCheckInterval = 100 * time.Millisecond
+)
+
+// 记录阻塞在key上的客户端，key有新数据时通知它们重试
+type blockingKeys struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+func newBlockingKeys() *blockingKeys {
+	return &blockingKeys{waiters: make(map[string]map[chan struct{}]struct{})}
+}
+
+func (b *blockingKeys) watch(keys []string) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	for _, key := range keys {
+		waiters, ok := b.waiters[key]
+		if !ok {
+			waiters = make(map[chan struct{}]struct{})
+			b.waiters[key] = waiters
+		}
+		waiters[ch] = struct{}{}
+	}
+	return ch
+}
+
+func (b *blockingKeys) unwatch(keys []string, ch chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, key := range keys {
+		waiters := b.waiters[key]
+		delete(waiters, ch)
+		if len(waiters) == 0 {
+			delete(b.waiters, key)
+		}
+	}
+}
+
+func (b *blockingKeys) signal(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.waiters[key] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// 通知阻塞在key上的客户端
+func (d *DB) signalKeyReady(key string) {
+	d.blocking.signal(key)
+}
+
+// 阻塞命令暂时没有数据时返回该回复，由Engine在不持有锁的情况下等待后重试
+// 在不能阻塞的场景下（如事务中）直接按照超时处理
+type blockedReply struct {
+	keys    []string
+	timeout time.Duration
+	// 重试时执行的命令，不再包含阻塞选项
+	retry [][]byte
+}
+
+func (r *blockedReply) Bytes() []byte {
+	return proto.NewNullMultiBulkReply().Bytes()
+}
+
+// 通知所有阻塞的客户端重试，DB被替换或交换后调用
+func (b *blockingKeys) signalAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, waiters := range b.waiters {
+		for ch := range waiters {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// 等待key有新数据后重试命令，超时或连接关闭时返回nil
+func (e *Engine) waitBlocked(conn iface.Conn, db *DB, blocked *blockedReply) proto.Reply {
+	ch := db.blocking.watch(blocked.keys)
+	defer func() {
+		db.blocking.unwatch(blocked.keys, ch)
+	}()
+
+	var deadline <-chan time.Time
+	if blocked.timeout > 0 {
+		timer := time.NewTimer(blocked.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	ticker := time.NewTicker(blockingCheckInterval)
+	defer ticker.Stop()
+
+	// 持有读锁时确认等待的是当前下标对应的DB再重试，DB被清空或交换后改为等待新的DB，
+	// 之后的清空或交换会通知正在等待的DB，不会错过
+	retry := func() proto.Reply {
+		e.dbMu.RLock()
+		defer e.dbMu.RUnlock()
+		if current := e.selectDb(conn.GetDbIndex()); current != db {
+			db.blocking.unwatch(blocked.keys, ch)
+			db = current
+			ch = db.blocking.watch(blocked.keys)
+		}
+		return db.Exec(conn, blocked.retry)
+	}
+	// 注册之后先重试一次，避免错过注册前写入的数据
+	reply := retry()
+	for {
+		if _, ok := reply.(*proto.NullMultiBulkReply); !ok {
+			return reply
+		}
+		select {
+		case <-ch:
+			reply = retry()
+		case <-deadline:
+			return proto.NewNullMultiBulkReply()
+		case <-ticker.C:
+			if conn.IsClosed() {
+				return proto.NewNullMultiBulkReply()
+			}
+		}
+	}
+}
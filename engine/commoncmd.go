@@ -14,7 +14,7 @@ func execSelect(c iface.Conn, args [][]byte) proto.Reply {
 	if err != nil {
 		return proto.NewGenericErrReply("db index error")
 	}
-	if dbIndex < 0 || dbIndex > maxDbNum {
+	if dbIndex < 0 || dbIndex >= maxDbNum {
 		return proto.NewGenericErrReply("db index out of range")
 	}
 	c.SetDbIndex(int(dbIndex))
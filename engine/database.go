@@ -1,47 +1,99 @@
 package engine
 
 import (
+	"gedis/aof"
 	"gedis/datastruct/dict"
 	"gedis/datastruct/sortedset"
 	"gedis/engine/entity"
 	"gedis/gedis/proto"
 	"gedis/iface"
+	"gedis/tool/locker"
 	"gedis/tool/logger"
 	"gedis/tool/timewheel"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	dataDictSize = 1 << 16
+	lockerSize   = 1 << 10
 )
 
+// 每个DB对象唯一的编号，DB可能被交换或替换，时间轮任务不能按下标区分
+var dbIDGenerator atomic.Uint64
+
+// DB 命令通过它访问数据，数据保存在共享的dbState中，
+// exec为命令所在的执行上下文，为nil时产生的aof直接写入
 type DB struct {
+	*dbState
+	exec *execution
+}
+
+type dbState struct {
+	id    uint64
 	index int
 
 	dataDict *dict.ConcurrentDict
 	ttlDict  *dict.ConcurrentDict
 
-	delay    *timewheel.Delay
-	writeAof func(command [][]byte)
+	// 执行命令时按keyFunc给key加锁
+	locker *locker.Locker
+	// 阻塞等待key的客户端
+	blocking *blockingKeys
+	// 被WATCH的key的版本
+	watched *watchedKeys
+
+	delay   *timewheel.Delay
+	aofSink *aof.AOF
+
+	// 主动过期下一次采样开始的位置
+	expireCursor int
+	stats        *serverStats
 }
 
-func newDB(delay *timewheel.Delay) *DB {
-	db := &DB{
+func newDB(delay *timewheel.Delay, stats *serverStats) *DB {
+	state := &dbState{
+		id:       dbIDGenerator.Add(1),
 		dataDict: dict.NewConcurrentDict(dataDictSize),
 		ttlDict:  dict.NewConcurrentDict(dataDictSize),
+		locker:   locker.NewLocker(lockerSize),
+		blocking: newBlockingKeys(),
+		watched:  newWatchedKeys(),
 		delay:    delay,
+		stats:    stats,
 	}
-	return db
+	return &DB{dbState: state}
 }
 
 func (d *DB) SetIndex(index int) {
 	d.index = index
 }
 
+// 根据命令的keyFunc给涉及的key加锁，多key命令的执行是原子的
+// 命令产生的aof在执行成功后才写入，panic或者返回Abort时撤销已经做出的修改
 func (d *DB) Exec(c iface.Conn, command [][]byte) proto.Reply {
-	//cmdName := strings.ToLower(string(command[0]))
-	return d.execNormalCommand(command)
+	// 脚本中调用的命令，key在脚本开始时已经锁住
+	if run, ok := c.(*scriptRun); ok {
+		return run.exec(d, command)
+	}
+	cmdName := strings.ToLower(string(command[0]))
+	cmd, ok := commandCenter[cmdName]
+	if ok && cmd.keyFunc != nil && validateArgsNum(cmd.argsNum, command) {
+		writeKeys, readKeys := cmd.keyFunc(command[1:])
+		d.locker.RWLocks(writeKeys, readKeys)
+		defer d.locker.RWUnlocks(writeKeys, readKeys)
+	}
+	ex := &execution{}
+	reply := d.withExec(ex).execWithUndo(command)
+	if _, ok := reply.(*abortReply); ok {
+		return unwrapAbort(reply)
+	}
+	if d.aofSink != nil {
+		d.aofSink.SaveCommands(ex.aofIndexes, ex.aofCommands)
+	}
+	return reply
 }
 
 func (d *DB) execNormalCommand(command [][]byte) proto.Reply {
@@ -56,7 +108,17 @@ func (d *DB) execNormalCommand(command [][]byte) proto.Reply {
 	return cmd.execFunc(d, command[1:])
 }
 
+// 获取key对应的数据，同时记录一次访问
 func (d *DB) GetEntity(key string) (*entity.DataEntity, bool) {
+	dataEntity, exist := d.peekEntity(key)
+	if exist {
+		dataEntity.Touch()
+	}
+	return dataEntity, exist
+}
+
+// 获取key对应的数据，不影响访问时间和访问频率，用于查看key的信息
+func (d *DB) peekEntity(key string) (*entity.DataEntity, bool) {
 	val, exist := d.dataDict.Get(key)
 	if !exist {
 		return nil, false
@@ -69,8 +131,32 @@ func (d *DB) GetEntity(key string) (*entity.DataEntity, bool) {
 	return dataEntity, ok
 }
 
+// 获取key对应的数据，已过期的key视为不存在但不会删除
+// 用于不持有key的锁的命令，删除过期的key可能会删掉其他命令刚刚写入的数据
+func (d *DB) peekEntityUnlocked(key string) (*entity.DataEntity, bool) {
+	val, exist := d.dataDict.Get(key)
+	if !exist {
+		return nil, false
+	}
+	if expireTime, hasTTL := d.TTL(key); hasTTL && time.Now().After(expireTime) {
+		return nil, false
+	}
+	dataEntity, ok := val.(*entity.DataEntity)
+	return dataEntity, ok
+}
+
 func (d *DB) PutEntity(key string, e *entity.DataEntity) int {
+	e.Touch()
+	old, existed := d.dataDict.Get(key)
 	d.dataDict.Put(key, e)
+	d.watched.touch(key)
+	d.addUndo(func() {
+		if existed {
+			d.PutEntity(key, old.(*entity.DataEntity))
+		} else {
+			d.Remove(key)
+		}
+	})
 	return 1
 }
 
@@ -81,31 +167,80 @@ func (d *DB) IsExpire(key string) bool {
 	}
 	expireTime := val.(time.Time)
 	isExpire := time.Now().After(expireTime)
-	if isExpire {
-		d.Remove(key)
+	// 并发检查同一个key时只统计一次
+	if isExpire && d.removeExpired(key) > 0 {
+		d.stats.expiredKeys.Add(1)
 	}
 	return isExpire
 }
 
-func (d *DB) Remove(key string) {
-	d.ttlDict.Delete(key)
-	d.dataDict.Delete(key)
+// 删除过期的key，不记录撤销操作，命令被撤销时不会让过期的key重新出现
+func (d *DB) removeExpired(key string) int {
+	if _, deleted := d.ttlDict.Delete(key); deleted > 0 {
+		d.cancelDelay(key)
+	}
+	_, deleted := d.dataDict.Delete(key)
+	if deleted > 0 {
+		d.watched.touch(key)
+	}
+	return deleted
+}
+
+// 删除key，返回删除的个数
+func (d *DB) Remove(key string) int {
+	ttl, ttlDeleted := d.ttlDict.Delete(key)
+	if ttlDeleted > 0 {
+		d.cancelDelay(key)
+	}
+	old, deleted := d.dataDict.Delete(key)
+	if deleted > 0 {
+		d.watched.touch(key)
+		d.addUndo(func() {
+			d.PutEntity(key, old.(*entity.DataEntity))
+			if ttlDeleted > 0 {
+				d.ExpireAt(key, ttl.(time.Time))
+			}
+		})
+	}
+	return deleted
+}
+
+// 获取key的过期时间，没有设置过期时间时返回false
+func (d *DB) TTL(key string) (time.Time, bool) {
+	val, exist := d.ttlDict.Get(key)
+	if !exist {
+		return time.Time{}, false
+	}
+	return val.(time.Time), true
 }
 
 func (d *DB) ExpireAt(key string, expireTime time.Time) {
+	old, hasTTL := d.TTL(key)
+	d.addUndo(func() {
+		if hasTTL {
+			d.ExpireAt(key, old)
+		} else {
+			d.Persist(key)
+		}
+	})
 	d.ttlDict.Put(key, expireTime)
+	d.watched.touch(key)
+	// 时间轮中同一个key只会保留一个任务，需要先取消旧的任务
+	d.cancelDelay(key)
 	d.addDelayAt(key, expireTime)
 }
 
-func genExpireKey(key string) string {
-	return "expire" + key
+func (d *DB) genExpireKey(key string) string {
+	return "expire" + strconv.FormatUint(d.id, 10) + ":" + key
 }
 
 func (d *DB) addDelayAt(key string, expireTime time.Time) {
 	if d.delay != nil {
-		d.delay.AddAt(expireTime, genExpireKey(key), func() {
+		d.delay.AddAt(expireTime, d.genExpireKey(key), func() {
 			logger.Debug("expire: ", key)
-
+			// 与主动过期一样需要持有key的锁，否则检查和删除之间key可能被其他命令重新写入
+			d.locker.Locks(key)
+			defer d.locker.Unlocks(key)
 			d.IsExpire(key)
 		})
 	}
@@ -113,25 +248,40 @@ func (d *DB) addDelayAt(key string, expireTime time.Time) {
 
 func (d *DB) cancelDelay(key string) {
 	if d.delay != nil {
-		d.delay.Cancel(genExpireKey(key))
+		d.delay.Cancel(d.genExpireKey(key))
+	}
+}
+
+// 取消所有的过期任务，DB被清空或替换后调用
+func (d *DB) cancelAllDelay() {
+	for _, key := range d.ttlDict.Keys() {
+		d.cancelDelay(key)
 	}
 }
 
 func (d *DB) Persist(key string) {
-	d.ttlDict.Delete(key)
+	if old, deleted := d.ttlDict.Delete(key); deleted > 0 {
+		d.watched.touch(key)
+		d.addUndo(func() {
+			d.ExpireAt(key, old.(time.Time))
+		})
+	}
 	d.cancelDelay(key)
 }
 
-func (d *DB) getOrInitSortedSetObject(key string) (*sortedset.SortedSet, error, proto.Reply) {
+func (d *DB) getOrInitSortedSetObject(key string) (*sortedset.SortedSet, proto.Reply) {
 	sortedSet, reply := d.getSortedSetObject(key)
-	if sortedSet == nil && reply == nil {
+	if reply != nil {
+		return nil, reply
+	}
+	if sortedSet == nil {
 		sortedSet = sortedset.NewSortedSet()
 		dataEntity := &entity.DataEntity{
 			Object: sortedSet,
 		}
 		d.PutEntity(key, dataEntity)
 	}
-	return sortedSet, nil, reply
+	return sortedSet, nil
 }
 
 func (d *DB) getSortedSetObject(key string) (*sortedset.SortedSet, proto.Reply) {
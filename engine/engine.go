@@ -3,6 +3,7 @@ package engine
 import (
 	"fmt"
 	"gedis/aof"
+	"gedis/config"
 	"gedis/gedis/proto"
 	"gedis/iface"
 	"gedis/pubsub"
@@ -10,6 +11,7 @@ import (
 	"gedis/tool/timewheel"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"sync/atomic"
 )
 
@@ -27,6 +29,17 @@ type Engine struct {
 	aof *aof.AOF
 
 	pubsub *pubsub.Pubsub
+
+	// 访问DB的命令执行期间持有读锁，清空或交换DB时持有写锁，
+	// 保证命令不会在被替换掉的DB上执行，aof中的db下标也不会在写入前被改变
+	dbMu sync.RWMutex
+
+	stats *serverStats
+	// 已加载的脚本以及正在执行的脚本
+	scripts *scriptCache
+	// 主动过期下一次处理的db
+	expireDbIndex int
+	closed        chan struct{}
 }
 
 func NewEngine() *Engine {
@@ -34,8 +47,11 @@ func NewEngine() *Engine {
 	e.delay = timewheel.NewDelay()
 	e.dbSet = make([]*atomic.Value, maxDbNum)
 	e.pubsub = pubsub.NewPubsub()
+	e.stats = newServerStats()
+	e.scripts = newScriptCache()
+	e.closed = make(chan struct{})
 	for i := 0; i < maxDbNum; i++ {
-		db := newDB(e.delay)
+		db := newDB(e.delay, e.stats)
 		db.SetIndex(i)
 		dbset := new(atomic.Value)
 		dbset.Store(db)
@@ -48,47 +64,65 @@ func NewEngine() *Engine {
 	}
 	e.aof = aof_
 	e.aofBindAllDB()
+	// 模块注册的命令可能出现在aof中，需要先加载
+	if err := loadModules(config.Properties.LoadModule); err != nil {
+		panic(err)
+	}
 	e.aof.LoadAof(0)
+	go e.serverCron()
 	return e
 }
 
 func (e *Engine) Close() {
+	close(e.closed)
+	// 时间轮每毫秒推进一次，引擎关闭后不能继续运行
+	e.delay.Stop()
+	e.aof.Close()
+}
 
+// CloseConn 客户端断开连接时调用，释放它WATCH的key并放弃没有执行的事务
+func (e *Engine) CloseConn(conn iface.Conn) {
+	conn.SetMultiState(false)
+	e.unwatchAll(conn)
 }
 
 func (e *Engine) Exec(conn iface.Conn, command [][]byte) (result proto.Reply) {
 	defer func() {
 		if err := recover(); err != nil {
 			logger.Warn(fmt.Sprintf("exec command fail: %v\n%s", err, string(debug.Stack())))
-			result = proto.NewGenericErrReply(err.(string))
+			result = proto.NewGenericErrReply(fmt.Sprint(err))
 		}
 	}()
 	commandName := strings.ToLower(string(command[0]))
-	if commandName == "command" {
-		return proto.NewMultiBulkReply([][]byte{[]byte("ok")})
-	}
-	if commandName == "ping" {
-		return Ping(command[1:])
+	if conn.InMultiState() && !isTxCommand(commandName) {
+		return e.enqueue(conn, command)
 	}
-	if commandName == "auth" {
-		return Auth(command[1:])
+	if cmd, ok := engineCommands[commandName]; ok {
+		if !validateArgsNum(cmd.argsNum, command) {
+			return proto.NewArgNumErrReply(commandName)
+		}
+		unlock := e.lockDBs(cmd.lock)
+		defer unlock()
+		return cmd.exec(e, conn, command[1:])
 	}
 
-	switch commandName {
-	case "select":
-		return execSelect(conn, command[1:])
-	case "subscribe":
-		return e.pubsub.Subscribe(conn, command[1:])
-	case "unsubscribe":
-		return e.pubsub.Unsubscribe(conn, command[1:])
-	case "publish":
-		return e.pubsub.Publish(conn, command[1:])
+	logger.Debugf("db index: %v\n", conn.GetDbIndex())
+	db, reply := e.execInDB(conn, command)
+	if blocked, ok := reply.(*blockedReply); ok {
+		return e.waitBlocked(conn, db, blocked)
 	}
+	return reply
+}
 
-	dbIndex := conn.GetDbIndex()
-	logger.Debugf("db index: %v\n", dbIndex)
-	db := e.selectDb(dbIndex)
-	return db.Exec(conn, command)
+// 在连接当前所在的db中执行命令，执行期间DB不会被清空或交换
+func (e *Engine) execInDB(conn iface.Conn, command [][]byte) (*DB, proto.Reply) {
+	// 脚本中调用的命令，脚本开始时已经持有读锁
+	if _, ok := conn.(*scriptRun); !ok {
+		e.dbMu.RLock()
+		defer e.dbMu.RUnlock()
+	}
+	db := e.selectDb(conn.GetDbIndex())
+	return db, db.Exec(conn, command)
 }
 
 func (e *Engine) selectDb(index int) *DB {
@@ -97,9 +131,11 @@ func (e *Engine) selectDb(index int) *DB {
 
 func (e *Engine) aofBindAllDB() {
 	for _, dbset := range e.dbSet {
-		db := dbset.Load().(*DB)
-		db.writeAof = func(command [][]byte) {
-			e.aof.SaveGedisCommand(db.index, command)
-		}
+		e.aofBindDB(dbset.Load().(*DB))
 	}
 }
+
+// aof使用DB当前的下标记录，DB被交换后下标会跟着变化
+func (e *Engine) aofBindDB(db *DB) {
+	db.aofSink = e.aof
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+// 在临时目录中创建引擎，aof文件写在该目录下，测试结束时关闭
+func newTestEngine(t *testing.T) *Engine {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+	e := NewEngine()
+	t.Cleanup(e.Close)
+	return e
+}
+
+// 用同一个目录下的aof重新创建引擎，原来的引擎在测试结束时关闭
+func reloadTestEngine(t *testing.T, e *Engine) *Engine {
+	reloaded := NewEngine()
+	t.Cleanup(reloaded.Close)
+	return reloaded
+}
+
+// 执行一行以空格分隔的命令，返回去掉换行后的回复
+func testExec(e *Engine, c *gedisconn.VirtualConn, line string) string {
+	fields := strings.Fields(line)
+	args := make([][]byte, len(fields))
+	for i, field := range fields {
+		args[i] = []byte(field)
+	}
+	reply := e.Exec(c, args)
+	return strings.TrimSpace(strings.ReplaceAll(string(reply.Bytes()), "\r\n", " "))
+}
+
+func expectReply(t *testing.T, e *Engine, c *gedisconn.VirtualConn, line, want string) {
+	t.Helper()
+	if got := testExec(e, c, line); got != want {
+		t.Errorf("%s: expected %q, actual %q", line, want, got)
+	}
+}
+
+func readAof(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(aofFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.ToLower(string(data))
+}
+
+// 命令执行以及重新加载aof都需要时间，剩余秒数允许比want少1
+func expectTTL(t *testing.T, e *Engine, c *gedisconn.VirtualConn, key string, want int64) {
+	t.Helper()
+	got := testExec(e, c, "TTL "+key)
+	if got != ":"+strconv.FormatInt(want, 10) && got != ":"+strconv.FormatInt(want-1, 10) {
+		t.Errorf("TTL %s: expected %d, actual %q", key, want, got)
+	}
+}
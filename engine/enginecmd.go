@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"gedis/gedis/proto"
+	"gedis/iface"
+)
+
+// 执行期间对db的加锁方式
+const (
+	// 不访问db中的数据
+	lockNone = iota
+	// 访问db中的数据，执行期间db不会被清空或交换
+	lockShared
+	// 清空或交换db，执行期间独占所有db
+	lockExclusive
+)
+
+type engineExecFunc func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply
+
+// Engine中直接处理的命令，它们不属于某一个db，没有注册在commandCenter中
+type engineCommand struct {
+	exec engineExecFunc
+	// 包含命令名，负数表示至少需要-argsNum个参数
+	argsNum int
+	lock    int
+	// 不能放进事务
+	noMulti bool
+}
+
+var engineCommands = make(map[string]*engineCommand)
+
+func registerEngineCommand(name string, exec engineExecFunc, argsNum int, lock int) *engineCommand {
+	cmd := &engineCommand{exec: exec, argsNum: argsNum, lock: lock}
+	engineCommands[name] = cmd
+	return cmd
+}
+
+// 按照命令的加锁方式对所有db加锁，返回解锁函数
+func (e *Engine) lockDBs(lock int) func() {
+	switch lock {
+	case lockShared:
+		e.dbMu.RLock()
+		return e.dbMu.RUnlock
+	case lockExclusive:
+		e.dbMu.Lock()
+		return e.dbMu.Unlock
+	}
+	return func() {}
+}
+
+// txConn 事务中执行Engine命令时使用的连接，命令通过它在事务的执行上下文中访问db
+type txConn struct {
+	iface.Conn
+	ex *execution
+}
+
+// 获取下标对应的db，事务中的修改会记录撤销操作，aof随事务一起写入
+func (e *Engine) dbFor(conn iface.Conn, index int) *DB {
+	db := e.selectDb(index)
+	if tx, ok := conn.(*txConn); ok {
+		return db.withExec(tx.ex)
+	}
+	return db
+}
+
+// 事务中执行时记录撤销操作，事务回滚时执行
+func addTxUndo(conn iface.Conn, undo func()) {
+	if tx, ok := conn.(*txConn); ok {
+		tx.ex.addUndo(undo)
+	}
+}
+
+func init() {
+	registerEngineCommand("command", func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply {
+		return proto.NewMultiBulkReply([][]byte{[]byte("ok")})
+	}, -1, lockNone)
+	registerEngineCommand("ping", func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply {
+		return Ping(args)
+	}, -1, lockNone)
+	registerEngineCommand("auth", func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply {
+		return Auth(args)
+	}, 2, lockNone)
+	registerEngineCommand("select", func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply {
+		return execSelect(conn, args)
+	}, 2, lockNone)
+
+	// EXEC按照事务中的命令自己加锁
+	registerEngineCommand("multi", (*Engine).execMulti, 1, lockNone)
+	registerEngineCommand("exec", (*Engine).execExec, 1, lockNone)
+	registerEngineCommand("discard", (*Engine).execDiscard, 1, lockNone)
+	registerEngineCommand("watch", (*Engine).execWatch, -2, lockShared)
+	registerEngineCommand("unwatch", (*Engine).execUnwatch, 1, lockNone)
+
+	// 订阅的连接会被记录下来，不能是事务中临时的连接
+	registerEngineCommand("subscribe", func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply {
+		return e.pubsub.Subscribe(conn, args)
+	}, -2, lockNone).noMulti = true
+	registerEngineCommand("unsubscribe", func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply {
+		return e.pubsub.Unsubscribe(conn, args)
+	}, -1, lockNone).noMulti = true
+	registerEngineCommand("publish", func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply {
+		return e.pubsub.Publish(conn, args)
+	}, 3, lockNone)
+
+	registerEngineCommand("info", func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply {
+		return e.info(args)
+	}, -1, lockNone)
+	registerEngineCommand("flushdb", (*Engine).execFlushDB, -1, lockExclusive)
+	registerEngineCommand("flushall", (*Engine).execFlushAll, -1, lockExclusive)
+	registerEngineCommand("swapdb", (*Engine).execSwapDB, 3, lockExclusive)
+	registerEngineCommand("move", (*Engine).execMove, 3, lockShared)
+	registerEngineCommand("copy", (*Engine).execCopy, -3, lockShared)
+	registerEngineCommand("memory", (*Engine).execMemory, -2, lockShared)
+
+	registerEngineCommand("eval", (*Engine).execEval, -3, lockShared)
+	registerEngineCommand("evalsha", (*Engine).execEvalSha, -3, lockShared)
+	registerEngineCommand("script", func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply {
+		return e.execScript(args)
+	}, -2, lockNone)
+	registerEngineCommand("module", func(e *Engine, conn iface.Conn, args [][]byte) proto.Reply {
+		return execModule(args)
+	}, -2, lockNone)
+}
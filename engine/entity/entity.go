@@ -1,5 +1,71 @@
 package entity
 
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// 与Redis一致的LFU参数
+const (
+	// 新key的初始访问频率，避免刚写入就被当成冷数据
+	lfuInitVal = 5
+	// 频率越高增长越慢
+	lfuLogFactor = 10
+	// 每隔多少分钟没有访问，频率衰减1
+	lfuDecayMinutes = 1
+	lfuMaxVal       = 255
+)
+
 type DataEntity struct {
 	Object any
+
+	// 最后访问时间，毫秒时间戳，0表示还没有访问过
+	lastAccess atomic.Int64
+	// 对数计数的访问频率
+	freq atomic.Uint32
+}
+
+// 记录一次访问，更新访问时间和访问频率
+func (e *DataEntity) Touch() {
+	now := time.Now().UnixMilli()
+	counter := e.decayedFreq(now)
+	if counter < lfuMaxVal {
+		base := float64(0)
+		if counter > lfuInitVal {
+			base = float64(counter - lfuInitVal)
+		}
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			counter++
+		}
+	}
+	e.freq.Store(counter)
+	e.lastAccess.Store(now)
+}
+
+// 距离上一次访问的时间
+func (e *DataEntity) IdleTime() time.Duration {
+	lastAccess := e.lastAccess.Load()
+	if lastAccess == 0 {
+		return 0
+	}
+	return time.Since(time.UnixMilli(lastAccess))
+}
+
+// 按照没有访问的时间衰减之后的访问频率
+func (e *DataEntity) Freq() uint8 {
+	return uint8(e.decayedFreq(time.Now().UnixMilli()))
+}
+
+func (e *DataEntity) decayedFreq(now int64) uint32 {
+	lastAccess := e.lastAccess.Load()
+	if lastAccess == 0 {
+		return lfuInitVal
+	}
+	counter := e.freq.Load()
+	periods := uint32((now - lastAccess) / int64(time.Minute/time.Millisecond) / lfuDecayMinutes)
+	if periods >= counter {
+		return 0
+	}
+	return counter - periods
 }
@@ -0,0 +1,30 @@
+package entity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreqDecay(t *testing.T) {
+	e := &DataEntity{}
+	if e.Freq() != lfuInitVal || e.IdleTime() != 0 {
+		t.Fatal("new entity should have the initial freq and no idle time")
+	}
+	e.Touch()
+	if e.Freq() < lfuInitVal {
+		t.Fatalf("unexpected freq %d after touch", e.Freq())
+	}
+	// 每分钟没有访问，频率衰减1
+	e.freq.Store(10)
+	e.lastAccess.Store(time.Now().Add(-3 * time.Minute).UnixMilli())
+	if freq := e.Freq(); freq != 7 {
+		t.Fatalf("expected freq 7, actual %d", freq)
+	}
+	if idle := e.IdleTime(); idle < 3*time.Minute {
+		t.Fatalf("unexpected idle time %v", idle)
+	}
+	e.lastAccess.Store(time.Now().Add(-time.Hour).UnixMilli())
+	if freq := e.Freq(); freq != 0 {
+		t.Fatalf("expected freq 0, actual %d", freq)
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import "gedis/aof"
+
+// execution 一次命令、事务或者脚本的执行过程
+// 其中的命令产生的aof先记录下来，执行成功后由执行者作为一个整体写入；
+// 同时记录撤销每一次修改的操作，失败时按相反的顺序撤销
+type execution struct {
+	aofIndexes  []int
+	aofCommands []aof.Command
+
+	undo []func()
+	// 正在回滚，回滚时做出的修改不再记录
+	undoing bool
+}
+
+// 执行到的位置，回滚到这里时撤销之后的修改
+type executionMark struct {
+	aof  int
+	undo int
+}
+
+func (ex *execution) addAof(index int, command [][]byte) {
+	ex.aofIndexes = append(ex.aofIndexes, index)
+	ex.aofCommands = append(ex.aofCommands, command)
+}
+
+func (ex *execution) addUndo(undo func()) {
+	if !ex.undoing {
+		ex.undo = append(ex.undo, undo)
+	}
+}
+
+func (ex *execution) mark() executionMark {
+	return executionMark{aof: len(ex.aofCommands), undo: len(ex.undo)}
+}
+
+// 撤销mark之后做出的修改，丢弃这期间产生的aof
+func (ex *execution) rollback(mark executionMark) {
+	ex.undoing = true
+	defer func() {
+		ex.undoing = false
+	}()
+	for i := len(ex.undo) - 1; i >= mark.undo; i-- {
+		ex.undo[i]()
+	}
+	ex.undo = ex.undo[:mark.undo]
+	ex.aofIndexes = ex.aofIndexes[:mark.aof]
+	ex.aofCommands = ex.aofCommands[:mark.aof]
+}
+
+// 在执行上下文中访问db，数据仍然是共享的
+func (d *DB) withExec(ex *execution) *DB {
+	return &DB{dbState: d.dbState, exec: ex}
+}
+
+// 在执行上下文中时先记录下来，否则直接写入
+func (d *DB) writeAof(command [][]byte) {
+	if d.exec != nil {
+		d.exec.addAof(d.index, command)
+		return
+	}
+	if d.aofSink != nil {
+		d.aofSink.SaveGedisCommand(d.index, command)
+	}
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"gedis/config"
+	"sync/atomic"
+	"time"
+)
+
+// 与Redis一致的主动过期参数，会根据 active-expire-effort 调整
+const (
+	// 每次从一个db采样的key数
+	activeExpireKeysPerLoop = 20
+	// 每秒最多占用的CPU时间百分比
+	activeExpireCPUPercent = 25
+	// 采样中过期key的比例低于该值时不再继续清理当前db
+	activeExpireAcceptableStale = 10
+	// 每次采样最多访问的分片数为采样key数的倍数，带过期时间的key很少时大部分分片都是空的
+	activeExpireShardsPerKey = 20
+)
+
+type serverStats struct {
+	// 累计删除的过期key数
+	expiredKeys atomic.Int64
+	// 主动过期因为时间预算用完而提前结束的次数
+	expireTimeCapReached atomic.Int64
+	// 主动过期累计耗时
+	expireCycleTime atomic.Int64
+	// 主动过期采样中已过期key的比例，float64
+	expiredStalePerc atomic.Value
+}
+
+func newServerStats() *serverStats {
+	stats := &serverStats{}
+	stats.expiredStalePerc.Store(float64(0))
+	return stats
+}
+
+// 定期执行的后台任务
+func (e *Engine) serverCron() {
+	hz := config.Properties.Hz
+	if hz <= 0 {
+		hz = 10
+	}
+	ticker := time.NewTicker(time.Second / time.Duration(hz))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.activeExpireCycle(hz)
+		case <-e.closed:
+			return
+		}
+	}
+}
+
+// 轮流对每个db采样带过期时间的key，删除已经过期的
+// 过期比例较高时继续清理当前db，直到比例足够低或者用完时间预算
+func (e *Engine) activeExpireCycle(hz int) {
+	effort := config.Properties.ActiveExpireEffort
+	if effort < 1 || effort > 10 {
+		effort = 1
+	}
+	effort--
+	keysPerLoop := activeExpireKeysPerLoop + activeExpireKeysPerLoop/4*effort
+	acceptableStale := activeExpireAcceptableStale - effort
+	timeLimit := time.Second * time.Duration(activeExpireCPUPercent+2*effort) / 100 / time.Duration(hz)
+
+	start := time.Now()
+	var totalSampled, totalExpired int
+	timeCapReached := false
+	for i := 0; i < len(e.dbSet) && !timeCapReached; i++ {
+		db := e.selectDb(e.expireDbIndex)
+		e.expireDbIndex = (e.expireDbIndex + 1) % len(e.dbSet)
+		for db.ttlDict.Count() > 0 {
+			sampled, expired := db.activeExpire(keysPerLoop)
+			totalSampled += sampled
+			totalExpired += expired
+			if time.Since(start) > timeLimit {
+				timeCapReached = true
+				break
+			}
+			// 只访问到空的分片时从保存的游标继续，直到采样到key或者用完时间预算
+			if sampled > 0 && expired*100 <= sampled*acceptableStale {
+				break
+			}
+		}
+	}
+
+	stats := e.stats
+	stats.expireCycleTime.Add(int64(time.Since(start)))
+	if timeCapReached {
+		stats.expireTimeCapReached.Add(1)
+	}
+	// 平滑处理，避免偶然的采样结果导致比例波动
+	current := float64(0)
+	if totalSampled > 0 {
+		current = float64(totalExpired) / float64(totalSampled)
+	}
+	old := stats.expiredStalePerc.Load().(float64)
+	stats.expiredStalePerc.Store(current*0.05 + old*0.95)
+}
+
+// 从上次的位置继续采样，返回采样数和其中已过期的key数
+func (d *DB) activeExpire(count int) (int, int) {
+	keys, next := d.ttlDict.ScanShards(d.expireCursor, count, count*activeExpireShardsPerKey)
+	d.expireCursor = next
+	expired := 0
+	for _, key := range keys {
+		d.locker.Locks(key)
+		if d.IsExpire(key) {
+			expired++
+		}
+		d.locker.Unlocks(key)
+	}
+	return len(keys), expired
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gedis/engine/entity"
+	"gedis/gedis/conn"
+)
+
+// 直接写入字典，不添加时间轮任务，模拟任务丢失的情况
+func putExpiredKey(db *DB, key string) {
+	db.dataDict.Put(key, &entity.DataEntity{Object: []byte("v")})
+	db.ttlDict.Put(key, time.Now().Add(-time.Second))
+}
+
+func TestActiveExpire(t *testing.T) {
+	e := newTestEngine(t)
+	db := e.selectDb(3)
+	for i := 0; i < 5; i++ {
+		putExpiredKey(db, "expired"+strconv.Itoa(i))
+	}
+	for i := 0; i < 100; i++ {
+		db.dataDict.Put("key"+strconv.Itoa(i), &entity.DataEntity{Object: []byte("v")})
+	}
+
+	// 带过期时间的key很少，由后台的主动过期删除，不需要访问这些key
+	deadline := time.Now().Add(2 * time.Second)
+	for db.ttlDict.Count() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := db.ttlDict.Count(); n != 0 {
+		t.Fatalf("%d expired keys are not reclaimed", n)
+	}
+	if n := db.dataDict.Count(); n != 100 {
+		t.Fatalf("expected 100 keys left, actual %d", n)
+	}
+	if n := e.stats.expiredKeys.Load(); n != 5 {
+		t.Fatalf("expected 5 expired keys, actual %d", n)
+	}
+}
+
+func TestActiveExpireBoundedScan(t *testing.T) {
+	db := newDB(nil, newServerStats())
+	// 一次采样最多访问 count*activeExpireShardsPerKey 个分片，下一次从这里继续
+	count := activeExpireKeysPerLoop
+	if sampled, _ := db.activeExpire(count); sampled != 0 || db.expireCursor != count*activeExpireShardsPerKey {
+		t.Fatalf("scan stopped at shard %d", db.expireCursor)
+	}
+	putExpiredKey(db, "a")
+	for i := 0; i < dataDictSize/(count*activeExpireShardsPerKey)+1; i++ {
+		if _, expired := db.activeExpire(count); expired > 0 {
+			return
+		}
+	}
+	t.Fatal("expired key is not sampled after a full pass")
+}
+
+// 时间轮的过期任务与写入同一个key的命令并发时，不能删除新写入的数据
+func TestExpireDelayRace(t *testing.T) {
+	e := newTestEngine(t)
+	db := e.selectDb(0)
+	c := gedisconn.NewVirtualConnection()
+	const keys = 100
+	for round := 0; round < 50; round++ {
+		for i := 0; i < keys; i++ {
+			key := "k" + strconv.Itoa(i)
+			putExpiredKey(db, key)
+			db.addDelayAt(key, time.Now())
+		}
+		for i := 0; i < keys; i++ {
+			testExec(e, c, "SET k"+strconv.Itoa(i)+" v")
+		}
+		// 等待所有的过期任务执行完
+		time.Sleep(20 * time.Millisecond)
+		if n := db.dataDict.Count(); n != keys {
+			t.Fatalf("round %d: %d keys written by SET are deleted", round, keys-n)
+		}
+	}
+}
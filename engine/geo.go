@@ -0,0 +1,472 @@
+package engine
+
+import (
+	"fmt"
+	"gedis/aof"
+	"gedis/datastruct/geohash"
+	"gedis/datastruct/sortedset"
+	"gedis/gedis/proto"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 距离单位与米的换算
+var geoUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"ft": 0.3048,
+	"mi": 1609.34,
+}
+
+func parseGeoUnit(arg []byte) (float64, proto.Reply) {
+	unit, ok := geoUnits[strings.ToLower(string(arg))]
+	if !ok {
+		return 0, proto.NewGenericErrReply("unsupported unit provided. please use M, KM, FT, MI")
+	}
+	return unit, nil
+}
+
+func parseCoordinate(lonArg, latArg []byte) (float64, float64, proto.Reply) {
+	lon, err1 := strconv.ParseFloat(string(lonArg), 64)
+	lat, err2 := strconv.ParseFloat(string(latArg), 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, proto.NewGenericErrReply("value is not a valid float")
+	}
+	if !geohash.ValidCoordinate(lon, lat) {
+		return 0, 0, proto.NewGenericErrReply(fmt.Sprintf("invalid longitude,latitude pair %f,%f", lon, lat))
+	}
+	return lon, lat, nil
+}
+
+func formatCoordinate(v float64) []byte {
+	return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+func formatDistance(distance float64) []byte {
+	return []byte(strconv.FormatFloat(distance, 'f', 4, 64))
+}
+
+// GEOADD key [NX | XX] [CH] longitude latitude member [longitude latitude member ...]
+func cmdGeoAdd(db *DB, args [][]byte) proto.Reply {
+	i := 1
+	var flags [][]byte
+	xx, nx := false, false
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+		default:
+			break loop
+		}
+		flags = append(flags, args[i])
+	}
+	if nx && xx {
+		return proto.NewGenericErrReply("XX and NX options at the same time are not compatible")
+	}
+	rest := args[i:]
+	if len(rest) == 0 || len(rest)%3 != 0 {
+		return proto.NewSyntaxErrReply()
+	}
+
+	// 转换为ZADD执行，分数为经纬度的geohash
+	zaddArgs := make([][]byte, 0, 1+len(flags)+len(rest)/3*2)
+	zaddArgs = append(zaddArgs, args[0])
+	zaddArgs = append(zaddArgs, flags...)
+	for j := 0; j < len(rest); j += 3 {
+		lon, lat, reply := parseCoordinate(rest[j], rest[j+1])
+		if reply != nil {
+			return reply
+		}
+		score := geohash.Encode(lon, lat)
+		zaddArgs = append(zaddArgs, []byte(strconv.FormatUint(score, 10)), rest[j+2])
+	}
+	return cmdZAdd(db, zaddArgs)
+}
+
+// 获取成员的经纬度
+func getGeoPosition(sortedSet *sortedset.SortedSet, member string) (lon, lat float64, ok bool) {
+	if sortedSet == nil {
+		return 0, 0, false
+	}
+	pair, exist := sortedSet.Get(member)
+	if !exist {
+		return 0, 0, false
+	}
+	lon, lat = geohash.Decode(uint64(pair.Score))
+	return lon, lat, true
+}
+
+// GEOPOS key [member [member ...]]
+func cmdGeoPos(db *DB, args [][]byte) proto.Reply {
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	result := make([]proto.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		lon, lat, ok := getGeoPosition(sortedSet, string(member))
+		if !ok {
+			result[i] = proto.NewNullMultiBulkReply()
+			continue
+		}
+		result[i] = proto.NewMultiBulkReply([][]byte{formatCoordinate(lon), formatCoordinate(lat)})
+	}
+	return proto.NewMixReply(result...)
+}
+
+// GEODIST key member1 member2 [M | KM | FT | MI]
+func cmdGeoDist(db *DB, args [][]byte) proto.Reply {
+	if len(args) > 4 {
+		return proto.NewSyntaxErrReply()
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var reply proto.Reply
+		unit, reply = parseGeoUnit(args[3])
+		if reply != nil {
+			return reply
+		}
+	}
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	lon1, lat1, ok1 := getGeoPosition(sortedSet, string(args[1]))
+	lon2, lat2, ok2 := getGeoPosition(sortedSet, string(args[2]))
+	if !ok1 || !ok2 {
+		return proto.NewNullBulkReply()
+	}
+	return proto.NewBulkReply(formatDistance(geohash.Distance(lon1, lat1, lon2, lat2) / unit))
+}
+
+// GEOHASH key [member [member ...]]
+func cmdGeoHash(db *DB, args [][]byte) proto.Reply {
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	result := make([]proto.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		var pair *sortedset.Pair
+		exist := false
+		if sortedSet != nil {
+			pair, exist = sortedSet.Get(string(member))
+		}
+		if !exist {
+			result[i] = proto.NewNullBulkReply()
+			continue
+		}
+		result[i] = proto.NewBulkReply([]byte(geohash.ToString(uint64(pair.Score))))
+	}
+	return proto.NewMixReply(result...)
+}
+
+// GEOSEARCH 的查询条件
+type geoSearchSpec struct {
+	fromMember []byte
+	lon, lat   float64
+	fromLonLat bool
+
+	byRadius bool
+	radius   float64
+	byBox    bool
+	width    float64
+	height   float64
+	unit     float64
+
+	// 1 升序，-1 降序，0 不排序
+	sort  int
+	count int64
+	any   bool
+
+	withCoord bool
+	withDist  bool
+	withHash  bool
+	storeDist bool
+}
+
+type geoPoint struct {
+	member   string
+	score    float64
+	lon, lat float64
+	distance float64
+}
+
+func parseGeoSearchSpec(cmdName string, args [][]byte, store bool) (*geoSearchSpec, proto.Reply) {
+	spec := &geoSearchSpec{}
+	for i := 0; i < len(args); i++ {
+		remain := len(args) - i - 1
+		switch strings.ToUpper(string(args[i])) {
+		case "FROMMEMBER":
+			if remain < 1 || spec.fromLonLat || spec.fromMember != nil {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			spec.fromMember = args[i+1]
+			i++
+		case "FROMLONLAT":
+			if remain < 2 || spec.fromLonLat || spec.fromMember != nil {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			lon, lat, reply := parseCoordinate(args[i+1], args[i+2])
+			if reply != nil {
+				return nil, reply
+			}
+			spec.lon, spec.lat, spec.fromLonLat = lon, lat, true
+			i += 2
+		case "BYRADIUS":
+			if remain < 2 || spec.byRadius || spec.byBox {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			radius, err := strconv.ParseFloat(string(args[i+1]), 64)
+			if err != nil || radius < 0 || math.IsNaN(radius) {
+				return nil, proto.NewGenericErrReply("radius cannot be negative")
+			}
+			unit, reply := parseGeoUnit(args[i+2])
+			if reply != nil {
+				return nil, reply
+			}
+			spec.radius, spec.unit, spec.byRadius = radius, unit, true
+			i += 2
+		case "BYBOX":
+			if remain < 3 || spec.byRadius || spec.byBox {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			width, err1 := strconv.ParseFloat(string(args[i+1]), 64)
+			height, err2 := strconv.ParseFloat(string(args[i+2]), 64)
+			if err1 != nil || err2 != nil || width < 0 || height < 0 {
+				return nil, proto.NewGenericErrReply("height or width cannot be negative")
+			}
+			unit, reply := parseGeoUnit(args[i+3])
+			if reply != nil {
+				return nil, reply
+			}
+			spec.width, spec.height, spec.unit, spec.byBox = width, height, unit, true
+			i += 3
+		case "ASC":
+			spec.sort = 1
+		case "DESC":
+			spec.sort = -1
+		case "COUNT":
+			if remain < 1 {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, proto.NewGenericErrReply("value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return nil, proto.NewGenericErrReply("COUNT must be > 0")
+			}
+			spec.count = count
+			i++
+			if remain >= 2 && strings.ToUpper(string(args[i+1])) == "ANY" {
+				spec.any = true
+				i++
+			}
+		case "WITHCOORD":
+			spec.withCoord = true
+		case "WITHDIST":
+			spec.withDist = true
+		case "WITHHASH":
+			spec.withHash = true
+		case "STOREDIST":
+			if !store {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			spec.storeDist = true
+		default:
+			return nil, proto.NewSyntaxErrReply()
+		}
+	}
+	if spec.fromMember == nil && !spec.fromLonLat {
+		return nil, proto.NewGenericErrReply("exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+	}
+	if !spec.byRadius && !spec.byBox {
+		return nil, proto.NewGenericErrReply("exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+	}
+	if store && (spec.withCoord || spec.withDist || spec.withHash) {
+		return nil, proto.NewGenericErrReply(cmdName + " is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	if spec.any && spec.count == 0 {
+		return nil, proto.NewGenericErrReply("the ANY argument requires COUNT argument")
+	}
+	// 指定了COUNT但不是ANY时，需要按距离排序后截取最近的
+	if spec.count > 0 && !spec.any && spec.sort == 0 {
+		spec.sort = 1
+	}
+	return spec, nil
+}
+
+// 判断点是否在搜索范围内，返回与中心点的距离，单位米
+func (spec *geoSearchSpec) match(lon, lat float64) (float64, bool) {
+	if spec.byRadius {
+		distance := geohash.Distance(spec.lon, spec.lat, lon, lat)
+		return distance, distance <= spec.radius*spec.unit
+	}
+	// 先比较计算量较小的纬度距离
+	height := spec.height * spec.unit
+	width := spec.width * spec.unit
+	if geohash.LatDistance(lat, spec.lat) > height/2 {
+		return 0, false
+	}
+	if geohash.Distance(lon, lat, spec.lon, lat) > width/2 {
+		return 0, false
+	}
+	return geohash.Distance(spec.lon, spec.lat, lon, lat), true
+}
+
+func (spec *geoSearchSpec) search(sortedSet *sortedset.SortedSet) []*geoPoint {
+	var radius, width, height float64
+	if spec.byRadius {
+		radius = spec.radius * spec.unit
+		width, height = radius*2, radius*2
+	} else {
+		width, height = spec.width*spec.unit, spec.height*spec.unit
+		radius = math.Sqrt(width*width+height*height) / 2
+	}
+	lonDelta, latDelta := geohash.BoundingDelta(spec.lat, width, height)
+
+	points := make([]*geoPoint, 0)
+	for _, area := range geohash.CoverAreas(spec.lon, spec.lat, radius, lonDelta, latDelta) {
+		min, max := area.ScoreRange()
+		minBorder := &sortedset.ScoreBorder{Value: float64(min)}
+		maxBorder := &sortedset.ScoreBorder{Value: float64(max), Exclude: true}
+		sortedSet.ForEach(minBorder, maxBorder, 0, -1, false, func(pair *sortedset.Pair) bool {
+			lon, lat := geohash.Decode(uint64(pair.Score))
+			distance, ok := spec.match(lon, lat)
+			if ok {
+				points = append(points, &geoPoint{
+					member:   pair.Member,
+					score:    pair.Score,
+					lon:      lon,
+					lat:      lat,
+					distance: distance,
+				})
+			}
+			// COUNT ANY 找到足够的结果就停止
+			return !spec.any || int64(len(points)) < spec.count
+		})
+		if spec.any && int64(len(points)) >= spec.count {
+			break
+		}
+	}
+
+	if spec.sort != 0 {
+		sort.SliceStable(points, func(i, j int) bool {
+			if spec.sort > 0 {
+				return points[i].distance < points[j].distance
+			}
+			return points[i].distance > points[j].distance
+		})
+	}
+	if spec.count > 0 && int64(len(points)) > spec.count {
+		points = points[:spec.count]
+	}
+	return points
+}
+
+// 确定搜索中心，FROMMEMBER时使用成员的位置
+func (spec *geoSearchSpec) resolveCenter(sortedSet *sortedset.SortedSet) proto.Reply {
+	if spec.fromLonLat {
+		return nil
+	}
+	lon, lat, ok := getGeoPosition(sortedSet, string(spec.fromMember))
+	if !ok {
+		return proto.NewGenericErrReply("could not decode requested zset member")
+	}
+	spec.lon, spec.lat = lon, lat
+	return nil
+}
+
+func (spec *geoSearchSpec) reply(points []*geoPoint) proto.Reply {
+	if !spec.withCoord && !spec.withDist && !spec.withHash {
+		members := make([][]byte, len(points))
+		for i, point := range points {
+			members[i] = []byte(point.member)
+		}
+		return proto.NewMultiBulkReply(members)
+	}
+	result := make([]proto.Reply, len(points))
+	for i, point := range points {
+		item := []proto.Reply{proto.NewBulkReply([]byte(point.member))}
+		if spec.withDist {
+			item = append(item, proto.NewBulkReply(formatDistance(point.distance/spec.unit)))
+		}
+		if spec.withHash {
+			item = append(item, proto.NewIntegerReply(int64(point.score)))
+		}
+		if spec.withCoord {
+			item = append(item, proto.NewMultiBulkReply([][]byte{formatCoordinate(point.lon), formatCoordinate(point.lat)}))
+		}
+		result[i] = proto.NewMixReply(item...)
+	}
+	return proto.NewMixReply(result...)
+}
+
+// GEOSEARCH key <FROMMEMBER member | FROMLONLAT longitude latitude> <BYRADIUS radius <M | KM | FT | MI> | BYBOX width height <M | KM | FT | MI>> [ASC | DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func cmdGeoSearch(db *DB, args [][]byte) proto.Reply {
+	spec, reply := parseGeoSearchSpec("GEOSEARCH", args[1:], false)
+	if reply != nil {
+		return reply
+	}
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return proto.NewEmptyMultiBulkReply()
+	}
+	if reply := spec.resolveCenter(sortedSet); reply != nil {
+		return reply
+	}
+	return spec.reply(spec.search(sortedSet))
+}
+
+// GEOSEARCHSTORE destination source <FROMMEMBER member | FROMLONLAT longitude latitude> <BYRADIUS radius <M | KM | FT | MI> | BYBOX width height <M | KM | FT | MI>> [ASC | DESC] [COUNT count [ANY]] [STOREDIST]
+func cmdGeoSearchStore(db *DB, args [][]byte) proto.Reply {
+	dest := string(args[0])
+	src := string(args[1])
+	spec, reply := parseGeoSearchSpec("GEOSEARCHSTORE", args[2:], true)
+	if reply != nil {
+		return reply
+	}
+
+	sortedSet, reply := db.getSortedSetObject(src)
+	if reply != nil {
+		return reply
+	}
+	var points []*geoPoint
+	if sortedSet != nil {
+		if reply := spec.resolveCenter(sortedSet); reply != nil {
+			return reply
+		}
+		points = spec.search(sortedSet)
+	}
+
+	pairs := make([]*sortedset.Pair, len(points))
+	for i, point := range points {
+		score := point.score
+		if spec.storeDist {
+			score = point.distance / spec.unit
+		}
+		pairs[i] = &sortedset.Pair{Member: point.member, Score: score}
+	}
+	db.storeSortedSet(dest, pairs)
+	db.writeAof(aof.GeoSearchStoreCmd(args...))
+	return proto.NewIntegerReply(int64(len(pairs)))
+}
+
+func init() {
+	registerCommand("GeoAdd", cmdGeoAdd, writeFirstKey, -5)
+	registerCommand("GeoPos", cmdGeoPos, readFirstKey, -2)
+	registerCommand("GeoDist", cmdGeoDist, readFirstKey, -4)
+	registerCommand("GeoHash", cmdGeoHash, readFirstKey, -2)
+	registerCommand("GeoSearch", cmdGeoSearch, readFirstKey, -7)
+	registerCommand("GeoSearchStore", cmdGeoSearchStore, writeFirstReadSecond, -8)
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+func TestGeoAdd(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "GEOADD Sicily 13.361389 38.115556 Palermo 15.087269 37.502669 Catania", ":2")
+	expectReply(t, e, c, "GEOADD Sicily NX 13 38 Palermo 12.758489 38.788135 edge1", ":1")
+	expectReply(t, e, c, "GEOADD Sicily XX 17.241510 38.788135 edge2", ":0")
+	expectReply(t, e, c, "GEOADD Sicily XX CH 13 38 edge1 17.241510 38.788135 edge2", ":1")
+	expectReply(t, e, c, "GEOADD Sicily CH 12.758489 38.788135 edge1 17.241510 38.788135 edge2", ":2")
+	expectReply(t, e, c, "GEOPOS Sicily Palermo none", "*2 *2 $18 13.361389338970184 $16 38.1155563954963 *-1")
+	expectReply(t, e, c, "GEODIST Sicily Palermo Catania", "$11 166274.1516")
+	expectReply(t, e, c, "GEODIST Sicily Palermo Catania km", "$8 166.2742")
+	expectReply(t, e, c, "GEODIST Sicily Palermo none", "$-1")
+	expectReply(t, e, c, "GEOHASH Sicily Palermo Catania none", "*3 $11 sqc8b49rny0 $11 sqdtr74hyu0 $-1")
+	// 坐标保存为有序集合的分数
+	expectReply(t, e, c, "ZSCORE Sicily Palermo", "$16 3479099956230698")
+	expectReply(t, e, c, "TYPE Sicily", "+zset")
+
+	expectReply(t, e, c, "GEOADD Sicily NX XX 13 38 a", "-ERR XX and NX options at the same time are not compatible")
+	expectReply(t, e, c, "GEOADD Sicily 200 38 a", "-ERR invalid longitude,latitude pair 200.000000,38.000000")
+	expectReply(t, e, c, "GEOADD Sicily 13 86 a", "-ERR invalid longitude,latitude pair 13.000000,86.000000")
+	expectReply(t, e, c, "GEOADD Sicily 13 38", "-ERR wrong number of arguments for 'geoadd' command")
+	expectReply(t, e, c, "GEODIST Sicily Palermo Catania yd", "-ERR unsupported unit provided. please use M, KM, FT, MI")
+	expectReply(t, e, c, "SET str x", "+ok")
+	expectReply(t, e, c, "GEOADD str 13 38 a", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func newGeoTestEngine(t *testing.T) (*Engine, *gedisconn.VirtualConn) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "GEOADD Sicily 13.361389 38.115556 Palermo 15.087269 37.502669 Catania", ":2")
+	expectReply(t, e, c, "GEOADD Sicily 12.758489 38.788135 edge1 17.241510 38.788135 edge2", ":2")
+	return e, c
+}
+
+func TestGeoSearch(t *testing.T) {
+	e, c := newGeoTestEngine(t)
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 15 37 BYRADIUS 200 km ASC", "*2 $7 Catania $7 Palermo")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 15 37 BYRADIUS 200 km DESC WITHDIST",
+		"*2 *2 $7 Palermo $8 190.4424 *2 $7 Catania $7 56.4413")
+	// 矩形的四个角到中心的距离超过了宽高的一半
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 15 37 BYBOX 400 400 km ASC WITHCOORD WITHDIST WITHHASH",
+		"*4 *4 $7 Catania $7 56.4413 :3479447370796909 *2 $18 15.087267458438873 $17 37.50266842333162 "+
+			"*4 $7 Palermo $8 190.4424 :3479099956230698 *2 $18 13.361389338970184 $16 38.1155563954963 "+
+			"*4 $5 edge2 $8 279.7403 :3481342659049484 *2 $18 17.241510450839996 $17 38.78813451624225 "+
+			"*4 $5 edge1 $8 279.7405 :3479273021651468 *2 $17 12.75848776102066 $17 38.78813451624225")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 15 37 BYRADIUS 279.7404 km DESC", "*3 $5 edge2 $7 Palermo $7 Catania")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 15 37 BYBOX 100 100 mi DESC", "*1 $7 Catania")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMMEMBER Palermo BYRADIUS 100 km DESC WITHDIST",
+		"*2 *2 $5 edge1 $7 91.4007 *2 $7 Palermo $6 0.0000")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMMEMBER Palermo BYBOX 700000 300000 m ASC", "*4 $7 Palermo $5 edge1 $7 Catania $5 edge2")
+	// COUNT没有ANY时返回最近的count个
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 15 37 BYBOX 400 400 km COUNT 2", "*2 $7 Catania $7 Palermo")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 15 37 BYBOX 400 400 km COUNT 3 DESC", "*3 $5 edge1 $5 edge2 $7 Palermo")
+	if reply := testExec(e, c, "GEOSEARCH Sicily FROMLONLAT 15 37 BYBOX 400 400 km COUNT 2 ANY"); !strings.HasPrefix(reply, "*2 ") {
+		t.Errorf("COUNT 2 ANY: %q", reply)
+	}
+	expectReply(t, e, c, "GEOSEARCH none FROMLONLAT 15 37 BYRADIUS 200 km", "*0")
+	// 删除成员之后不再出现在搜索结果中
+	expectReply(t, e, c, "ZREM Sicily edge1", ":1")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 15 37 BYBOX 400 400 km DESC", "*3 $5 edge2 $7 Palermo $7 Catania")
+
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMMEMBER none BYRADIUS 1 km", "-ERR could not decode requested zset member")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 1 1 COUNT 1", "-ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	expectReply(t, e, c, "GEOSEARCH Sicily BYRADIUS 1 km ASC", "-ERR wrong number of arguments for 'geosearch' command")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 1 1 FROMMEMBER a BYRADIUS 1 km", "-ERR syntax error")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 1 1 BYRADIUS 1 km BYBOX 1 1 km", "-ERR syntax error")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 1 1 BYRADIUS -1 km", "-ERR radius cannot be negative")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 1 1 BYBOX 1 -1 km", "-ERR height or width cannot be negative")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 1 1 BYRADIUS 1 yd", "-ERR unsupported unit provided. please use M, KM, FT, MI")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 1 1 BYRADIUS 1 km COUNT 0", "-ERR COUNT must be > 0")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 200 1 BYRADIUS 1 km", "-ERR invalid longitude,latitude pair 200.000000,1.000000")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 1 1 BYRADIUS 1 km STOREDIST", "-ERR syntax error")
+}
+
+func TestGeoSearchStore(t *testing.T) {
+	e, c := newGeoTestEngine(t)
+	expectReply(t, e, c, "GEOSEARCHSTORE dst Sicily FROMLONLAT 15 37 BYBOX 400 400 km ASC COUNT 3", ":3")
+	expectReply(t, e, c, "ZRANGE dst 0 -1 WITHSCORES",
+		"*6 $7 Palermo $16 3479099956230698 $7 Catania $16 3479447370796909 $5 edge2 $16 3481342659049484")
+	expectReply(t, e, c, "GEOSEARCH dst FROMLONLAT 15 37 BYRADIUS 300 km ASC", "*3 $7 Catania $7 Palermo $5 edge2")
+	// STOREDIST保存的是距离
+	expectReply(t, e, c, "GEOSEARCHSTORE dist Sicily FROMLONLAT 15 37 BYRADIUS 200 km STOREDIST", ":2")
+	expectReply(t, e, c, "ZRANGE dist 0 -1 WITHSCORES", "*4 $7 Catania $17 56.44125787015818 $7 Palermo $18 190.44242984775798")
+	// 结果为空时删除目标key
+	expectReply(t, e, c, "GEOSEARCHSTORE dist Sicily FROMLONLAT 0 0 BYRADIUS 1 km", ":0")
+	expectReply(t, e, c, "EXISTS dist", ":0")
+	expectReply(t, e, c, "GEOSEARCHSTORE dist none FROMLONLAT 0 0 BYRADIUS 1 km", ":0")
+
+	expectReply(t, e, c, "GEOSEARCHSTORE d Sicily FROMLONLAT 1 1 BYRADIUS 1 km WITHDIST",
+		"-ERR GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	expectReply(t, e, c, "SET str x", "+ok")
+	expectReply(t, e, c, "GEOSEARCHSTORE d str FROMLONLAT 1 1 BYRADIUS 1 km", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "GEOPOS Sicily Palermo", "*1 *2 $18 13.361389338970184 $16 38.1155563954963")
+	expectReply(t, e, c, "GEOSEARCH Sicily FROMLONLAT 15 37 BYRADIUS 200 km ASC WITHDIST",
+		"*2 *2 $7 Catania $7 56.4413 *2 $7 Palermo $8 190.4424")
+	expectReply(t, e, c, "ZRANGE dst 0 -1", "*3 $7 Palermo $7 Catania $5 edge2")
+	expectReply(t, e, c, "EXISTS dist", ":0")
+}
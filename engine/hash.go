@@ -0,0 +1,370 @@
+package engine
+
+import (
+	"gedis/aof"
+	"gedis/datastruct/hash"
+	"gedis/engine/entity"
+	"gedis/gedis/proto"
+	"math"
+	"strconv"
+	"strings"
+)
+
+func (d *DB) getHashObject(key string) (*hash.Hash, proto.Reply) {
+	dataEntity, exist := d.GetEntity(key)
+	if !exist {
+		return nil, nil
+	}
+	h, ok := dataEntity.Object.(*hash.Hash)
+	if !ok {
+		return nil, proto.NewWrongTypeErrReply()
+	}
+	return h, nil
+}
+
+func (d *DB) getOrInitHashObject(key string) (*hash.Hash, proto.Reply) {
+	h, reply := d.getHashObject(key)
+	if reply != nil {
+		return nil, reply
+	}
+	if h == nil {
+		h = hash.NewHash()
+		d.PutEntity(key, &entity.DataEntity{Object: h})
+	}
+	return h, nil
+}
+
+// 设置字段的值，记录旧值用于撤销
+func (d *DB) hashSet(key string, h *hash.Hash, field string, value []byte) int {
+	old, existed := h.Get(field)
+	result := h.Set(field, value)
+	d.Modified(key, func() {
+		if existed {
+			h.Set(field, old)
+		} else {
+			h.Delete(field)
+		}
+	})
+	return result
+}
+
+// 删除字段，记录被删除的值用于撤销
+func (d *DB) hashDelete(key string, h *hash.Hash, field string) int {
+	old, existed := h.Get(field)
+	if !existed {
+		return 0
+	}
+	h.Delete(field)
+	d.Modified(key, func() {
+		h.Set(field, old)
+	})
+	return 1
+}
+
+// HSET key field value [field value ...]
+func cmdHSet(db *DB, args [][]byte) proto.Reply {
+	if len(args)%2 != 1 {
+		return proto.NewArgNumErrReply("hset")
+	}
+	key := string(args[0])
+	h, reply := db.getOrInitHashObject(key)
+	if reply != nil {
+		return reply
+	}
+	var added int64
+	for i := 1; i < len(args); i += 2 {
+		added += int64(db.hashSet(key, h, string(args[i]), args[i+1]))
+	}
+	db.writeAof(aof.HSetCmd(args...))
+	return proto.NewIntegerReply(added)
+}
+
+// HSETNX key field value
+func cmdHSetNX(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	h, reply := db.getOrInitHashObject(key)
+	if reply != nil {
+		return reply
+	}
+	if h.Exists(field) {
+		return proto.NewIntegerReply(0)
+	}
+	db.hashSet(key, h, field, args[2])
+	db.writeAof(aof.HSetNXCmd(args...))
+	return proto.NewIntegerReply(1)
+}
+
+// HGET key field
+func cmdHGet(db *DB, args [][]byte) proto.Reply {
+	h, reply := db.getHashObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if h == nil {
+		return proto.NewNullBulkReply()
+	}
+	value, exist := h.Get(string(args[1]))
+	if !exist {
+		return proto.NewNullBulkReply()
+	}
+	return proto.NewBulkReply(value)
+}
+
+// HMGET key field [field ...]
+func cmdHMGet(db *DB, args [][]byte) proto.Reply {
+	h, reply := db.getHashObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	result := make([][]byte, len(args)-1)
+	if h == nil {
+		return proto.NewMultiBulkReply(result)
+	}
+	for i, field := range args[1:] {
+		value, exist := h.Get(string(field))
+		if exist {
+			result[i] = value
+		}
+	}
+	return proto.NewMultiBulkReply(result)
+}
+
+// HDEL key field [field ...]
+func cmdHDel(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	h, reply := db.getHashObject(key)
+	if reply != nil {
+		return reply
+	}
+	if h == nil {
+		return proto.NewIntegerReply(0)
+	}
+	var deleted int64
+	for _, field := range args[1:] {
+		deleted += int64(db.hashDelete(key, h, string(field)))
+	}
+	if h.Len() == 0 {
+		db.Remove(key)
+	}
+	if deleted > 0 {
+		db.writeAof(aof.HDelCmd(args...))
+	}
+	return proto.NewIntegerReply(deleted)
+}
+
+// HEXISTS key field
+func cmdHExists(db *DB, args [][]byte) proto.Reply {
+	h, reply := db.getHashObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if h == nil || !h.Exists(string(args[1])) {
+		return proto.NewIntegerReply(0)
+	}
+	return proto.NewIntegerReply(1)
+}
+
+// HLEN key
+func cmdHLen(db *DB, args [][]byte) proto.Reply {
+	h, reply := db.getHashObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if h == nil {
+		return proto.NewIntegerReply(0)
+	}
+	return proto.NewIntegerReply(int64(h.Len()))
+}
+
+// HSTRLEN key field
+func cmdHStrLen(db *DB, args [][]byte) proto.Reply {
+	h, reply := db.getHashObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if h == nil {
+		return proto.NewIntegerReply(0)
+	}
+	value, _ := h.Get(string(args[1]))
+	return proto.NewIntegerReply(int64(len(value)))
+}
+
+// HKEYS key
+func cmdHKeys(db *DB, args [][]byte) proto.Reply {
+	h, reply := db.getHashObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if h == nil {
+		return proto.NewEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, h.Len())
+	h.ForEach(func(field string, value []byte) bool {
+		result = append(result, []byte(field))
+		return true
+	})
+	return proto.NewMultiBulkReply(result)
+}
+
+// HVALS key
+func cmdHVals(db *DB, args [][]byte) proto.Reply {
+	h, reply := db.getHashObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if h == nil {
+		return proto.NewEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, h.Len())
+	h.ForEach(func(field string, value []byte) bool {
+		result = append(result, value)
+		return true
+	})
+	return proto.NewMultiBulkReply(result)
+}
+
+// HGETALL key
+func cmdHGetAll(db *DB, args [][]byte) proto.Reply {
+	h, reply := db.getHashObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if h == nil {
+		return proto.NewEmptyMultiBulkReply()
+	}
+	result := make([][]byte, 0, h.Len()*2)
+	h.ForEach(func(field string, value []byte) bool {
+		result = append(result, []byte(field), value)
+		return true
+	})
+	return proto.NewMultiBulkReply(result)
+}
+
+// HINCRBY key field increment
+func cmdHIncrBy(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	h, reply := db.getOrInitHashObject(key)
+	if reply != nil {
+		return reply
+	}
+	var current int64
+	if value, exist := h.Get(field); exist {
+		current, err = strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return proto.NewGenericErrReply("hash value is not an integer")
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return proto.NewGenericErrReply("increment or decrement would overflow")
+	}
+	current += delta
+	db.hashSet(key, h, field, []byte(strconv.FormatInt(current, 10)))
+	db.writeAof(aof.HIncrByCmd(args...))
+	return proto.NewIntegerReply(current)
+}
+
+// HINCRBYFLOAT key field increment
+func cmdHIncrByFloat(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return proto.NewGenericErrReply("value is not a valid float")
+	}
+	h, reply := db.getOrInitHashObject(key)
+	if reply != nil {
+		return reply
+	}
+	var current float64
+	if value, exist := h.Get(field); exist {
+		current, err = strconv.ParseFloat(string(value), 64)
+		if err != nil {
+			return proto.NewGenericErrReply("hash value is not a float")
+		}
+	}
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return proto.NewGenericErrReply("increment would produce NaN or Infinity")
+	}
+	value := []byte(strconv.FormatFloat(current, 'f', -1, 64))
+	db.hashSet(key, h, field, value)
+	// 记录计算结果，避免回放时浮点误差
+	db.writeAof(aof.HSetCmd(args[0], args[1], value))
+	return proto.NewBulkReply(value)
+}
+
+// HRANDFIELD key [count [WITHVALUES]]
+func cmdHRandField(db *DB, args [][]byte) proto.Reply {
+	if len(args) > 3 {
+		return proto.NewSyntaxErrReply()
+	}
+	h, reply := db.getHashObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if len(args) == 1 {
+		if h == nil {
+			return proto.NewNullBulkReply()
+		}
+		fields := h.RandomFields(1)
+		return proto.NewBulkReply([]byte(fields[0]))
+	}
+
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHVALUES" {
+			return proto.NewSyntaxErrReply()
+		}
+		withValues = true
+	}
+	if reply := checkRandCount(count, withValues); reply != nil {
+		return reply
+	}
+	if h == nil || count == 0 {
+		return proto.NewEmptyMultiBulkReply()
+	}
+
+	var fields []string
+	if count > 0 {
+		fields = h.RandomDistinctFields(int(count))
+	} else {
+		// 负数允许重复
+		fields = h.RandomFields(int(-count))
+	}
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		result = append(result, []byte(field))
+		if withValues {
+			value, _ := h.Get(field)
+			result = append(result, value)
+		}
+	}
+	return proto.NewMultiBulkReply(result)
+}
+
+func init() {
+	registerCommand("HSet", cmdHSet, writeFirstKey, -4)
+	registerCommand("HSetNX", cmdHSetNX, writeFirstKey, 4)
+	registerCommand("HGet", cmdHGet, readFirstKey, 3)
+	registerCommand("HMGet", cmdHMGet, readFirstKey, -3)
+	registerCommand("HDel", cmdHDel, writeFirstKey, -3)
+	registerCommand("HExists", cmdHExists, readFirstKey, 3)
+	registerCommand("HLen", cmdHLen, readFirstKey, 2)
+	registerCommand("HStrLen", cmdHStrLen, readFirstKey, 3)
+	registerCommand("HKeys", cmdHKeys, readFirstKey, 2)
+	registerCommand("HVals", cmdHVals, readFirstKey, 2)
+	registerCommand("HGetAll", cmdHGetAll, readFirstKey, 2)
+	registerCommand("HIncrBy", cmdHIncrBy, writeFirstKey, 4)
+	registerCommand("HIncrByFloat", cmdHIncrByFloat, writeFirstKey, 4)
+	registerCommand("HRandField", cmdHRandField, readFirstKey, -2)
+}
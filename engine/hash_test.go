@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+func TestHashCommands(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "HSET h a 1 b 2", ":2")
+	expectReply(t, e, c, "HSET h a 3 c 4", ":1")
+	expectReply(t, e, c, "HSET h a", "-ERR wrong number of arguments for 'hset' command")
+	expectReply(t, e, c, "HSETNX h a 5", ":0")
+	expectReply(t, e, c, "HSETNX h d 5", ":1")
+	expectReply(t, e, c, "HGET h a", "$1 3")
+	expectReply(t, e, c, "HGET h x", "$-1")
+	expectReply(t, e, c, "HMGET h a x c", "*3 $1 3 $-1 $1 4")
+	expectReply(t, e, c, "HLEN h", ":4")
+	expectReply(t, e, c, "HSTRLEN h a", ":1")
+	expectReply(t, e, c, "HDEL h a x", ":1")
+	expectReply(t, e, c, "HEXISTS h a", ":0")
+	expectReply(t, e, c, "HDEL h b c d", ":3")
+	expectReply(t, e, c, "EXISTS h", ":0")
+
+	expectReply(t, e, c, "SET s x", "+ok")
+	expectReply(t, e, c, "HGET s a", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestHashIncr(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "HINCRBY h n 5", ":5")
+	expectReply(t, e, c, "HINCRBY h n -7", ":-2")
+	expectReply(t, e, c, "HINCRBY h n x", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "HSET h big 9223372036854775807", ":1")
+	expectReply(t, e, c, "HINCRBY h big 1", "-ERR increment or decrement would overflow")
+	expectReply(t, e, c, "HGET h big", "$19 9223372036854775807")
+	expectReply(t, e, c, "HSET h s abc", ":1")
+	expectReply(t, e, c, "HINCRBY h s 1", "-ERR hash value is not an integer")
+
+	expectReply(t, e, c, "HINCRBYFLOAT h f 10.5", "$4 10.5")
+	expectReply(t, e, c, "HINCRBYFLOAT h f 0.1", "$4 10.6")
+	expectReply(t, e, c, "HINCRBYFLOAT h f inf", "-ERR value is not a valid float")
+	expectReply(t, e, c, "HINCRBYFLOAT h s 1", "-ERR hash value is not a float")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "HMGET h n big f", "*3 $2 -2 $19 9223372036854775807 $4 10.6")
+	expectReply(t, e, c, "HLEN h", ":4")
+}
+
+func TestHashRandField(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "HRANDFIELD h", "$-1")
+	expectReply(t, e, c, "HRANDFIELD h 3", "*0")
+	expectReply(t, e, c, "HSET h a 1", ":1")
+	expectReply(t, e, c, "HRANDFIELD h", "$1 a")
+	expectReply(t, e, c, "HRANDFIELD h 5", "*1 $1 a")
+	expectReply(t, e, c, "HRANDFIELD h 1 WITHVALUES", "*2 $1 a $1 1")
+	// 负数允许重复，返回的个数与字段数无关
+	expectReply(t, e, c, "HRANDFIELD h -3", "*3 $1 a $1 a $1 a")
+	expectReply(t, e, c, "HRANDFIELD h -2 WITHVALUES", "*4 $1 a $1 1 $1 a $1 1")
+	expectReply(t, e, c, "HRANDFIELD h -9223372036854775808", "-ERR value is out of range")
+	expectReply(t, e, c, "HRANDFIELD h -9000000 WITHVALUES", "-ERR value is out of range")
+	expectReply(t, e, c, "HRANDFIELD h 1 VALUES", "-ERR syntax error")
+}
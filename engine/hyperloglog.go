@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"gedis/aof"
+	"gedis/datastruct/hyperloglog"
+	"gedis/engine/entity"
+	"gedis/gedis/proto"
+)
+
+func (d *DB) getHyperLogLog(key string) (*hyperloglog.HyperLogLog, proto.Reply) {
+	value, reply := d.getStringObject(key)
+	if reply != nil {
+		return nil, reply
+	}
+	if value == nil {
+		return nil, nil
+	}
+	h, err := hyperloglog.Parse(value)
+	if err == hyperloglog.ErrCorrupted {
+		return nil, proto.NewSimpleErrReply("INVALIDOBJ Corrupted HLL object detected")
+	}
+	if err != nil {
+		return nil, proto.NewSimpleErrReply("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	}
+	return h, nil
+}
+
+// 以Redis的格式保存为字符串，保留原有的过期时间
+func (d *DB) putHyperLogLog(key string, h *hyperloglog.HyperLogLog) {
+	d.PutEntity(key, &entity.DataEntity{Object: h.Bytes()})
+}
+
+// PFADD key [element [element ...]]
+func cmdPFAdd(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	h, reply := db.getHyperLogLog(key)
+	if reply != nil {
+		return reply
+	}
+	updated := false
+	if h == nil {
+		h = hyperloglog.New()
+		updated = true
+	}
+	for _, element := range args[1:] {
+		if h.Add(element) {
+			updated = true
+		}
+	}
+	if !updated {
+		return proto.NewIntegerReply(0)
+	}
+	db.putHyperLogLog(key, h)
+	db.writeAof(aof.PFAddCmd(args...))
+	return proto.NewIntegerReply(1)
+}
+
+// PFCOUNT key [key ...]
+func cmdPFCount(db *DB, args [][]byte) proto.Reply {
+	if len(args) == 1 {
+		key := string(args[0])
+		h, reply := db.getHyperLogLog(key)
+		if reply != nil {
+			return reply
+		}
+		if h == nil {
+			return proto.NewIntegerReply(0)
+		}
+		if h.CacheValid() {
+			return proto.NewIntegerReply(int64(h.Count()))
+		}
+		// 计算后把基数缓存到字符串头部，与Redis一致
+		count := h.Count()
+		db.putHyperLogLog(key, h)
+		return proto.NewIntegerReply(int64(count))
+	}
+
+	keys := toStrings(args)
+
+	merged := hyperloglog.New()
+	for _, key := range keys {
+		h, reply := db.getHyperLogLog(key)
+		if reply != nil {
+			return reply
+		}
+		if h != nil {
+			merged.Merge(h)
+		}
+	}
+	return proto.NewIntegerReply(int64(merged.Count()))
+}
+
+// PFMERGE destkey [sourcekey [sourcekey ...]]
+func cmdPFMerge(db *DB, args [][]byte) proto.Reply {
+	dest := string(args[0])
+	keys := toStrings(args[1:])
+
+	merged, reply := db.getHyperLogLog(dest)
+	if reply != nil {
+		return reply
+	}
+	if merged == nil {
+		merged = hyperloglog.New()
+	}
+	for _, key := range keys {
+		h, reply := db.getHyperLogLog(key)
+		if reply != nil {
+			return reply
+		}
+		if h != nil {
+			merged.Merge(h)
+		}
+	}
+	db.putHyperLogLog(dest, merged)
+	db.writeAof(aof.PFMergeCmd(args...))
+	return proto.NewOkReply()
+}
+
+func init() {
+	registerCommand("PFAdd", cmdPFAdd, writeFirstKey, -2)
+	registerCommand("PFCount", cmdPFCount, writeAllKeys, -2)
+	registerCommand("PFMerge", cmdPFMerge, writeFirstReadOthers, -2)
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+func TestPFAddCount(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "PFADD h1 a b c d", ":1")
+	// 所有寄存器都没有变化时返回0
+	expectReply(t, e, c, "PFADD h1 a b", ":0")
+	expectReply(t, e, c, "PFADD h1 e", ":1")
+	// 不带元素时只有创建key才返回1
+	expectReply(t, e, c, "PFADD empty", ":1")
+	expectReply(t, e, c, "PFADD empty", ":0")
+	expectReply(t, e, c, "PFCOUNT h1", ":5")
+	expectReply(t, e, c, "PFCOUNT empty", ":0")
+	expectReply(t, e, c, "PFCOUNT none", ":0")
+	expectReply(t, e, c, "EXISTS none", ":0")
+
+	// 多个key时计算并集的基数，不修改任何key
+	expectReply(t, e, c, "PFADD h2 d e f g", ":1")
+	expectReply(t, e, c, "PFCOUNT h1 h2", ":7")
+	expectReply(t, e, c, "PFCOUNT h1 h2 none empty", ":7")
+	expectReply(t, e, c, "PFCOUNT h2", ":4")
+
+	// 保存为字符串
+	expectReply(t, e, c, "TYPE h1", "+string")
+	expectReply(t, e, c, "GETRANGE h1 0 3", "$4 HYLL")
+	expectReply(t, e, c, "SET str notahll", "+ok")
+	expectReply(t, e, c, "PFADD str a", "-WRONGTYPE Key is not a valid HyperLogLog string value.")
+	expectReply(t, e, c, "PFCOUNT str", "-WRONGTYPE Key is not a valid HyperLogLog string value.")
+	expectReply(t, e, c, "PFCOUNT h1 str", "-WRONGTYPE Key is not a valid HyperLogLog string value.")
+	expectReply(t, e, c, "RPUSH l a", ":1")
+	expectReply(t, e, c, "PFADD l a", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	expectReply(t, e, c, "PFADD", "-ERR wrong number of arguments for 'pfadd' command")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "PFCOUNT h1", ":5")
+	expectReply(t, e, c, "PFCOUNT h1 h2", ":7")
+	expectReply(t, e, c, "EXISTS empty", ":1")
+	expectReply(t, e, c, "PFADD h1 a", ":0")
+}
+
+func TestPFMerge(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "PFADD h1 a b c", ":1")
+	expectReply(t, e, c, "PFADD h2 c d e", ":1")
+	expectReply(t, e, c, "PFADD dst x y", ":1")
+	expectReply(t, e, c, "EXPIRE dst 100", ":1")
+	// 目标key已经存在时与源key合并，保留过期时间
+	expectReply(t, e, c, "PFMERGE dst h1 h2 none", "+ok")
+	expectReply(t, e, c, "PFCOUNT dst", ":7")
+	expectTTL(t, e, c, "dst", 100)
+	expectReply(t, e, c, "PFCOUNT h1", ":3")
+	// 没有源key时创建空的目标key
+	expectReply(t, e, c, "PFMERGE new", "+ok")
+	expectReply(t, e, c, "PFCOUNT new", ":0")
+	expectReply(t, e, c, "EXISTS new", ":1")
+	expectReply(t, e, c, "PFMERGE h1 h1", "+ok")
+	expectReply(t, e, c, "PFCOUNT h1", ":3")
+
+	expectReply(t, e, c, "SET str notahll", "+ok")
+	expectReply(t, e, c, "PFMERGE dst str", "-WRONGTYPE Key is not a valid HyperLogLog string value.")
+	expectReply(t, e, c, "PFMERGE str h1", "-WRONGTYPE Key is not a valid HyperLogLog string value.")
+	expectReply(t, e, c, "GET str", "$7 notahll")
+	expectReply(t, e, c, "PFCOUNT dst", ":7")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "PFCOUNT dst", ":7")
+	expectTTL(t, e, c, "dst", 100)
+	expectReply(t, e, c, "PFCOUNT new", ":0")
+	expectReply(t, e, c, "PFCOUNT h1 h2", ":5")
+}
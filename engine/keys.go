@@ -2,31 +2,438 @@ package engine
 
 import (
 	"gedis/aof"
+	"gedis/datastruct/bitmap"
+	"gedis/datastruct/hash"
+	"gedis/datastruct/list"
+	"gedis/datastruct/set"
+	"gedis/datastruct/sortedset"
+	"gedis/datastruct/stream"
 	"gedis/gedis/proto"
+	"gedis/util"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func execExpire(db *DB, args [][]byte) proto.Reply {
-	if len(args) < 2 || len(args) > 3 {
-		return proto.NewArgNumErrReply("expire")
+const (
+	expireNX = 1 << iota
+	expireXX
+	expireGT
+	expireLT
+)
+
+// 解析 NX | XX | GT | LT
+func parseExpireFlags(args [][]byte) (int, proto.Reply) {
+	flags := 0
+	for _, arg := range args {
+		switch strings.ToUpper(string(arg)) {
+		case "NX":
+			flags |= expireNX
+		case "XX":
+			flags |= expireXX
+		case "GT":
+			flags |= expireGT
+		case "LT":
+			flags |= expireLT
+		default:
+			return 0, proto.NewGenericErrReply("Unsupported option " + string(arg))
+		}
+	}
+	if flags&expireNX != 0 && flags&(expireXX|expireGT|expireLT) != 0 {
+		return 0, proto.NewGenericErrReply("NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if flags&expireGT != 0 && flags&expireLT != 0 {
+		return 0, proto.NewGenericErrReply("GT and LT options at the same time are not compatible")
+	}
+	return flags, nil
+}
+
+// 判断是否满足NX等条件，没有过期时间视为永不过期
+func checkExpireFlags(flags int, expireAt time.Time, oldExpireAt time.Time, hasTTL bool) bool {
+	switch {
+	case flags&expireNX != 0:
+		return !hasTTL
+	case flags&expireXX != 0 && !hasTTL:
+		return false
+	case flags&expireGT != 0:
+		return hasTTL && expireAt.After(oldExpireAt)
+	case flags&expireLT != 0:
+		return !hasTTL || expireAt.Before(oldExpireAt)
 	}
+	return true
+}
+
+// unit为时间单位对应的毫秒数，absolute表示参数是unix时间戳
+func execExpire(db *DB, args [][]byte, cmdName string, unit int64, absolute bool) proto.Reply {
 	key := string(args[0])
-	seconds, err := strconv.ParseInt(string(args[1]), 10, 64)
-	if err != nil || seconds < 0 {
-		return proto.NewGenericErrReply("invalid expire time")
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
 	}
-	_, exist := db.GetEntity(key)
-	if !exist {
+	flags, reply := parseExpireFlags(args[2:])
+	if reply != nil {
+		return reply
+	}
+
+	invalidReply := proto.NewGenericErrReply("invalid expire time in '" + cmdName + "' command")
+	if ttl > math.MaxInt64/unit || ttl < math.MinInt64/unit {
+		return invalidReply
+	}
+	ms := ttl * unit
+	if !absolute {
+		now := time.Now().UnixMilli()
+		// now为正数，比较时不能用 math.MinInt64-now，会溢出
+		if (ms > 0 && ms > math.MaxInt64-now) || (ms < 0 && now < math.MinInt64-ms) {
+			return invalidReply
+		}
+		ms += now
+	}
+	expireAt := time.UnixMilli(ms)
+
+	if _, exist := db.GetEntity(key); !exist {
+		return proto.NewIntegerReply(0)
+	}
+	oldExpireAt, hasTTL := db.TTL(key)
+	if !checkExpireFlags(flags, expireAt, oldExpireAt, hasTTL) {
 		return proto.NewIntegerReply(0)
 	}
 
-	// todo 暂时不处理nx等情况
-	db.ExpireAt(key, time.Now().Add(time.Duration(seconds)*time.Second))
-	db.writeAof(aof.ExpireAtCmd(key, seconds))
+	// 过期时间已经过去，直接删除
+	if !expireAt.After(time.Now()) {
+		db.Remove(key)
+		db.writeAof(aof.DelCmd(args[0]))
+		return proto.NewIntegerReply(1)
+	}
+	db.ExpireAt(key, expireAt)
+	db.writeAof(aof.PExpireAtCmd(key, expireAt))
+	return proto.NewIntegerReply(1)
+}
+
+// EXPIRE key seconds [NX | XX | GT | LT]
+func cmdExpire(db *DB, args [][]byte) proto.Reply {
+	return execExpire(db, args, "expire", 1000, false)
+}
+
+// PEXPIRE key milliseconds [NX | XX | GT | LT]
+func cmdPExpire(db *DB, args [][]byte) proto.Reply {
+	return execExpire(db, args, "pexpire", 1, false)
+}
+
+// EXPIREAT key unix-time-seconds [NX | XX | GT | LT]
+func cmdExpireAt(db *DB, args [][]byte) proto.Reply {
+	return execExpire(db, args, "expireat", 1000, true)
+}
+
+// PEXPIREAT key unix-time-milliseconds [NX | XX | GT | LT]
+func cmdPExpireAt(db *DB, args [][]byte) proto.Reply {
+	return execExpire(db, args, "pexpireat", 1, true)
+}
+
+// 返回key的过期时间，key不存在返回-2，没有过期时间返回-1
+// convert把过期时间转换为需要返回的值
+func execTTL(db *DB, key string, convert func(expireAt time.Time) int64) proto.Reply {
+	if _, exist := db.GetEntity(key); !exist {
+		return proto.NewIntegerReply(-2)
+	}
+	expireAt, hasTTL := db.TTL(key)
+	if !hasTTL {
+		return proto.NewIntegerReply(-1)
+	}
+	return proto.NewIntegerReply(convert(expireAt))
+}
+
+// TTL key
+func cmdTTL(db *DB, args [][]byte) proto.Reply {
+	return execTTL(db, string(args[0]), func(expireAt time.Time) int64 {
+		// 四舍五入到秒
+		return (time.Until(expireAt).Milliseconds() + 500) / 1000
+	})
+}
+
+// PTTL key
+func cmdPTTL(db *DB, args [][]byte) proto.Reply {
+	return execTTL(db, string(args[0]), func(expireAt time.Time) int64 {
+		return time.Until(expireAt).Milliseconds()
+	})
+}
+
+// EXPIRETIME key
+func cmdExpireTime(db *DB, args [][]byte) proto.Reply {
+	return execTTL(db, string(args[0]), func(expireAt time.Time) int64 {
+		return expireAt.Unix()
+	})
+}
+
+// PEXPIRETIME key
+func cmdPExpireTime(db *DB, args [][]byte) proto.Reply {
+	return execTTL(db, string(args[0]), func(expireAt time.Time) int64 {
+		return expireAt.UnixMilli()
+	})
+}
+
+// PERSIST key
+func cmdPersist(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	if _, exist := db.GetEntity(key); !exist {
+		return proto.NewIntegerReply(0)
+	}
+	if _, hasTTL := db.TTL(key); !hasTTL {
+		return proto.NewIntegerReply(0)
+	}
+	db.Persist(key)
+	db.writeAof(aof.PersistCmd(args...))
+	return proto.NewIntegerReply(1)
+}
+
+// 对象对应的类型名称
+func getType(object any) string {
+	switch obj := object.(type) {
+	case []byte, bitmap.BitMap:
+		return "string"
+	case *list.QuickList:
+		return "list"
+	case *hash.Hash:
+		return "hash"
+	case *set.Set:
+		return "set"
+	case *sortedset.SortedSet:
+		return "zset"
+	case *stream.Stream:
+		return "stream"
+	case ModuleObject:
+		return obj.TypeName()
+	}
+	return "none"
+}
+
+func execDel(db *DB, args [][]byte) proto.Reply {
+	keys := toStrings(args)
+
+	var deleted int64
+	for _, key := range keys {
+		if _, exist := db.GetEntity(key); exist {
+			db.Remove(key)
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		db.writeAof(aof.DelCmd(args...))
+	}
+	return proto.NewIntegerReply(deleted)
+}
+
+// DEL key [key ...]
+func cmdDel(db *DB, args [][]byte) proto.Reply {
+	return execDel(db, args)
+}
+
+// UNLINK key [key ...]
+func cmdUnlink(db *DB, args [][]byte) proto.Reply {
+	return execDel(db, args)
+}
+
+// EXISTS key [key ...]，同一个key出现多次会被重复计数
+func cmdExists(db *DB, args [][]byte) proto.Reply {
+	var count int64
+	for _, arg := range args {
+		if _, exist := db.GetEntity(string(arg)); exist {
+			count++
+		}
+	}
+	return proto.NewIntegerReply(count)
+}
+
+// TOUCH key [key ...]
+func cmdTouch(db *DB, args [][]byte) proto.Reply {
+	return cmdExists(db, args)
+}
+
+// TYPE key
+func cmdType(db *DB, args [][]byte) proto.Reply {
+	dataEntity, exist := db.peekEntity(string(args[0]))
+	if !exist {
+		return proto.NewSimpleStringReply("none")
+	}
+	return proto.NewSimpleStringReply(getType(dataEntity.Object))
+}
+
+// 将src移动到dest，过期时间一起带过去
+func (d *DB) rename(src, dest string) {
+	dataEntity, _ := d.GetEntity(src)
+	expireAt, hasTTL := d.TTL(src)
+	d.Remove(src)
+	d.Remove(dest)
+	d.PutEntity(dest, dataEntity)
+	if hasTTL {
+		d.ExpireAt(dest, expireAt)
+	}
+}
+
+// RENAME key newkey
+func cmdRename(db *DB, args [][]byte) proto.Reply {
+	src, dest := string(args[0]), string(args[1])
+
+	if _, exist := db.GetEntity(src); !exist {
+		return proto.NewGenericErrReply("no such key")
+	}
+	if src != dest {
+		db.rename(src, dest)
+		db.writeAof(aof.RenameCmd(args...))
+	}
+	return proto.NewOkReply()
+}
+
+// RENAMENX key newkey
+func cmdRenameNX(db *DB, args [][]byte) proto.Reply {
+	src, dest := string(args[0]), string(args[1])
+
+	if _, exist := db.GetEntity(src); !exist {
+		return proto.NewGenericErrReply("no such key")
+	}
+	if _, exist := db.GetEntity(dest); exist {
+		return proto.NewIntegerReply(0)
+	}
+	db.rename(src, dest)
+	db.writeAof(aof.RenameNXCmd(args...))
 	return proto.NewIntegerReply(1)
 }
 
+// KEYS pattern
+func cmdKeys(db *DB, args [][]byte) proto.Reply {
+	pattern := string(args[0])
+	result := make([][]byte, 0)
+	for _, key := range db.dataDict.Keys() {
+		if !util.GlobMatch(pattern, key) {
+			continue
+		}
+		// 没有持有key的锁，只跳过过期的key，由持有锁的命令或者主动过期删除
+		if _, exist := db.peekEntityUnlocked(key); exist {
+			result = append(result, []byte(key))
+		}
+	}
+	return proto.NewMultiBulkReply(result)
+}
+
+const defaultScanCount = 10
+
+type scanSpec struct {
+	match string
+	count int
+	// 只返回指定类型的key，为空时不过滤
+	typ string
+}
+
+func (s *scanSpec) matchKey(key string) bool {
+	return s.match == "" || util.GlobMatch(s.match, key)
+}
+
+// 解析 [MATCH pattern] [COUNT count] [TYPE type]，withType为false时不支持TYPE
+func parseScanSpec(args [][]byte, withType bool) (*scanSpec, proto.Reply) {
+	spec := &scanSpec{count: defaultScanCount}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, proto.NewSyntaxErrReply()
+		}
+		value := string(args[i+1])
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			// * 匹配所有key，不需要再逐个匹配
+			if value != "*" {
+				spec.match = value
+			}
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, proto.NewGenericErrReply("value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			spec.count = count
+		case "TYPE":
+			if !withType {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			spec.typ = strings.ToLower(value)
+		default:
+			return nil, proto.NewSyntaxErrReply()
+		}
+	}
+	return spec, nil
+}
+
+func parseCursor(arg []byte) (uint64, proto.Reply) {
+	cursor, err := strconv.ParseUint(string(arg), 10, 64)
+	if err != nil {
+		return 0, proto.NewGenericErrReply("invalid cursor")
+	}
+	return cursor, nil
+}
+
+func scanReply(cursor uint64, items [][]byte) proto.Reply {
+	return proto.NewMixReply(
+		proto.NewBulkReply([]byte(strconv.FormatUint(cursor, 10))),
+		proto.NewMultiBulkReply(items),
+	)
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+// 游标为字典的分片下标
+func cmdScan(db *DB, args [][]byte) proto.Reply {
+	cursor, reply := parseCursor(args[0])
+	if reply != nil {
+		return reply
+	}
+	spec, reply := parseScanSpec(args[1:], true)
+	if reply != nil {
+		return reply
+	}
+	next := 0
+	keys := make([]string, 0)
+	if cursor < uint64(db.dataDict.ShardCount()) {
+		keys, next = db.dataDict.Scan(int(cursor), spec.count)
+	}
+	result := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if !spec.matchKey(key) {
+			continue
+		}
+		dataEntity, exist := db.peekEntityUnlocked(key)
+		if !exist {
+			continue
+		}
+		if spec.typ != "" && getType(dataEntity.Object) != spec.typ {
+			continue
+		}
+		result = append(result, []byte(key))
+	}
+	return scanReply(uint64(next), result)
+}
+
+// DBSIZE
+func cmdDBSize(db *DB, args [][]byte) proto.Reply {
+	return proto.NewIntegerReply(int64(db.dataDict.Count()))
+}
+
 func init() {
-	registerCommand("Expire", execExpire, nil, -3)
+	registerCommand("Expire", cmdExpire, writeFirstKey, -3)
+	registerCommand("PExpire", cmdPExpire, writeFirstKey, -3)
+	registerCommand("ExpireAt", cmdExpireAt, writeFirstKey, -3)
+	registerCommand("PExpireAt", cmdPExpireAt, writeFirstKey, -3)
+	registerCommand("TTL", cmdTTL, readFirstKey, 2)
+	registerCommand("PTTL", cmdPTTL, readFirstKey, 2)
+	registerCommand("ExpireTime", cmdExpireTime, readFirstKey, 2)
+	registerCommand("PExpireTime", cmdPExpireTime, readFirstKey, 2)
+	registerCommand("Persist", cmdPersist, writeFirstKey, 2)
+	registerCommand("Del", cmdDel, writeAllKeys, -2)
+	registerCommand("Unlink", cmdUnlink, writeAllKeys, -2)
+	registerCommand("Exists", cmdExists, readAllKeys, -2)
+	registerCommand("Touch", cmdTouch, readAllKeys, -2)
+	registerCommand("Type", cmdType, readFirstKey, 2)
+	registerCommand("Rename", cmdRename, writeFirstTwoKeys, 3)
+	registerCommand("RenameNX", cmdRenameNX, writeFirstTwoKeys, 3)
+	registerCommand("Keys", cmdKeys, noKeys, 2)
+	registerCommand("Scan", cmdScan, noKeys, -2)
+	registerCommand("DBSize", cmdDBSize, noKeys, 1)
 }
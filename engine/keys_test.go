@@ -0,0 +1,232 @@
+package engine
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gedis/gedis/conn"
+)
+
+func TestDelExistsType(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MSET a 1 b 2", "+ok")
+	expectReply(t, e, c, "RPUSH l x", ":1")
+	expectReply(t, e, c, "HSET h f v", ":1")
+	expectReply(t, e, c, "SADD s m", ":1")
+	expectReply(t, e, c, "ZADD z 1 m", ":1")
+	expectReply(t, e, c, "XADD x 1-1 f v", "$3 1-1")
+
+	expectReply(t, e, c, "TYPE a", "+string")
+	expectReply(t, e, c, "TYPE l", "+list")
+	expectReply(t, e, c, "TYPE h", "+hash")
+	expectReply(t, e, c, "TYPE s", "+set")
+	expectReply(t, e, c, "TYPE z", "+zset")
+	expectReply(t, e, c, "TYPE x", "+stream")
+	expectReply(t, e, c, "TYPE none", "+none")
+
+	// 同一个key出现多次会被重复计数
+	expectReply(t, e, c, "EXISTS a a none b", ":3")
+	expectReply(t, e, c, "TOUCH a none", ":1")
+	expectReply(t, e, c, "DEL a none a", ":1")
+	expectReply(t, e, c, "UNLINK b l h", ":3")
+	expectReply(t, e, c, "DEL none", ":0")
+	expectReply(t, e, c, "EXISTS a b l h", ":0")
+	expectReply(t, e, c, "DEL", "-ERR wrong number of arguments for 'del' command")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "EXISTS a b l h s z x", ":3")
+}
+
+func TestRename(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1 EX 100", "+ok")
+	expectReply(t, e, c, "SET b 2", "+ok")
+	expectReply(t, e, c, "RENAME a c", "+ok")
+	expectReply(t, e, c, "EXISTS a", ":0")
+	expectTTL(t, e, c, "c", 100)
+	// 覆盖dest时dest原来的过期时间也被替换
+	expectReply(t, e, c, "RENAME b c", "+ok")
+	expectReply(t, e, c, "GET c", "$1 2")
+	expectReply(t, e, c, "TTL c", ":-1")
+	expectReply(t, e, c, "RENAME c c", "+ok")
+	expectReply(t, e, c, "RENAME none c", "-ERR no such key")
+
+	expectReply(t, e, c, "SET d 4", "+ok")
+	expectReply(t, e, c, "RENAMENX c d", ":0")
+	expectReply(t, e, c, "RENAMENX c e", ":1")
+	expectReply(t, e, c, "RENAMENX none f", "-ERR no such key")
+
+	// 时间轮中的过期任务跟随新的key
+	expectReply(t, e, c, "SET p v PX 100", "+ok")
+	expectReply(t, e, c, "RENAME p q", "+ok")
+	time.Sleep(300 * time.Millisecond)
+	if _, exist := e.selectDb(0).dataDict.Get("q"); exist {
+		t.Error("renamed key is not expired")
+	}
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "MGET a b c d e", "*5 $-1 $-1 $-1 $1 4 $1 2")
+	expectReply(t, e, c, "EXISTS p q", ":0")
+}
+
+func TestExpire(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1", "+ok")
+	expectReply(t, e, c, "TTL a", ":-1")
+	expectReply(t, e, c, "PTTL a", ":-1")
+	expectReply(t, e, c, "EXPIRETIME a", ":-1")
+	expectReply(t, e, c, "TTL none", ":-2")
+	expectReply(t, e, c, "PTTL none", ":-2")
+	expectReply(t, e, c, "PEXPIRETIME none", ":-2")
+	expectReply(t, e, c, "EXPIRE none 100", ":0")
+
+	expectReply(t, e, c, "EXPIRE a 100", ":1")
+	expectTTL(t, e, c, "a", 100)
+	if pttl, _ := strconv.Atoi(strings.TrimPrefix(testExec(e, c, "PTTL a"), ":")); pttl < 99000 || pttl > 100000 {
+		t.Errorf("unexpected pttl %d", pttl)
+	}
+	expectReply(t, e, c, "PERSIST a", ":1")
+	expectReply(t, e, c, "PERSIST a", ":0")
+	expectReply(t, e, c, "TTL a", ":-1")
+	expectReply(t, e, c, "EXPIREAT a 32503680000", ":1")
+	expectReply(t, e, c, "EXPIRETIME a", ":32503680000")
+	expectReply(t, e, c, "PEXPIREAT a 32503680000123", ":1")
+	expectReply(t, e, c, "PEXPIRETIME a", ":32503680000123")
+
+	// 负数或者已经过去的时间直接删除key
+	expectReply(t, e, c, "MSET n1 1 n2 2 n3 3 n4 4", "+ok")
+	expectReply(t, e, c, "EXPIRE n1 -5", ":1")
+	expectReply(t, e, c, "PEXPIRE n2 -9223372036854775808", ":1")
+	expectReply(t, e, c, "EXPIREAT n3 1", ":1")
+	expectReply(t, e, c, "PEXPIREAT n4 0", ":1")
+	expectReply(t, e, c, "EXISTS n1 n2 n3 n4", ":0")
+
+	expectReply(t, e, c, "EXPIRE a 9223372036854775807", "-ERR invalid expire time in 'expire' command")
+	expectReply(t, e, c, "PEXPIRE a 9223372036854775807", "-ERR invalid expire time in 'pexpire' command")
+	expectReply(t, e, c, "EXPIRE a x", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "EXPIRE a 10 YY", "-ERR Unsupported option YY")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "PEXPIRETIME a", ":32503680000123")
+	expectReply(t, e, c, "EXISTS n1 n2 n3 n4", ":0")
+}
+
+func TestExpireFlags(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1", "+ok")
+	expectReply(t, e, c, "EXPIRE a 100 XX", ":0")
+	// 没有过期时间视为永不过期，GT不会生效，LT会生效
+	expectReply(t, e, c, "EXPIRE a 100 GT", ":0")
+	expectReply(t, e, c, "EXPIRE a 100 NX", ":1")
+	expectReply(t, e, c, "EXPIRE a 200 NX", ":0")
+	expectTTL(t, e, c, "a", 100)
+	expectReply(t, e, c, "EXPIRE a 200 XX", ":1")
+	expectReply(t, e, c, "EXPIRE a 100 GT", ":0")
+	expectReply(t, e, c, "EXPIRE a 300 GT", ":1")
+	expectReply(t, e, c, "EXPIRE a 400 LT", ":0")
+	expectReply(t, e, c, "EXPIRE a 50 XX LT", ":1")
+	expectTTL(t, e, c, "a", 50)
+	expectReply(t, e, c, "SET b 1", "+ok")
+	expectReply(t, e, c, "EXPIRE b 100 LT", ":1")
+
+	expectReply(t, e, c, "EXPIRE a 10 NX XX", "-ERR NX and XX, GT or LT options at the same time are not compatible")
+	expectReply(t, e, c, "EXPIRE a 10 GT LT", "-ERR GT and LT options at the same time are not compatible")
+
+	e = reloadTestEngine(t, e)
+	expectTTL(t, e, c, "a", 50)
+	expectTTL(t, e, c, "b", 100)
+}
+
+func TestKeysScan(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MSET a1 1 a2 2 b1 3", "+ok")
+	expectReply(t, e, c, "RPUSH l1 x", ":1")
+	expectReply(t, e, c, "SET e1 1 PX 1", "+ok")
+	time.Sleep(5 * time.Millisecond)
+	// 返回的顺序由key所在的分片决定
+	expectKeys := func(line string, want ...string) {
+		t.Helper()
+		fields := strings.Fields(testExec(e, c, line))
+		var actual []string
+		for i := len(fields) - 1; i > 0 && !strings.HasPrefix(fields[i], "*"); i -= 2 {
+			actual = append(actual, fields[i])
+		}
+		sort.Strings(actual)
+		if strings.Join(actual, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: expected %v, actual %v", line, want, actual)
+		}
+	}
+	expectKeys("KEYS a*", "a1", "a2")
+	expectKeys("KEYS [bl]1", "b1", "l1")
+	expectKeys("KEYS *", "a1", "a2", "b1", "l1")
+	expectKeys("SCAN 0 MATCH a* COUNT 100", "a1", "a2")
+	expectReply(t, e, c, "KEYS e*", "*0")
+	expectReply(t, e, c, "SCAN 0 TYPE list COUNT 100", "*2 $1 0 *1 $2 l1")
+	expectReply(t, e, c, "SCAN 0 MATCH e* COUNT 100", "*2 $1 0 *0")
+	expectReply(t, e, c, "SCAN 65536", "*2 $1 0 *0")
+	expectReply(t, e, c, "SCAN x", "-ERR invalid cursor")
+	expectReply(t, e, c, "SCAN 0 COUNT 0", "-ERR syntax error")
+	expectReply(t, e, c, "SCAN 0 MATCH", "-ERR syntax error")
+
+	// 逐步遍历时每个key都会返回
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		reply := testExec(e, c, "SCAN "+cursor+" COUNT 1")
+		fields := strings.Fields(reply)
+		cursor = fields[2]
+		for i := 5; i < len(fields); i += 2 {
+			seen[fields[i]] = true
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	if len(seen) != 4 || !seen["a1"] || !seen["a2"] || !seen["b1"] || !seen["l1"] {
+		t.Errorf("unexpected keys of scan: %v", seen)
+	}
+}
+
+// KEYS和SCAN不持有key的锁，不能删除过期的key，否则可能删掉并发写入的数据
+func TestKeysScanExpireRace(t *testing.T) {
+	e := newTestEngine(t)
+	db := e.selectDb(0)
+	c := gedisconn.NewVirtualConnection()
+	const keys = 100
+	for round := 0; round < 50; round++ {
+		for i := 0; i < keys; i++ {
+			putExpiredKey(db, "k"+strconv.Itoa(i))
+		}
+		var done atomic.Bool
+		var wg sync.WaitGroup
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c := gedisconn.NewVirtualConnection()
+				for !done.Load() {
+					testExec(e, c, "KEYS k*")
+					testExec(e, c, "SCAN 0 COUNT 1000")
+				}
+			}()
+		}
+		for i := 0; i < keys; i++ {
+			testExec(e, c, "SET k"+strconv.Itoa(i)+" v")
+		}
+		done.Store(true)
+		wg.Wait()
+		if n := db.dataDict.Count(); n != keys {
+			t.Fatalf("round %d: %d keys written by SET are deleted", round, keys-n)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package engine
+
+import (
+	"gedis/aof"
+	"gedis/datastruct/bitmap"
+	"gedis/datastruct/hash"
+	"gedis/datastruct/list"
+	"gedis/datastruct/set"
+	"gedis/datastruct/sortedset"
+	"gedis/datastruct/stream"
+	"gedis/engine/entity"
+	"gedis/gedis/proto"
+	"gedis/iface"
+	"strconv"
+	"strings"
+)
+
+// 涉及多个db的命令，需要在Engine中执行
+
+func parseDbIndex(arg []byte) (int, proto.Reply) {
+	dbIndex, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	if dbIndex < 0 || dbIndex >= maxDbNum {
+		return 0, proto.NewGenericErrReply("DB index is out of range")
+	}
+	return dbIndex, nil
+}
+
+// 解析 [ASYNC | SYNC]
+func parseFlushMode(args [][]byte) (bool, proto.Reply) {
+	if len(args) > 1 {
+		return false, proto.NewSyntaxErrReply()
+	}
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch strings.ToUpper(string(args[0])) {
+	case "ASYNC":
+		return true, nil
+	case "SYNC":
+		return false, nil
+	}
+	return false, proto.NewSyntaxErrReply()
+}
+
+// 用新的DB替换掉原来的DB，async为true时在后台释放原来的DB，调用者需要独占所有db
+func (e *Engine) flushDB(conn iface.Conn, index int, async bool) {
+	db := newDB(e.delay, e.stats)
+	db.SetIndex(index)
+	e.aofBindDB(db)
+
+	old := e.selectDb(index)
+	e.dbSet[index].Store(db)
+	// 事务回滚时换回原来的DB，其中的过期key由惰性删除和主动过期处理
+	addTxUndo(conn, func() {
+		e.dbSet[index].Store(old)
+	})
+
+	// 让阻塞的客户端转到新的DB上等待
+	old.blocking.signalAll()
+	if async {
+		go old.cancelAllDelay()
+	} else {
+		old.cancelAllDelay()
+	}
+}
+
+// FLUSHDB [ASYNC | SYNC]
+func (e *Engine) execFlushDB(conn iface.Conn, args [][]byte) proto.Reply {
+	async, reply := parseFlushMode(args)
+	if reply != nil {
+		return reply
+	}
+	index := conn.GetDbIndex()
+	e.flushDB(conn, index, async)
+	e.dbFor(conn, index).writeAof(aof.FlushDBCmd(args...))
+	return proto.NewOkReply()
+}
+
+// FLUSHALL [ASYNC | SYNC]
+func (e *Engine) execFlushAll(conn iface.Conn, args [][]byte) proto.Reply {
+	async, reply := parseFlushMode(args)
+	if reply != nil {
+		return reply
+	}
+	for i := range e.dbSet {
+		e.flushDB(conn, i, async)
+	}
+	e.dbFor(conn, 0).writeAof(aof.FlushAllCmd(args...))
+	return proto.NewOkReply()
+}
+
+// SWAPDB index1 index2
+func (e *Engine) execSwapDB(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) != 2 {
+		return proto.NewArgNumErrReply("swapdb")
+	}
+	index1, reply := parseDbIndex(args[0])
+	if reply != nil {
+		return reply
+	}
+	index2, reply := parseDbIndex(args[1])
+	if reply != nil {
+		return reply
+	}
+	if index1 != index2 {
+		e.swapDB(index1, index2)
+		addTxUndo(conn, func() {
+			e.swapDB(index1, index2)
+		})
+	}
+	e.dbFor(conn, conn.GetDbIndex()).writeAof(aof.SwapDBCmd(args...))
+	return proto.NewOkReply()
+}
+
+// 调用者需要独占所有db
+func (e *Engine) swapDB(index1, index2 int) {
+	db1, db2 := e.selectDb(index1), e.selectDb(index2)
+	db1.SetIndex(index2)
+	db2.SetIndex(index1)
+	e.dbSet[index1].Store(db2)
+	e.dbSet[index2].Store(db1)
+
+	db1.blocking.signalAll()
+	db2.blocking.signalAll()
+}
+
+// 对两个db中的key加锁，按db下标的顺序加锁，避免方向相反的两个命令互相等待
+func lockAcrossDBs(src, dst *DB, srcKey, dstKey string) func() {
+	if src.dbState == dst.dbState {
+		src.locker.Locks(srcKey, dstKey)
+		return func() {
+			src.locker.Unlocks(srcKey, dstKey)
+		}
+	}
+	first, firstKey, second, secondKey := src, srcKey, dst, dstKey
+	if dst.index < src.index {
+		first, firstKey, second, secondKey = dst, dstKey, src, srcKey
+	}
+	first.locker.Locks(firstKey)
+	second.locker.Locks(secondKey)
+	return func() {
+		second.locker.Unlocks(secondKey)
+		first.locker.Unlocks(firstKey)
+	}
+}
+
+// MOVE key db
+func (e *Engine) execMove(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) != 2 {
+		return proto.NewArgNumErrReply("move")
+	}
+	dstIndex, reply := parseDbIndex(args[1])
+	if reply != nil {
+		return reply
+	}
+	srcIndex := conn.GetDbIndex()
+	if srcIndex == dstIndex {
+		return proto.NewGenericErrReply("source and destination objects are the same")
+	}
+	key := string(args[0])
+	src, dst := e.dbFor(conn, srcIndex), e.dbFor(conn, dstIndex)
+	unlock := lockAcrossDBs(src, dst, key, key)
+	defer unlock()
+
+	dataEntity, exist := src.GetEntity(key)
+	if !exist {
+		return proto.NewIntegerReply(0)
+	}
+	if _, exist = dst.GetEntity(key); exist {
+		return proto.NewIntegerReply(0)
+	}
+	expireAt, hasTTL := src.TTL(key)
+	src.Remove(key)
+	dst.PutEntity(key, dataEntity)
+	if hasTTL {
+		dst.ExpireAt(key, expireAt)
+	}
+	src.writeAof(aof.MoveCmd(args...))
+	dst.signalKeyReady(key)
+	return proto.NewIntegerReply(1)
+}
+
+// 深拷贝对象，用于COPY
+func cloneObject(object any) any {
+	switch obj := object.(type) {
+	case []byte:
+		return append([]byte(nil), obj...)
+	case bitmap.BitMap:
+		return append([]byte(nil), obj...)
+	case *list.QuickList:
+		return obj.Clone()
+	case *hash.Hash:
+		return obj.Clone()
+	case *set.Set:
+		return obj.Clone()
+	case *sortedset.SortedSet:
+		return obj.Clone()
+	case *stream.Stream:
+		return obj.Clone()
+	case ModuleObject:
+		return obj.Clone()
+	}
+	return object
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func (e *Engine) execCopy(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) < 2 {
+		return proto.NewArgNumErrReply("copy")
+	}
+	srcIndex := conn.GetDbIndex()
+	dstIndex := srcIndex
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "DB":
+			if i+1 >= len(args) {
+				return proto.NewSyntaxErrReply()
+			}
+			var reply proto.Reply
+			dstIndex, reply = parseDbIndex(args[i+1])
+			if reply != nil {
+				return reply
+			}
+			i++
+		case "REPLACE":
+			replace = true
+		default:
+			return proto.NewSyntaxErrReply()
+		}
+	}
+	srcKey, dstKey := string(args[0]), string(args[1])
+	if srcIndex == dstIndex && srcKey == dstKey {
+		return proto.NewGenericErrReply("source and destination objects are the same")
+	}
+	src, dst := e.dbFor(conn, srcIndex), e.dbFor(conn, dstIndex)
+	unlock := lockAcrossDBs(src, dst, srcKey, dstKey)
+	defer unlock()
+
+	dataEntity, exist := src.GetEntity(srcKey)
+	if !exist {
+		return proto.NewIntegerReply(0)
+	}
+	if _, exist = dst.GetEntity(dstKey); exist && !replace {
+		return proto.NewIntegerReply(0)
+	}
+	dst.Remove(dstKey)
+	dst.PutEntity(dstKey, &entity.DataEntity{Object: cloneObject(dataEntity.Object)})
+	if expireAt, hasTTL := src.TTL(srcKey); hasTTL {
+		dst.ExpireAt(dstKey, expireAt)
+	}
+	src.writeAof(aof.CopyCmd(args...))
+	dst.signalKeyReady(dstKey)
+	return proto.NewIntegerReply(1)
+}
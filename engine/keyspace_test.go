@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gedis/gedis/conn"
+)
+
+// 在另一个连接上执行阻塞命令，返回接收回复的通道
+func execBlocking(e *Engine, dbIndex int, line string) <-chan string {
+	c := gedisconn.NewVirtualConnection()
+	c.SetDbIndex(dbIndex)
+	ch := make(chan string, 1)
+	go func() {
+		ch <- testExec(e, c, line)
+	}()
+	// 等待命令进入阻塞
+	time.Sleep(50 * time.Millisecond)
+	return ch
+}
+
+func expectBlockingReply(t *testing.T, ch <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		if got != want {
+			t.Errorf("expected %q, actual %q", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Error("blocked client is not woken up")
+	}
+}
+
+func TestFlushDB(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MSET a 1 b 2", "+ok")
+	expectReply(t, e, c, "SET p v PX 100", "+ok")
+	expectReply(t, e, c, "SELECT 1", "+ok")
+	expectReply(t, e, c, "SET a 1", "+ok")
+	expectReply(t, e, c, "SELECT 0", "+ok")
+
+	expectReply(t, e, c, "FLUSHDB ASYNC", "+ok")
+	expectReply(t, e, c, "DBSIZE", ":0")
+	// 原来DB的过期任务不会删除新DB中的同名key
+	expectReply(t, e, c, "SET p v", "+ok")
+	time.Sleep(300 * time.Millisecond)
+	expectReply(t, e, c, "EXISTS p", ":1")
+	expectReply(t, e, c, "SET b 3", "+ok")
+	expectReply(t, e, c, "FLUSHDB ASYNC SYNC", "-ERR syntax error")
+	expectReply(t, e, c, "FLUSHDB NOW", "-ERR syntax error")
+
+	// 阻塞的客户端转到新的DB上等待
+	ch := execBlocking(e, 2, "XREAD BLOCK 0 STREAMS x $")
+	expectReply(t, e, c, "SELECT 2", "+ok")
+	expectReply(t, e, c, "FLUSHDB", "+ok")
+	expectReply(t, e, c, "XADD x 1-1 f v", "$3 1-1")
+	expectBlockingReply(t, ch, "*1 *2 $1 x *1 *2 $3 1-1 *2 $1 f $1 v")
+
+	e = reloadTestEngine(t, e)
+	c = gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MGET a b p", "*3 $-1 $1 3 $1 v")
+	expectReply(t, e, c, "SELECT 1", "+ok")
+	expectReply(t, e, c, "GET a", "$1 1")
+	expectReply(t, e, c, "SELECT 2", "+ok")
+	expectReply(t, e, c, "XLEN x", ":1")
+}
+
+func TestFlushAll(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	for i := 0; i < 3; i++ {
+		expectReply(t, e, c, "SELECT "+strconv.Itoa(i), "+ok")
+		expectReply(t, e, c, "SET a 1 EX 100", "+ok")
+	}
+	expectReply(t, e, c, "FLUSHALL ASYNC", "+ok")
+	for i := 0; i < 3; i++ {
+		expectReply(t, e, c, "SELECT "+strconv.Itoa(i), "+ok")
+		expectReply(t, e, c, "DBSIZE", ":0")
+	}
+	expectReply(t, e, c, "SET b 2", "+ok")
+	expectReply(t, e, c, "FLUSHALL x", "-ERR syntax error")
+
+	e = reloadTestEngine(t, e)
+	c = gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "EXISTS a", ":0")
+	expectReply(t, e, c, "SELECT 2", "+ok")
+	expectReply(t, e, c, "MGET a b", "*2 $-1 $1 2")
+}
+
+func TestSwapDB(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 0", "+ok")
+	expectReply(t, e, c, "SELECT 1", "+ok")
+	expectReply(t, e, c, "SET a 1 EX 100", "+ok")
+
+	ch := execBlocking(e, 0, "XREAD BLOCK 0 STREAMS x $")
+	expectReply(t, e, c, "SWAPDB 0 1", "+ok")
+	expectReply(t, e, c, "GET a", "$1 0")
+	expectReply(t, e, c, "TTL a", ":-1")
+	// 交换后写入的aof使用DB新的下标
+	expectReply(t, e, c, "SET b 1", "+ok")
+	expectReply(t, e, c, "SELECT 0", "+ok")
+	expectTTL(t, e, c, "a", 100)
+	expectReply(t, e, c, "XADD x 1-1 f v", "$3 1-1")
+	expectBlockingReply(t, ch, "*1 *2 $1 x *1 *2 $3 1-1 *2 $1 f $1 v")
+
+	expectReply(t, e, c, "SWAPDB 2 2", "+ok")
+	expectReply(t, e, c, "SWAPDB 0", "-ERR wrong number of arguments for 'swapdb' command")
+	expectReply(t, e, c, "SWAPDB 0 x", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "SWAPDB 0 100", "-ERR DB index is out of range")
+
+	e = reloadTestEngine(t, e)
+	c = gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MGET a b", "*2 $1 1 $-1")
+	expectTTL(t, e, c, "a", 100)
+	expectReply(t, e, c, "SELECT 1", "+ok")
+	expectReply(t, e, c, "MGET a b", "*2 $1 0 $1 1")
+}
+
+// 交换DB的同时在两个DB中执行命令，命令不会写到被换走的DB，aof中记录的db下标也与执行时一致
+func TestSwapDBConcurrent(t *testing.T) {
+	e := newTestEngine(t)
+	const workers, incrs, swaps = 4, 200, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(dbIndex int) {
+			defer wg.Done()
+			c := gedisconn.NewVirtualConnection()
+			c.SetDbIndex(dbIndex)
+			for j := 0; j < incrs; j++ {
+				testExec(e, c, "INCR n"+strconv.Itoa(dbIndex))
+			}
+		}(i % 2)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c := gedisconn.NewVirtualConnection()
+		for j := 0; j < swaps; j++ {
+			testExec(e, c, "SWAPDB 0 1")
+		}
+	}()
+	wg.Wait()
+
+	c := gedisconn.NewVirtualConnection()
+	total := 0
+	values := make([]string, 2)
+	for i := range values {
+		c.SetDbIndex(i)
+		values[i] = testExec(e, c, "MGET n0 n1")
+		for _, field := range strings.Fields(values[i])[1:] {
+			if n, err := strconv.Atoi(field); err == nil {
+				total += n
+			}
+		}
+	}
+	if total != workers*incrs {
+		t.Fatalf("expected %d increments, actual %d", workers*incrs, total)
+	}
+
+	e = reloadTestEngine(t, e)
+	for i, want := range values {
+		c.SetDbIndex(i)
+		expectReply(t, e, c, "MGET n0 n1", want)
+	}
+}
+
+func TestMoveCopy(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1 EX 100", "+ok")
+	expectReply(t, e, c, "RPUSH l x y", ":2")
+	expectReply(t, e, c, "MOVE a 1", ":1")
+	expectReply(t, e, c, "MOVE a 1", ":0")
+	expectReply(t, e, c, "SET a 2", "+ok")
+	expectReply(t, e, c, "MOVE a 1", ":0")
+	expectReply(t, e, c, "MOVE a 0", "-ERR source and destination objects are the same")
+	expectReply(t, e, c, "MOVE a 100", "-ERR DB index is out of range")
+
+	expectReply(t, e, c, "COPY l l2", ":1")
+	// 复制的是独立的对象
+	expectReply(t, e, c, "RPUSH l2 z", ":3")
+	expectReply(t, e, c, "LLEN l", ":2")
+	expectReply(t, e, c, "COPY l l2", ":0")
+	expectReply(t, e, c, "COPY l l2 REPLACE", ":1")
+	expectReply(t, e, c, "COPY l l DB 1", ":1")
+	expectReply(t, e, c, "COPY l l", "-ERR source and destination objects are the same")
+	expectReply(t, e, c, "COPY l x DB", "-ERR syntax error")
+	expectReply(t, e, c, "COPY none x", ":0")
+
+	e = reloadTestEngine(t, e)
+	c = gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "GET a", "$1 2")
+	expectReply(t, e, c, "LRANGE l2 0 -1", "*2 $1 x $1 y")
+	expectReply(t, e, c, "SELECT 1", "+ok")
+	expectReply(t, e, c, "GET a", "$1 1")
+	expectTTL(t, e, c, "a", 100)
+	expectReply(t, e, c, "LLEN l", ":2")
+}
@@ -0,0 +1,559 @@
+package engine
+
+import (
+	"bytes"
+	"gedis/aof"
+	"gedis/datastruct/list"
+	"gedis/engine/entity"
+	"gedis/gedis/proto"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func (d *DB) getListObject(key string) (*list.QuickList, proto.Reply) {
+	dataEntity, exist := d.GetEntity(key)
+	if !exist {
+		return nil, nil
+	}
+	l, ok := dataEntity.Object.(*list.QuickList)
+	if !ok {
+		return nil, proto.NewWrongTypeErrReply()
+	}
+	return l, nil
+}
+
+func (d *DB) getOrInitListObject(key string) (*list.QuickList, proto.Reply) {
+	l, reply := d.getListObject(key)
+	if reply != nil {
+		return nil, reply
+	}
+	if l == nil {
+		l = list.NewQuickList()
+		d.PutEntity(key, &entity.DataEntity{Object: l})
+	}
+	return l, nil
+}
+
+// 在列表头部或尾部添加元素，撤销时从同一端弹出
+func (d *DB) listPush(key string, l *list.QuickList, val any, left bool) {
+	if left {
+		l.AddFirst(val)
+	} else {
+		l.Add(val)
+	}
+	d.Modified(key, func() {
+		if left {
+			l.RemoveFirst()
+		} else {
+			l.RemoveLast()
+		}
+	})
+}
+
+// 从列表头部或尾部弹出元素，撤销时放回同一端
+func (d *DB) listPop(key string, l *list.QuickList, left bool) any {
+	var val any
+	if left {
+		val, _ = l.RemoveFirst()
+	} else {
+		val, _ = l.RemoveLast()
+	}
+	d.Modified(key, func() {
+		if left {
+			l.AddFirst(val)
+		} else {
+			l.Add(val)
+		}
+	})
+	return val
+}
+
+// 把负数下标转换成正数下标
+func normalizeIndex(idx int64, size int) int {
+	if idx < 0 {
+		idx += int64(size)
+	}
+	return int(idx)
+}
+
+// 把 [start, stop] 闭区间转换成 [start, stop) 区间，区间为空时start >= stop
+func normalizeRange(start, stop int64, size int) (int, int) {
+	if start < 0 {
+		start += int64(size)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop < 0 {
+		stop += int64(size)
+	}
+	if stop >= int64(size) {
+		stop = int64(size) - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return int(start), int(stop) + 1
+}
+
+func pushList(db *DB, args [][]byte, left bool, onlyExist bool) proto.Reply {
+	key := string(args[0])
+	var l *list.QuickList
+	var reply proto.Reply
+	if onlyExist {
+		l, reply = db.getListObject(key)
+		if l == nil && reply == nil {
+			return proto.NewIntegerReply(0)
+		}
+	} else {
+		l, reply = db.getOrInitListObject(key)
+	}
+	if reply != nil {
+		return reply
+	}
+	for _, value := range args[1:] {
+		db.listPush(key, l, value, left)
+	}
+	if left {
+		db.writeAof(aof.LPushCmd(args...))
+	} else {
+		db.writeAof(aof.RPushCmd(args...))
+	}
+	return proto.NewIntegerReply(int64(l.Len()))
+}
+
+// LPUSH key element [element ...]
+func cmdLPush(db *DB, args [][]byte) proto.Reply {
+	return pushList(db, args, true, false)
+}
+
+// RPUSH key element [element ...]
+func cmdRPush(db *DB, args [][]byte) proto.Reply {
+	return pushList(db, args, false, false)
+}
+
+// LPUSHX key element [element ...]
+func cmdLPushX(db *DB, args [][]byte) proto.Reply {
+	return pushList(db, args, true, true)
+}
+
+// RPUSHX key element [element ...]
+func cmdRPushX(db *DB, args [][]byte) proto.Reply {
+	return pushList(db, args, false, true)
+}
+
+func popList(db *DB, args [][]byte, left bool) proto.Reply {
+	if len(args) > 2 {
+		return proto.NewSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := int64(-1)
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count < 0 {
+			return proto.NewGenericErrReply("value is out of range, must be positive")
+		}
+	}
+	l, reply := db.getListObject(key)
+	if reply != nil {
+		return reply
+	}
+	if l == nil {
+		if count < 0 {
+			return proto.NewNullBulkReply()
+		}
+		return proto.NewNullMultiBulkReply()
+	}
+
+	n := 1
+	if count >= 0 {
+		n = l.Len()
+		if count < int64(n) {
+			n = int(count)
+		}
+	}
+	result := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		result = append(result, db.listPop(key, l, left).([]byte))
+	}
+	if l.Len() == 0 {
+		db.Remove(key)
+	}
+	if n > 0 {
+		if left {
+			db.writeAof(aof.LPopCmd(args...))
+		} else {
+			db.writeAof(aof.RPopCmd(args...))
+		}
+	}
+	if count < 0 {
+		return proto.NewBulkReply(result[0])
+	}
+	return proto.NewMultiBulkReply(result)
+}
+
+// LPOP key [count]
+func cmdLPop(db *DB, args [][]byte) proto.Reply {
+	return popList(db, args, true)
+}
+
+// RPOP key [count]
+func cmdRPop(db *DB, args [][]byte) proto.Reply {
+	return popList(db, args, false)
+}
+
+// LLEN key
+func cmdLLen(db *DB, args [][]byte) proto.Reply {
+	l, reply := db.getListObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if l == nil {
+		return proto.NewIntegerReply(0)
+	}
+	return proto.NewIntegerReply(int64(l.Len()))
+}
+
+// LRANGE key start stop
+func cmdLRange(db *DB, args [][]byte) proto.Reply {
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	l, reply := db.getListObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if l == nil {
+		return proto.NewEmptyMultiBulkReply()
+	}
+	from, to := normalizeRange(start, stop, l.Len())
+	values := l.Range(from, to)
+	result := make([][]byte, len(values))
+	for i, val := range values {
+		result[i] = val.([]byte)
+	}
+	return proto.NewMultiBulkReply(result)
+}
+
+// LINDEX key index
+func cmdLIndex(db *DB, args [][]byte) proto.Reply {
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	l, reply := db.getListObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if l == nil {
+		return proto.NewNullBulkReply()
+	}
+	val, err := l.Get(normalizeIndex(index, l.Len()))
+	if err != nil {
+		return proto.NewNullBulkReply()
+	}
+	return proto.NewBulkReply(val.([]byte))
+}
+
+// LSET key index element
+func cmdLSet(db *DB, args [][]byte) proto.Reply {
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	key := string(args[0])
+	l, reply := db.getListObject(key)
+	if reply != nil {
+		return reply
+	}
+	if l == nil {
+		return proto.NewGenericErrReply("no such key")
+	}
+	idx := normalizeIndex(index, l.Len())
+	old, err := l.Get(idx)
+	if err != nil {
+		return proto.NewGenericErrReply("index out of range")
+	}
+	l.Update(idx, args[2])
+	db.Modified(key, func() {
+		l.Update(idx, old)
+	})
+	db.writeAof(aof.LSetCmd(args...))
+	return proto.NewOkReply()
+}
+
+// LINSERT key BEFORE|AFTER pivot element
+func cmdLInsert(db *DB, args [][]byte) proto.Reply {
+	var after bool
+	switch strings.ToUpper(string(args[1])) {
+	case "BEFORE":
+		after = false
+	case "AFTER":
+		after = true
+	default:
+		return proto.NewSyntaxErrReply()
+	}
+	key := string(args[0])
+	l, reply := db.getListObject(key)
+	if reply != nil {
+		return reply
+	}
+	if l == nil {
+		return proto.NewIntegerReply(0)
+	}
+	pivot := args[2]
+	index := -1
+	l.ForEach(func(idx int, val any) bool {
+		if bytes.Equal(val.([]byte), pivot) {
+			index = idx
+			return false
+		}
+		return true
+	})
+	if index < 0 {
+		return proto.NewIntegerReply(-1)
+	}
+	if after {
+		index++
+	}
+	l.Insert(index, args[3])
+	db.Modified(key, func() {
+		l.Del(index)
+	})
+	db.writeAof(aof.LInsertCmd(args...))
+	return proto.NewIntegerReply(int64(l.Len()))
+}
+
+// LREM key count element
+func cmdLRem(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	l, reply := db.getListObject(key)
+	if reply != nil {
+		return reply
+	}
+	if l == nil {
+		return proto.NewIntegerReply(0)
+	}
+	element := args[2]
+	equals := func(val any) bool {
+		return bytes.Equal(val.([]byte), element)
+	}
+	// 先记下被删除元素的下标，撤销时按下标从小到大插回
+	limit := int(count)
+	if limit < 0 {
+		limit = -limit
+	}
+	var indexes []int
+	collect := func(idx int, val any) bool {
+		if equals(val) {
+			indexes = append(indexes, idx)
+		}
+		return limit == 0 || len(indexes) < limit
+	}
+	var removed int
+	if count >= 0 {
+		l.ForEach(collect)
+		removed = l.DelByVal(equals, int(count))
+	} else {
+		l.ReverseForEach(collect)
+		slices.Reverse(indexes)
+		removed = l.ReverseDelByVal(equals, int(-count))
+	}
+	if removed > 0 {
+		db.Modified(key, func() {
+			for _, idx := range indexes {
+				l.Insert(idx, element)
+			}
+		})
+	}
+	if l.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.writeAof(aof.LRemCmd(args...))
+	}
+	return proto.NewIntegerReply(int64(removed))
+}
+
+// LTRIM key start stop
+func cmdLTrim(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	l, reply := db.getListObject(key)
+	if reply != nil {
+		return reply
+	}
+	if l == nil {
+		return proto.NewOkReply()
+	}
+	from, to := normalizeRange(start, stop, l.Len())
+	head := l.Range(0, from)
+	tail := l.Range(to, l.Len())
+	l.Trim(from, to)
+	db.Modified(key, func() {
+		for i := len(head) - 1; i >= 0; i-- {
+			l.AddFirst(head[i])
+		}
+		for _, val := range tail {
+			l.Add(val)
+		}
+	})
+	if l.Len() == 0 {
+		db.Remove(key)
+	}
+	db.writeAof(aof.LTrimCmd(args...))
+	return proto.NewOkReply()
+}
+
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func cmdLPos(db *DB, args [][]byte) proto.Reply {
+	rank, count, maxLen := int64(1), int64(-1), int64(0)
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return proto.NewSyntaxErrReply()
+		}
+		val, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return proto.NewGenericErrReply("value is not an integer or out of range")
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "RANK":
+			if val == 0 {
+				return proto.NewGenericErrReply("RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = val
+		case "COUNT":
+			if val < 0 {
+				return proto.NewGenericErrReply("COUNT can't be negative")
+			}
+			count = val
+		case "MAXLEN":
+			if val < 0 {
+				return proto.NewGenericErrReply("MAXLEN can't be negative")
+			}
+			maxLen = val
+		default:
+			return proto.NewSyntaxErrReply()
+		}
+	}
+
+	l, reply := db.getListObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if l == nil {
+		if count < 0 {
+			return proto.NewNullBulkReply()
+		}
+		return proto.NewEmptyMultiBulkReply()
+	}
+
+	element := args[1]
+	limit := count
+	if limit <= 0 {
+		// 不带COUNT时只需要一个结果，COUNT 0 表示全部
+		limit = int64(l.Len())
+		if count < 0 {
+			limit = 1
+		}
+	}
+	skip := rank
+	if skip < 0 {
+		skip = -skip
+	}
+	skip--
+	var compared int64
+	positions := make([]proto.Reply, 0)
+	consumer := func(idx int, val any) bool {
+		if maxLen > 0 && compared >= maxLen {
+			return false
+		}
+		compared++
+		if !bytes.Equal(val.([]byte), element) {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		positions = append(positions, proto.NewIntegerReply(int64(idx)))
+		return int64(len(positions)) < limit
+	}
+	if rank > 0 {
+		l.ForEach(consumer)
+	} else {
+		l.ReverseForEach(consumer)
+	}
+
+	if count < 0 {
+		if len(positions) == 0 {
+			return proto.NewNullBulkReply()
+		}
+		return positions[0]
+	}
+	return proto.NewMixReply(positions...)
+}
+
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func cmdLMove(db *DB, args [][]byte) proto.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	from := strings.ToUpper(string(args[2]))
+	to := strings.ToUpper(string(args[3]))
+	if (from != "LEFT" && from != "RIGHT") || (to != "LEFT" && to != "RIGHT") {
+		return proto.NewSyntaxErrReply()
+	}
+
+	srcList, reply := db.getListObject(src)
+	if reply != nil {
+		return reply
+	}
+	if srcList == nil {
+		return proto.NewNullBulkReply()
+	}
+	destList, reply := db.getListObject(dest)
+	if reply != nil {
+		return reply
+	}
+
+	val := db.listPop(src, srcList, from == "LEFT")
+	if destList == nil {
+		destList, _ = db.getOrInitListObject(dest)
+	}
+	db.listPush(dest, destList, val, to == "LEFT")
+	if srcList.Len() == 0 {
+		db.Remove(src)
+	}
+	db.writeAof(aof.LMoveCmd(args...))
+	return proto.NewBulkReply(val.([]byte))
+}
+
+func init() {
+	registerCommand("LPush", cmdLPush, writeFirstKey, -3)
+	registerCommand("RPush", cmdRPush, writeFirstKey, -3)
+	registerCommand("LPushX", cmdLPushX, writeFirstKey, -3)
+	registerCommand("RPushX", cmdRPushX, writeFirstKey, -3)
+	registerCommand("LPop", cmdLPop, writeFirstKey, -2)
+	registerCommand("RPop", cmdRPop, writeFirstKey, -2)
+	registerCommand("LLen", cmdLLen, readFirstKey, 2)
+	registerCommand("LRange", cmdLRange, readFirstKey, 4)
+	registerCommand("LIndex", cmdLIndex, readFirstKey, 3)
+	registerCommand("LSet", cmdLSet, writeFirstKey, 4)
+	registerCommand("LInsert", cmdLInsert, writeFirstKey, 5)
+	registerCommand("LRem", cmdLRem, writeFirstKey, 4)
+	registerCommand("LTrim", cmdLTrim, writeFirstKey, 4)
+	registerCommand("LPos", cmdLPos, readFirstKey, -3)
+	registerCommand("LMove", cmdLMove, writeFirstTwoKeys, 5)
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+func TestListPopCount(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "RPUSH l a b c d e", ":5")
+	expectReply(t, e, c, "LPOP l 2", "*2 $1 a $1 b")
+	expectReply(t, e, c, "RPOP l 2", "*2 $1 e $1 d")
+	expectReply(t, e, c, "LPOP l 0", "*0")
+	expectReply(t, e, c, "LRANGE l 0 -1", "*1 $1 c")
+	// count超过长度时弹出全部元素并删除key
+	expectReply(t, e, c, "RPOP l 10", "*1 $1 c")
+	expectReply(t, e, c, "EXISTS l", ":0")
+	expectReply(t, e, c, "LPOP l", "$-1")
+	expectReply(t, e, c, "LPOP l 2", "*-1")
+	expectReply(t, e, c, "RPUSH p a b", ":2")
+	expectReply(t, e, c, "RPOP p", "$1 b")
+	expectReply(t, e, c, "LPOP p -1", "-ERR value is out of range, must be positive")
+	expectReply(t, e, c, "LPOP p x", "-ERR value is out of range, must be positive")
+	expectReply(t, e, c, "LPOP p 1 2", "-ERR syntax error")
+	expectReply(t, e, c, "SET str x", "+ok")
+	expectReply(t, e, c, "LPOP str 1", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "EXISTS l", ":0")
+	expectReply(t, e, c, "LRANGE p 0 -1", "*1 $1 a")
+}
+
+func TestListInsertRem(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "RPUSH l a b c", ":3")
+	expectReply(t, e, c, "LINSERT l BEFORE b x", ":4")
+	expectReply(t, e, c, "LINSERT l after c y", ":5")
+	expectReply(t, e, c, "LINSERT l BEFORE a z", ":6")
+	expectReply(t, e, c, "LRANGE l 0 -1", "*6 $1 z $1 a $1 x $1 b $1 c $1 y")
+	// 只在第一个匹配的元素处插入
+	expectReply(t, e, c, "RPUSH l a", ":7")
+	expectReply(t, e, c, "LINSERT l AFTER a w", ":8")
+	expectReply(t, e, c, "LRANGE l 0 -1", "*8 $1 z $1 a $1 w $1 x $1 b $1 c $1 y $1 a")
+	expectReply(t, e, c, "LINSERT l BEFORE none v", ":-1")
+	expectReply(t, e, c, "LINSERT none BEFORE a v", ":0")
+	expectReply(t, e, c, "EXISTS none", ":0")
+	expectReply(t, e, c, "LINSERT l MIDDLE a v", "-ERR syntax error")
+
+	expectReply(t, e, c, "RPUSH r a b a c a d a", ":7")
+	// 负数从尾部开始删除
+	expectReply(t, e, c, "LREM r -2 a", ":2")
+	expectReply(t, e, c, "LRANGE r 0 -1", "*5 $1 a $1 b $1 a $1 c $1 d")
+	expectReply(t, e, c, "LREM r 1 a", ":1")
+	expectReply(t, e, c, "LRANGE r 0 -1", "*4 $1 b $1 a $1 c $1 d")
+	expectReply(t, e, c, "LREM r -5 none", ":0")
+	expectReply(t, e, c, "RPUSH r a a", ":6")
+	// 0表示删除全部
+	expectReply(t, e, c, "LREM r 0 a", ":3")
+	expectReply(t, e, c, "LRANGE r 0 -1", "*3 $1 b $1 c $1 d")
+	expectReply(t, e, c, "RPUSH one x x", ":2")
+	expectReply(t, e, c, "LREM one -10 x", ":2")
+	expectReply(t, e, c, "EXISTS one", ":0")
+	expectReply(t, e, c, "LREM r x a", "-ERR value is not an integer or out of range")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "LRANGE l 0 -1", "*8 $1 z $1 a $1 w $1 x $1 b $1 c $1 y $1 a")
+	expectReply(t, e, c, "LRANGE r 0 -1", "*3 $1 b $1 c $1 d")
+	expectReply(t, e, c, "EXISTS one", ":0")
+}
+
+func TestListPos(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "RPUSH l a b c 1 2 3 c c", ":8")
+	expectReply(t, e, c, "LPOS l c", ":2")
+	expectReply(t, e, c, "LPOS l none", "$-1")
+	expectReply(t, e, c, "LPOS l c RANK 2", ":6")
+	expectReply(t, e, c, "LPOS l c RANK -1", ":7")
+	expectReply(t, e, c, "LPOS l c RANK -3", ":2")
+	expectReply(t, e, c, "LPOS l c RANK 4", "$-1")
+	expectReply(t, e, c, "LPOS l c COUNT 2", "*2 :2 :6")
+	// COUNT 0 返回全部匹配的位置
+	expectReply(t, e, c, "LPOS l c COUNT 0", "*3 :2 :6 :7")
+	expectReply(t, e, c, "LPOS l c RANK -1 COUNT 2", "*2 :7 :6")
+	expectReply(t, e, c, "LPOS l c RANK 2 COUNT 0", "*2 :6 :7")
+	expectReply(t, e, c, "LPOS l none COUNT 0", "*0")
+	// MAXLEN限制比较的元素个数，从查找方向开始计算
+	expectReply(t, e, c, "LPOS l c COUNT 0 MAXLEN 7", "*2 :2 :6")
+	expectReply(t, e, c, "LPOS l c MAXLEN 2", "$-1")
+	expectReply(t, e, c, "LPOS l c RANK -1 COUNT 0 MAXLEN 2", "*2 :7 :6")
+	expectReply(t, e, c, "LPOS l c RANK 2 MAXLEN 3", "$-1")
+	expectReply(t, e, c, "LPOS l c MAXLEN 0", ":2")
+	expectReply(t, e, c, "LPOS none c", "$-1")
+	expectReply(t, e, c, "LPOS none c COUNT 1", "*0")
+
+	expectReply(t, e, c, "LPOS l c RANK 0", "-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+	expectReply(t, e, c, "LPOS l c COUNT -1", "-ERR COUNT can't be negative")
+	expectReply(t, e, c, "LPOS l c MAXLEN -1", "-ERR MAXLEN can't be negative")
+	expectReply(t, e, c, "LPOS l c RANK x", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "LPOS l c RANK", "-ERR syntax error")
+	expectReply(t, e, c, "LPOS l c FIRST 1", "-ERR syntax error")
+	expectReply(t, e, c, "SET str x", "+ok")
+	expectReply(t, e, c, "LPOS str c", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestListMove(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "RPUSH l a b c", ":3")
+	// 同一个key时相当于旋转列表
+	expectReply(t, e, c, "LMOVE l l LEFT RIGHT", "$1 a")
+	expectReply(t, e, c, "LRANGE l 0 -1", "*3 $1 b $1 c $1 a")
+	expectReply(t, e, c, "LMOVE l l RIGHT LEFT", "$1 a")
+	expectReply(t, e, c, "LRANGE l 0 -1", "*3 $1 a $1 b $1 c")
+	expectReply(t, e, c, "LMOVE l l left left", "$1 a")
+	expectReply(t, e, c, "LRANGE l 0 -1", "*3 $1 a $1 b $1 c")
+	expectReply(t, e, c, "RPUSH single x", ":1")
+	expectReply(t, e, c, "LMOVE single single LEFT RIGHT", "$1 x")
+	expectReply(t, e, c, "LRANGE single 0 -1", "*1 $1 x")
+
+	expectReply(t, e, c, "LMOVE l dst RIGHT LEFT", "$1 c")
+	expectReply(t, e, c, "LMOVE l dst RIGHT LEFT", "$1 b")
+	expectReply(t, e, c, "LMOVE l dst LEFT RIGHT", "$1 a")
+	expectReply(t, e, c, "LRANGE dst 0 -1", "*3 $1 b $1 c $1 a")
+	// 源列表为空时删除key
+	expectReply(t, e, c, "EXISTS l", ":0")
+	expectReply(t, e, c, "LMOVE l dst LEFT LEFT", "$-1")
+	expectReply(t, e, c, "EXISTS l", ":0")
+
+	expectReply(t, e, c, "SET str x", "+ok")
+	expectReply(t, e, c, "LMOVE dst str LEFT LEFT", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	expectReply(t, e, c, "LMOVE str dst LEFT LEFT", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	expectReply(t, e, c, "LLEN dst", ":3")
+	expectReply(t, e, c, "LMOVE dst l UP LEFT", "-ERR syntax error")
+	expectReply(t, e, c, "LMOVE dst l LEFT", "-ERR wrong number of arguments for 'lmove' command")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "LRANGE dst 0 -1", "*3 $1 b $1 c $1 a")
+	expectReply(t, e, c, "LRANGE single 0 -1", "*1 $1 x")
+	expectReply(t, e, c, "EXISTS l", ":0")
+	expectReply(t, e, c, "GET str", "$1 x")
+}
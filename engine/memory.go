@@ -0,0 +1,268 @@
+package engine
+
+import (
+	"fmt"
+	"gedis/datastruct/bitmap"
+	"gedis/datastruct/hash"
+	"gedis/datastruct/list"
+	"gedis/datastruct/set"
+	"gedis/datastruct/sortedset"
+	"gedis/datastruct/stream"
+	"gedis/engine/entity"
+	"gedis/gedis/proto"
+	"gedis/iface"
+	"strconv"
+	"strings"
+)
+
+// 估算内存时使用的固定开销，单位字节
+const (
+	// 字典中一个key以及DataEntity的开销
+	keyOverhead = 96
+	// 切片头
+	sliceOverhead = 24
+	// map中一个元素的开销
+	mapEntryOverhead = 48
+	// 跳表节点的平均开销
+	skiplistNodeOverhead = 64
+	// 待确认消息的开销
+	pendingEntryOverhead = 64
+
+	defaultMemorySamples = 5
+)
+
+// 累计前limit个元素的大小，按平均值估算全部元素，limit为0时统计全部元素
+type sampler struct {
+	limit int
+	count int
+	total int64
+}
+
+// 返回是否需要继续抽样
+func (s *sampler) add(size int64) bool {
+	s.count++
+	s.total += size
+	return s.limit == 0 || s.count < s.limit
+}
+
+func (s *sampler) estimate(n int) int64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.total * int64(n) / int64(s.count)
+}
+
+func bytesSize(b []byte) int64 {
+	return int64(len(b)) + sliceOverhead
+}
+
+// 估算对象占用的内存，集合类型按照前samples个元素估算
+func objectSize(object any, samples int) int64 {
+	s := &sampler{limit: samples}
+	switch obj := object.(type) {
+	case []byte:
+		return bytesSize(obj)
+	case bitmap.BitMap:
+		return bytesSize(obj)
+	case *list.QuickList:
+		obj.ForEach(func(i int, val any) bool {
+			b, _ := val.([]byte)
+			return s.add(bytesSize(b))
+		})
+		return sliceOverhead + s.estimate(obj.Len())
+	case *hash.Hash:
+		obj.ForEach(func(field string, value []byte) bool {
+			return s.add(mapEntryOverhead + int64(len(field)) + bytesSize(value))
+		})
+		return mapEntryOverhead + s.estimate(obj.Len())
+	case *set.Set:
+		if obj.Encoding() == set.EncodingIntSet {
+			return sliceOverhead + 8*int64(obj.Len())
+		}
+		obj.ForEach(func(member string) bool {
+			return s.add(mapEntryOverhead + int64(len(member)))
+		})
+		return mapEntryOverhead + s.estimate(obj.Len())
+	case *sortedset.SortedSet:
+		obj.ForEachAll(func(pair *sortedset.Pair) bool {
+			return s.add(mapEntryOverhead + skiplistNodeOverhead + int64(len(pair.Member)))
+		})
+		return mapEntryOverhead + skiplistNodeOverhead + s.estimate(int(obj.Len()))
+	case *stream.Stream:
+		for _, entry := range obj.Range(stream.MinID, stream.MaxID, samples, false) {
+			size := int64(sliceOverhead)
+			for _, field := range entry.Fields {
+				size += bytesSize(field)
+			}
+			s.add(size)
+		}
+		size := sliceOverhead + s.estimate(obj.Len())
+		for _, group := range obj.Groups() {
+			size += mapEntryOverhead + int64(group.PendingLen())*pendingEntryOverhead
+			for _, consumer := range group.Consumers() {
+				size += mapEntryOverhead + int64(len(consumer.Name))
+			}
+		}
+		return size
+	case ModuleObject:
+		return obj.MemoryUsage()
+	}
+	return 0
+}
+
+func entitySize(key string, dataEntity *entity.DataEntity, samples int) int64 {
+	return keyOverhead + int64(len(key)) + objectSize(dataEntity.Object, samples)
+}
+
+// MEMORY USAGE key [SAMPLES count]
+// MEMORY DOCTOR
+func (e *Engine) execMemory(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) == 0 {
+		return proto.NewArgNumErrReply("memory")
+	}
+	switch strings.ToUpper(string(args[0])) {
+	case "USAGE":
+		return e.memoryUsage(conn, args[1:])
+	case "DOCTOR":
+		if len(args) != 1 {
+			return proto.NewArgNumErrReply("memory|doctor")
+		}
+		return proto.NewBulkReply([]byte(e.bigKeysReport()))
+	}
+	return proto.NewGenericErrReply("unknown subcommand '" + string(args[0]) + "'")
+}
+
+func (e *Engine) memoryUsage(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) != 1 && len(args) != 3 {
+		return proto.NewArgNumErrReply("memory|usage")
+	}
+	samples := defaultMemorySamples
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[1])) != "SAMPLES" {
+			return proto.NewSyntaxErrReply()
+		}
+		var err error
+		samples, err = strconv.Atoi(string(args[2]))
+		if err != nil || samples < 0 {
+			return proto.NewGenericErrReply("value is not an integer or out of range")
+		}
+	}
+	key := string(args[0])
+	db := e.selectDb(conn.GetDbIndex())
+	db.locker.RLocks(key)
+	defer db.locker.RUnlocks(key)
+	dataEntity, exist := db.peekEntity(key)
+	if !exist {
+		return proto.NewNullBulkReply()
+	}
+	return proto.NewIntegerReply(entitySize(key, dataEntity, samples))
+}
+
+// 对象的长度，字符串为字节数，集合为元素个数
+func objectLength(object any) int64 {
+	switch obj := object.(type) {
+	case []byte:
+		return int64(len(obj))
+	case bitmap.BitMap:
+		return int64(len(obj))
+	case *list.QuickList:
+		return int64(obj.Len())
+	case *hash.Hash:
+		return int64(obj.Len())
+	case *set.Set:
+		return int64(obj.Len())
+	case *sortedset.SortedSet:
+		return obj.Len()
+	case *stream.Stream:
+		return int64(obj.Len())
+	}
+	return 0
+}
+
+type bigKeyStat struct {
+	typ  string
+	unit string
+
+	keys  int64
+	total int64
+	// 长度最大的key
+	biggestKey string
+	biggest    int64
+}
+
+// 与 redis-cli --bigkeys 类似，遍历所有db找出每种类型中最大的key
+func (e *Engine) bigKeysReport() string {
+	stats := []*bigKeyStat{
+		{typ: "string", unit: "bytes"},
+		{typ: "list", unit: "items"},
+		{typ: "hash", unit: "fields"},
+		{typ: "set", unit: "members"},
+		{typ: "zset", unit: "members"},
+		{typ: "stream", unit: "entries"},
+	}
+	statByType := make(map[string]*bigKeyStat, len(stats))
+	for _, stat := range stats {
+		statByType[stat.typ] = stat
+	}
+
+	var scanned, dbs int64
+	var biggestMemoryKey string
+	var biggestMemory int64
+	for i := range e.dbSet {
+		db := e.selectDb(i)
+		keys := db.dataDict.Keys()
+		if len(keys) > 0 {
+			dbs++
+		}
+		for _, key := range keys {
+			db.locker.RLocks(key)
+			dataEntity, exist := db.peekEntity(key)
+			if !exist {
+				db.locker.RUnlocks(key)
+				continue
+			}
+			name := fmt.Sprintf("db%d:%s", i, key)
+			length := objectLength(dataEntity.Object)
+			memory := entitySize(key, dataEntity, defaultMemorySamples)
+			stat := statByType[getType(dataEntity.Object)]
+			db.locker.RUnlocks(key)
+
+			scanned++
+			if memory > biggestMemory {
+				biggestMemoryKey, biggestMemory = name, memory
+			}
+			if stat == nil {
+				continue
+			}
+			stat.keys++
+			stat.total += length
+			if stat.biggestKey == "" || length > stat.biggest {
+				stat.biggestKey, stat.biggest = name, length
+			}
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("# Scanned %d keys in %d dbs\n\n", scanned, dbs))
+	for _, stat := range stats {
+		if stat.biggestKey != "" {
+			builder.WriteString(fmt.Sprintf("Biggest %6s found '%s' has %d %s\n", stat.typ, stat.biggestKey, stat.biggest, stat.unit))
+		}
+	}
+	if biggestMemoryKey != "" {
+		builder.WriteString(fmt.Sprintf("Biggest key by memory usage '%s' uses about %d bytes\n", biggestMemoryKey, biggestMemory))
+	}
+	builder.WriteString("\n")
+	for _, stat := range stats {
+		var percent, avg float64
+		if scanned > 0 {
+			percent = float64(stat.keys) * 100 / float64(scanned)
+		}
+		if stat.keys > 0 {
+			avg = float64(stat.total) / float64(stat.keys)
+		}
+		builder.WriteString(fmt.Sprintf("%d %ss with %d %s (%.2f%% of keys, avg size %.2f)\n",
+			stat.keys, stat.typ, stat.total, stat.unit, percent, avg))
+	}
+	return builder.String()
+}
@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"gedis/aof"
+	"gedis/gedis/proto"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CommandFlag 模块命令的属性
+type CommandFlag int
+
+const (
+	// 会修改数据，执行成功后写入aof；原地修改模块对象时需要调用DB.Modified记录撤销操作，
+	// 命令panic或者返回Abort时才能回滚
+	FlagWrite CommandFlag = 1 << iota
+	// 只读取数据
+	FlagReadOnly
+	// 不允许在脚本中调用
+	FlagNoScript
+)
+
+// ModuleObject 模块自定义的数据类型需要实现的接口
+type ModuleObject interface {
+	// TYPE命令返回的类型名称
+	TypeName() string
+	// MEMORY USAGE估算的内存大小
+	MemoryUsage() int64
+	// 生成能够重建该对象的命令，写命令执行后用这些命令记录到aof
+	AofRewrite(key string) [][][]byte
+	// 深拷贝，COPY时使用
+	Clone() ModuleObject
+}
+
+// ModuleLoader 模块的入口，args为配置中模块名之后的参数
+type ModuleLoader func(m *Module, args []string) error
+
+var (
+	modulesMu     sync.Mutex
+	moduleLoaders = make(map[string]ModuleLoader)
+	// 已经加载的模块，命令是全局注册的，同一个模块只加载一次
+	loadedModules = make(map[string]*Module)
+)
+
+// RegisterModule 在模块包的init中调用，配置了loadmodule之后才会被加载
+func RegisterModule(name string, loader ModuleLoader) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	name = strings.ToLower(name)
+	if _, ok := moduleLoaders[name]; ok {
+		panic("module " + name + " registered twice")
+	}
+	moduleLoaders[name] = loader
+}
+
+// Module 模块通过它注册命令
+type Module struct {
+	name string
+	args []string
+	// 模块注册的命令
+	commands []string
+}
+
+func (m *Module) Name() string {
+	return m.name
+}
+
+// Register 注册命令，arity包含命令名，负数表示至少需要-arity个参数
+func (m *Module) Register(name string, flags CommandFlag, arity int, keyFunc KeyFunc, exec ExecFunc) error {
+	name = strings.ToLower(name)
+	if flags&FlagWrite != 0 && flags&FlagReadOnly != 0 {
+		return errors.New("command " + name + " can not be both write and readonly")
+	}
+	if exec == nil {
+		return errors.New("command " + name + " has no exec function")
+	}
+	_, isEngineCommand := engineCommands[name]
+	if _, ok := commandCenter[name]; ok || isEngineCommand {
+		return errors.New("command " + name + " already exists")
+	}
+	if keyFunc == nil {
+		keyFunc = noKeys
+	}
+	cmd := registerCommand(name, exec, keyFunc, arity)
+	cmd.flags = flags
+	if flags&FlagWrite != 0 {
+		cmd.execFunc = func(db *DB, args [][]byte) proto.Reply {
+			reply := exec(db, args)
+			if !proto.IsErrReply(reply) {
+				propagateModuleCommand(db, keyFunc, append([][]byte{[]byte(name)}, args...))
+			}
+			return reply
+		}
+	}
+	m.commands = append(m.commands, name)
+	return nil
+}
+
+// 写命令修改的key都保存着模块对象时，用对象生成的命令记录到aof，与命令是否确定无关；
+// 否则直接记录命令本身
+func propagateModuleCommand(db *DB, keyFunc KeyFunc, cmdLine [][]byte) {
+	writeKeys, _ := keyFunc(cmdLine[1:])
+	commands := make([][][]byte, 0, len(writeKeys)*2)
+	for _, key := range writeKeys {
+		commands = append(commands, aof.DelCmd([]byte(key)))
+		dataEntity, exist := db.peekEntity(key)
+		if !exist {
+			continue
+		}
+		object, ok := dataEntity.Object.(ModuleObject)
+		if !ok {
+			db.writeAof(cmdLine)
+			return
+		}
+		commands = append(commands, object.AofRewrite(key)...)
+		if expireAt, hasTTL := db.TTL(key); hasTTL {
+			commands = append(commands, aof.PExpireAtCmd(key, expireAt))
+		}
+	}
+	if len(writeKeys) == 0 {
+		db.writeAof(cmdLine)
+		return
+	}
+	for _, command := range commands {
+		db.writeAof(command)
+	}
+}
+
+// 加载配置中的模块，每一项为模块名以及参数
+func loadModules(specs []string) error {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	for _, spec := range specs {
+		fields := strings.Fields(spec)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if _, ok := loadedModules[name]; ok {
+			continue
+		}
+		loader, ok := moduleLoaders[name]
+		if !ok {
+			return fmt.Errorf("module %s not found", name)
+		}
+		m := &Module{name: name, args: fields[1:]}
+		if err := loader(m, m.args); err != nil {
+			// 加载失败时撤销已经注册的命令
+			for _, cmdName := range m.commands {
+				delete(commandCenter, cmdName)
+			}
+			return fmt.Errorf("load module %s: %w", name, err)
+		}
+		loadedModules[name] = m
+	}
+	return nil
+}
+
+// MODULE LIST
+func execModule(args [][]byte) proto.Reply {
+	if len(args) == 0 {
+		return proto.NewArgNumErrReply("module")
+	}
+	if strings.ToLower(string(args[0])) != "list" {
+		return proto.NewGenericErrReply("unknown subcommand '" + string(args[0]) + "'")
+	}
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	names := make([]string, 0, len(loadedModules))
+	for name := range loadedModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	replies := make([]proto.Reply, 0, len(names))
+	for _, name := range names {
+		m := loadedModules[name]
+		replies = append(replies, proto.NewMultiBulkReply([][]byte{
+			[]byte("name"), []byte(m.name),
+			[]byte("args"), []byte(strings.Join(m.args, " ")),
+		}))
+	}
+	return proto.NewMixReply(replies...)
+}
@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gedis/config"
+	"gedis/engine/entity"
+	"gedis/gedis/conn"
+	"gedis/gedis/proto"
+)
+
+// 测试用的计数器类型
+type testCounter struct {
+	n int64
+}
+
+func (c *testCounter) TypeName() string {
+	return "testcounter"
+}
+
+func (c *testCounter) MemoryUsage() int64 {
+	return 8
+}
+
+func (c *testCounter) AofRewrite(key string) [][][]byte {
+	return [][][]byte{{[]byte("TCOUNTER.SET"), []byte(key), []byte(strconv.FormatInt(c.n, 10))}}
+}
+
+func (c *testCounter) Clone() ModuleObject {
+	return &testCounter{n: c.n}
+}
+
+func getTestCounter(db *DB, key string) (*testCounter, proto.Reply) {
+	dataEntity, exist := db.GetEntity(key)
+	if !exist {
+		return nil, nil
+	}
+	c, ok := dataEntity.Object.(*testCounter)
+	if !ok {
+		return nil, proto.NewWrongTypeErrReply()
+	}
+	return c, nil
+}
+
+func init() {
+	// TCOUNTER.INCR每次增加的步长由模块参数指定
+	RegisterModule("testcounter", func(m *Module, args []string) error {
+		step := int64(1)
+		if len(args) > 0 {
+			n, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			step = n
+		}
+		if err := m.Register("tcounter.incr", FlagWrite, 2, writeFirstKey, func(db *DB, args [][]byte) proto.Reply {
+			key := string(args[0])
+			c, reply := getTestCounter(db, key)
+			if reply != nil {
+				return reply
+			}
+			if c == nil {
+				c = &testCounter{}
+				db.PutEntity(key, &entity.DataEntity{Object: c})
+			}
+			old := c.n
+			c.n += step
+			db.Modified(key, func() {
+				c.n = old
+			})
+			return proto.NewIntegerReply(c.n)
+		}); err != nil {
+			return err
+		}
+		if err := m.Register("tcounter.set", FlagWrite|FlagNoScript, 3, writeFirstKey, func(db *DB, args [][]byte) proto.Reply {
+			n, err := strconv.ParseInt(string(args[1]), 10, 64)
+			if err != nil {
+				return proto.NewGenericErrReply("value is not an integer or out of range")
+			}
+			db.PutEntity(string(args[0]), &entity.DataEntity{Object: &testCounter{n: n}})
+			return proto.NewOkReply()
+		}); err != nil {
+			return err
+		}
+		return m.Register("tcounter.get", FlagReadOnly, 2, readFirstKey, func(db *DB, args [][]byte) proto.Reply {
+			c, reply := getTestCounter(db, string(args[0]))
+			if reply != nil || c == nil {
+				return proto.NewNullBulkReply()
+			}
+			return proto.NewIntegerReply(c.n)
+		})
+	})
+	// 注册命令之后加载失败
+	RegisterModule("testbroken", func(m *Module, args []string) error {
+		if err := m.Register("tbroken.cmd", FlagReadOnly, 1, nil, func(db *DB, args [][]byte) proto.Reply {
+			return proto.NewOkReply()
+		}); err != nil {
+			return err
+		}
+		return errors.New("broken")
+	})
+}
+
+func TestModuleRegister(t *testing.T) {
+	exec := func(db *DB, args [][]byte) proto.Reply {
+		return proto.NewOkReply()
+	}
+	m := &Module{name: "test"}
+	t.Cleanup(func() {
+		for _, name := range m.commands {
+			delete(commandCenter, name)
+		}
+	})
+	if err := m.Register("tmod.cmd", FlagReadOnly, 2, nil, exec); err != nil {
+		t.Fatal(err)
+	}
+	if commandCenter["tmod.cmd"].keyFunc == nil {
+		t.Error("keyFunc of module command is nil")
+	}
+	for _, tt := range []struct {
+		name  string
+		flags CommandFlag
+		exec  ExecFunc
+		err   string
+	}{
+		{"TMOD.CMD", 0, exec, "command tmod.cmd already exists"},
+		{"get", 0, exec, "command get already exists"},
+		{"flushdb", 0, exec, "command flushdb already exists"},
+		{"multi", 0, exec, "command multi already exists"},
+		{"eval", 0, exec, "command eval already exists"},
+		{"tmod.both", FlagWrite | FlagReadOnly, exec, "command tmod.both can not be both write and readonly"},
+		{"tmod.nil", FlagWrite, nil, "command tmod.nil has no exec function"},
+	} {
+		err := m.Register(tt.name, tt.flags, 2, nil, tt.exec)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("register %s: expected %q, actual %v", tt.name, tt.err, err)
+		}
+	}
+	if _, ok := commandCenter["tmod.nil"]; ok {
+		t.Error("command without exec function is registered")
+	}
+
+	if err := loadModules([]string{"nosuch"}); err == nil || err.Error() != "module nosuch not found" {
+		t.Errorf("unexpected error of unknown module: %v", err)
+	}
+	// 加载失败的模块注册的命令会被撤销
+	if err := loadModules([]string{"testbroken"}); err == nil || err.Error() != "load module testbroken: broken" {
+		t.Errorf("unexpected error of broken module: %v", err)
+	}
+	if _, ok := commandCenter["tbroken.cmd"]; ok {
+		t.Error("command of broken module is not removed")
+	}
+}
+
+func newModuleTestEngine(t *testing.T) *Engine {
+	modules := config.Properties.LoadModule
+	config.Properties.LoadModule = []string{"testcounter 5"}
+	t.Cleanup(func() {
+		config.Properties.LoadModule = modules
+	})
+	return newTestEngine(t)
+}
+
+func TestModuleCommands(t *testing.T) {
+	e := newModuleTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MODULE LIST", "*1 *4 $4 name $11 testcounter $4 args $1 5")
+	expectReply(t, e, c, "MODULE LOAD x", "-ERR unknown subcommand 'LOAD'")
+	expectReply(t, e, c, "TCOUNTER.INCR a", ":5")
+	expectReply(t, e, c, "TCOUNTER.INCR a", ":10")
+	expectReply(t, e, c, "TCOUNTER.GET a", ":10")
+	expectReply(t, e, c, "TCOUNTER.GET none", "$-1")
+	expectReply(t, e, c, "TCOUNTER.GET", "-ERR wrong number of arguments for 'tcounter.get' command")
+	expectReply(t, e, c, "SET s x", "+ok")
+	expectReply(t, e, c, "TCOUNTER.INCR s", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	expectReply(t, e, c, "GET a", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	expectReply(t, e, c, "TYPE a", "+testcounter")
+	expectReply(t, e, c, "OBJECT ENCODING a", "$6 module")
+	expectReply(t, e, c, "MEMORY USAGE a", ":"+strconv.Itoa(keyOverhead+1+8))
+
+	// COPY得到的是独立的对象
+	expectReply(t, e, c, "COPY a b", ":1")
+	expectReply(t, e, c, "TCOUNTER.INCR b", ":15")
+	expectReply(t, e, c, "TCOUNTER.GET a", ":10")
+	expectReply(t, e, c, "COPY a m DB 1", ":1")
+
+	// 写命令保留过期时间
+	expectReply(t, e, c, "EXPIRE a 100", ":1")
+	expectReply(t, e, c, "TCOUNTER.INCR a", ":15")
+	expectTTL(t, e, c, "a", 100)
+
+	expectScriptReply(t, e, c, ":20", "EVAL", "return redis.call('TCOUNTER.INCR', KEYS[1])", "1", "a")
+	expectScriptReply(t, e, c, "-ERR This Redis command is not allowed from script",
+		"EVAL", "return redis.call('TCOUNTER.SET', KEYS[1], '1')", "1", "a")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "TCOUNTER.INCR c", "+QUEUED")
+	expectReply(t, e, c, "TCOUNTER.GET c", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "*2 :5 :5")
+
+	// 原地修改记录了撤销操作
+	t.Run("undo", func(t *testing.T) {
+		injectPanic(t, "tcounter.incr")
+		expectReply(t, e, c, "TCOUNTER.INCR a", "-ERR injected panic")
+		expectReply(t, e, c, "TCOUNTER.GET a", ":20")
+	})
+
+	// aof中记录的是对象生成的命令，而不是命令本身
+	aof := readAof(t)
+	if strings.Contains(aof, "tcounter.incr") {
+		t.Error("module command is written to aof instead of the rewritten commands")
+	}
+	expectAofOrder(t, "tcounter.set", "copy", "pexpireat", "tcounter.set", "multi", "tcounter.set", "exec")
+
+	check := func(e *Engine) {
+		t.Helper()
+		c := gedisconn.NewVirtualConnection()
+		expectReply(t, e, c, "TCOUNTER.GET a", ":20")
+		expectTTL(t, e, c, "a", 100)
+		expectReply(t, e, c, "TCOUNTER.GET b", ":15")
+		expectReply(t, e, c, "TCOUNTER.GET c", ":5")
+		expectReply(t, e, c, "TYPE b", "+testcounter")
+		expectReply(t, e, c, "SELECT 1", "+ok")
+		expectReply(t, e, c, "TCOUNTER.GET m", ":10")
+	}
+	check(e)
+	check(reloadTestEngine(t, e))
+}
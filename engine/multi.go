@@ -0,0 +1,318 @@
+package engine
+
+import (
+	"errors"
+	"gedis/gedis/proto"
+	"gedis/iface"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 所有被WATCH的key共用一个递增的版本号，DB被清空或交换后版本号也不会重复
+var versionGenerator atomic.Uint64
+
+type watchedKey struct {
+	// WATCH该key的客户端个数
+	refs    int
+	version atomic.Uint64
+}
+
+// 只记录被WATCH的key的版本，key被修改时更新版本
+type watchedKeys struct {
+	mu   sync.RWMutex
+	keys map[string]*watchedKey
+}
+
+func newWatchedKeys() *watchedKeys {
+	return &watchedKeys{keys: make(map[string]*watchedKey)}
+}
+
+// 返回key当前的版本
+func (w *watchedKeys) watch(key string) uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	k, ok := w.keys[key]
+	if !ok {
+		k = &watchedKey{}
+		k.version.Store(versionGenerator.Add(1))
+		w.keys[key] = k
+	}
+	k.refs++
+	return k.version.Load()
+}
+
+func (w *watchedKeys) unwatch(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	k, ok := w.keys[key]
+	if !ok {
+		return
+	}
+	k.refs--
+	if k.refs <= 0 {
+		delete(w.keys, key)
+	}
+}
+
+// 没有被WATCH的key返回0
+func (w *watchedKeys) version(key string) uint64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if k, ok := w.keys[key]; ok {
+		return k.version.Load()
+	}
+	return 0
+}
+
+// key被修改
+func (w *watchedKeys) touch(keys ...string) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if len(w.keys) == 0 {
+		return
+	}
+	for _, key := range keys {
+		if k, ok := w.keys[key]; ok {
+			k.version.Store(versionGenerator.Add(1))
+		}
+	}
+}
+
+// 连接中记录的WATCH的key带上db下标
+func genWatchKey(dbIndex int, key string) string {
+	return strconv.Itoa(dbIndex) + ":" + key
+}
+
+func parseWatchKey(watchKey string) (int, string) {
+	index, key, _ := strings.Cut(watchKey, ":")
+	dbIndex, _ := strconv.Atoi(index)
+	return dbIndex, key
+}
+
+// 事务控制命令不会被放进队列
+func isTxCommand(name string) bool {
+	switch name {
+	case "multi", "exec", "discard", "watch":
+		return true
+	}
+	return false
+}
+
+// MULTI
+func (e *Engine) execMulti(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) != 0 {
+		return proto.NewArgNumErrReply("multi")
+	}
+	if conn.InMultiState() {
+		return proto.NewGenericErrReply("MULTI calls can not be nested")
+	}
+	conn.SetMultiState(true)
+	return proto.NewOkReply()
+}
+
+// 检查命令能否放进事务，有错误时整个事务都会被放弃
+func (e *Engine) enqueue(conn iface.Conn, command [][]byte) proto.Reply {
+	name := strings.ToLower(string(command[0]))
+	var errReply proto.Reply
+	if cmd, ok := engineCommands[name]; ok {
+		if cmd.noMulti {
+			errReply = proto.NewGenericErrReply("Command not allowed inside a transaction")
+		} else if !validateArgsNum(cmd.argsNum, command) {
+			errReply = proto.NewArgNumErrReply(name)
+		}
+	} else if cmd, ok := commandCenter[name]; !ok {
+		errReply = proto.NewGenericErrReply("未知的命令：" + name)
+	} else if !validateArgsNum(cmd.argsNum, command) {
+		errReply = proto.NewArgNumErrReply(name)
+	}
+	if errReply != nil {
+		conn.AddTxError(errors.New(string(errReply.Bytes())))
+		return errReply
+	}
+	conn.EnqueueCmd(command)
+	return proto.NewQueueReply()
+}
+
+// DISCARD
+func (e *Engine) execDiscard(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) != 0 {
+		return proto.NewArgNumErrReply("discard")
+	}
+	if !conn.InMultiState() {
+		return proto.NewGenericErrReply("DISCARD without MULTI")
+	}
+	conn.SetMultiState(false)
+	e.unwatchAll(conn)
+	return proto.NewOkReply()
+}
+
+// WATCH key [key ...]
+func (e *Engine) execWatch(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) == 0 {
+		return proto.NewArgNumErrReply("watch")
+	}
+	if conn.InMultiState() {
+		return proto.NewGenericErrReply("WATCH inside MULTI is not allowed")
+	}
+	dbIndex := conn.GetDbIndex()
+	db := e.selectDb(dbIndex)
+	watching := conn.GetWatching()
+	for _, arg := range args {
+		watchKey := genWatchKey(dbIndex, string(arg))
+		if _, ok := watching[watchKey]; ok {
+			continue
+		}
+		watching[watchKey] = db.watched.watch(string(arg))
+	}
+	return proto.NewOkReply()
+}
+
+// UNWATCH
+func (e *Engine) execUnwatch(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) != 0 {
+		return proto.NewArgNumErrReply("unwatch")
+	}
+	e.unwatchAll(conn)
+	return proto.NewOkReply()
+}
+
+func (e *Engine) unwatchAll(conn iface.Conn) {
+	for watchKey := range conn.GetWatching() {
+		dbIndex, key := parseWatchKey(watchKey)
+		e.selectDb(dbIndex).watched.unwatch(key)
+	}
+	conn.CancelWatching()
+}
+
+// WATCH的key是否被修改过，DB被清空或交换后版本号对不上，同样视为被修改
+func (e *Engine) isWatchingChanged(conn iface.Conn) bool {
+	for watchKey, version := range conn.GetWatching() {
+		dbIndex, key := parseWatchKey(watchKey)
+		if e.selectDb(dbIndex).watched.version(key) != version {
+			return true
+		}
+	}
+	return false
+}
+
+// 按照每条命令的keyFunc计算每个db需要加锁的key，事务中的SELECT会切换后续命令所在的db
+func (e *Engine) txLockKeys(conn iface.Conn, cmdLines [][][]byte) (map[int][]string, map[int][]string) {
+	writeKeys := make(map[int][]string)
+	readKeys := make(map[int][]string)
+	dbIndex := conn.GetDbIndex()
+	for _, cmdLine := range cmdLines {
+		name := strings.ToLower(string(cmdLine[0]))
+		if name == "select" {
+			if index, reply := parseDbIndex(cmdLine[1]); reply == nil {
+				dbIndex = index
+			}
+			continue
+		}
+		cmd, ok := commandCenter[name]
+		if !ok || cmd.keyFunc == nil {
+			continue
+		}
+		w, r := cmd.keyFunc(cmdLine[1:])
+		writeKeys[dbIndex] = append(writeKeys[dbIndex], w...)
+		readKeys[dbIndex] = append(readKeys[dbIndex], r...)
+	}
+	return writeKeys, readKeys
+}
+
+// 事务中的命令需要的加锁方式
+func txLockMode(cmdLines [][][]byte) int {
+	for _, cmdLine := range cmdLines {
+		if cmd, ok := engineCommands[strings.ToLower(string(cmdLine[0]))]; ok && cmd.lock != lockNone {
+			return lockExclusive
+		}
+	}
+	return lockShared
+}
+
+// 按照db下标的顺序加锁，返回解锁函数
+func (e *Engine) lockTx(writeKeys, readKeys map[int][]string) func() {
+	indexes := make([]int, 0, len(writeKeys)+len(readKeys))
+	for index := range writeKeys {
+		indexes = append(indexes, index)
+	}
+	for index := range readKeys {
+		if _, ok := writeKeys[index]; !ok {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+	dbs := make([]*DB, len(indexes))
+	for i, index := range indexes {
+		dbs[i] = e.selectDb(index)
+		dbs[i].locker.RWLocks(writeKeys[index], readKeys[index])
+	}
+	return func() {
+		for i := len(dbs) - 1; i >= 0; i-- {
+			dbs[i].locker.RWUnlocks(writeKeys[indexes[i]], readKeys[indexes[i]])
+		}
+	}
+}
+
+// EXEC
+func (e *Engine) execExec(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) != 0 {
+		return proto.NewArgNumErrReply("exec")
+	}
+	if !conn.InMultiState() {
+		return proto.NewGenericErrReply("EXEC without MULTI")
+	}
+	cmdLines := conn.GetQueuedCmdLine()
+	hasErrors := len(conn.GetTxErrors()) > 0
+	conn.SetMultiState(false)
+	defer e.unwatchAll(conn)
+	if hasErrors {
+		return proto.NewSimpleErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+
+	// 事务中有访问db的Engine命令时，它们涉及的key无法提前计算，执行期间独占所有db；
+	// 否则只锁住事务中的命令涉及的key
+	if txLockMode(cmdLines) == lockExclusive {
+		e.dbMu.Lock()
+		defer e.dbMu.Unlock()
+	} else {
+		e.dbMu.RLock()
+		defer e.dbMu.RUnlock()
+		unlock := e.lockTx(e.txLockKeys(conn, cmdLines))
+		defer unlock()
+	}
+	if e.isWatchingChanged(conn) {
+		return proto.NewNullMultiBulkReply()
+	}
+
+	// 事务中的命令产生的aof先记录下来，最后作为一个整体写入
+	// 某条命令panic或者返回Abort时撤销整个事务，aof也不会写入
+	ex := &execution{}
+	defer func() {
+		if err := recover(); err != nil {
+			ex.rollback(executionMark{})
+			panic(err)
+		}
+	}()
+	tx := &txConn{Conn: conn, ex: ex}
+	replies := make([]proto.Reply, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		name := strings.ToLower(string(cmdLine[0]))
+		if cmd, ok := engineCommands[name]; ok {
+			replies = append(replies, cmd.exec(e, tx, cmdLine[1:]))
+			continue
+		}
+		db := e.selectDb(conn.GetDbIndex()).withExec(ex)
+		// 事务中不能阻塞，阻塞命令直接按超时处理
+		reply := db.execWithUndo(cmdLine)
+		if _, ok := reply.(*abortReply); ok {
+			ex.rollback(executionMark{})
+			return unwrapAbort(reply)
+		}
+		replies = append(replies, reply)
+	}
+	e.aof.SaveTransaction(ex.aofIndexes, ex.aofCommands)
+	return proto.NewMixReply(replies...)
+}
@@ -0,0 +1,296 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+// aof中的命令按顺序出现
+func expectAofOrder(t *testing.T, commands ...string) {
+	t.Helper()
+	aof := readAof(t)
+	pos := 0
+	for _, command := range commands {
+		i := strings.Index(aof[pos:], "\r\n"+command+"\r\n")
+		if i < 0 {
+			t.Fatalf("%s is not found in aof after position %d:\n%q", command, pos, aof)
+		}
+		pos += i + len(command)
+	}
+}
+
+func TestMultiExec(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "EXEC", "-ERR EXEC without MULTI")
+	expectReply(t, e, c, "DISCARD", "-ERR DISCARD without MULTI")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "MULTI", "-ERR MULTI calls can not be nested")
+	expectReply(t, e, c, "SET a 1", "+QUEUED")
+	expectReply(t, e, c, "INCR a", "+QUEUED")
+	expectReply(t, e, c, "SELECT 1", "+QUEUED")
+	expectReply(t, e, c, "SET b 2", "+QUEUED")
+	expectReply(t, e, c, "PING", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "*5 +ok :2 +ok +ok +pong")
+	expectReply(t, e, c, "GET b", "$1 2")
+
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "SET b 3", "+QUEUED")
+	expectReply(t, e, c, "DISCARD", "+ok")
+	expectReply(t, e, c, "GET b", "$1 2")
+	// 空事务
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "EXEC", "*0")
+	expectAofOrder(t, "multi", "set", "incr", "select", "set", "exec")
+
+	e = reloadTestEngine(t, e)
+	c = gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "GET a", "$1 2")
+	expectReply(t, e, c, "SELECT 1", "+ok")
+	expectReply(t, e, c, "GET b", "$1 2")
+}
+
+func TestExecAbort(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "SET a 1", "+QUEUED")
+	expectReply(t, e, c, "NOSUCH x", "-ERR 未知的命令：nosuch")
+	expectReply(t, e, c, "SET a", "-ERR wrong number of arguments for 'set' command")
+	expectReply(t, e, c, "SWAPDB 0", "-ERR wrong number of arguments for 'swapdb' command")
+	expectReply(t, e, c, "SUBSCRIBE ch", "-ERR Command not allowed inside a transaction")
+	expectReply(t, e, c, "EXEC", "-EXECABORT Transaction discarded because of previous errors.")
+	expectReply(t, e, c, "EXISTS a", ":0")
+
+	// 执行时出错的命令不影响其他命令
+	expectReply(t, e, c, "SET s x", "+ok")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "INCR s", "+QUEUED")
+	expectReply(t, e, c, "SET a 1", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "*2 -ERR value is not an integer or out of range +ok")
+	expectReply(t, e, c, "GET a", "$1 1")
+}
+
+func TestWatch(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	other := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "WATCH", "-ERR wrong number of arguments for 'watch' command")
+	expectReply(t, e, c, "WATCH a", "+ok")
+	expectReply(t, e, other, "SET a 2", "+ok")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "WATCH b", "-ERR WATCH inside MULTI is not allowed")
+	expectReply(t, e, c, "SET a 3", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "*-1")
+	expectReply(t, e, c, "GET a", "$1 2")
+
+	// EXEC之后不再WATCH
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "SET a 3", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "*1 +ok")
+
+	// 只读命令和没有修改的key不会让事务失败
+	expectReply(t, e, c, "WATCH a b", "+ok")
+	expectReply(t, e, other, "GET a", "$1 3")
+	expectReply(t, e, other, "SET c 1", "+ok")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "INCR a", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "*1 :4")
+
+	expectReply(t, e, c, "WATCH a", "+ok")
+	expectReply(t, e, c, "UNWATCH", "+ok")
+	expectReply(t, e, other, "SET a 1", "+ok")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "INCR a", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "*1 :2")
+
+	// 过期、清空以及交换db都视为修改
+	expectReply(t, e, c, "WATCH a", "+ok")
+	expectReply(t, e, other, "EXPIRE a 100", ":1")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "EXEC", "*-1")
+	expectReply(t, e, c, "WATCH a", "+ok")
+	expectReply(t, e, other, "FLUSHDB", "+ok")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "EXEC", "*-1")
+	expectReply(t, e, c, "WATCH a", "+ok")
+	expectReply(t, e, other, "SWAPDB 0 1", "+ok")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "EXEC", "*-1")
+
+	// DISCARD同样取消WATCH
+	expectReply(t, e, c, "WATCH a", "+ok")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "DISCARD", "+ok")
+	expectReply(t, e, other, "SET a 1", "+ok")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "GET a", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "*1 $1 1")
+}
+
+// 访问多个db的命令、脚本以及不属于db的命令都可以放进事务
+// 只有真正修改了key的命令才会让WATCH它的事务失败
+func TestWatchModified(t *testing.T) {
+	tests := []struct {
+		setup   string
+		command string
+		changed bool
+	}{
+		{"SET k v", "SET k x NX", false},
+		{"SET k v", "SET k x XX", true},
+		{"SET k v", "LPUSH k x", false},
+		{"SET k v", "DEL none", false},
+		{"SET k v", "DEL k", true},
+		{"SET k v", "EXPIRE k 100 XX", false},
+		{"SET k v", "PERSIST k", false},
+		{"SET k v", "APPEND k x", true},
+		{"SET k v", "SETBIT k 0 1", true},
+		{"RPUSH k a b", "LREM k 0 x", false},
+		{"RPUSH k a b", "LSET k 0 x", true},
+		{"RPUSH k a b", "RPUSH k c", true},
+		{"RPUSH k a b", "LINSERT k BEFORE x y", false},
+		{"HSET k a 1", "HDEL k x", false},
+		{"HSET k a 1", "HSET k a 2", true},
+		{"SADD k a", "SREM k x", false},
+		{"SADD k a", "SADD k b", true},
+		{"ZADD k 1 a", "ZADD k XX 2 x", false},
+		{"ZADD k 1 a", "ZADD k XX 2 a", true},
+		{"ZADD k 1 a", "ZREM k x", false},
+		{"PFADD k a", "PFADD k a", false},
+		{"XADD k 1-1 f v", "XDEL k 2-1", false},
+		{"XADD k 1-1 f v", "XTRIM k MAXLEN 5", false},
+		{"XADD k 1-1 f v", "XTRIM k MAXLEN 0", true},
+		{"XADD k 1-1 f v", "XADD k 2-1 f v", true},
+	}
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	other := gedisconn.NewVirtualConnection()
+	for _, tt := range tests {
+		testExec(e, other, "DEL k")
+		testExec(e, other, tt.setup)
+		expectReply(t, e, c, "WATCH k", "+ok")
+		testExec(e, other, tt.command)
+		expectReply(t, e, c, "MULTI", "+ok")
+		expectReply(t, e, c, "PING", "+QUEUED")
+		want := "*1 +pong"
+		if tt.changed {
+			want = "*-1"
+		}
+		if actual := testExec(e, c, "EXEC"); actual != want {
+			t.Errorf("%s after %s: expected %q, actual %q", tt.command, tt.setup, want, actual)
+		}
+	}
+}
+
+// 客户端断开连接后释放它WATCH的key，事务也被放弃
+func TestCloseConn(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	other := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "WATCH a b", "+ok")
+	expectReply(t, e, c, "SELECT 1", "+ok")
+	expectReply(t, e, c, "WATCH a", "+ok")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "SET a 1", "+QUEUED")
+	expectReply(t, e, other, "WATCH a", "+ok")
+	e.CloseConn(c)
+
+	if c.InMultiState() || len(c.GetQueuedCmdLine()) != 0 || len(c.GetWatching()) != 0 {
+		t.Error("transaction state is kept after the connection is closed")
+	}
+	if keys := e.selectDb(1).watched.keys; len(keys) != 0 {
+		t.Errorf("watched keys of db 1 are leaked: %v", keys)
+	}
+	keys := e.selectDb(0).watched.keys
+	if len(keys) != 1 || keys["a"] == nil || keys["a"].refs != 1 {
+		t.Errorf("unexpected watched keys of db 0: %v", keys)
+	}
+	expectReply(t, e, c, "EXISTS a", ":0")
+
+	// 其他客户端的WATCH不受影响
+	expectReply(t, e, c, "SELECT 0", "+ok")
+	expectReply(t, e, c, "SET a 1", "+ok")
+	expectReply(t, e, other, "MULTI", "+ok")
+	expectReply(t, e, other, "GET a", "+QUEUED")
+	expectReply(t, e, other, "EXEC", "*-1")
+	if keys := e.selectDb(0).watched.keys; len(keys) != 0 {
+		t.Errorf("watched keys of db 0 are leaked: %v", keys)
+	}
+}
+
+func TestMultiEngineCommands(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MSET a 1 b x", "+ok")
+	expectReply(t, e, c, "MULTI", "+ok")
+	for _, line := range []string{
+		"MOVE a 1",
+		"SWAPDB 0 1",
+		"GET a",
+		"COPY a c DB 2",
+		"EVAL return(redis.call('incr',KEYS[1])) 1 a",
+		"PUBLISH ch m",
+		"UNWATCH",
+		"MEMORY USAGE a",
+		"SELECT 1",
+		"FLUSHDB",
+		"PING",
+	} {
+		expectReply(t, e, c, line, "+QUEUED")
+	}
+	expectReply(t, e, c, "EXEC", "*11 :1 +ok $1 1 :1 :2 :0 +ok :122 +ok +ok +pong")
+	expectReply(t, e, c, "DBSIZE", ":0")
+	expectAofOrder(t, "multi", "move", "swapdb", "copy", "incr", "flushdb", "exec")
+
+	check := func(e *Engine) {
+		t.Helper()
+		c := gedisconn.NewVirtualConnection()
+		expectReply(t, e, c, "MGET a b", "*2 $1 2 $-1")
+		expectReply(t, e, c, "SELECT 1", "+ok")
+		expectReply(t, e, c, "DBSIZE", ":0")
+		expectReply(t, e, c, "SELECT 2", "+ok")
+		expectReply(t, e, c, "GET c", "$1 1")
+	}
+	check(e)
+	check(reloadTestEngine(t, e))
+}
+
+// 事务失败时撤销清空和交换db
+func TestMultiEngineCommandsRollback(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1 EX 100", "+ok")
+	expectReply(t, e, c, "SELECT 1", "+ok")
+	expectReply(t, e, c, "SET b 2", "+ok")
+	expectReply(t, e, c, "SELECT 0", "+ok")
+	// 重新加载aof之前恢复SET
+	t.Run("exec", func(t *testing.T) {
+		injectPanic(t, "set")
+		expectReply(t, e, c, "MULTI", "+ok")
+		expectReply(t, e, c, "SWAPDB 0 1", "+QUEUED")
+		expectReply(t, e, c, "MOVE b 2", "+QUEUED")
+		expectReply(t, e, c, "FLUSHALL", "+QUEUED")
+		expectReply(t, e, c, "SET c 3", "+QUEUED")
+		expectReply(t, e, c, "EXEC", "-ERR injected panic")
+	})
+
+	check := func(e *Engine) {
+		t.Helper()
+		c := gedisconn.NewVirtualConnection()
+		expectReply(t, e, c, "MGET a b c", "*3 $1 1 $-1 $-1")
+		expectTTL(t, e, c, "a", 100)
+		expectReply(t, e, c, "SELECT 1", "+ok")
+		expectReply(t, e, c, "MGET a b", "*2 $-1 $1 2")
+		expectReply(t, e, c, "SELECT 2", "+ok")
+		expectReply(t, e, c, "DBSIZE", ":0")
+	}
+	check(e)
+	for _, command := range []string{"swapdb", "move", "flushall"} {
+		if strings.Contains(readAof(t), command) {
+			t.Errorf("%s of the failed transaction is written to aof", command)
+		}
+	}
+	check(reloadTestEngine(t, e))
+}
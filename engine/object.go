@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"gedis/datastruct/bitmap"
+	"gedis/datastruct/hash"
+	"gedis/datastruct/list"
+	"gedis/datastruct/set"
+	"gedis/datastruct/sortedset"
+	"gedis/datastruct/stream"
+	"gedis/gedis/proto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 不超过该长度的字符串视为embstr
+	embstrSizeLimit = 44
+)
+
+// 获取对象当前使用的编码
+func getEncoding(object any) string {
+	switch obj := object.(type) {
+	case []byte:
+		if len(obj) <= 20 {
+			if v, err := strconv.ParseInt(string(obj), 10, 64); err == nil && strconv.FormatInt(v, 10) == string(obj) {
+				return "int"
+			}
+		}
+		if len(obj) <= embstrSizeLimit {
+			return "embstr"
+		}
+		return "raw"
+	case bitmap.BitMap:
+		return "raw"
+	case *list.QuickList:
+		return "quicklist"
+	case *hash.Hash:
+		return "hashtable"
+	case *set.Set:
+		return obj.Encoding()
+	case *sortedset.SortedSet:
+		return "skiplist"
+	case *stream.Stream:
+		return "stream"
+	case ModuleObject:
+		return "module"
+	}
+	return "unknown"
+}
+
+// OBJECT ENCODING | IDLETIME | FREQ | REFCOUNT key
+func cmdObject(db *DB, args [][]byte) proto.Reply {
+	subCommand := strings.ToUpper(string(args[0]))
+	switch subCommand {
+	case "ENCODING", "IDLETIME", "FREQ", "REFCOUNT":
+	default:
+		return proto.NewGenericErrReply("unknown subcommand '" + string(args[0]) + "'")
+	}
+	if len(args) != 2 {
+		return proto.NewArgNumErrReply("object|" + strings.ToLower(subCommand))
+	}
+	// 查看key的信息不算一次访问
+	dataEntity, exist := db.peekEntity(string(args[1]))
+	if !exist {
+		return proto.NewNullBulkReply()
+	}
+	switch subCommand {
+	case "ENCODING":
+		return proto.NewBulkReply([]byte(getEncoding(dataEntity.Object)))
+	case "IDLETIME":
+		return proto.NewIntegerReply(int64(dataEntity.IdleTime() / time.Second))
+	case "FREQ":
+		return proto.NewIntegerReply(int64(dataEntity.Freq()))
+	}
+	// 对象不会被多个key共享
+	return proto.NewIntegerReply(1)
+}
+
+func init() {
+	registerCommand("Object", cmdObject, readSubCommandKey, -2)
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gedis/gedis/conn"
+)
+
+func TestObjectEncoding(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MSET i 123 s abc n 0123", "+ok")
+	expectReply(t, e, c, "SET r "+strings.Repeat("x", embstrSizeLimit+1), "+ok")
+	expectReply(t, e, c, "RPUSH l a", ":1")
+	expectReply(t, e, c, "HSET h f v", ":1")
+	expectReply(t, e, c, "SADD is 1 2", ":2")
+	expectReply(t, e, c, "SADD hs 1 a", ":2")
+	expectReply(t, e, c, "ZADD z 1 m", ":1")
+	expectReply(t, e, c, "XADD x 1-1 f v", "$3 1-1")
+
+	encodings := map[string]string{
+		"i": "int", "s": "embstr", "n": "embstr", "r": "raw", "l": "quicklist", "h": "hashtable",
+		"is": "intset", "hs": "hashtable", "z": "skiplist", "x": "stream",
+	}
+	for key, encoding := range encodings {
+		expectReply(t, e, c, "OBJECT ENCODING "+key, "$"+strconv.Itoa(len(encoding))+" "+encoding)
+	}
+	// 加入非整数成员后转换为hashtable
+	expectReply(t, e, c, "SADD is a", ":1")
+	expectReply(t, e, c, "OBJECT ENCODING is", "$9 hashtable")
+	expectReply(t, e, c, "OBJECT ENCODING none", "$-1")
+	expectReply(t, e, c, "OBJECT REFCOUNT l", ":1")
+	expectReply(t, e, c, "OBJECT HELP", "-ERR unknown subcommand 'HELP'")
+	expectReply(t, e, c, "OBJECT ENCODING", "-ERR wrong number of arguments for 'object|encoding' command")
+	expectReply(t, e, c, "OBJECT FREQ a b", "-ERR wrong number of arguments for 'object|freq' command")
+
+	e = reloadTestEngine(t, e)
+	encodings["is"] = "hashtable"
+	for key, encoding := range encodings {
+		expectReply(t, e, c, "OBJECT ENCODING "+key, "$"+strconv.Itoa(len(encoding))+" "+encoding)
+	}
+	if aof := readAof(t); strings.Contains(aof, "object") {
+		t.Error("OBJECT is written to aof")
+	}
+}
+
+func TestObjectIdleTimeFreq(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1", "+ok")
+	freq := func() int {
+		n, _ := strconv.Atoi(strings.TrimPrefix(testExec(e, c, "OBJECT FREQ a"), ":"))
+		return n
+	}
+	initial := freq()
+	if initial < 5 {
+		t.Fatalf("unexpected initial freq %d", initial)
+	}
+	for i := 0; i < 100; i++ {
+		testExec(e, c, "GET a")
+	}
+	if n := freq(); n <= initial {
+		t.Errorf("freq is not increased by access: %d", n)
+	}
+
+	// 查看key的信息不算一次访问
+	time.Sleep(1100 * time.Millisecond)
+	expectReply(t, e, c, "OBJECT IDLETIME a", ":1")
+	expectReply(t, e, c, "OBJECT IDLETIME a", ":1")
+	expectReply(t, e, c, "TYPE a", "+string")
+	expectReply(t, e, c, "MEMORY USAGE a", ":122")
+	expectReply(t, e, c, "OBJECT IDLETIME a", ":1")
+	expectReply(t, e, c, "GET a", "$1 1")
+	expectReply(t, e, c, "OBJECT IDLETIME a", ":0")
+	expectReply(t, e, c, "OBJECT IDLETIME none", "$-1")
+}
+
+func TestMemoryUsage(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	// key的开销 + key的长度 + 对象的大小
+	expectReply(t, e, c, "SET s abc", "+ok")
+	expectReply(t, e, c, "MEMORY USAGE s", ":"+strconv.Itoa(keyOverhead+1+3+sliceOverhead))
+	expectReply(t, e, c, "RPUSH l a bbb", ":2")
+	// 按照前SAMPLES个元素估算，0表示统计全部元素
+	expectReply(t, e, c, "MEMORY USAGE l SAMPLES 1", ":"+strconv.Itoa(keyOverhead+1+sliceOverhead+2*(1+sliceOverhead)))
+	expectReply(t, e, c, "MEMORY USAGE l SAMPLES 0", ":"+strconv.Itoa(keyOverhead+1+sliceOverhead+(1+sliceOverhead)+(3+sliceOverhead)))
+	expectReply(t, e, c, "SADD is 1 2 3", ":3")
+	expectReply(t, e, c, "MEMORY USAGE is", ":"+strconv.Itoa(keyOverhead+2+sliceOverhead+3*8))
+	expectReply(t, e, c, "MEMORY USAGE none", "$-1")
+
+	expectReply(t, e, c, "MEMORY USAGE s SAMPLES -1", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "MEMORY USAGE s SAMPLES x", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "MEMORY USAGE s COUNT 1", "-ERR syntax error")
+	expectReply(t, e, c, "MEMORY USAGE s SAMPLES", "-ERR wrong number of arguments for 'memory|usage' command")
+	expectReply(t, e, c, "MEMORY", "-ERR wrong number of arguments for 'memory' command")
+	expectReply(t, e, c, "MEMORY STATS", "-ERR unknown subcommand 'STATS'")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "MEMORY USAGE l SAMPLES 0", ":"+strconv.Itoa(keyOverhead+1+sliceOverhead+(1+sliceOverhead)+(3+sliceOverhead)))
+	if aof := readAof(t); strings.Contains(aof, "memory") {
+		t.Error("MEMORY is written to aof")
+	}
+}
+
+func TestMemoryDoctor(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MEMORY DOCTOR x", "-ERR wrong number of arguments for 'memory|doctor' command")
+	expectReply(t, e, c, "MSET a 1 b 12345", "+ok")
+	expectReply(t, e, c, "RPUSH l a b c", ":3")
+	expectReply(t, e, c, "SELECT 3", "+ok")
+	expectReply(t, e, c, "RPUSH l2 a", ":1")
+	expectReply(t, e, c, "HSET h f v", ":1")
+
+	report := testExec(e, c, "MEMORY DOCTOR")
+	for _, want := range []string{
+		"# Scanned 5 keys in 2 dbs",
+		"Biggest string found 'db0:b' has 5 bytes",
+		"Biggest   list found 'db0:l' has 3 items",
+		"Biggest   hash found 'db3:h' has 1 fields",
+		"2 strings with 6 bytes (40.00% of keys, avg size 3.00)",
+		"2 lists with 4 items (40.00% of keys, avg size 2.00)",
+		"0 zsets with 0 members",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not contain %q:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package engine
+
+import "gedis/gedis/proto"
+
+// count为负数时允许重复，返回的数量与集合大小无关，需要限制避免分配过大的内存
+const maxRandCount = 1 << 24
+
+// HRANDFIELD、SRANDMEMBER、ZRANDMEMBER的count，同时返回值时回复的长度翻倍
+func checkRandCount(count int64, withValues bool) proto.Reply {
+	limit := int64(maxRandCount)
+	if withValues {
+		limit /= 2
+	}
+	if count < -limit {
+		return proto.NewGenericErrReply("value is out of range")
+	}
+	return nil
+}
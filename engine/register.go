@@ -2,6 +2,7 @@ package engine
 
 import (
 	"gedis/gedis/proto"
+	"strconv"
 	"strings"
 )
 
@@ -16,10 +17,105 @@ type command struct {
 	execFunc ExecFunc
 	keyFunc  KeyFunc
 	argsNum  int // number of arguments 负数表示要大于后面的值
+	// 模块命令的属性
+	flags CommandFlag
 }
 
-func registerCommand(name string, execFunc ExecFunc, keyFunc KeyFunc, argsNum int) {
+func registerCommand(name string, execFunc ExecFunc, keyFunc KeyFunc, argsNum int) *command {
 	name = strings.ToLower(name)
-	cmd := command{name, execFunc, keyFunc, argsNum}
-	commandCenter[name] = &cmd
+	cmd := &command{name: name, execFunc: execFunc, keyFunc: keyFunc, argsNum: argsNum}
+	commandCenter[name] = cmd
+	return cmd
+}
+
+// 常用的KeyFunc，返回需要加写锁和读锁的key
+
+func noKeys(args [][]byte) ([]string, []string) {
+	return nil, nil
+}
+
+func writeFirstKey(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, nil
+}
+
+func readFirstKey(args [][]byte) ([]string, []string) {
+	return nil, []string{string(args[0])}
+}
+
+func writeAllKeys(args [][]byte) ([]string, []string) {
+	return toStrings(args), nil
+}
+
+func readAllKeys(args [][]byte) ([]string, []string) {
+	return nil, toStrings(args)
+}
+
+// 前两个参数都是会被修改的key
+func writeFirstTwoKeys(args [][]byte) ([]string, []string) {
+	return toStrings(args[:2]), nil
+}
+
+func readFirstTwoKeys(args [][]byte) ([]string, []string) {
+	return nil, toStrings(args[:2])
+}
+
+// 第一个参数为写入的目标key，第二个参数为读取的key
+func writeFirstReadSecond(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+// 第一个参数为写入的目标key，其余参数都是读取的key
+func writeFirstReadOthers(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, toStrings(args[1:])
+}
+
+// key value 交替出现
+func writeEvenKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, (len(args)+1)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+	return keys, nil
+}
+
+// args[offset]为key的个数，后面紧跟着这些key
+func numKeys(args [][]byte, offset int) []string {
+	if offset >= len(args) {
+		return nil
+	}
+	n, err := strconv.Atoi(string(args[offset]))
+	if err != nil || n <= 0 {
+		return nil
+	}
+	end := offset + 1 + n
+	if end > len(args) {
+		end = len(args)
+	}
+	return toStrings(args[offset+1 : end])
+}
+
+// numkeys key [key ...] ...
+func readNumKeys(args [][]byte) ([]string, []string) {
+	return nil, numKeys(args, 0)
+}
+
+// destination numkeys key [key ...] ...
+func writeFirstReadNumKeys(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, numKeys(args, 1)
+}
+
+// 子命令之后的第一个参数为key，例如 OBJECT ENCODING key
+func subCommandKey(args [][]byte) []string {
+	if len(args) < 2 {
+		return nil
+	}
+	return []string{string(args[1])}
+}
+
+func readSubCommandKey(args [][]byte) ([]string, []string) {
+	return nil, subCommandKey(args)
+}
+
+func writeSubCommandKey(args [][]byte) ([]string, []string) {
+	return subCommandKey(args), nil
 }
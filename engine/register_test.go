@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+func TestKeyFunc(t *testing.T) {
+	for name, cmd := range commandCenter {
+		if cmd.keyFunc == nil {
+			t.Errorf("%s has no keyFunc", name)
+		}
+	}
+
+	tests := []struct {
+		line  string
+		write []string
+		read  []string
+	}{
+		{"SET a 1 EX 10", []string{"a"}, nil},
+		{"GET a", nil, []string{"a"}},
+		{"MSET a 1 b 2", []string{"a", "b"}, nil},
+		{"MGET a b", nil, []string{"a", "b"}},
+		{"DEL a b", []string{"a", "b"}, nil},
+		{"RENAME a b", []string{"a", "b"}, nil},
+		{"LMOVE a b LEFT RIGHT", []string{"a", "b"}, nil},
+		{"SMOVE a b m", []string{"a", "b"}, nil},
+		{"SINTERSTORE d a b", []string{"d"}, []string{"a", "b"}},
+		{"SINTERCARD 2 a b LIMIT 1", nil, []string{"a", "b"}},
+		{"ZUNIONSTORE d 2 a b WEIGHTS 1 2", []string{"d"}, []string{"a", "b"}},
+		{"ZINTER 2 a b", nil, []string{"a", "b"}},
+		{"ZRANGESTORE d a 0 -1", []string{"d"}, []string{"a"}},
+		{"BITOP AND d a b", []string{"d"}, []string{"a", "b"}},
+		{"PFMERGE d a b", []string{"d"}, []string{"a", "b"}},
+		{"GEOSEARCHSTORE d a FROMLONLAT 0 0 BYRADIUS 1 km", []string{"d"}, []string{"a"}},
+		{"LCS a b", nil, []string{"a", "b"}},
+		{"OBJECT ENCODING a", nil, []string{"a"}},
+		{"XREAD COUNT 1 STREAMS a b 0 0", nil, []string{"a", "b"}},
+		{"XREADGROUP GROUP g c STREAMS a b > >", []string{"a", "b"}, nil},
+		{"XGROUP CREATE a g $", []string{"a"}, nil},
+	}
+	for _, tt := range tests {
+		fields := strings.Fields(tt.line)
+		args := make([][]byte, len(fields)-1)
+		for i, field := range fields[1:] {
+			args[i] = []byte(field)
+		}
+		write, read := commandCenter[strings.ToLower(fields[0])].keyFunc(args)
+		if !reflect.DeepEqual(write, tt.write) || !reflect.DeepEqual(read, tt.read) {
+			t.Errorf("%s: expected %v %v, actual %v %v", tt.line, tt.write, tt.read, write, read)
+		}
+	}
+}
+
+// 多key命令执行期间其他命令不能访问这些key
+func TestKeyLock(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "RPUSH l1 a b c d e", ":5")
+	expectReply(t, e, c, "SADD s1 a b c d e", ":5")
+
+	const n, writers = 1000, 8
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := gedisconn.NewVirtualConnection()
+			for j := 0; j < n; j++ {
+				v := strconv.Itoa(i*n + j)
+				testExec(e, c, "MSET a "+v+" b "+v)
+				testExec(e, c, "INCR counter")
+				testExec(e, c, "LMOVE l1 l2 LEFT RIGHT")
+				testExec(e, c, "LMOVE l2 l1 LEFT RIGHT")
+				testExec(e, c, "SMOVE s1 s2 "+string(rune('a'+j%5)))
+				testExec(e, c, "SMOVE s2 s1 "+string(rune('a'+(j+2)%5)))
+			}
+		}(i)
+	}
+	done := make(chan struct{})
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		c := gedisconn.NewVirtualConnection()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			reply := strings.Fields(testExec(e, c, "MGET a b"))
+			if len(reply) == 5 && reply[2] != reply[4] {
+				t.Errorf("MGET sees a half applied MSET: %v", reply)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(done)
+	<-read
+
+	check := func(e *Engine) {
+		t.Helper()
+		c := gedisconn.NewVirtualConnection()
+		expectReply(t, e, c, "GET counter", "$4 "+strconv.Itoa(writers*n))
+		reply := strings.Fields(testExec(e, c, "MGET a b"))
+		if reply[2] != reply[4] {
+			t.Errorf("a and b differ: %v", reply)
+		}
+		llen1, _ := strconv.Atoi(strings.TrimPrefix(testExec(e, c, "LLEN l1"), ":"))
+		llen2, _ := strconv.Atoi(strings.TrimPrefix(testExec(e, c, "LLEN l2"), ":"))
+		if llen1+llen2 != 5 {
+			t.Errorf("elements of the lists are lost: %d + %d", llen1, llen2)
+		}
+		card1, _ := strconv.Atoi(strings.TrimPrefix(testExec(e, c, "SCARD s1"), ":"))
+		card2, _ := strconv.Atoi(strings.TrimPrefix(testExec(e, c, "SCARD s2"), ":"))
+		if card1+card2 != 5 {
+			t.Errorf("members of the sets are lost: %d + %d", card1, card2)
+		}
+	}
+	check(e)
+	state := testExec(e, c, "MGET a b")
+	lists := testExec(e, c, "LRANGE l1 0 -1") + testExec(e, c, "LRANGE l2 0 -1")
+
+	// aof中的顺序与执行顺序一致，重新加载后得到相同的结果
+	e = reloadTestEngine(t, e)
+	check(e)
+	expectReply(t, e, c, "MGET a b", state)
+	if actual := testExec(e, c, "LRANGE l1 0 -1") + testExec(e, c, "LRANGE l2 0 -1"); actual != lists {
+		t.Errorf("lists after reload: expected %q, actual %q", lists, actual)
+	}
+}
@@ -0,0 +1,312 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	gedisconn "gedis/gedis/conn"
+	"gedis/gedis/proto"
+	"gedis/iface"
+	"strconv"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+const (
+	scriptKilledErr = "ERR Script killed by user with SCRIPT KILL..."
+	unkillableErr   = "UNKILLABLE Sorry the script already executed write commands against the dataset. " +
+		"You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command."
+)
+
+// 脚本缓存，key为脚本的sha1
+type scriptCache struct {
+	mu      sync.RWMutex
+	scripts map[string]*lua.FunctionProto
+	// 正在执行的脚本
+	running map[*scriptRun]struct{}
+}
+
+func newScriptCache() *scriptCache {
+	return &scriptCache{
+		scripts: make(map[string]*lua.FunctionProto),
+		running: make(map[*scriptRun]struct{}),
+	}
+}
+
+func scriptSha(script []byte) string {
+	sum := sha1.Sum(script)
+	return hex.EncodeToString(sum[:])
+}
+
+// 编译并缓存脚本，返回sha1
+func (c *scriptCache) load(script []byte) (string, *lua.FunctionProto, error) {
+	sha := scriptSha(script)
+	c.mu.RLock()
+	fnProto, ok := c.scripts[sha]
+	c.mu.RUnlock()
+	if ok {
+		return sha, fnProto, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(string(script)), "@user_script")
+	if err != nil {
+		return "", nil, err
+	}
+	fnProto, err = lua.Compile(chunk, "@user_script")
+	if err != nil {
+		return "", nil, err
+	}
+	c.mu.Lock()
+	c.scripts[sha] = fnProto
+	c.mu.Unlock()
+	return sha, fnProto, nil
+}
+
+func (c *scriptCache) get(sha string) (*lua.FunctionProto, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fnProto, ok := c.scripts[strings.ToLower(sha)]
+	return fnProto, ok
+}
+
+func (c *scriptCache) exists(sha string) bool {
+	_, ok := c.get(sha)
+	return ok
+}
+
+func (c *scriptCache) flush() {
+	c.mu.Lock()
+	c.scripts = make(map[string]*lua.FunctionProto)
+	c.mu.Unlock()
+}
+
+func (c *scriptCache) start(run *scriptRun) {
+	c.mu.Lock()
+	c.running[run] = struct{}{}
+	c.mu.Unlock()
+}
+
+func (c *scriptCache) finish(run *scriptRun) {
+	c.mu.Lock()
+	delete(c.running, run)
+	c.mu.Unlock()
+}
+
+// 终止所有正在执行的脚本，已经执行过写命令的脚本不能被终止
+func (c *scriptCache) kill() proto.Reply {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.running) == 0 {
+		return proto.NewSimpleErrReply("NOTBUSY No scripts in execution right now.")
+	}
+	for run := range c.running {
+		run.mu.Lock()
+		written := len(run.ex.aofCommands) > run.start.aof
+		run.mu.Unlock()
+		if written {
+			return proto.NewSimpleErrReply(unkillableErr)
+		}
+	}
+	for run := range c.running {
+		run.kill()
+	}
+	return proto.NewOkReply()
+}
+
+// scriptRun 一次脚本执行，同时作为脚本中调用命令使用的虚拟连接
+type scriptRun struct {
+	*gedisconn.VirtualConn
+
+	// 脚本开始时所在的db以及声明的key，执行期间这些key一直被锁住
+	db   *DB
+	keys map[string]struct{}
+
+	mu     sync.Mutex
+	killed bool
+	cancel context.CancelFunc
+	// 脚本中的写命令产生的aof，最后作为一个整体写入；
+	// 事务中的脚本与事务共用执行上下文，aof随事务一起写入，start为脚本开始时的位置
+	ex    *execution
+	start executionMark
+}
+
+func (r *scriptRun) kill() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.killed = true
+	r.cancel()
+}
+
+// 执行脚本中调用的db命令，key已经在脚本开始时锁住，这里不再加锁
+func (r *scriptRun) exec(db *DB, command [][]byte) proto.Reply {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.killed {
+		return proto.NewSimpleErrReply(scriptKilledErr)
+	}
+	cmdName := strings.ToLower(string(command[0]))
+	if cmd, ok := commandCenter[cmdName]; ok && cmd.keyFunc != nil && validateArgsNum(cmd.argsNum, command) {
+		writeKeys, readKeys := cmd.keyFunc(command[1:])
+		for _, keys := range [][]string{writeKeys, readKeys} {
+			for _, key := range keys {
+				if !r.declared(db, key) {
+					return proto.NewGenericErrReply("Script attempted to access a non-declared key: " + key)
+				}
+			}
+		}
+	}
+	// 命令失败时只撤销这一条命令，脚本中已经执行的命令仍然有效
+	reply := unwrapAbort(db.withExec(r.ex).execWithUndo(command))
+	// 脚本中不能阻塞，阻塞命令直接按超时处理
+	if _, ok := reply.(*blockedReply); ok {
+		return proto.NewNullMultiBulkReply()
+	}
+	return reply
+}
+
+// 只能访问脚本开始时所在db中声明过的key
+func (r *scriptRun) declared(db *DB, key string) bool {
+	if db != r.db {
+		return false
+	}
+	_, ok := r.keys[key]
+	return ok
+}
+
+// numkeys key [key ...] arg [arg ...]
+func parseScriptArgs(args [][]byte) ([][]byte, [][]byte, proto.Reply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, nil, proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return nil, nil, proto.NewGenericErrReply("Number of keys can't be negative")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, proto.NewGenericErrReply("Number of keys can't be greater than number of args")
+	}
+	return args[1 : 1+numKeys], args[1+numKeys:], nil
+}
+
+// EVAL script numkeys [key [key ...]] [arg [arg ...]]
+func (e *Engine) execEval(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) < 2 {
+		return proto.NewArgNumErrReply("eval")
+	}
+	_, fnProto, err := e.scripts.load(args[0])
+	if err != nil {
+		return proto.NewGenericErrReply("Error compiling script (new function): " + singleLine(err.Error()))
+	}
+	return e.runScript(conn, fnProto, args[1:])
+}
+
+// EVALSHA sha1 numkeys [key [key ...]] [arg [arg ...]]
+func (e *Engine) execEvalSha(conn iface.Conn, args [][]byte) proto.Reply {
+	if len(args) < 2 {
+		return proto.NewArgNumErrReply("evalsha")
+	}
+	fnProto, ok := e.scripts.get(string(args[0]))
+	if !ok {
+		return proto.NewSimpleErrReply("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return e.runScript(conn, fnProto, args[1:])
+}
+
+// 锁住声明的key后执行脚本，其他客户端在脚本执行期间不能访问这些key
+func (e *Engine) runScript(conn iface.Conn, fnProto *lua.FunctionProto, args [][]byte) proto.Reply {
+	keys, argv, reply := parseScriptArgs(args)
+	if reply != nil {
+		return reply
+	}
+	db := e.selectDb(conn.GetDbIndex())
+	run := &scriptRun{
+		VirtualConn: gedisconn.NewVirtualConnection(),
+		db:          db,
+		keys:        make(map[string]struct{}, len(keys)),
+		ex:          &execution{},
+	}
+	tx, inTx := conn.(*txConn)
+	if inTx {
+		run.ex = tx.ex
+		run.start = tx.ex.mark()
+	}
+	run.SetDbIndex(conn.GetDbIndex())
+	for _, key := range keys {
+		run.keys[string(key)] = struct{}{}
+	}
+	lockKeys := toStrings(keys)
+	db.locker.Locks(lockKeys...)
+	defer db.locker.Unlocks(lockKeys...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	run.cancel = cancel
+	e.scripts.start(run)
+	defer e.scripts.finish(run)
+
+	L := newScriptState(e, run, keys, argv)
+	defer L.Close()
+	L.SetContext(ctx)
+	L.Push(L.NewFunctionFromProto(fnProto))
+	err := L.PCall(0, 1, nil)
+	// 脚本出错时已经执行的写命令仍然有效，同样需要写入aof
+	if !inTx {
+		e.aof.SaveTransaction(run.ex.aofIndexes, run.ex.aofCommands)
+	}
+	if err != nil {
+		run.mu.Lock()
+		killed := run.killed
+		run.mu.Unlock()
+		if killed {
+			return proto.NewSimpleErrReply(scriptKilledErr)
+		}
+		return scriptErrorReply(err)
+	}
+	return luaToReply(L.Get(-1))
+}
+
+// SCRIPT LOAD|EXISTS|FLUSH|KILL
+func (e *Engine) execScript(args [][]byte) proto.Reply {
+	if len(args) == 0 {
+		return proto.NewArgNumErrReply("script")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "load":
+		if len(args) != 2 {
+			return proto.NewArgNumErrReply("script|load")
+		}
+		sha, _, err := e.scripts.load(args[1])
+		if err != nil {
+			return proto.NewGenericErrReply("Error compiling script (new function): " + singleLine(err.Error()))
+		}
+		return proto.NewBulkReply([]byte(sha))
+	case "exists":
+		if len(args) < 2 {
+			return proto.NewArgNumErrReply("script|exists")
+		}
+		replies := make([]proto.Reply, 0, len(args)-1)
+		for _, sha := range args[1:] {
+			exists := int64(0)
+			if e.scripts.exists(string(sha)) {
+				exists = 1
+			}
+			replies = append(replies, proto.NewIntegerReply(exists))
+		}
+		return proto.NewMixReply(replies...)
+	case "flush":
+		if _, reply := parseFlushMode(args[1:]); reply != nil {
+			return reply
+		}
+		e.scripts.flush()
+		return proto.NewOkReply()
+	case "kill":
+		if len(args) != 1 {
+			return proto.NewArgNumErrReply("script|kill")
+		}
+		return e.scripts.kill()
+	}
+	return proto.NewGenericErrReply("unknown subcommand '" + subCmd + "'. Try SCRIPT HELP.")
+}
@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gedis/gedis/conn"
+)
+
+// 脚本中包含空格，参数需要逐个传入
+func scriptExec(e *Engine, c *gedisconn.VirtualConn, args ...string) string {
+	command := make([][]byte, len(args))
+	for i, arg := range args {
+		command[i] = []byte(arg)
+	}
+	reply := e.Exec(c, command)
+	return strings.TrimSpace(strings.ReplaceAll(string(reply.Bytes()), "\r\n", " "))
+}
+
+func expectScriptReply(t *testing.T, e *Engine, c *gedisconn.VirtualConn, want string, args ...string) {
+	t.Helper()
+	if actual := scriptExec(e, c, args...); actual != want {
+		t.Errorf("%q: expected %q, actual %q", args, want, actual)
+	}
+}
+
+func TestEval(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectScriptReply(t, e, c, ":1", "EVAL", "return 1", "0")
+	expectScriptReply(t, e, c, ":3", "EVAL", "return 3.99", "0")
+	expectScriptReply(t, e, c, "*3 :1 $1 a *1 :2", "EVAL", "return {1, 'a', {2}}", "0")
+	// 数组遇到nil就结束
+	expectScriptReply(t, e, c, "*1 :1", "EVAL", "return {1, nil, 2}", "0")
+	expectScriptReply(t, e, c, ":1", "EVAL", "return true", "0")
+	expectScriptReply(t, e, c, "$-1", "EVAL", "return false", "0")
+	expectScriptReply(t, e, c, "$-1", "EVAL", "return nil", "0")
+	expectScriptReply(t, e, c, "+FINE", "EVAL", "return redis.status_reply('FINE')", "0")
+	expectScriptReply(t, e, c, "-ERR my error", "EVAL", "return redis.error_reply('ERR my error')", "0")
+	expectScriptReply(t, e, c, "*2 $1 k $1 v", "EVAL", "return {KEYS[1], ARGV[1]}", "1", "k", "v")
+	expectScriptReply(t, e, c, "$40 e0e1f9fabfc9d4800c877a703b823ac0578ff8db",
+		"EVAL", "return redis.sha1hex('return 1')", "0")
+
+	expectScriptReply(t, e, c, "+ok", "EVAL", "return redis.call('SET', KEYS[1], ARGV[1])", "1", "a", "1")
+	expectScriptReply(t, e, c, "$1 1", "GET", "a")
+	expectScriptReply(t, e, c, "*2 $1 1 $-1", "EVAL", "return redis.call('MGET', KEYS[1], KEYS[2])", "2", "a", "b")
+
+	expectScriptReply(t, e, c, "-ERR wrong number of arguments for 'eval' command", "EVAL", "return 1")
+	expectScriptReply(t, e, c, "-ERR value is not an integer or out of range", "EVAL", "return 1", "x")
+	expectScriptReply(t, e, c, "-ERR Number of keys can't be negative", "EVAL", "return 1", "-1")
+	expectScriptReply(t, e, c, "-ERR Number of keys can't be greater than number of args", "EVAL", "return 1", "2", "k")
+	if reply := scriptExec(e, c, "EVAL", "return (", "0"); !strings.HasPrefix(reply, "-ERR Error compiling script") {
+		t.Errorf("unexpected reply of bad script: %q", reply)
+	}
+	if reply := scriptExec(e, c, "EVAL", "error('boom')", "0"); !strings.HasPrefix(reply, "-ERR Error running script") ||
+		!strings.Contains(reply, "boom") {
+		t.Errorf("unexpected reply of failed script: %q", reply)
+	}
+	// 访问外部环境的函数不可用
+	expectScriptReply(t, e, c, ":1", "EVAL", "return os == nil and io == nil and dofile == nil and require == nil", "0")
+}
+
+func TestScriptCommand(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	sha := "e0e1f9fabfc9d4800c877a703b823ac0578ff8db"
+	expectScriptReply(t, e, c, "-NOSCRIPT No matching script. Please use EVAL.", "EVALSHA", sha, "0")
+	expectScriptReply(t, e, c, "$40 "+sha, "SCRIPT", "LOAD", "return 1")
+	expectScriptReply(t, e, c, ":1", "EVALSHA", sha, "0")
+	expectScriptReply(t, e, c, ":1", "EVALSHA", strings.ToUpper(sha), "0")
+	expectScriptReply(t, e, c, "*2 :1 :0", "SCRIPT", "EXISTS", sha, "ffffffffffffffffffffffffffffffffffffffff")
+	expectScriptReply(t, e, c, "+ok", "SCRIPT", "FLUSH")
+	expectScriptReply(t, e, c, "*1 :0", "SCRIPT", "EXISTS", sha)
+	// EVAL同样会缓存脚本
+	expectScriptReply(t, e, c, ":1", "EVAL", "return 1", "0")
+	expectScriptReply(t, e, c, "*1 :1", "SCRIPT", "EXISTS", sha)
+	expectScriptReply(t, e, c, "+ok", "SCRIPT", "FLUSH", "ASYNC")
+	expectScriptReply(t, e, c, "*1 :0", "SCRIPT", "EXISTS", sha)
+
+	expectScriptReply(t, e, c, "-ERR syntax error", "SCRIPT", "FLUSH", "LATER")
+	expectScriptReply(t, e, c, "-ERR wrong number of arguments for 'script|load' command", "SCRIPT", "LOAD")
+	expectScriptReply(t, e, c, "-ERR wrong number of arguments for 'script|exists' command", "SCRIPT", "EXISTS")
+	expectScriptReply(t, e, c, "-ERR unknown subcommand 'help'. Try SCRIPT HELP.", "SCRIPT", "HELP")
+	expectScriptReply(t, e, c, "-ERR wrong number of arguments for 'script' command", "SCRIPT")
+	if reply := scriptExec(e, c, "SCRIPT", "LOAD", "return ("); !strings.HasPrefix(reply, "-ERR Error compiling script") {
+		t.Errorf("unexpected reply of bad script: %q", reply)
+	}
+	expectScriptReply(t, e, c, "-NOTBUSY No scripts in execution right now.", "SCRIPT", "KILL")
+}
+
+func TestScriptKill(t *testing.T) {
+	e := newTestEngine(t)
+	done := make(chan string)
+	go func() {
+		done <- scriptExec(e, gedisconn.NewVirtualConnection(), "EVAL", "while true do end", "0")
+	}()
+	c := gedisconn.NewVirtualConnection()
+	deadline := time.Now().Add(2 * time.Second)
+	for scriptExec(e, c, "SCRIPT", "KILL") != "+ok" {
+		if time.Now().After(deadline) {
+			t.Fatal("script is not running")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case reply := <-done:
+		if reply != "-"+scriptKilledErr {
+			t.Errorf("unexpected reply of killed script: %q", reply)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("script is not killed")
+	}
+}
+
+// 脚本只能访问声明过的key，不能调用事务、脚本等命令
+func TestScriptRestrictions(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	undeclared := "-ERR Script attempted to access a non-declared key: b"
+	expectScriptReply(t, e, c, undeclared, "EVAL", "return redis.call('GET', 'b')", "1", "a")
+	expectScriptReply(t, e, c, undeclared, "EVAL", "redis.call('SET', KEYS[1], '1') return redis.call('RENAME', KEYS[1], 'b')", "1", "a")
+	expectScriptReply(t, e, c, undeclared, "EVAL", "return redis.pcall('MGET', KEYS[1], 'b')", "1", "a")
+	// 声明的key只在脚本开始时所在的db中有效
+	expectScriptReply(t, e, c, "-ERR Script attempted to access a non-declared key: a",
+		"EVAL", "redis.call('SELECT', '1') return redis.call('GET', KEYS[1])", "1", "a")
+	expectScriptReply(t, e, c, ":0", "EXISTS", "b")
+
+	forbidden := "-ERR This Redis command is not allowed from script"
+	for _, command := range []string{"'EVAL', 'return 1', '0'", "'MULTI'", "'EXEC'", "'WATCH', KEYS[1]",
+		"'FLUSHALL'", "'SWAPDB', '0', '1'", "'SUBSCRIBE', 'ch'", "'SCRIPT', 'FLUSH'", "'NOSUCH'"} {
+		expectScriptReply(t, e, c, forbidden, "EVAL", "return redis.call("+command+")", "1", "a")
+	}
+	expectScriptReply(t, e, c, "-ERR Please specify at least one argument for this redis lib call",
+		"EVAL", "return redis.call()", "0")
+	expectScriptReply(t, e, c, "-ERR Lua redis lib command arguments must be strings or integers",
+		"EVAL", "return redis.call('GET', {})", "0")
+	expectScriptReply(t, e, c, "+pong", "EVAL", "return redis.call('PING')", "0")
+	// 脚本中不能阻塞，阻塞命令直接按超时处理
+	expectScriptReply(t, e, c, "$-1", "EVAL", "return redis.call('XREAD', 'BLOCK', '0', 'STREAMS', KEYS[1], '$')", "1", "x")
+}
+
+func TestScriptErrors(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET s x", "+ok")
+	notInteger := "-ERR value is not an integer or out of range"
+	// redis.call 的错误中断脚本并原样返回
+	expectScriptReply(t, e, c, notInteger, "EVAL", "redis.call('INCR', KEYS[1]) return 'unreachable'", "1", "s")
+	expectScriptReply(t, e, c, "-ERR wrong number of arguments for 'get' command", "EVAL", "return redis.call('GET')", "0")
+	// redis.pcall 把错误作为返回值交给脚本处理
+	expectScriptReply(t, e, c, "$43 ERR value is not an integer or out of range",
+		"EVAL", "local r = redis.pcall('INCR', KEYS[1]) return r['err']", "1", "s")
+	expectScriptReply(t, e, c, notInteger, "EVAL", "return redis.pcall('INCR', KEYS[1])", "1", "s")
+	expectScriptReply(t, e, c, "$6 caught",
+		"EVAL", "local ok = pcall(redis.call, 'INCR', KEYS[1]) if not ok then return 'caught' end", "1", "s")
+
+	// 出错之前执行的写命令仍然有效，同样写入aof
+	expectScriptReply(t, e, c, notInteger,
+		"EVAL", "redis.call('SET', KEYS[1], '1') redis.call('INCR', KEYS[2])", "2", "a", "s")
+	expectReply(t, e, c, "GET a", "$1 1")
+	expectAofOrder(t, "multi", "set", "exec")
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "MGET a s", "*2 $1 1 $1 x")
+}
+
+// 脚本中的写命令作为一个MULTI/EXEC块写入aof，不记录脚本本身
+func TestScriptAof(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	script := "redis.call('SET', KEYS[1], ARGV[1]) redis.call('INCR', KEYS[1]) " +
+		"redis.call('RPUSH', KEYS[2], redis.call('GET', KEYS[1])) return redis.call('GET', KEYS[1])"
+	expectScriptReply(t, e, c, "$1 2", "EVAL", script, "2", "a", "l", "1")
+	expectReply(t, e, c, "SCRIPT LOAD return(redis.call('INCR',KEYS[1]))", "$40 "+scriptSha([]byte("return(redis.call('INCR',KEYS[1]))")))
+	expectScriptReply(t, e, c, ":3", "EVALSHA", scriptSha([]byte("return(redis.call('INCR',KEYS[1]))")), "1", "a")
+	// 只读脚本不写入aof
+	expectScriptReply(t, e, c, "$1 3", "EVAL", "return redis.call('GET', KEYS[1])", "1", "a")
+
+	aof := readAof(t)
+	for _, command := range []string{"eval", "script", "get"} {
+		if strings.Contains(aof, "\r\n"+command+"\r\n") {
+			t.Errorf("%s is written to aof", command)
+		}
+	}
+	if n := strings.Count(aof, "\r\nmulti\r\n"); n != 2 {
+		t.Errorf("expected 2 multi blocks, actual %d", n)
+	}
+	expectAofOrder(t, "multi", "set", "incr", "rpush", "exec", "multi", "incr", "exec")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "GET a", "$1 3")
+	expectReply(t, e, c, "LRANGE l 0 -1", "*1 $1 2")
+}
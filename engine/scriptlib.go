@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"bytes"
+	"gedis/gedis/proto"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// 脚本中可以使用的标准库，不提供io、os等访问外部环境的库
+var scriptLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+func newScriptState(e *Engine, run *scriptRun, keys, argv [][]byte) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range scriptLibs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "require"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("KEYS", bytesToTable(L, keys))
+	L.SetGlobal("ARGV", bytesToTable(L, argv))
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"call": func(L *lua.LState) int {
+			return scriptCall(L, e, run, true)
+		},
+		"pcall": func(L *lua.LState) int {
+			return scriptCall(L, e, run, false)
+		},
+		"error_reply": func(L *lua.LState) int {
+			L.Push(statusTable(L, "err", L.CheckString(1)))
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			L.Push(statusTable(L, "ok", L.CheckString(1)))
+			return 1
+		},
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(scriptSha([]byte(L.CheckString(1)))))
+			return 1
+		},
+	})
+	L.SetGlobal("redis", redis)
+	return L
+}
+
+func bytesToTable(L *lua.LState, args [][]byte) *lua.LTable {
+	table := L.CreateTable(len(args), 0)
+	for _, arg := range args {
+		table.Append(lua.LString(arg))
+	}
+	return table
+}
+
+func statusTable(L *lua.LState, field, msg string) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString(field, lua.LString(msg))
+	return table
+}
+
+// redis.call 出错时抛出异常，redis.pcall 出错时返回 {err=...}
+func scriptCall(L *lua.LState, e *Engine, run *scriptRun, raise bool) int {
+	n := L.GetTop()
+	if n == 0 {
+		return scriptCallError(L, "Please specify at least one argument for this redis lib call", raise)
+	}
+	command := make([][]byte, n)
+	for i := 1; i <= n; i++ {
+		switch arg := L.Get(i).(type) {
+		case lua.LString:
+			command[i-1] = []byte(arg)
+		case lua.LNumber:
+			command[i-1] = []byte(arg.String())
+		default:
+			return scriptCallError(L, "Lua redis lib command arguments must be strings or integers", raise)
+		}
+	}
+	cmdName := strings.ToLower(string(command[0]))
+	if cmd, ok := commandCenter[cmdName]; ok && cmd.flags&FlagNoScript != 0 ||
+		!ok && cmdName != "select" && cmdName != "ping" {
+		return scriptCallError(L, "This Redis command is not allowed from script", raise)
+	}
+	reply := e.Exec(run, command)
+	value, _ := respToLua(L, reply.Bytes())
+	if errTable, ok := value.(*lua.LTable); ok && raise {
+		if msg := errTable.RawGetString("err"); msg != lua.LNil {
+			L.Error(errTable, 1)
+		}
+	}
+	L.Push(value)
+	return 1
+}
+
+func scriptCallError(L *lua.LState, msg string, raise bool) int {
+	errTable := statusTable(L, "err", "ERR "+msg)
+	if raise {
+		L.Error(errTable, 1)
+	}
+	L.Push(errTable)
+	return 1
+}
+
+// 把命令的返回值转换为Lua的值，返回剩余未解析的部分
+func respToLua(L *lua.LState, data []byte) (lua.LValue, []byte) {
+	if len(data) == 0 {
+		return lua.LFalse, nil
+	}
+	end := bytes.Index(data, []byte("\r\n"))
+	if end < 0 {
+		return lua.LFalse, nil
+	}
+	line, rest := string(data[1:end]), data[end+2:]
+	switch data[0] {
+	case '+':
+		return statusTable(L, "ok", line), rest
+	case '-':
+		return statusTable(L, "err", line), rest
+	case ':':
+		n, _ := strconv.ParseInt(line, 10, 64)
+		return lua.LNumber(n), rest
+	case '$':
+		size, _ := strconv.Atoi(line)
+		if size < 0 || size+2 > len(rest) {
+			return lua.LFalse, rest
+		}
+		return lua.LString(rest[:size]), rest[size+2:]
+	case '*':
+		count, _ := strconv.Atoi(line)
+		if count < 0 {
+			return lua.LFalse, rest
+		}
+		table := L.CreateTable(count, 0)
+		for i := 0; i < count; i++ {
+			var value lua.LValue
+			value, rest = respToLua(L, rest)
+			table.Append(value)
+		}
+		return table, rest
+	}
+	return lua.LFalse, nil
+}
+
+// 把脚本的返回值转换为回复，与Redis的转换规则一致
+func luaToReply(value lua.LValue) proto.Reply {
+	switch v := value.(type) {
+	case lua.LString:
+		return proto.NewBulkReply([]byte(v))
+	case lua.LNumber:
+		return proto.NewIntegerReply(int64(v))
+	case lua.LBool:
+		if v {
+			return proto.NewIntegerReply(1)
+		}
+		return proto.NewNullBulkReply()
+	case *lua.LTable:
+		if msg, ok := v.RawGetString("err").(lua.LString); ok {
+			return proto.NewSimpleErrReply(singleLine(string(msg)))
+		}
+		if msg, ok := v.RawGetString("ok").(lua.LString); ok {
+			return proto.NewSimpleStringReply(singleLine(string(msg)))
+		}
+		// 数组遇到nil就结束
+		replies := make([]proto.Reply, 0, v.Len())
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			replies = append(replies, luaToReply(item))
+		}
+		return proto.NewMixReply(replies...)
+	}
+	return proto.NewNullBulkReply()
+}
+
+// 脚本中未捕获的异常，redis.call 抛出的错误原样返回
+func scriptErrorReply(err error) proto.Reply {
+	if apiErr, ok := err.(*lua.ApiError); ok {
+		if table, ok := apiErr.Object.(*lua.LTable); ok {
+			if msg, ok := table.RawGetString("err").(lua.LString); ok {
+				return proto.NewSimpleErrReply(singleLine(string(msg)))
+			}
+		}
+		return proto.NewGenericErrReply("Error running script: " + singleLine(apiErr.Object.String()))
+	}
+	return proto.NewGenericErrReply("Error running script: " + singleLine(err.Error()))
+}
+
+// 简单字符串和错误回复中不能出现换行
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
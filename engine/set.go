@@ -0,0 +1,412 @@
+package engine
+
+import (
+	"gedis/aof"
+	"gedis/datastruct/set"
+	"gedis/engine/entity"
+	"gedis/gedis/proto"
+	"strconv"
+	"strings"
+)
+
+func (d *DB) getSetObject(key string) (*set.Set, proto.Reply) {
+	dataEntity, exist := d.GetEntity(key)
+	if !exist {
+		return nil, nil
+	}
+	s, ok := dataEntity.Object.(*set.Set)
+	if !ok {
+		return nil, proto.NewWrongTypeErrReply()
+	}
+	return s, nil
+}
+
+func (d *DB) getOrInitSetObject(key string) (*set.Set, proto.Reply) {
+	s, reply := d.getSetObject(key)
+	if reply != nil {
+		return nil, reply
+	}
+	if s == nil {
+		s = set.NewSet()
+		d.PutEntity(key, &entity.DataEntity{Object: s})
+	}
+	return s, nil
+}
+
+// 批量获取集合，不存在的key对应nil
+func (d *DB) getSetObjects(keys []string) ([]*set.Set, proto.Reply) {
+	sets := make([]*set.Set, len(keys))
+	for i, key := range keys {
+		s, reply := d.getSetObject(key)
+		if reply != nil {
+			return nil, reply
+		}
+		sets[i] = s
+	}
+	return sets, nil
+}
+
+// 用结果集合覆盖dest，结果为空时删除dest
+func (d *DB) storeSet(dest string, s *set.Set) {
+	d.Remove(dest)
+	if s.Len() > 0 {
+		d.PutEntity(dest, &entity.DataEntity{Object: s})
+	}
+}
+
+// 向集合添加成员，新增时记录下来用于撤销
+func (d *DB) setAdd(key string, s *set.Set, member string) int {
+	intset := s.IntSet()
+	added := s.Add(member)
+	if added > 0 {
+		d.Modified(key, func() {
+			// 添加触发了升级时恢复原来的intset编码
+			if intset != nil && s.IntSet() == nil {
+				s.Downgrade(intset)
+			}
+			s.Remove(member)
+		})
+	}
+	return added
+}
+
+// 从集合删除成员，删除时记录下来用于撤销
+func (d *DB) setRemove(key string, s *set.Set, member string) int {
+	removed := s.Remove(member)
+	if removed > 0 {
+		d.Modified(key, func() {
+			s.Add(member)
+		})
+	}
+	return removed
+}
+
+func toStrings(args [][]byte) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = string(arg)
+	}
+	return result
+}
+
+func membersReply(members []string) proto.Reply {
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return proto.NewMultiBulkReply(result)
+}
+
+// SADD key member [member ...]
+func cmdSAdd(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	s, reply := db.getOrInitSetObject(key)
+	if reply != nil {
+		return reply
+	}
+	var added int64
+	for _, member := range args[1:] {
+		added += int64(db.setAdd(key, s, string(member)))
+	}
+	db.writeAof(aof.SAddCmd(args...))
+	return proto.NewIntegerReply(added)
+}
+
+// SREM key member [member ...]
+func cmdSRem(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	s, reply := db.getSetObject(key)
+	if reply != nil {
+		return reply
+	}
+	if s == nil {
+		return proto.NewIntegerReply(0)
+	}
+	var removed int64
+	for _, member := range args[1:] {
+		removed += int64(db.setRemove(key, s, string(member)))
+	}
+	if s.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.writeAof(aof.SRemCmd(args...))
+	}
+	return proto.NewIntegerReply(removed)
+}
+
+// SISMEMBER key member
+func cmdSIsMember(db *DB, args [][]byte) proto.Reply {
+	s, reply := db.getSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if s == nil || !s.Contains(string(args[1])) {
+		return proto.NewIntegerReply(0)
+	}
+	return proto.NewIntegerReply(1)
+}
+
+// SMISMEMBER key member [member ...]
+func cmdSMIsMember(db *DB, args [][]byte) proto.Reply {
+	s, reply := db.getSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	result := make([]proto.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		if s != nil && s.Contains(string(member)) {
+			result[i] = proto.NewIntegerReply(1)
+		} else {
+			result[i] = proto.NewIntegerReply(0)
+		}
+	}
+	return proto.NewMixReply(result...)
+}
+
+// SCARD key
+func cmdSCard(db *DB, args [][]byte) proto.Reply {
+	s, reply := db.getSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if s == nil {
+		return proto.NewIntegerReply(0)
+	}
+	return proto.NewIntegerReply(int64(s.Len()))
+}
+
+// SMEMBERS key
+func cmdSMembers(db *DB, args [][]byte) proto.Reply {
+	s, reply := db.getSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if s == nil {
+		return proto.NewEmptyMultiBulkReply()
+	}
+	return membersReply(s.Members())
+}
+
+// SPOP key [count]
+func cmdSPop(db *DB, args [][]byte) proto.Reply {
+	if len(args) > 2 {
+		return proto.NewSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := int64(-1)
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count < 0 {
+			return proto.NewGenericErrReply("value is out of range, must be positive")
+		}
+	}
+	s, reply := db.getSetObject(key)
+	if reply != nil {
+		return reply
+	}
+	if s == nil {
+		if count < 0 {
+			return proto.NewNullBulkReply()
+		}
+		return proto.NewEmptyMultiBulkReply()
+	}
+
+	n := 1
+	if count >= 0 {
+		n = int(count)
+	}
+	members := s.RandomDistinctMembers(n)
+	for _, member := range members {
+		db.setRemove(key, s, member)
+	}
+	if s.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(members) > 0 {
+		// 随机结果不能直接回放，记录实际删除的元素
+		removed := make([][]byte, 0, len(members)+1)
+		removed = append(removed, args[0])
+		for _, member := range members {
+			removed = append(removed, []byte(member))
+		}
+		db.writeAof(aof.SRemCmd(removed...))
+	}
+	if count < 0 {
+		return proto.NewBulkReply([]byte(members[0]))
+	}
+	return membersReply(members)
+}
+
+// SRANDMEMBER key [count]
+func cmdSRandMember(db *DB, args [][]byte) proto.Reply {
+	if len(args) > 2 {
+		return proto.NewSyntaxErrReply()
+	}
+	s, reply := db.getSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if len(args) == 1 {
+		if s == nil {
+			return proto.NewNullBulkReply()
+		}
+		return proto.NewBulkReply([]byte(s.RandomMembers(1)[0]))
+	}
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	if reply := checkRandCount(count, false); reply != nil {
+		return reply
+	}
+	if s == nil || count == 0 {
+		return proto.NewEmptyMultiBulkReply()
+	}
+	if count > 0 {
+		return membersReply(s.RandomDistinctMembers(int(count)))
+	}
+	// 负数允许重复
+	return membersReply(s.RandomMembers(int(-count)))
+}
+
+// SMOVE source destination member
+func cmdSMove(db *DB, args [][]byte) proto.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	member := string(args[2])
+
+	srcSet, reply := db.getSetObject(src)
+	if reply != nil {
+		return reply
+	}
+	destSet, reply := db.getSetObject(dest)
+	if reply != nil {
+		return reply
+	}
+	if srcSet == nil || !srcSet.Contains(member) {
+		return proto.NewIntegerReply(0)
+	}
+	if src == dest {
+		return proto.NewIntegerReply(1)
+	}
+	db.setRemove(src, srcSet, member)
+	if srcSet.Len() == 0 {
+		db.Remove(src)
+	}
+	if destSet == nil {
+		destSet, _ = db.getOrInitSetObject(dest)
+	}
+	db.setAdd(dest, destSet, member)
+	db.writeAof(aof.SMoveCmd(args...))
+	return proto.NewIntegerReply(1)
+}
+
+type setOperation func(sets ...*set.Set) *set.Set
+
+func execSetOperation(db *DB, args [][]byte, operation setOperation) proto.Reply {
+	keys := toStrings(args)
+
+	sets, reply := db.getSetObjects(keys)
+	if reply != nil {
+		return reply
+	}
+	return membersReply(operation(sets...).Members())
+}
+
+func execSetOperationStore(db *DB, args [][]byte, operation setOperation, aofCmd func(args ...[]byte) [][]byte) proto.Reply {
+	dest := string(args[0])
+	keys := toStrings(args[1:])
+
+	sets, reply := db.getSetObjects(keys)
+	if reply != nil {
+		return reply
+	}
+	result := operation(sets...)
+	db.storeSet(dest, result)
+	db.writeAof(aofCmd(args...))
+	return proto.NewIntegerReply(int64(result.Len()))
+}
+
+// SINTER key [key ...]
+func cmdSInter(db *DB, args [][]byte) proto.Reply {
+	return execSetOperation(db, args, set.Intersect)
+}
+
+// SUNION key [key ...]
+func cmdSUnion(db *DB, args [][]byte) proto.Reply {
+	return execSetOperation(db, args, set.Union)
+}
+
+// SDIFF key [key ...]
+func cmdSDiff(db *DB, args [][]byte) proto.Reply {
+	return execSetOperation(db, args, set.Diff)
+}
+
+// SINTERSTORE destination key [key ...]
+func cmdSInterStore(db *DB, args [][]byte) proto.Reply {
+	return execSetOperationStore(db, args, set.Intersect, aof.SInterStoreCmd)
+}
+
+// SUNIONSTORE destination key [key ...]
+func cmdSUnionStore(db *DB, args [][]byte) proto.Reply {
+	return execSetOperationStore(db, args, set.Union, aof.SUnionStoreCmd)
+}
+
+// SDIFFSTORE destination key [key ...]
+func cmdSDiffStore(db *DB, args [][]byte) proto.Reply {
+	return execSetOperationStore(db, args, set.Diff, aof.SDiffStoreCmd)
+}
+
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func cmdSInterCard(db *DB, args [][]byte) proto.Reply {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || numKeys <= 0 {
+		return proto.NewGenericErrReply("numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-1) {
+		return proto.NewGenericErrReply("Number of keys can't be greater than number of args")
+	}
+	keys := toStrings(args[1 : numKeys+1])
+	var limit int64
+	rest := args[numKeys+1:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToUpper(string(rest[0])) != "LIMIT" {
+			return proto.NewSyntaxErrReply()
+		}
+		limit, err = strconv.ParseInt(string(rest[1]), 10, 64)
+		if err != nil || limit < 0 {
+			return proto.NewGenericErrReply("LIMIT can't be negative")
+		}
+	}
+
+	sets, reply := db.getSetObjects(keys)
+	if reply != nil {
+		return reply
+	}
+	card := int64(set.Intersect(sets...).Len())
+	if limit > 0 && card > limit {
+		card = limit
+	}
+	return proto.NewIntegerReply(card)
+}
+
+func init() {
+	registerCommand("SAdd", cmdSAdd, writeFirstKey, -3)
+	registerCommand("SRem", cmdSRem, writeFirstKey, -3)
+	registerCommand("SIsMember", cmdSIsMember, readFirstKey, 3)
+	registerCommand("SMIsMember", cmdSMIsMember, readFirstKey, -3)
+	registerCommand("SCard", cmdSCard, readFirstKey, 2)
+	registerCommand("SMembers", cmdSMembers, readFirstKey, 2)
+	registerCommand("SPop", cmdSPop, writeFirstKey, -2)
+	registerCommand("SRandMember", cmdSRandMember, readFirstKey, -2)
+	registerCommand("SMove", cmdSMove, writeFirstTwoKeys, 4)
+	registerCommand("SInter", cmdSInter, readAllKeys, -2)
+	registerCommand("SUnion", cmdSUnion, readAllKeys, -2)
+	registerCommand("SDiff", cmdSDiff, readAllKeys, -2)
+	registerCommand("SInterStore", cmdSInterStore, writeFirstReadOthers, -3)
+	registerCommand("SUnionStore", cmdSUnionStore, writeFirstReadOthers, -3)
+	registerCommand("SDiffStore", cmdSDiffStore, writeFirstReadOthers, -3)
+	registerCommand("SInterCard", cmdSInterCard, readNumKeys, -3)
+}
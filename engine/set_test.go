@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+func TestSetStore(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SADD s1 1 2 3 4", ":4")
+	expectReply(t, e, c, "SADD s2 3 4 5", ":3")
+	expectReply(t, e, c, "SADD s3 4 a", ":2")
+
+	expectReply(t, e, c, "SINTERSTORE inter s1 s2", ":2")
+	expectReply(t, e, c, "SMEMBERS inter", "*2 $1 3 $1 4")
+	// 结果只有整数成员时使用intset编码
+	expectReply(t, e, c, "SINTERSTORE inter s1 s2 s3", ":1")
+	expectReply(t, e, c, "SMEMBERS inter", "*1 $1 4")
+	expectReply(t, e, c, "OBJECT ENCODING inter", "$6 intset")
+	expectReply(t, e, c, "SUNIONSTORE union s1 s2 none", ":5")
+	expectReply(t, e, c, "SMEMBERS union", "*5 $1 1 $1 2 $1 3 $1 4 $1 5")
+	expectReply(t, e, c, "SUNIONSTORE union2 s2 s3", ":4")
+	expectReply(t, e, c, "OBJECT ENCODING union2", "$9 hashtable")
+	expectReply(t, e, c, "SMISMEMBER union2 3 4 5 a b", "*5 :1 :1 :1 :1 :0")
+	expectReply(t, e, c, "SDIFFSTORE diff s1 s2 s3", ":2")
+	expectReply(t, e, c, "SMEMBERS diff", "*2 $1 1 $1 2")
+	expectReply(t, e, c, "SDIFFSTORE diff2 none s1", ":0")
+
+	// 目标key作为源key时先计算结果再覆盖
+	expectReply(t, e, c, "SUNIONSTORE s1 s1 s2", ":5")
+	expectReply(t, e, c, "SMEMBERS s1", "*5 $1 1 $1 2 $1 3 $1 4 $1 5")
+	// 覆盖其他类型的目标key，结果为空时删除
+	expectReply(t, e, c, "SET str x", "+ok")
+	expectReply(t, e, c, "SINTERSTORE str s1 s3", ":1")
+	expectReply(t, e, c, "TYPE str", "+set")
+	expectReply(t, e, c, "SINTERSTORE str s1 none", ":0")
+	expectReply(t, e, c, "EXISTS str", ":0")
+	expectReply(t, e, c, "SET str x", "+ok")
+	expectReply(t, e, c, "SDIFFSTORE dst s1 str", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	expectReply(t, e, c, "EXISTS dst", ":0")
+	expectReply(t, e, c, "SUNIONSTORE dst", "-ERR wrong number of arguments for 'sunionstore' command")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "SMEMBERS inter", "*1 $1 4")
+	expectReply(t, e, c, "SMEMBERS union", "*5 $1 1 $1 2 $1 3 $1 4 $1 5")
+	expectReply(t, e, c, "SMISMEMBER union2 3 4 5 a b", "*5 :1 :1 :1 :1 :0")
+	expectReply(t, e, c, "SMEMBERS diff", "*2 $1 1 $1 2")
+	expectReply(t, e, c, "SMEMBERS s1", "*5 $1 1 $1 2 $1 3 $1 4 $1 5")
+	expectReply(t, e, c, "EXISTS diff2 dst", ":0")
+	expectReply(t, e, c, "GET str", "$1 x")
+}
+
+func TestSetEncoding(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	members := make([]string, 512)
+	for i := range members {
+		members[i] = strconv.Itoa(i)
+	}
+	expectReply(t, e, c, "SADD big "+strings.Join(members, " "), ":512")
+	expectReply(t, e, c, "OBJECT ENCODING big", "$6 intset")
+	// 超过512个整数时转换为hashtable
+	expectReply(t, e, c, "SADD big 512", ":1")
+	expectReply(t, e, c, "OBJECT ENCODING big", "$9 hashtable")
+	expectReply(t, e, c, "SCARD big", ":513")
+	// 删除成员不会转换回intset
+	expectReply(t, e, c, "SREM big 512 511", ":2")
+	expectReply(t, e, c, "OBJECT ENCODING big", "$9 hashtable")
+
+	expectReply(t, e, c, "SADD s 1 -2 9223372036854775807", ":3")
+	expectReply(t, e, c, "OBJECT ENCODING s", "$6 intset")
+	expectReply(t, e, c, "SMEMBERS s", "*3 $2 -2 $1 1 $19 9223372036854775807")
+	// 不是规范的整数表示时按字符串保存
+	expectReply(t, e, c, "SADD s 01", ":1")
+	expectReply(t, e, c, "OBJECT ENCODING s", "$9 hashtable")
+	expectReply(t, e, c, "SMISMEMBER s 1 01 -2 2", "*4 :1 :1 :1 :0")
+
+	expectReply(t, e, c, "SADD f 1 9223372036854775808", ":2")
+	expectReply(t, e, c, "OBJECT ENCODING f", "$9 hashtable")
+
+	// 重放同样的命令，编码与重启前一致
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "SCARD big", ":511")
+	expectReply(t, e, c, "OBJECT ENCODING big", "$9 hashtable")
+	expectReply(t, e, c, "SISMEMBER big 510", ":1")
+	expectReply(t, e, c, "SISMEMBER big 511", ":0")
+	expectReply(t, e, c, "OBJECT ENCODING s", "$9 hashtable")
+	expectReply(t, e, c, "SCARD s", ":4")
+}
+
+func TestSetRandom(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SADD s 1 2 3", ":3")
+	// count不小于集合大小时返回全部成员
+	expectReply(t, e, c, "SRANDMEMBER s 3", "*3 $1 1 $1 2 $1 3")
+	expectReply(t, e, c, "SRANDMEMBER s 10", "*3 $1 1 $1 2 $1 3")
+	expectReply(t, e, c, "SRANDMEMBER s 0", "*0")
+	for _, tc := range []struct {
+		count    string
+		n        int
+		distinct bool
+	}{{"2", 2, true}, {"-5", 5, false}} {
+		reply := strings.Fields(testExec(e, c, "SRANDMEMBER s "+tc.count))
+		if len(reply) != 1+2*tc.n || reply[0] != "*"+strconv.Itoa(tc.n) {
+			t.Fatalf("SRANDMEMBER s %s: %v", tc.count, reply)
+		}
+		seen := make(map[string]bool)
+		for i := 2; i < len(reply); i += 2 {
+			if reply[i] != "1" && reply[i] != "2" && reply[i] != "3" {
+				t.Errorf("SRANDMEMBER s %s: unexpected member %q", tc.count, reply[i])
+			}
+			if tc.distinct && seen[reply[i]] {
+				t.Errorf("SRANDMEMBER s %s: duplicated member %q", tc.count, reply[i])
+			}
+			seen[reply[i]] = true
+		}
+	}
+	expectReply(t, e, c, "SADD one a", ":1")
+	// 负数允许重复
+	expectReply(t, e, c, "SRANDMEMBER one -3", "*3 $1 a $1 a $1 a")
+	expectReply(t, e, c, "SRANDMEMBER one", "$1 a")
+	expectReply(t, e, c, "SRANDMEMBER none", "$-1")
+	expectReply(t, e, c, "SRANDMEMBER none 2", "*0")
+	expectReply(t, e, c, "SRANDMEMBER s x", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "SRANDMEMBER s -9223372036854775808", "-ERR value is out of range")
+	expectReply(t, e, c, "SRANDMEMBER s 1 2", "-ERR syntax error")
+	expectReply(t, e, c, "SCARD s", ":3")
+
+	expectReply(t, e, c, "SADD p 1 2 3 4 5", ":5")
+	reply := strings.Fields(testExec(e, c, "SPOP p 2"))
+	if len(reply) != 5 || reply[0] != "*2" || reply[2] == reply[4] {
+		t.Fatalf("SPOP p 2: %v", reply)
+	}
+	expectReply(t, e, c, "SCARD p", ":3")
+	expectReply(t, e, c, "SMISMEMBER p "+reply[2]+" "+reply[4], "*2 :0 :0")
+	remain := testExec(e, c, "SMEMBERS p")
+	expectReply(t, e, c, "SPOP p 0", "*0")
+	expectReply(t, e, c, "SPOP one", "$1 a")
+	expectReply(t, e, c, "EXISTS one", ":0")
+	// count超过集合大小时弹出全部成员并删除key
+	expectReply(t, e, c, "SADD all 1 2", ":2")
+	expectReply(t, e, c, "SPOP all 5", "*2 $1 1 $1 2")
+	expectReply(t, e, c, "EXISTS all", ":0")
+	expectReply(t, e, c, "SPOP none", "$-1")
+	expectReply(t, e, c, "SPOP none 2", "*0")
+	expectReply(t, e, c, "SPOP p -1", "-ERR value is out of range, must be positive")
+	expectReply(t, e, c, "SPOP p 1 2", "-ERR syntax error")
+
+	// aof记录的是实际弹出的成员
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "SMEMBERS p", remain)
+	expectReply(t, e, c, "SMEMBERS s", "*3 $1 1 $1 2 $1 3")
+	expectReply(t, e, c, "EXISTS one all", ":0")
+}
@@ -2,44 +2,234 @@ package engine
 
 import (
 	"gedis/aof"
+	"gedis/datastruct/set"
 	"gedis/datastruct/sortedset"
+	"gedis/engine/entity"
 	"gedis/gedis/proto"
+	"math"
 	"strconv"
+	"strings"
 )
 
-// ZADD key score member [score member...]
-func cmdZAdd(db *DB, args [][]byte) proto.Reply {
-	if len(args)%2 != 1 {
-		return proto.NewArgNumErrReply("zadd")
+func formatScore(score float64) []byte {
+	if math.IsInf(score, 1) {
+		return []byte("inf")
+	}
+	if math.IsInf(score, -1) {
+		return []byte("-inf")
+	}
+	return []byte(strconv.FormatFloat(score, 'f', -1, 64))
+}
+
+func parseScore(arg []byte) (float64, bool) {
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false
+	}
+	return score, true
+}
+
+func pairsReply(pairs []*sortedset.Pair, withScores bool) proto.Reply {
+	size := len(pairs)
+	if withScores {
+		size *= 2
+	}
+	result := make([][]byte, 0, size)
+	for _, pair := range pairs {
+		result = append(result, []byte(pair.Member))
+		if withScores {
+			result = append(result, formatScore(pair.Score))
+		}
+	}
+	return proto.NewMultiBulkReply(result)
+}
+
+// 设置成员的分数，记录旧分数用于撤销
+func (d *DB) zsetAdd(key string, sortedSet *sortedset.SortedSet, member string, score float64) {
+	old, existed := sortedSet.Get(member)
+	var oldScore float64
+	if existed {
+		oldScore = old.Score
+	}
+	sortedSet.Add(member, score)
+	d.Modified(key, func() {
+		if existed {
+			sortedSet.Add(member, oldScore)
+		} else {
+			sortedSet.Remove(member)
+		}
+	})
+}
+
+// 删除成员，记录被删除的分数用于撤销
+func (d *DB) zsetRemove(key string, sortedSet *sortedset.SortedSet, member string) bool {
+	old, existed := sortedSet.Get(member)
+	if !existed {
+		return false
+	}
+	score := old.Score
+	sortedSet.Remove(member)
+	d.Modified(key, func() {
+		sortedSet.Add(member, score)
+	})
+	return true
+}
+
+// 记录批量删除的成员，撤销时重新加入
+func (d *DB) zsetRemoved(key string, sortedSet *sortedset.SortedSet, removed []*sortedset.Pair) {
+	if len(removed) == 0 {
+		return
 	}
+	d.Modified(key, func() {
+		for _, pair := range removed {
+			sortedSet.Add(pair.Member, pair.Score)
+		}
+	})
+}
+
+// 用结果覆盖dest，结果为空时删除dest
+func (d *DB) storeSortedSet(dest string, pairs []*sortedset.Pair) {
+	d.Remove(dest)
+	if len(pairs) == 0 {
+		return
+	}
+	sortedSet := sortedset.NewSortedSet()
+	for _, pair := range pairs {
+		sortedSet.Add(pair.Member, pair.Score)
+	}
+	d.PutEntity(dest, &entity.DataEntity{Object: sortedSet})
+}
+
+// ZADD命令的选项
+type zAddFlags struct {
+	nx   bool
+	xx   bool
+	gt   bool
+	lt   bool
+	ch   bool
+	incr bool
+}
+
+// 解析选项，返回第一个score的下标
+func parseZAddFlags(args [][]byte) (*zAddFlags, int, proto.Reply) {
+	flags := &zAddFlags{}
+	i := 1
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			flags.nx = true
+		case "XX":
+			flags.xx = true
+		case "GT":
+			flags.gt = true
+		case "LT":
+			flags.lt = true
+		case "CH":
+			flags.ch = true
+		case "INCR":
+			flags.incr = true
+		default:
+			break loop
+		}
+	}
+	rest := len(args) - i
+	if rest == 0 || rest%2 != 0 {
+		return nil, 0, proto.NewSyntaxErrReply()
+	}
+	if flags.nx && flags.xx {
+		return nil, 0, proto.NewGenericErrReply("XX and NX options at the same time are not compatible")
+	}
+	if (flags.gt && flags.lt) || (flags.nx && (flags.gt || flags.lt)) {
+		return nil, 0, proto.NewGenericErrReply("GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if flags.incr && rest != 2 {
+		return nil, 0, proto.NewGenericErrReply("INCR option supports a single increment-element pair")
+	}
+	return flags, i, nil
+}
+
+// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member...]
+func cmdZAdd(db *DB, args [][]byte) proto.Reply {
 	key := string(args[0])
-	size := (len(args) - 1) / 2
+	flags, start, reply := parseZAddFlags(args)
+	if reply != nil {
+		return reply
+	}
+	size := (len(args) - start) / 2
 	pairs := make([]*sortedset.Pair, size)
 
 	for i := 0; i < size; i++ {
-		score, err := strconv.ParseFloat(string(args[i*2+1]), 64)
-		if err != nil {
-			return proto.NewGenericErrReply("value is not valid fload")
+		score, ok := parseScore(args[start+i*2])
+		if !ok {
+			return proto.NewGenericErrReply("value is not a valid float")
 		}
 		pair := &sortedset.Pair{
-			Member: string(args[i*2+2]),
+			Member: string(args[start+i*2+1]),
 			Score:  score,
 		}
 		pairs[i] = pair
 	}
 
-	sortedSet, err, reply := db.getOrInitSortedSetObject(key)
-	if err != nil {
+	sortedSet, reply := db.getSortedSetObject(key)
+	if reply != nil {
 		return reply
 	}
-	i := int64(0)
+	if sortedSet == nil {
+		if flags.xx {
+			// 不会新增成员，也就不需要创建key
+			if flags.incr {
+				return proto.NewNullBulkReply()
+			}
+			return proto.NewIntegerReply(0)
+		}
+		sortedSet, _ = db.getOrInitSortedSetObject(key)
+	}
+
+	var added, changed int64
+	// 实际生效的修改，用于写aof
+	effective := [][]byte{args[0]}
 	for _, pair := range pairs {
-		if sortedSet.Add(pair.Member, pair.Score) {
-			i++
+		score := pair.Score
+		current, exist := sortedSet.Get(pair.Member)
+		if (exist && flags.nx) || (!exist && flags.xx) {
+			continue
+		}
+		if exist && flags.incr {
+			score += current.Score
+			if math.IsNaN(score) {
+				removeEmptySortedSet(db, key, sortedSet)
+				return proto.NewGenericErrReply("resulting score is not a number (NaN)")
+			}
+		}
+		if exist {
+			if (flags.gt && score <= current.Score) || (flags.lt && score >= current.Score) || score == current.Score {
+				continue
+			}
+			changed++
+		} else {
+			added++
 		}
+		db.zsetAdd(key, sortedSet, pair.Member, score)
+		effective = append(effective, formatScore(score), []byte(pair.Member))
 	}
-	db.writeAof(aof.ZAddCmd(args...))
-	return proto.NewIntegerReply(i)
+	removeEmptySortedSet(db, key, sortedSet)
+	if len(effective) > 1 {
+		db.writeAof(aof.ZAddCmd(effective...))
+	}
+
+	if flags.incr {
+		pair, exist := sortedSet.Get(pairs[0].Member)
+		// 被NX/XX/GT/LT拦截时返回nil
+		if !exist || (added == 0 && changed == 0 && (flags.nx || flags.xx || flags.gt || flags.lt)) {
+			return proto.NewNullBulkReply()
+		}
+		return proto.NewBulkReply(formatScore(pair.Score))
+	}
+	if flags.ch {
+		return proto.NewIntegerReply(added + changed)
+	}
+	return proto.NewIntegerReply(added)
 }
 
 // zscore key member
@@ -60,10 +250,709 @@ func cmdZScore(db *DB, args [][]byte) proto.Reply {
 	if !exist {
 		return proto.NewNullBulkReply()
 	}
-	return proto.NewBulkReply([]byte(strconv.FormatFloat(pair.Score, 'f', -1, 64)))
+	return proto.NewBulkReply(formatScore(pair.Score))
+}
+
+// ZMSCORE key member [member ...]
+func cmdZMScore(db *DB, args [][]byte) proto.Reply {
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	result := make([][]byte, len(args)-1)
+	if sortedSet == nil {
+		return proto.NewMultiBulkReply(result)
+	}
+	for i, member := range args[1:] {
+		if pair, exist := sortedSet.Get(string(member)); exist {
+			result[i] = formatScore(pair.Score)
+		}
+	}
+	return proto.NewMultiBulkReply(result)
+}
+
+// ZREM key member [member ...]
+func cmdZRem(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	sortedSet, reply := db.getSortedSetObject(key)
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return proto.NewIntegerReply(0)
+	}
+	var removed int64
+	for _, member := range args[1:] {
+		if db.zsetRemove(key, sortedSet, string(member)) {
+			removed++
+		}
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.writeAof(aof.ZRemCmd(args...))
+	}
+	return proto.NewIntegerReply(removed)
+}
+
+// ZCARD key
+func cmdZCard(db *DB, args [][]byte) proto.Reply {
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return proto.NewIntegerReply(0)
+	}
+	return proto.NewIntegerReply(sortedSet.Len())
+}
+
+// ZINCRBY key increment member
+func cmdZIncrBy(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	delta, ok := parseScore(args[1])
+	if !ok {
+		return proto.NewGenericErrReply("value is not a valid float")
+	}
+	member := string(args[2])
+	sortedSet, reply := db.getOrInitSortedSetObject(key)
+	if reply != nil {
+		return reply
+	}
+	score := delta
+	if pair, exist := sortedSet.Get(member); exist {
+		score += pair.Score
+	}
+	if math.IsNaN(score) {
+		if sortedSet.Len() == 0 {
+			db.Remove(key)
+		}
+		return proto.NewGenericErrReply("resulting score is not a number (NaN)")
+	}
+	db.zsetAdd(key, sortedSet, member, score)
+	db.writeAof(aof.ZIncrByCmd(args...))
+	return proto.NewBulkReply(formatScore(score))
+}
+
+func execZRank(db *DB, args [][]byte, desc bool) proto.Reply {
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORE" {
+			return proto.NewSyntaxErrReply()
+		}
+		withScore = true
+	} else if len(args) != 2 {
+		return proto.NewSyntaxErrReply()
+	}
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return proto.NewNullBulkReply()
+	}
+	member := string(args[1])
+	rank := sortedSet.GetRank(member, desc)
+	if rank < 0 {
+		return proto.NewNullBulkReply()
+	}
+	if withScore {
+		pair, _ := sortedSet.Get(member)
+		return proto.NewMixReply(proto.NewIntegerReply(rank), proto.NewBulkReply(formatScore(pair.Score)))
+	}
+	return proto.NewIntegerReply(rank)
+}
+
+// ZRANK key member [WITHSCORE]
+func cmdZRank(db *DB, args [][]byte) proto.Reply {
+	return execZRank(db, args, false)
+}
+
+// ZREVRANK key member [WITHSCORE]
+func cmdZRevRank(db *DB, args [][]byte) proto.Reply {
+	return execZRank(db, args, true)
+}
+
+const (
+	rangeByRank  = ""
+	rangeByScore = "BYSCORE"
+	rangeByLex   = "BYLEX"
+)
+
+// ZRANGE系列命令的查询条件
+type zRangeSpec struct {
+	start      []byte
+	stop       []byte
+	by         string
+	rev        bool
+	hasLimit   bool
+	offset     int64
+	count      int64
+	withScores bool
+}
+
+// 解析 start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func parseZRangeSpec(args [][]byte) (*zRangeSpec, proto.Reply) {
+	spec := &zRangeSpec{start: args[0], stop: args[1], count: -1}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "BYSCORE":
+			spec.by = rangeByScore
+		case "BYLEX":
+			spec.by = rangeByLex
+		case "REV":
+			spec.rev = true
+		case "WITHSCORES":
+			spec.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			offset, err1 := strconv.ParseInt(string(args[i+1]), 10, 64)
+			count, err2 := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err1 != nil || err2 != nil {
+				return nil, proto.NewGenericErrReply("value is not an integer or out of range")
+			}
+			spec.hasLimit = true
+			spec.offset = offset
+			spec.count = count
+			i += 2
+		default:
+			return nil, proto.NewSyntaxErrReply()
+		}
+	}
+	if spec.hasLimit && spec.by == rangeByRank {
+		return nil, proto.NewGenericErrReply("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.by == rangeByLex {
+		return nil, proto.NewGenericErrReply("syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return spec, nil
+}
+
+// 解析分数区间，rev为true时参数顺序是 max min
+func parseScoreRange(minArg, maxArg []byte, rev bool) (*sortedset.ScoreBorder, *sortedset.ScoreBorder, proto.Reply) {
+	if rev {
+		minArg, maxArg = maxArg, minArg
+	}
+	min, err := sortedset.ParseScoreBorder(string(minArg))
+	if err != nil {
+		return nil, nil, proto.NewGenericErrReply(err.Error())
+	}
+	max, err := sortedset.ParseScoreBorder(string(maxArg))
+	if err != nil {
+		return nil, nil, proto.NewGenericErrReply(err.Error())
+	}
+	return min, max, nil
+}
+
+// 解析字典序区间，rev为true时参数顺序是 max min
+func parseLexRange(minArg, maxArg []byte, rev bool) (*sortedset.LexBorder, *sortedset.LexBorder, proto.Reply) {
+	if rev {
+		minArg, maxArg = maxArg, minArg
+	}
+	min, err := sortedset.ParseLexBorder(string(minArg))
+	if err != nil {
+		return nil, nil, proto.NewGenericErrReply(err.Error())
+	}
+	max, err := sortedset.ParseLexBorder(string(maxArg))
+	if err != nil {
+		return nil, nil, proto.NewGenericErrReply(err.Error())
+	}
+	return min, max, nil
+}
+
+func (spec *zRangeSpec) query(sortedSet *sortedset.SortedSet) ([]*sortedset.Pair, proto.Reply) {
+	switch spec.by {
+	case rangeByScore:
+		min, max, reply := parseScoreRange(spec.start, spec.stop, spec.rev)
+		if reply != nil {
+			return nil, reply
+		}
+		if sortedSet == nil || spec.offset < 0 {
+			return nil, nil
+		}
+		return sortedSet.Range(min, max, spec.offset, spec.count, spec.rev), nil
+	case rangeByLex:
+		min, max, reply := parseLexRange(spec.start, spec.stop, spec.rev)
+		if reply != nil {
+			return nil, reply
+		}
+		if sortedSet == nil || spec.offset < 0 {
+			return nil, nil
+		}
+		return sortedSet.Range(min, max, spec.offset, spec.count, spec.rev), nil
+	}
+	start, err1 := strconv.ParseInt(string(spec.start), 10, 64)
+	stop, err2 := strconv.ParseInt(string(spec.stop), 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	if sortedSet == nil {
+		return nil, nil
+	}
+	from, to := normalizeRange(start, stop, int(sortedSet.Len()))
+	return sortedSet.RangeByRank(int64(from), int64(to), spec.rev), nil
+}
+
+// ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func cmdZRange(db *DB, args [][]byte) proto.Reply {
+	spec, reply := parseZRangeSpec(args[1:])
+	if reply != nil {
+		return reply
+	}
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	pairs, reply := spec.query(sortedSet)
+	if reply != nil {
+		return reply
+	}
+	return pairsReply(pairs, spec.withScores)
+}
+
+// ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+func cmdZRangeStore(db *DB, args [][]byte) proto.Reply {
+	dest := string(args[0])
+	src := string(args[1])
+	spec, reply := parseZRangeSpec(args[2:])
+	if reply != nil {
+		return reply
+	}
+	if spec.withScores {
+		return proto.NewSyntaxErrReply()
+	}
+
+	sortedSet, reply := db.getSortedSetObject(src)
+	if reply != nil {
+		return reply
+	}
+	pairs, reply := spec.query(sortedSet)
+	if reply != nil {
+		return reply
+	}
+	db.storeSortedSet(dest, pairs)
+	db.writeAof(aof.ZRangeStoreCmd(args...))
+	return proto.NewIntegerReply(int64(len(pairs)))
+}
+
+// ZCOUNT key min max
+func cmdZCount(db *DB, args [][]byte) proto.Reply {
+	min, max, reply := parseScoreRange(args[1], args[2], false)
+	if reply != nil {
+		return reply
+	}
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return proto.NewIntegerReply(0)
+	}
+	return proto.NewIntegerReply(sortedSet.Count(min, max))
+}
+
+// ZLEXCOUNT key min max
+func cmdZLexCount(db *DB, args [][]byte) proto.Reply {
+	min, max, reply := parseLexRange(args[1], args[2], false)
+	if reply != nil {
+		return reply
+	}
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return proto.NewIntegerReply(0)
+	}
+	return proto.NewIntegerReply(sortedSet.Count(min, max))
+}
+
+func removeEmptySortedSet(db *DB, key string, sortedSet *sortedset.SortedSet) {
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+}
+
+// ZREMRANGEBYRANK key start stop
+func cmdZRemRangeByRank(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	sortedSet, reply := db.getSortedSetObject(key)
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return proto.NewIntegerReply(0)
+	}
+	from, to := normalizeRange(start, stop, int(sortedSet.Len()))
+	removed := sortedSet.RemoveByRank(int64(from), int64(to))
+	db.zsetRemoved(key, sortedSet, removed)
+	removeEmptySortedSet(db, key, sortedSet)
+	if len(removed) > 0 {
+		db.writeAof(aof.ZRemRangeByRankCmd(args...))
+	}
+	return proto.NewIntegerReply(int64(len(removed)))
+}
+
+// ZREMRANGEBYSCORE key min max
+func cmdZRemRangeByScore(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	min, max, reply := parseScoreRange(args[1], args[2], false)
+	if reply != nil {
+		return reply
+	}
+	sortedSet, reply := db.getSortedSetObject(key)
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return proto.NewIntegerReply(0)
+	}
+	removed := sortedSet.RemoveRange(min, max)
+	db.zsetRemoved(key, sortedSet, removed)
+	removeEmptySortedSet(db, key, sortedSet)
+	if len(removed) > 0 {
+		db.writeAof(aof.ZRemRangeByScoreCmd(args...))
+	}
+	return proto.NewIntegerReply(int64(len(removed)))
+}
+
+// ZREMRANGEBYLEX key min max
+func cmdZRemRangeByLex(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	min, max, reply := parseLexRange(args[1], args[2], false)
+	if reply != nil {
+		return reply
+	}
+	sortedSet, reply := db.getSortedSetObject(key)
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return proto.NewIntegerReply(0)
+	}
+	removed := sortedSet.RemoveRange(min, max)
+	db.zsetRemoved(key, sortedSet, removed)
+	removeEmptySortedSet(db, key, sortedSet)
+	if len(removed) > 0 {
+		db.writeAof(aof.ZRemRangeByLexCmd(args...))
+	}
+	return proto.NewIntegerReply(int64(len(removed)))
+}
+
+func execZPop(db *DB, args [][]byte, max bool) proto.Reply {
+	if len(args) > 2 {
+		return proto.NewSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := int64(1)
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count < 0 {
+			return proto.NewGenericErrReply("value is out of range, must be positive")
+		}
+	}
+	sortedSet, reply := db.getSortedSetObject(key)
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return proto.NewEmptyMultiBulkReply()
+	}
+	var popped []*sortedset.Pair
+	if max {
+		popped = sortedSet.PopMax(count)
+	} else {
+		popped = sortedSet.PopMin(count)
+	}
+	db.zsetRemoved(key, sortedSet, popped)
+	removeEmptySortedSet(db, key, sortedSet)
+	if len(popped) > 0 {
+		if max {
+			db.writeAof(aof.ZPopMaxCmd(args...))
+		} else {
+			db.writeAof(aof.ZPopMinCmd(args...))
+		}
+	}
+	return pairsReply(popped, true)
+}
+
+// ZPOPMIN key [count]
+func cmdZPopMin(db *DB, args [][]byte) proto.Reply {
+	return execZPop(db, args, false)
+}
+
+// ZPOPMAX key [count]
+func cmdZPopMax(db *DB, args [][]byte) proto.Reply {
+	return execZPop(db, args, true)
+}
+
+// ZRANDMEMBER key [count [WITHSCORES]]
+func cmdZRandMember(db *DB, args [][]byte) proto.Reply {
+	if len(args) > 3 {
+		return proto.NewSyntaxErrReply()
+	}
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if len(args) == 1 {
+		if sortedSet == nil {
+			return proto.NewNullBulkReply()
+		}
+		return proto.NewBulkReply([]byte(sortedSet.RandomPairs(1, false)[0].Member))
+	}
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	withScores := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORES" {
+			return proto.NewSyntaxErrReply()
+		}
+		withScores = true
+	}
+	if reply := checkRandCount(count, withScores); reply != nil {
+		return reply
+	}
+	if sortedSet == nil || count == 0 {
+		return proto.NewEmptyMultiBulkReply()
+	}
+	if count > 0 {
+		return pairsReply(sortedSet.RandomPairs(count, true), withScores)
+	}
+	// 负数允许重复
+	return pairsReply(sortedSet.RandomPairs(-count, false), withScores)
+}
+
+// ZSCAN key cursor [MATCH pattern] [COUNT count]
+func cmdZScan(db *DB, args [][]byte) proto.Reply {
+	cursor, reply := parseCursor(args[1])
+	if reply != nil {
+		return reply
+	}
+	spec, reply := parseScanSpec(args[2:], false)
+	if reply != nil {
+		return reply
+	}
+	sortedSet, reply := db.getSortedSetObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if sortedSet == nil {
+		return scanReply(0, [][]byte{})
+	}
+	pairs, next := sortedSet.Scan(cursor, spec.count)
+	result := make([][]byte, 0, 2*len(pairs))
+	for _, pair := range pairs {
+		if spec.matchKey(pair.Member) {
+			result = append(result, []byte(pair.Member), formatScore(pair.Score))
+		}
+	}
+	return scanReply(next, result)
+}
+
+// 读取参与集合运算的有序集合，普通集合的成员分数视为1，不存在的key对应nil
+func (d *DB) getZSetOperands(keys []string) ([]*sortedset.SortedSet, proto.Reply) {
+	result := make([]*sortedset.SortedSet, len(keys))
+	for i, key := range keys {
+		dataEntity, exist := d.GetEntity(key)
+		if !exist {
+			continue
+		}
+		switch obj := dataEntity.Object.(type) {
+		case *sortedset.SortedSet:
+			result[i] = obj
+		case *set.Set:
+			sortedSet := sortedset.NewSortedSet()
+			obj.ForEach(func(member string) bool {
+				sortedSet.Add(member, 1)
+				return true
+			})
+			result[i] = sortedSet
+		default:
+			return nil, proto.NewWrongTypeErrReply()
+		}
+	}
+	return result, nil
+}
+
+const (
+	zSetUnion = iota
+	zSetInter
+	zSetDiff
+)
+
+// 有序集合运算的参数
+type zSetOperationSpec struct {
+	keys       []string
+	weights    []float64
+	aggregate  sortedset.Aggregate
+	withScores bool
+}
+
+// 解析 numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func parseZSetOperationSpec(cmdName string, args [][]byte, operation int, store bool) (*zSetOperationSpec, proto.Reply) {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return nil, proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return nil, proto.NewGenericErrReply("at least 1 input key is needed for '" + cmdName + "' command")
+	}
+	if numKeys > int64(len(args)-1) {
+		return nil, proto.NewSyntaxErrReply()
+	}
+	spec := &zSetOperationSpec{
+		keys:      toStrings(args[1 : numKeys+1]),
+		aggregate: sortedset.AggregateSum,
+	}
+	for i := int(numKeys) + 1; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch {
+		case arg == "WEIGHTS" && operation != zSetDiff:
+			if i+int(numKeys) >= len(args) {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			spec.weights = make([]float64, numKeys)
+			for j := range spec.weights {
+				weight, ok := parseScore(args[i+1+j])
+				if !ok {
+					return nil, proto.NewGenericErrReply("weight value is not a float")
+				}
+				spec.weights[j] = weight
+			}
+			i += int(numKeys)
+		case arg == "AGGREGATE" && operation != zSetDiff:
+			if i+1 >= len(args) {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			switch strings.ToUpper(string(args[i+1])) {
+			case "SUM":
+				spec.aggregate = sortedset.AggregateSum
+			case "MIN":
+				spec.aggregate = sortedset.AggregateMin
+			case "MAX":
+				spec.aggregate = sortedset.AggregateMax
+			default:
+				return nil, proto.NewSyntaxErrReply()
+			}
+			i++
+		case arg == "WITHSCORES" && !store:
+			spec.withScores = true
+		default:
+			return nil, proto.NewSyntaxErrReply()
+		}
+	}
+	return spec, nil
+}
+
+func (spec *zSetOperationSpec) compute(sets []*sortedset.SortedSet, operation int) *sortedset.SortedSet {
+	switch operation {
+	case zSetUnion:
+		return sortedset.Union(sets, spec.weights, spec.aggregate)
+	case zSetInter:
+		return sortedset.Inter(sets, spec.weights, spec.aggregate)
+	}
+	return sortedset.Diff(sets)
+}
+
+func execZSetOperation(db *DB, cmdName string, args [][]byte, operation int) proto.Reply {
+	spec, reply := parseZSetOperationSpec(cmdName, args, operation, false)
+	if reply != nil {
+		return reply
+	}
+
+	sets, reply := db.getZSetOperands(spec.keys)
+	if reply != nil {
+		return reply
+	}
+	result := spec.compute(sets, operation)
+	return pairsReply(result.RangeByRank(0, result.Len(), false), spec.withScores)
+}
+
+func execZSetOperationStore(db *DB, cmdName string, args [][]byte, operation int, aofCmd func(args ...[]byte) [][]byte) proto.Reply {
+	dest := string(args[0])
+	spec, reply := parseZSetOperationSpec(cmdName, args[1:], operation, true)
+	if reply != nil {
+		return reply
+	}
+	sets, reply := db.getZSetOperands(spec.keys)
+	if reply != nil {
+		return reply
+	}
+	result := spec.compute(sets, operation)
+	db.Remove(dest)
+	if result.Len() > 0 {
+		db.PutEntity(dest, &entity.DataEntity{Object: result})
+	}
+	db.writeAof(aofCmd(args...))
+	return proto.NewIntegerReply(result.Len())
+}
+
+// ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func cmdZUnion(db *DB, args [][]byte) proto.Reply {
+	return execZSetOperation(db, "zunion", args, zSetUnion)
+}
+
+// ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func cmdZInter(db *DB, args [][]byte) proto.Reply {
+	return execZSetOperation(db, "zinter", args, zSetInter)
+}
+
+// ZDIFF numkeys key [key ...] [WITHSCORES]
+func cmdZDiff(db *DB, args [][]byte) proto.Reply {
+	return execZSetOperation(db, "zdiff", args, zSetDiff)
+}
+
+// ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func cmdZUnionStore(db *DB, args [][]byte) proto.Reply {
+	return execZSetOperationStore(db, "zunionstore", args, zSetUnion, aof.ZUnionStoreCmd)
+}
+
+// ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func cmdZInterStore(db *DB, args [][]byte) proto.Reply {
+	return execZSetOperationStore(db, "zinterstore", args, zSetInter, aof.ZInterStoreCmd)
+}
+
+// ZDIFFSTORE destination numkeys key [key ...]
+func cmdZDiffStore(db *DB, args [][]byte) proto.Reply {
+	return execZSetOperationStore(db, "zdiffstore", args, zSetDiff, aof.ZDiffStoreCmd)
 }
 
 func init() {
-	registerCommand("ZAdd", cmdZAdd, nil, -4)
-	registerCommand("ZScore", cmdZScore, nil, -3)
+	registerCommand("ZAdd", cmdZAdd, writeFirstKey, -4)
+	registerCommand("ZScore", cmdZScore, readFirstKey, -3)
+	registerCommand("ZMScore", cmdZMScore, readFirstKey, -3)
+	registerCommand("ZRem", cmdZRem, writeFirstKey, -3)
+	registerCommand("ZCard", cmdZCard, readFirstKey, 2)
+	registerCommand("ZIncrBy", cmdZIncrBy, writeFirstKey, 4)
+	registerCommand("ZRank", cmdZRank, readFirstKey, -3)
+	registerCommand("ZRevRank", cmdZRevRank, readFirstKey, -3)
+	registerCommand("ZRange", cmdZRange, readFirstKey, -4)
+	registerCommand("ZRangeStore", cmdZRangeStore, writeFirstReadSecond, -5)
+	registerCommand("ZCount", cmdZCount, readFirstKey, 4)
+	registerCommand("ZLexCount", cmdZLexCount, readFirstKey, 4)
+	registerCommand("ZRemRangeByRank", cmdZRemRangeByRank, writeFirstKey, 4)
+	registerCommand("ZRemRangeByScore", cmdZRemRangeByScore, writeFirstKey, 4)
+	registerCommand("ZRemRangeByLex", cmdZRemRangeByLex, writeFirstKey, 4)
+	registerCommand("ZPopMin", cmdZPopMin, writeFirstKey, -2)
+	registerCommand("ZPopMax", cmdZPopMax, writeFirstKey, -2)
+	registerCommand("ZRandMember", cmdZRandMember, readFirstKey, -2)
+	registerCommand("ZUnion", cmdZUnion, readNumKeys, -3)
+	registerCommand("ZInter", cmdZInter, readNumKeys, -3)
+	registerCommand("ZDiff", cmdZDiff, readNumKeys, -3)
+	registerCommand("ZUnionStore", cmdZUnionStore, writeFirstReadNumKeys, -4)
+	registerCommand("ZInterStore", cmdZInterStore, writeFirstReadNumKeys, -4)
+	registerCommand("ZDiffStore", cmdZDiffStore, writeFirstReadNumKeys, -4)
+	registerCommand("ZScan", cmdZScan, readFirstKey, -3)
 }
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+func TestZAddFlags(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "ZADD z 1 a 2 b", ":2")
+	expectReply(t, e, c, "ZADD z NX 5 a 3 c", ":1")
+	expectReply(t, e, c, "ZSCORE z a", "$1 1")
+	expectReply(t, e, c, "ZADD z XX 5 a 4 d", ":0")
+	expectReply(t, e, c, "ZSCORE z a", "$1 5")
+	expectReply(t, e, c, "ZSCORE z d", "$-1")
+	expectReply(t, e, c, "ZADD z XX CH 6 a 2 b", ":1")
+	expectReply(t, e, c, "ZADD z GT CH 1 a 9 b 7 e", ":2")
+	expectReply(t, e, c, "ZMSCORE z a b e", "*3 $1 6 $1 9 $1 7")
+	expectReply(t, e, c, "ZADD z LT CH 8 a 1 b", ":1")
+	expectReply(t, e, c, "ZMSCORE z a b", "*2 $1 6 $1 1")
+
+	expectReply(t, e, c, "ZADD z INCR 2.5 a", "$3 8.5")
+	expectReply(t, e, c, "ZADD z NX INCR 1 a", "$-1")
+	expectReply(t, e, c, "ZADD z XX INCR 1 x", "$-1")
+	expectReply(t, e, c, "ZADD z GT INCR -1 a", "$-1")
+	expectReply(t, e, c, "ZADD z INCR 1 n", "$1 1")
+	expectReply(t, e, c, "ZADD none XX 1 a", ":0")
+	expectReply(t, e, c, "EXISTS none", ":0")
+
+	expectReply(t, e, c, "ZADD z NX XX 1 a", "-ERR XX and NX options at the same time are not compatible")
+	expectReply(t, e, c, "ZADD z GT LT 1 a", "-ERR GT, LT, and/or NX options at the same time are not compatible")
+	expectReply(t, e, c, "ZADD z NX GT 1 a", "-ERR GT, LT, and/or NX options at the same time are not compatible")
+	expectReply(t, e, c, "ZADD z INCR 1 a 2 b", "-ERR INCR option supports a single increment-element pair")
+	expectReply(t, e, c, "ZADD z 1 a 2", "-ERR syntax error")
+	expectReply(t, e, c, "ZADD z x a", "-ERR value is not a valid float")
+	expectReply(t, e, c, "ZADD z INCR inf a", "$3 inf")
+	expectReply(t, e, c, "ZADD z INCR -inf a", "-ERR resulting score is not a number (NaN)")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "ZRANGE z 0 -1 WITHSCORES", "*10 $1 b $1 1 $1 n $1 1 $1 c $1 3 $1 e $1 7 $1 a $3 inf")
+}
+
+func TestZSetOperations(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "ZADD z1 1 a 2 b 3 c", ":3")
+	expectReply(t, e, c, "ZADD z2 10 b 20 c 30 d", ":3")
+	expectReply(t, e, c, "SADD s c d e", ":3")
+
+	expectReply(t, e, c, "ZUNION 2 z1 z2 WITHSCORES", "*8 $1 a $1 1 $1 b $2 12 $1 c $2 23 $1 d $2 30")
+	expectReply(t, e, c, "ZUNION 2 z1 z2 WEIGHTS 2 1 AGGREGATE MIN WITHSCORES",
+		"*8 $1 a $1 2 $1 b $1 4 $1 c $1 6 $1 d $2 30")
+	expectReply(t, e, c, "ZINTER 2 z1 z2 AGGREGATE MAX WITHSCORES", "*4 $1 b $2 10 $1 c $2 20")
+	// 普通集合的成员分数为1
+	expectReply(t, e, c, "ZINTER 2 z1 s WITHSCORES", "*2 $1 c $1 4")
+	expectReply(t, e, c, "ZDIFF 3 z1 z2 s", "*1 $1 a")
+	expectReply(t, e, c, "ZDIFF 2 z1 missing WITHSCORES", "*6 $1 a $1 1 $1 b $1 2 $1 c $1 3")
+
+	expectReply(t, e, c, "ZUNIONSTORE dest 2 z1 z2 WEIGHTS 1 0.5", ":4")
+	expectReply(t, e, c, "ZRANGE dest 0 -1 WITHSCORES", "*8 $1 a $1 1 $1 b $1 7 $1 c $2 13 $1 d $2 15")
+	expectReply(t, e, c, "ZINTERSTORE inter 2 z1 z2", ":2")
+	expectReply(t, e, c, "ZDIFFSTORE diff 2 z1 z2", ":1")
+	// 结果为空时删除dest
+	expectReply(t, e, c, "ZINTERSTORE dest 2 z1 missing", ":0")
+	expectReply(t, e, c, "EXISTS dest", ":0")
+
+	expectReply(t, e, c, "ZUNION 0 z1", "-ERR at least 1 input key is needed for 'zunion' command")
+	expectReply(t, e, c, "ZUNION 3 z1 z2", "-ERR syntax error")
+	expectReply(t, e, c, "ZUNION x z1", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "ZUNION 2 z1 z2 WEIGHTS 1", "-ERR syntax error")
+	expectReply(t, e, c, "ZUNION 2 z1 z2 WEIGHTS 1 x", "-ERR weight value is not a float")
+	expectReply(t, e, c, "ZUNION 2 z1 z2 AGGREGATE AVG", "-ERR syntax error")
+	expectReply(t, e, c, "ZDIFF 2 z1 z2 WEIGHTS 1 1", "-ERR syntax error")
+	expectReply(t, e, c, "ZUNIONSTORE dest 2 z1 z2 WITHSCORES", "-ERR syntax error")
+	expectReply(t, e, c, "SET str x", "+ok")
+	expectReply(t, e, c, "ZUNION 2 z1 str", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "ZRANGE inter 0 -1 WITHSCORES", "*4 $1 b $2 12 $1 c $2 23")
+	expectReply(t, e, c, "ZRANGE diff 0 -1", "*1 $1 a")
+	expectReply(t, e, c, "EXISTS dest", ":0")
+}
@@ -0,0 +1,1468 @@
+package engine
+
+import (
+	"gedis/aof"
+	"gedis/datastruct/stream"
+	"gedis/engine/entity"
+	"gedis/gedis/proto"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (d *DB) getStreamObject(key string) (*stream.Stream, proto.Reply) {
+	dataEntity, exist := d.GetEntity(key)
+	if !exist {
+		return nil, nil
+	}
+	s, ok := dataEntity.Object.(*stream.Stream)
+	if !ok {
+		return nil, proto.NewWrongTypeErrReply()
+	}
+	return s, nil
+}
+
+func (d *DB) getOrInitStreamObject(key string) (*stream.Stream, proto.Reply) {
+	s, reply := d.getStreamObject(key)
+	if reply != nil {
+		return nil, reply
+	}
+	if s == nil {
+		s = stream.NewStream()
+		d.PutEntity(key, &entity.DataEntity{Object: s})
+	}
+	return s, nil
+}
+
+// 记录消息ID相关的状态，撤销时恢复
+func (d *DB) saveStreamState(key string, s *stream.Stream) {
+	lastID, maxDeletedID, entriesAdded := s.LastID, s.MaxDeletedID, s.EntriesAdded
+	d.Modified(key, func() {
+		s.LastID, s.MaxDeletedID, s.EntriesAdded = lastID, maxDeletedID, entriesAdded
+	})
+}
+
+// 记录被删除的消息，撤销时放回原来的位置，maxDeletedID为删除之前的值
+func (d *DB) streamRemoved(key string, s *stream.Stream, removed []*stream.Entry, maxDeletedID stream.ID) {
+	if len(removed) == 0 {
+		return
+	}
+	d.Modified(key, func() {
+		s.Restore(removed)
+		s.MaxDeletedID = maxDeletedID
+	})
+}
+
+// 记录消费者组的读取位置，撤销时恢复
+func (d *DB) saveGroupState(key string, group *stream.Group) {
+	lastID, entriesRead := group.LastID, group.EntriesRead
+	d.Modified(key, func() {
+		group.LastID, group.EntriesRead = lastID, entriesRead
+	})
+}
+
+// 记录消费者的交互时间，撤销时恢复
+func (d *DB) saveConsumerState(key string, consumer *stream.Consumer) {
+	seenTime, activeTime := consumer.SeenTime, consumer.ActiveTime
+	d.Modified(key, func() {
+		consumer.SeenTime, consumer.ActiveTime = seenTime, activeTime
+	})
+}
+
+func (d *DB) streamCreateConsumer(key string, group *stream.Group, name string, now int64) (*stream.Consumer, bool) {
+	consumer, created := group.CreateConsumer(name, now)
+	if created {
+		d.Modified(key, func() {
+			group.DeleteConsumer(name)
+		})
+	}
+	return consumer, created
+}
+
+// 转移待确认消息，撤销时交还给原来的消费者
+func (d *DB) streamClaim(key string, group *stream.Group, id stream.ID, consumer *stream.Consumer,
+	deliveryTime int64, deliveryCount uint64) *stream.PendingEntry {
+	old, exist := group.Pending(id)
+	var undo func()
+	if exist {
+		prev, prevTime, prevCount := old.Consumer, old.DeliveryTime, old.DeliveryCount
+		undo = func() {
+			group.Claim(id, prev, prevTime, prevCount)
+		}
+	} else {
+		undo = func() {
+			group.Ack(id)
+		}
+	}
+	pending := group.Claim(id, consumer, deliveryTime, deliveryCount)
+	d.Modified(key, undo)
+	return pending
+}
+
+// 确认消息，撤销时放回原来消费者的待确认列表
+func (d *DB) streamAck(key string, group *stream.Group, id stream.ID) bool {
+	old, exist := group.Pending(id)
+	if !exist {
+		return false
+	}
+	consumer, deliveryTime, deliveryCount := old.Consumer, old.DeliveryTime, old.DeliveryCount
+	group.Ack(id)
+	d.Modified(key, func() {
+		group.Claim(id, consumer, deliveryTime, deliveryCount)
+	})
+	return true
+}
+
+func nowMs() int64 {
+	return time.Now().UnixMilli()
+}
+
+func invalidStreamIDReply() proto.Reply {
+	return proto.NewGenericErrReply(stream.ErrInvalidID.Error())
+}
+
+func noGroupReply(key, group string) proto.Reply {
+	return proto.NewSimpleErrReply("NOGROUP No such consumer group '" + group + "' for key name '" + key + "'")
+}
+
+// 获取stream以及其中的消费者组，不存在时返回NOGROUP错误
+func (d *DB) getStreamGroup(key, groupName string) (*stream.Stream, *stream.Group, proto.Reply) {
+	s, reply := d.getStreamObject(key)
+	if reply != nil {
+		return nil, nil, reply
+	}
+	if s == nil || s.Group(groupName) == nil {
+		return nil, nil, noGroupReply(key, groupName)
+	}
+	return s, s.Group(groupName), nil
+}
+
+// 解析范围查询的ID，支持 - + 以及 ( 开头的开区间，省略seq时起点取0，终点取最大值
+func parseRangeID(arg []byte, isStart bool) (stream.ID, proto.Reply) {
+	s := string(arg)
+	switch s {
+	case "-":
+		return stream.MinID, nil
+	case "+":
+		return stream.MaxID, nil
+	}
+	exclude := strings.HasPrefix(s, "(")
+	if exclude {
+		s = s[1:]
+	}
+	var missingSeq uint64
+	if !isStart {
+		missingSeq = math.MaxUint64
+	}
+	id, err := stream.ParseID(s, missingSeq)
+	if err != nil {
+		return id, invalidStreamIDReply()
+	}
+	if !exclude {
+		return id, nil
+	}
+	var ok bool
+	if isStart {
+		id, ok = id.Next()
+		if !ok {
+			return id, proto.NewGenericErrReply("invalid start ID for the interval")
+		}
+	} else {
+		id, ok = id.Prev()
+		if !ok {
+			return id, proto.NewGenericErrReply("invalid end ID for the interval")
+		}
+	}
+	return id, nil
+}
+
+func streamIDReply(id stream.ID) proto.Reply {
+	return proto.NewBulkReply([]byte(id.String()))
+}
+
+func streamEntryReply(entry *stream.Entry) proto.Reply {
+	return proto.NewMixReply(streamIDReply(entry.ID), proto.NewMultiBulkReply(entry.Fields))
+}
+
+func streamEntriesReply(entries []*stream.Entry) proto.Reply {
+	result := make([]proto.Reply, len(entries))
+	for i, entry := range entries {
+		result[i] = streamEntryReply(entry)
+	}
+	return proto.NewMixReply(result...)
+}
+
+// 裁剪选项 <MAXLEN | MINID> [= | ~] threshold [LIMIT count]
+type streamTrimSpec struct {
+	byLen  bool
+	maxLen int
+	minID  stream.ID
+	limit  int
+}
+
+// 从args[i]开始解析裁剪选项，返回下一个未解析参数的下标
+func parseStreamTrim(args [][]byte, i int) (*streamTrimSpec, int, proto.Reply) {
+	spec := &streamTrimSpec{byLen: strings.ToUpper(string(args[i])) == "MAXLEN"}
+	i++
+	approx := false
+	if i < len(args) {
+		switch string(args[i]) {
+		case "~":
+			approx = true
+			i++
+		case "=":
+			i++
+		}
+	}
+	if i >= len(args) {
+		return nil, 0, proto.NewSyntaxErrReply()
+	}
+	if spec.byLen {
+		maxLen, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil {
+			return nil, 0, proto.NewGenericErrReply("value is not an integer or out of range")
+		}
+		if maxLen < 0 {
+			return nil, 0, proto.NewGenericErrReply("The MAXLEN argument must be >= 0.")
+		}
+		spec.maxLen = int(maxLen)
+	} else {
+		minID, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			return nil, 0, invalidStreamIDReply()
+		}
+		spec.minID = minID
+	}
+	i++
+	if i+1 < len(args) && strings.ToUpper(string(args[i])) == "LIMIT" {
+		if !approx {
+			return nil, 0, proto.NewGenericErrReply("syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		limit, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return nil, 0, proto.NewGenericErrReply("value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return nil, 0, proto.NewGenericErrReply("The LIMIT argument must be >= 0.")
+		}
+		spec.limit = int(limit)
+		i += 2
+	}
+	return spec, i, nil
+}
+
+// 近似裁剪也按照精确裁剪处理，保留的消息数不会少于要求，返回删除的消息数
+func (spec *streamTrimSpec) trim(db *DB, key string, s *stream.Stream) int {
+	maxDeletedID := s.MaxDeletedID
+	var removed []*stream.Entry
+	if spec.byLen {
+		removed = s.TrimByLen(spec.maxLen, spec.limit)
+	} else {
+		removed = s.TrimByMinID(spec.minID, spec.limit)
+	}
+	db.streamRemoved(key, s, removed, maxDeletedID)
+	return len(removed)
+}
+
+// XADD key [NOMKSTREAM] [<MAXLEN | MINID> [= | ~] threshold [LIMIT count]] <* | id> field value [field value ...]
+func cmdXAdd(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	noMkStream := false
+	var trim *streamTrimSpec
+	i := 1
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NOMKSTREAM":
+			noMkStream = true
+		case "MAXLEN", "MINID":
+			var reply proto.Reply
+			trim, i, reply = parseStreamTrim(args, i)
+			if reply != nil {
+				return reply
+			}
+			i--
+		default:
+			break loop
+		}
+	}
+	if i >= len(args) {
+		return proto.NewSyntaxErrReply()
+	}
+	idArg := string(args[i])
+	fields := args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return proto.NewArgNumErrReply("xadd")
+	}
+
+	s, reply := db.getStreamObject(key)
+	if reply != nil {
+		return reply
+	}
+	if s == nil && noMkStream {
+		return proto.NewNullBulkReply()
+	}
+	lastID := stream.MinID
+	if s != nil {
+		lastID = s.LastID
+	}
+
+	var id stream.ID
+	switch {
+	case idArg == "*":
+		now := nowMs()
+		if now < 0 {
+			now = 0
+		}
+		var ok bool
+		if s == nil {
+			id = stream.ID{Ms: uint64(now)}
+		} else if id, ok = s.NextID(uint64(now)); !ok {
+			return proto.NewGenericErrReply("The stream has exhausted the last possible ID, unable to add more items")
+		}
+	case strings.HasSuffix(idArg, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(idArg, "-*"), 10, 64)
+		if err != nil {
+			return invalidStreamIDReply()
+		}
+		id = stream.ID{Ms: ms}
+		if ms == lastID.Ms {
+			if lastID.Seq == math.MaxUint64 {
+				return proto.NewGenericErrReply("The ID specified in XADD is equal or smaller than the target stream top item")
+			}
+			id.Seq = lastID.Seq + 1
+		}
+	default:
+		var err error
+		id, err = stream.ParseID(idArg, 0)
+		if err != nil {
+			return invalidStreamIDReply()
+		}
+	}
+	if id.IsZero() {
+		return proto.NewGenericErrReply("The ID specified in XADD must be greater than 0-0")
+	}
+	if !lastID.Less(id) {
+		return proto.NewGenericErrReply("The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+
+	if s == nil {
+		s, _ = db.getOrInitStreamObject(key)
+	}
+	db.saveStreamState(key, s)
+	s.Add(id, fields)
+	db.Modified(key, func() {
+		s.Delete(id)
+	})
+	if trim != nil {
+		trim.trim(db, key, s)
+	}
+
+	// 自动生成的ID替换为实际的ID，保证回放结果一致
+	aofArgs := make([][]byte, len(args))
+	copy(aofArgs, args)
+	aofArgs[i] = []byte(id.String())
+	db.writeAof(aof.XAddCmd(aofArgs...))
+	db.signalKeyReady(key)
+	return streamIDReply(id)
+}
+
+// XLEN key
+func cmdXLen(db *DB, args [][]byte) proto.Reply {
+	s, reply := db.getStreamObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if s == nil {
+		return proto.NewIntegerReply(0)
+	}
+	return proto.NewIntegerReply(int64(s.Len()))
+}
+
+func execXRange(db *DB, args [][]byte, rev bool) proto.Reply {
+	startArg, endArg := args[1], args[2]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, reply := parseRangeID(startArg, true)
+	if reply != nil {
+		return reply
+	}
+	end, reply := parseRangeID(endArg, false)
+	if reply != nil {
+		return reply
+	}
+	count := -1
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToUpper(string(args[3])) != "COUNT" {
+			return proto.NewSyntaxErrReply()
+		}
+		c, err := strconv.ParseInt(string(args[4]), 10, 64)
+		if err != nil {
+			return proto.NewGenericErrReply("value is not an integer or out of range")
+		}
+		if c < 0 {
+			c = 0
+		}
+		count = int(c)
+	}
+
+	s, reply := db.getStreamObject(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	if s == nil || count == 0 {
+		return proto.NewEmptyMultiBulkReply()
+	}
+	return streamEntriesReply(s.Range(start, end, count, rev))
+}
+
+// XRANGE key start end [COUNT count]
+func cmdXRange(db *DB, args [][]byte) proto.Reply {
+	return execXRange(db, args, false)
+}
+
+// XREVRANGE key end start [COUNT count]
+func cmdXRevRange(db *DB, args [][]byte) proto.Reply {
+	return execXRange(db, args, true)
+}
+
+// XDEL key id [id ...]
+func cmdXDel(db *DB, args [][]byte) proto.Reply {
+	ids := make([]stream.ID, len(args)-1)
+	for i, arg := range args[1:] {
+		id, err := stream.ParseID(string(arg), 0)
+		if err != nil {
+			return invalidStreamIDReply()
+		}
+		ids[i] = id
+	}
+	key := string(args[0])
+	s, reply := db.getStreamObject(key)
+	if reply != nil {
+		return reply
+	}
+	if s == nil {
+		return proto.NewIntegerReply(0)
+	}
+	maxDeletedID := s.MaxDeletedID
+	var removed []*stream.Entry
+	for _, id := range ids {
+		if entry, exist := s.Get(id); exist && s.Delete(id) {
+			removed = append(removed, entry)
+		}
+	}
+	db.streamRemoved(key, s, removed, maxDeletedID)
+	deleted := int64(len(removed))
+	if deleted > 0 {
+		db.writeAof(aof.XDelCmd(args...))
+	}
+	return proto.NewIntegerReply(deleted)
+}
+
+// XTRIM key <MAXLEN | MINID> [= | ~] threshold [LIMIT count]
+func cmdXTrim(db *DB, args [][]byte) proto.Reply {
+	switch strings.ToUpper(string(args[1])) {
+	case "MAXLEN", "MINID":
+	default:
+		return proto.NewSyntaxErrReply()
+	}
+	trim, i, reply := parseStreamTrim(args, 1)
+	if reply != nil {
+		return reply
+	}
+	if i != len(args) {
+		return proto.NewSyntaxErrReply()
+	}
+	key := string(args[0])
+	s, reply := db.getStreamObject(key)
+	if reply != nil {
+		return reply
+	}
+	if s == nil {
+		return proto.NewIntegerReply(0)
+	}
+	trimmed := trim.trim(db, key, s)
+	if trimmed > 0 {
+		db.writeAof(aof.XTrimCmd(args...))
+	}
+	return proto.NewIntegerReply(int64(trimmed))
+}
+
+// XREAD/XREADGROUP 的公共选项
+type streamReadSpec struct {
+	group    string
+	consumer string
+	count    int
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	keys     []string
+	ids      [][]byte
+	// STREAMS之前的参数，用于构造重试命令
+	prefix [][]byte
+}
+
+func parseStreamReadSpec(cmdName string, args [][]byte, withGroup bool) (*streamReadSpec, proto.Reply) {
+	spec := &streamReadSpec{}
+	i := 0
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "STREAMS" {
+			break
+		}
+		remain := len(args) - i - 1
+		switch {
+		case option == "COUNT" && remain >= 1:
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, proto.NewGenericErrReply("value is not an integer or out of range")
+			}
+			if count > 0 {
+				spec.count = int(count)
+			}
+			spec.prefix = append(spec.prefix, args[i], args[i+1])
+			i++
+		case option == "BLOCK" && remain >= 1:
+			timeout, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, proto.NewGenericErrReply("timeout is not an integer or out of range")
+			}
+			if timeout < 0 {
+				return nil, proto.NewGenericErrReply("timeout is negative")
+			}
+			spec.block = true
+			spec.timeout = time.Duration(timeout) * time.Millisecond
+			i++
+		case option == "GROUP" && withGroup && remain >= 2:
+			spec.group = string(args[i+1])
+			spec.consumer = string(args[i+2])
+			spec.prefix = append(spec.prefix, args[i], args[i+1], args[i+2])
+			i += 2
+		case option == "NOACK" && withGroup:
+			spec.noAck = true
+			spec.prefix = append(spec.prefix, args[i])
+		default:
+			return nil, proto.NewSyntaxErrReply()
+		}
+	}
+	if withGroup && spec.group == "" {
+		return nil, proto.NewGenericErrReply("Missing GROUP option for XREADGROUP")
+	}
+	rest := args[i:]
+	if len(rest) < 3 || (len(rest)-1)%2 != 0 {
+		if len(rest) == 0 {
+			return nil, proto.NewSyntaxErrReply()
+		}
+		special := "$"
+		if withGroup {
+			special = ">"
+		}
+		return nil, proto.NewGenericErrReply("Unbalanced '" + cmdName + "' list of streams: for each stream key an ID or '" + special + "' must be specified.")
+	}
+	n := (len(rest) - 1) / 2
+	spec.keys = toStrings(rest[1 : n+1])
+	spec.ids = make([][]byte, n)
+	copy(spec.ids, rest[n+1:])
+	return spec, nil
+}
+
+// STREAMS之后前一半参数为key
+func streamReadKeys(args [][]byte) []string {
+	for i, arg := range args {
+		if strings.ToUpper(string(arg)) == "STREAMS" {
+			rest := args[i+1:]
+			return toStrings(rest[:len(rest)/2])
+		}
+	}
+	return nil
+}
+
+func xReadKeys(args [][]byte) ([]string, []string) {
+	return nil, streamReadKeys(args)
+}
+
+// XREADGROUP会修改消费者组的状态
+func xReadGroupKeys(args [][]byte) ([]string, []string) {
+	return streamReadKeys(args), nil
+}
+
+// 构造不带BLOCK选项的重试命令
+func (spec *streamReadSpec) retryCommand(cmdName string, ids [][]byte) [][]byte {
+	command := make([][]byte, 0, 2+len(spec.prefix)+len(spec.keys)*2)
+	command = append(command, []byte(cmdName))
+	command = append(command, spec.prefix...)
+	command = append(command, []byte("STREAMS"))
+	for _, key := range spec.keys {
+		command = append(command, []byte(key))
+	}
+	return append(command, ids...)
+}
+
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func cmdXRead(db *DB, args [][]byte) proto.Reply {
+	spec, reply := parseStreamReadSpec("xread", args, false)
+	if reply != nil {
+		return reply
+	}
+
+	ids := make([]stream.ID, len(spec.keys))
+	resolved := make([][]byte, len(spec.keys))
+	for i, key := range spec.keys {
+		s, reply := db.getStreamObject(key)
+		if reply != nil {
+			return reply
+		}
+		switch string(spec.ids[i]) {
+		case "$":
+			// 只读取调用之后新增的消息
+			if s != nil {
+				ids[i] = s.LastID
+			}
+		case ">":
+			return proto.NewGenericErrReply("The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		default:
+			id, err := stream.ParseID(string(spec.ids[i]), 0)
+			if err != nil {
+				return invalidStreamIDReply()
+			}
+			ids[i] = id
+		}
+		resolved[i] = []byte(ids[i].String())
+	}
+
+	result := make([]proto.Reply, 0)
+	for i, key := range spec.keys {
+		s, _ := db.getStreamObject(key)
+		if s == nil {
+			continue
+		}
+		start, ok := ids[i].Next()
+		if !ok {
+			continue
+		}
+		entries := s.Range(start, stream.MaxID, spec.count, false)
+		if len(entries) > 0 {
+			result = append(result, proto.NewMixReply(proto.NewBulkReply([]byte(key)), streamEntriesReply(entries)))
+		}
+	}
+	if len(result) > 0 {
+		return proto.NewMixReply(result...)
+	}
+	if spec.block {
+		return &blockedReply{
+			keys:    spec.keys,
+			timeout: spec.timeout,
+			retry:   spec.retryCommand("XREAD", resolved),
+		}
+	}
+	return proto.NewNullMultiBulkReply()
+}
+
+// 更新消费者组的已读消息数
+func updateEntriesRead(s *stream.Stream, group *stream.Group, id stream.ID) {
+	if entriesRead, ok := s.EstimateEntriesRead(id); ok {
+		group.EntriesRead = entriesRead
+	} else if group.EntriesRead >= 0 {
+		group.EntriesRead++
+	}
+}
+
+// 将消费者组的状态转换为可以回放的命令
+func xClaimAof(key, group, consumer []byte, entry *stream.PendingEntry, lastID stream.ID) [][]byte {
+	return aof.XClaimCmd(key, group, consumer, []byte("0"), []byte(entry.ID.String()),
+		[]byte("TIME"), []byte(strconv.FormatInt(entry.DeliveryTime, 10)),
+		[]byte("RETRYCOUNT"), []byte(strconv.FormatUint(entry.DeliveryCount, 10)),
+		[]byte("FORCE"), []byte("JUSTID"), []byte("LASTID"), []byte(lastID.String()))
+}
+
+func xGroupSetIDAof(key []byte, group *stream.Group) [][]byte {
+	return aof.XGroupCmd([]byte("SETID"), key, []byte(group.Name), []byte(group.LastID.String()),
+		[]byte("ENTRIESREAD"), []byte(strconv.FormatInt(group.EntriesRead, 10)))
+}
+
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func cmdXReadGroup(db *DB, args [][]byte) proto.Reply {
+	spec, reply := parseStreamReadSpec("xreadgroup", args, true)
+	if reply != nil {
+		return reply
+	}
+
+	// 先检查所有的key和消费者组，避免只处理了一部分
+	streams := make([]*stream.Stream, len(spec.keys))
+	allNew := true
+	for i, key := range spec.keys {
+		s, reply := db.getStreamObject(key)
+		if reply != nil {
+			return reply
+		}
+		if s == nil || s.Group(spec.group) == nil {
+			return proto.NewSimpleErrReply("NOGROUP No such key '" + key + "' or consumer group '" + spec.group + "' in XREADGROUP with GROUP option")
+		}
+		streams[i] = s
+		if string(spec.ids[i]) != ">" {
+			allNew = false
+			if _, err := stream.ParseID(string(spec.ids[i]), 0); err != nil {
+				return invalidStreamIDReply()
+			}
+		}
+	}
+
+	now := nowMs()
+	result := make([]proto.Reply, 0)
+	for i, key := range spec.keys {
+		s := streams[i]
+		group := s.Group(spec.group)
+		keyArg := []byte(key)
+		consumerArg := []byte(spec.consumer)
+		consumer, created := db.streamCreateConsumer(key, group, spec.consumer, now)
+		db.saveConsumerState(key, consumer)
+		consumer.SeenTime = now
+		if created {
+			db.writeAof(aof.XGroupCmd([]byte("CREATECONSUMER"), keyArg, []byte(spec.group), consumerArg))
+		}
+
+		if string(spec.ids[i]) == ">" {
+			entries := s.Range(group.LastID, stream.MaxID, 0, false)
+			if len(entries) > 0 && entries[0].ID == group.LastID {
+				entries = entries[1:]
+			}
+			if spec.count > 0 && len(entries) > spec.count {
+				entries = entries[:spec.count]
+			}
+			if len(entries) == 0 {
+				continue
+			}
+			db.saveGroupState(key, group)
+			for _, entry := range entries {
+				group.LastID = entry.ID
+				updateEntriesRead(s, group, entry.ID)
+				if !spec.noAck {
+					pending := db.streamClaim(key, group, entry.ID, consumer, now, 1)
+					db.writeAof(xClaimAof(keyArg, []byte(spec.group), consumerArg, pending, group.LastID))
+				}
+			}
+			consumer.ActiveTime = now
+			db.writeAof(xGroupSetIDAof(keyArg, group))
+			result = append(result, proto.NewMixReply(proto.NewBulkReply(keyArg), streamEntriesReply(entries)))
+			continue
+		}
+
+		// 读取消费者自己的待确认消息
+		id, _ := stream.ParseID(string(spec.ids[i]), 0)
+		items := make([]proto.Reply, 0)
+		if start, ok := id.Next(); ok {
+			for _, pending := range consumer.PendingFrom(start, spec.count) {
+				entry, exist := s.Get(pending.ID)
+				if !exist {
+					// 消息已经被删除
+					items = append(items, proto.NewMixReply(streamIDReply(pending.ID), proto.NewNullMultiBulkReply()))
+					continue
+				}
+				pending = db.streamClaim(key, group, pending.ID, consumer, now, pending.DeliveryCount+1)
+				db.writeAof(xClaimAof(keyArg, []byte(spec.group), consumerArg, pending, group.LastID))
+				items = append(items, streamEntryReply(entry))
+			}
+		}
+		result = append(result, proto.NewMixReply(proto.NewBulkReply(keyArg), proto.NewMixReply(items...)))
+	}
+
+	if len(result) > 0 {
+		return proto.NewMixReply(result...)
+	}
+	if spec.block && allNew {
+		return &blockedReply{
+			keys:    spec.keys,
+			timeout: spec.timeout,
+			retry:   spec.retryCommand("XREADGROUP", spec.ids),
+		}
+	}
+	return proto.NewNullMultiBulkReply()
+}
+
+// XACK key group id [id ...]
+func cmdXAck(db *DB, args [][]byte) proto.Reply {
+	ids := make([]stream.ID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, err := stream.ParseID(string(arg), 0)
+		if err != nil {
+			return invalidStreamIDReply()
+		}
+		ids[i] = id
+	}
+	key := string(args[0])
+	s, reply := db.getStreamObject(key)
+	if reply != nil {
+		return reply
+	}
+	if s == nil || s.Group(string(args[1])) == nil {
+		return proto.NewIntegerReply(0)
+	}
+	group := s.Group(string(args[1]))
+	var acked int64
+	for _, id := range ids {
+		if db.streamAck(key, group, id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		db.writeAof(aof.XAckCmd(args...))
+	}
+	return proto.NewIntegerReply(acked)
+}
+
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func cmdXPending(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	groupName := string(args[1])
+	if len(args) == 2 {
+		_, group, reply := db.getStreamGroup(key, groupName)
+		if reply != nil {
+			return reply
+		}
+		pending := group.PendingRange(stream.MinID, stream.MaxID, 0)
+		if len(pending) == 0 {
+			return proto.NewMixReply(proto.NewIntegerReply(0), proto.NewNullBulkReply(),
+				proto.NewNullBulkReply(), proto.NewNullMultiBulkReply())
+		}
+		consumers := make([]proto.Reply, 0)
+		for _, consumer := range group.Consumers() {
+			if consumer.PendingLen() > 0 {
+				consumers = append(consumers, proto.NewMultiBulkReply([][]byte{
+					[]byte(consumer.Name), []byte(strconv.Itoa(consumer.PendingLen())),
+				}))
+			}
+		}
+		return proto.NewMixReply(
+			proto.NewIntegerReply(int64(len(pending))),
+			streamIDReply(pending[0].ID),
+			streamIDReply(pending[len(pending)-1].ID),
+			proto.NewMixReply(consumers...),
+		)
+	}
+
+	rest := args[2:]
+	var minIdle int64
+	if strings.ToUpper(string(rest[0])) == "IDLE" {
+		if len(rest) < 2 {
+			return proto.NewSyntaxErrReply()
+		}
+		var err error
+		minIdle, err = strconv.ParseInt(string(rest[1]), 10, 64)
+		if err != nil {
+			return proto.NewGenericErrReply("value is not an integer or out of range")
+		}
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return proto.NewSyntaxErrReply()
+	}
+	start, reply := parseRangeID(rest[0], true)
+	if reply != nil {
+		return reply
+	}
+	end, reply := parseRangeID(rest[1], false)
+	if reply != nil {
+		return reply
+	}
+	count, err := strconv.ParseInt(string(rest[2]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	_, group, reply := db.getStreamGroup(key, groupName)
+	if reply != nil {
+		return reply
+	}
+	if count <= 0 {
+		return proto.NewEmptyMultiBulkReply()
+	}
+
+	var candidates []*stream.PendingEntry
+	if len(rest) == 4 {
+		consumer := group.Consumer(string(rest[3]))
+		if consumer == nil {
+			return proto.NewEmptyMultiBulkReply()
+		}
+		candidates = consumer.PendingFrom(start, 0)
+	} else {
+		candidates = group.PendingRange(start, end, 0)
+	}
+	now := nowMs()
+	result := make([]proto.Reply, 0)
+	for _, pending := range candidates {
+		if end.Less(pending.ID) || int64(len(result)) >= count {
+			break
+		}
+		idle := now - pending.DeliveryTime
+		if idle < minIdle {
+			continue
+		}
+		result = append(result, proto.NewMixReply(
+			streamIDReply(pending.ID),
+			proto.NewBulkReply([]byte(pending.Consumer.Name)),
+			proto.NewIntegerReply(idle),
+			proto.NewIntegerReply(int64(pending.DeliveryCount)),
+		))
+	}
+	return proto.NewMixReply(result...)
+}
+
+// XCLAIM 和 XAUTOCLAIM 的公共选项
+type streamClaimSpec struct {
+	minIdle      int64
+	deliveryTime int64
+	retryCount   int64
+	force        bool
+	justID       bool
+	lastID       *stream.ID
+}
+
+// 尝试把一条待确认消息转移给consumer，消息已经被删除时从待确认列表中移除
+func (spec *streamClaimSpec) claim(db *DB, args [][]byte, s *stream.Stream, group *stream.Group,
+	consumer **stream.Consumer, id stream.ID, now int64) (claimed *stream.Entry, deleted bool) {
+	pending, exist := group.Pending(id)
+	entry, inStream := s.Get(id)
+	if !exist {
+		if !spec.force || !inStream {
+			return nil, false
+		}
+	} else if !inStream {
+		db.streamAck(string(args[0]), group, id)
+		db.writeAof(aof.XAckCmd(args[0], args[1], []byte(id.String())))
+		return nil, true
+	} else if spec.minIdle > 0 && now-pending.DeliveryTime < spec.minIdle {
+		return nil, false
+	}
+
+	key := string(args[0])
+	if *consumer == nil {
+		*consumer, _ = db.streamCreateConsumer(key, group, string(args[2]), now)
+	}
+	deliveryCount := uint64(1)
+	if exist {
+		deliveryCount = pending.DeliveryCount
+	}
+	if spec.retryCount >= 0 {
+		deliveryCount = uint64(spec.retryCount)
+	} else if !spec.justID {
+		deliveryCount++
+	}
+	pending = db.streamClaim(key, group, id, *consumer, spec.deliveryTime, deliveryCount)
+	db.saveConsumerState(key, *consumer)
+	(*consumer).ActiveTime = now
+	db.writeAof(xClaimAof(args[0], args[1], args[2], pending, group.LastID))
+	return entry, false
+}
+
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func cmdXClaim(db *DB, args [][]byte) proto.Reply {
+	key, groupName := string(args[0]), string(args[1])
+	now := nowMs()
+	spec := &streamClaimSpec{deliveryTime: now, retryCount: -1}
+	var err error
+	spec.minIdle, err = strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("Invalid min-idle-time argument for XCLAIM")
+	}
+	if spec.minIdle < 0 {
+		spec.minIdle = 0
+	}
+
+	i := 4
+	ids := make([]stream.ID, 0)
+	for ; i < len(args); i++ {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return invalidStreamIDReply()
+	}
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		remain := len(args) - i - 1
+		switch {
+		case option == "FORCE":
+			spec.force = true
+		case option == "JUSTID":
+			spec.justID = true
+		case option == "IDLE" && remain >= 1:
+			idle, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return proto.NewGenericErrReply("Invalid IDLE option argument for XCLAIM")
+			}
+			spec.deliveryTime = now - idle
+			i++
+		case option == "TIME" && remain >= 1:
+			t, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return proto.NewGenericErrReply("Invalid TIME option argument for XCLAIM")
+			}
+			spec.deliveryTime = t
+			i++
+		case option == "RETRYCOUNT" && remain >= 1:
+			retryCount, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || retryCount < 0 {
+				return proto.NewGenericErrReply("Invalid RETRYCOUNT option argument for XCLAIM")
+			}
+			spec.retryCount = retryCount
+			i++
+		case option == "LASTID" && remain >= 1:
+			lastID, err := stream.ParseID(string(args[i+1]), 0)
+			if err != nil {
+				return invalidStreamIDReply()
+			}
+			spec.lastID = &lastID
+			i++
+		default:
+			return proto.NewGenericErrReply("Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+	}
+	// 未来的时间视为当前时间
+	if spec.deliveryTime > now {
+		spec.deliveryTime = now
+	}
+
+	s, group, reply := db.getStreamGroup(key, groupName)
+	if reply != nil {
+		return reply
+	}
+	if spec.lastID != nil && group.LastID.Less(*spec.lastID) {
+		db.saveGroupState(key, group)
+		group.LastID = *spec.lastID
+		db.writeAof(xGroupSetIDAof(args[0], group))
+	}
+
+	consumer := group.Consumer(string(args[2]))
+	result := make([]proto.Reply, 0)
+	for _, id := range ids {
+		entry, _ := spec.claim(db, args, s, group, &consumer, id, now)
+		if entry == nil {
+			continue
+		}
+		if spec.justID {
+			result = append(result, streamIDReply(id))
+		} else {
+			result = append(result, streamEntryReply(entry))
+		}
+	}
+	return proto.NewMixReply(result...)
+}
+
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func cmdXAutoClaim(db *DB, args [][]byte) proto.Reply {
+	key, groupName := string(args[0]), string(args[1])
+	now := nowMs()
+	spec := &streamClaimSpec{deliveryTime: now, retryCount: -1}
+	var err error
+	spec.minIdle, err = strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	if spec.minIdle < 0 {
+		spec.minIdle = 0
+	}
+	start, reply := parseRangeID(args[4], true)
+	if reply != nil {
+		return reply
+	}
+	count := int64(100)
+	for i := 5; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "JUSTID":
+			spec.justID = true
+		case option == "COUNT" && i+1 < len(args):
+			count, err = strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || count < 1 || count > math.MaxInt64/10 {
+				return proto.NewGenericErrReply("COUNT must be > 0")
+			}
+			i++
+		default:
+			return proto.NewSyntaxErrReply()
+		}
+	}
+
+	s, group, reply := db.getStreamGroup(key, groupName)
+	if reply != nil {
+		return reply
+	}
+	consumer := group.Consumer(string(args[2]))
+	// 限制扫描的次数，避免待确认列表过长时阻塞太久
+	// 多取一条用来确定下一次的起始ID
+	attempts := count * 10
+	claimed := make([]proto.Reply, 0)
+	deleted := make([][]byte, 0)
+	next := stream.MinID
+	candidates := group.PendingRange(start, stream.MaxID, int(attempts+1))
+	for i, pending := range candidates {
+		if attempts == 0 || int64(len(claimed)) >= count {
+			next = pending.ID
+			break
+		}
+		attempts--
+		entry, isDeleted := spec.claim(db, args, s, group, &consumer, pending.ID, now)
+		if isDeleted {
+			deleted = append(deleted, []byte(pending.ID.String()))
+		} else if entry != nil {
+			if spec.justID {
+				claimed = append(claimed, streamIDReply(entry.ID))
+			} else {
+				claimed = append(claimed, streamEntryReply(entry))
+			}
+		}
+		if i == len(candidates)-1 {
+			next = stream.MinID
+		}
+	}
+	return proto.NewMixReply(streamIDReply(next), proto.NewMixReply(claimed...), proto.NewMultiBulkReply(deleted))
+}
+
+// 解析消费者组的起始ID，$表示stream中最后一条消息
+func parseGroupID(arg []byte, s *stream.Stream) (stream.ID, proto.Reply) {
+	if string(arg) == "$" {
+		if s == nil {
+			return stream.MinID, nil
+		}
+		return s.LastID, nil
+	}
+	id, err := stream.ParseID(string(arg), 0)
+	if err != nil {
+		return id, invalidStreamIDReply()
+	}
+	return id, nil
+}
+
+// 解析 ENTRIESREAD 选项，没有指定时根据ID估算
+func parseEntriesRead(args [][]byte, s *stream.Stream, id stream.ID) (int64, proto.Reply) {
+	if len(args) == 0 {
+		if entriesRead, ok := s.EstimateEntriesRead(id); ok {
+			return entriesRead, nil
+		}
+		return -1, nil
+	}
+	if len(args) != 2 || strings.ToUpper(string(args[0])) != "ENTRIESREAD" {
+		return 0, proto.NewSyntaxErrReply()
+	}
+	entriesRead, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return 0, proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	if entriesRead < 0 && entriesRead != -1 {
+		return 0, proto.NewGenericErrReply("value for ENTRIESREAD must be positive or -1")
+	}
+	return entriesRead, nil
+}
+
+// XGROUP CREATE key group <id | $> [MKSTREAM] [ENTRIESREAD entries-read]
+// XGROUP SETID key group <id | $> [ENTRIESREAD entries-read]
+// XGROUP DESTROY key group
+// XGROUP CREATECONSUMER key group consumer
+// XGROUP DELCONSUMER key group consumer
+func cmdXGroup(db *DB, args [][]byte) proto.Reply {
+	subCommand := strings.ToUpper(string(args[0]))
+	argNum := map[string]int{"CREATE": 4, "SETID": 4, "DESTROY": 3, "CREATECONSUMER": 4, "DELCONSUMER": 4}
+	num, ok := argNum[subCommand]
+	if !ok {
+		return proto.NewGenericErrReply("unknown subcommand '" + string(args[0]) + "'")
+	}
+	if len(args) < num {
+		return proto.NewArgNumErrReply("xgroup|" + strings.ToLower(subCommand))
+	}
+	key, groupName := string(args[1]), string(args[2])
+
+	s, reply := db.getStreamObject(key)
+	if reply != nil {
+		return reply
+	}
+	mkStream := false
+	options := args[num:]
+	if subCommand == "CREATE" && len(options) > 0 && strings.ToUpper(string(options[0])) == "MKSTREAM" {
+		mkStream = true
+		options = options[1:]
+	}
+	if (subCommand == "DESTROY" || subCommand == "CREATECONSUMER" || subCommand == "DELCONSUMER") && len(options) > 0 {
+		return proto.NewArgNumErrReply("xgroup|" + strings.ToLower(subCommand))
+	}
+	if s == nil && !mkStream {
+		return proto.NewGenericErrReply("The XGROUP subcommand requires the key to exist. " +
+			"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	}
+
+	switch subCommand {
+	case "CREATE":
+		id, reply := parseGroupID(args[3], s)
+		if reply != nil {
+			return reply
+		}
+		if s == nil {
+			s = stream.NewStream()
+		}
+		entriesRead, reply := parseEntriesRead(options, s, id)
+		if reply != nil {
+			return reply
+		}
+		if s.Group(groupName) != nil {
+			return proto.NewSimpleErrReply("BUSYGROUP Consumer Group name already exists")
+		}
+		if mkStream {
+			if _, exist := db.GetEntity(key); !exist {
+				db.PutEntity(key, &entity.DataEntity{Object: s})
+			}
+		}
+		group := s.CreateGroup(groupName, id, entriesRead)
+		db.Modified(key, func() {
+			s.DestroyGroup(groupName)
+		})
+		aofArgs := [][]byte{[]byte("CREATE"), args[1], args[2], []byte(id.String())}
+		if mkStream {
+			aofArgs = append(aofArgs, []byte("MKSTREAM"))
+		}
+		aofArgs = append(aofArgs, []byte("ENTRIESREAD"), []byte(strconv.FormatInt(group.EntriesRead, 10)))
+		db.writeAof(aof.XGroupCmd(aofArgs...))
+		return proto.NewOkReply()
+	case "SETID":
+		id, reply := parseGroupID(args[3], s)
+		if reply != nil {
+			return reply
+		}
+		entriesRead, reply := parseEntriesRead(options, s, id)
+		if reply != nil {
+			return reply
+		}
+		group := s.Group(groupName)
+		if group == nil {
+			return noGroupReply(key, groupName)
+		}
+		db.saveGroupState(key, group)
+		group.LastID = id
+		group.EntriesRead = entriesRead
+		db.writeAof(xGroupSetIDAof(args[1], group))
+		return proto.NewOkReply()
+	case "DESTROY":
+		group := s.Group(groupName)
+		if !s.DestroyGroup(groupName) {
+			return proto.NewIntegerReply(0)
+		}
+		db.Modified(key, func() {
+			s.RestoreGroup(group)
+		})
+		db.writeAof(aof.XGroupCmd(args...))
+		return proto.NewIntegerReply(1)
+	case "CREATECONSUMER":
+		group := s.Group(groupName)
+		if group == nil {
+			return noGroupReply(key, groupName)
+		}
+		if _, created := db.streamCreateConsumer(key, group, string(args[3]), nowMs()); !created {
+			return proto.NewIntegerReply(0)
+		}
+		db.writeAof(aof.XGroupCmd(args...))
+		return proto.NewIntegerReply(1)
+	default:
+		group := s.Group(groupName)
+		if group == nil {
+			return noGroupReply(key, groupName)
+		}
+		consumer := group.Consumer(string(args[3]))
+		pending, deleted := group.DeleteConsumer(string(args[3]))
+		if deleted {
+			db.Modified(key, func() {
+				group.RestoreConsumer(consumer)
+			})
+			db.writeAof(aof.XGroupCmd(args...))
+		}
+		return proto.NewIntegerReply(int64(pending))
+	}
+}
+
+// 消费者组落后的消息数，无法确定时返回false
+func groupLag(s *stream.Stream, group *stream.Group) (int64, bool) {
+	if s.EntriesAdded == 0 || !group.LastID.Less(s.LastID) {
+		return 0, true
+	}
+	// 读取位置之后有被删除的消息时，已读消息数不能说明还剩多少消息，与Redis一致视为无法确定
+	if entriesRead, ok := s.EstimateEntriesRead(group.LastID); ok {
+		return int64(s.EntriesAdded) - entriesRead, true
+	}
+	return 0, false
+}
+
+func optionalIntegerReply(value int64, ok bool) proto.Reply {
+	if !ok {
+		return proto.NewNullBulkReply()
+	}
+	return proto.NewIntegerReply(value)
+}
+
+func bulkString(s string) proto.Reply {
+	return proto.NewBulkReply([]byte(s))
+}
+
+func optionalEntryReply(entry *stream.Entry) proto.Reply {
+	if entry == nil {
+		return proto.NewNullBulkReply()
+	}
+	return streamEntryReply(entry)
+}
+
+func streamInfoReply(s *stream.Stream, full bool, count int) proto.Reply {
+	firstID := stream.MinID
+	if first := s.First(); first != nil {
+		firstID = first.ID
+	}
+	result := []proto.Reply{
+		bulkString("length"), proto.NewIntegerReply(int64(s.Len())),
+		bulkString("last-generated-id"), streamIDReply(s.LastID),
+		bulkString("max-deleted-entry-id"), streamIDReply(s.MaxDeletedID),
+		bulkString("entries-added"), proto.NewIntegerReply(int64(s.EntriesAdded)),
+		bulkString("recorded-first-entry-id"), streamIDReply(firstID),
+	}
+	if !full {
+		return proto.NewMixReply(append(result,
+			bulkString("groups"), proto.NewIntegerReply(int64(len(s.Groups()))),
+			bulkString("first-entry"), optionalEntryReply(s.First()),
+			bulkString("last-entry"), optionalEntryReply(s.Last()),
+		)...)
+	}
+
+	result = append(result, bulkString("entries"), streamEntriesReply(s.Range(stream.MinID, stream.MaxID, count, false)))
+	groups := make([]proto.Reply, 0)
+	for _, group := range s.Groups() {
+		pending := make([]proto.Reply, 0)
+		for _, p := range group.PendingRange(stream.MinID, stream.MaxID, count) {
+			pending = append(pending, proto.NewMixReply(streamIDReply(p.ID), bulkString(p.Consumer.Name),
+				proto.NewIntegerReply(p.DeliveryTime), proto.NewIntegerReply(int64(p.DeliveryCount))))
+		}
+		consumers := make([]proto.Reply, 0)
+		for _, consumer := range group.Consumers() {
+			consumerPending := make([]proto.Reply, 0)
+			for _, p := range consumer.PendingFrom(stream.MinID, count) {
+				consumerPending = append(consumerPending, proto.NewMixReply(streamIDReply(p.ID),
+					proto.NewIntegerReply(p.DeliveryTime), proto.NewIntegerReply(int64(p.DeliveryCount))))
+			}
+			consumers = append(consumers, proto.NewMixReply(
+				bulkString("name"), bulkString(consumer.Name),
+				bulkString("seen-time"), proto.NewIntegerReply(consumer.SeenTime),
+				bulkString("active-time"), proto.NewIntegerReply(consumer.ActiveTime),
+				bulkString("pel-count"), proto.NewIntegerReply(int64(consumer.PendingLen())),
+				bulkString("pending"), proto.NewMixReply(consumerPending...),
+			))
+		}
+		lag, ok := groupLag(s, group)
+		groups = append(groups, proto.NewMixReply(
+			bulkString("name"), bulkString(group.Name),
+			bulkString("last-delivered-id"), streamIDReply(group.LastID),
+			bulkString("entries-read"), optionalIntegerReply(group.EntriesRead, group.EntriesRead >= 0),
+			bulkString("lag"), optionalIntegerReply(lag, ok),
+			bulkString("pel-count"), proto.NewIntegerReply(int64(group.PendingLen())),
+			bulkString("pending"), proto.NewMixReply(pending...),
+			bulkString("consumers"), proto.NewMixReply(consumers...),
+		))
+	}
+	return proto.NewMixReply(append(result, bulkString("groups"), proto.NewMixReply(groups...))...)
+}
+
+// XINFO STREAM key [FULL [COUNT count]]
+// XINFO GROUPS key
+// XINFO CONSUMERS key group
+func cmdXInfo(db *DB, args [][]byte) proto.Reply {
+	subCommand := strings.ToUpper(string(args[0]))
+	argNum := map[string]int{"STREAM": 2, "GROUPS": 2, "CONSUMERS": 3}
+	num, ok := argNum[subCommand]
+	if !ok {
+		return proto.NewGenericErrReply("unknown subcommand '" + string(args[0]) + "'")
+	}
+	if len(args) < num || (subCommand != "STREAM" && len(args) != num) {
+		return proto.NewArgNumErrReply("xinfo|" + strings.ToLower(subCommand))
+	}
+	key := string(args[1])
+	s, reply := db.getStreamObject(key)
+	if reply != nil {
+		return reply
+	}
+	if s == nil {
+		return proto.NewGenericErrReply("no such key")
+	}
+
+	switch subCommand {
+	case "STREAM":
+		full := false
+		count := 10
+		rest := args[2:]
+		if len(rest) > 0 {
+			if strings.ToUpper(string(rest[0])) != "FULL" {
+				return proto.NewSyntaxErrReply()
+			}
+			full = true
+			rest = rest[1:]
+		}
+		if len(rest) > 0 {
+			if len(rest) != 2 || strings.ToUpper(string(rest[0])) != "COUNT" {
+				return proto.NewSyntaxErrReply()
+			}
+			c, err := strconv.ParseInt(string(rest[1]), 10, 64)
+			if err != nil {
+				return proto.NewGenericErrReply("value is not an integer or out of range")
+			}
+			// 0 表示返回全部
+			count = int(max(c, 0))
+		}
+		return streamInfoReply(s, full, count)
+	case "GROUPS":
+		result := make([]proto.Reply, 0)
+		for _, group := range s.Groups() {
+			lag, ok := groupLag(s, group)
+			result = append(result, proto.NewMixReply(
+				bulkString("name"), bulkString(group.Name),
+				bulkString("consumers"), proto.NewIntegerReply(int64(len(group.Consumers()))),
+				bulkString("pending"), proto.NewIntegerReply(int64(group.PendingLen())),
+				bulkString("last-delivered-id"), streamIDReply(group.LastID),
+				bulkString("entries-read"), optionalIntegerReply(group.EntriesRead, group.EntriesRead >= 0),
+				bulkString("lag"), optionalIntegerReply(lag, ok),
+			))
+		}
+		return proto.NewMixReply(result...)
+	default:
+		groupName := string(args[2])
+		group := s.Group(groupName)
+		if group == nil {
+			return noGroupReply(key, groupName)
+		}
+		now := nowMs()
+		result := make([]proto.Reply, 0)
+		for _, consumer := range group.Consumers() {
+			inactive := int64(-1)
+			if consumer.ActiveTime >= 0 {
+				inactive = now - consumer.ActiveTime
+			}
+			result = append(result, proto.NewMixReply(
+				bulkString("name"), bulkString(consumer.Name),
+				bulkString("pending"), proto.NewIntegerReply(int64(consumer.PendingLen())),
+				bulkString("idle"), proto.NewIntegerReply(now-consumer.SeenTime),
+				bulkString("inactive"), proto.NewIntegerReply(inactive),
+			))
+		}
+		return proto.NewMixReply(result...)
+	}
+}
+
+func init() {
+	registerCommand("XAdd", cmdXAdd, writeFirstKey, -5)
+	registerCommand("XLen", cmdXLen, readFirstKey, 2)
+	registerCommand("XRange", cmdXRange, readFirstKey, -4)
+	registerCommand("XRevRange", cmdXRevRange, readFirstKey, -4)
+	registerCommand("XDel", cmdXDel, writeFirstKey, -3)
+	registerCommand("XTrim", cmdXTrim, writeFirstKey, -4)
+	registerCommand("XRead", cmdXRead, xReadKeys, -4)
+	registerCommand("XReadGroup", cmdXReadGroup, xReadGroupKeys, -7)
+	registerCommand("XAck", cmdXAck, writeFirstKey, -4)
+	registerCommand("XPending", cmdXPending, readFirstKey, -3)
+	registerCommand("XClaim", cmdXClaim, writeFirstKey, -6)
+	registerCommand("XAutoClaim", cmdXAutoClaim, writeFirstKey, -6)
+	registerCommand("XGroup", cmdXGroup, writeSubCommandKey, -2)
+	registerCommand("XInfo", cmdXInfo, readSubCommandKey, -2)
+}
@@ -0,0 +1,260 @@
+package engine
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gedis/gedis/conn"
+)
+
+func TestXAutoClaim(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	for i := 1; i <= 12; i++ {
+		testExec(e, c, "XADD s "+strconv.Itoa(i)+"-0 f v"+strconv.Itoa(i))
+	}
+	expectReply(t, e, c, "XGROUP CREATE s g 0", "+ok")
+	testExec(e, c, "XREADGROUP GROUP g alice STREAMS s >")
+	expectReply(t, e, c, "XAUTOCLAIM s g bob 0 0 COUNT 3 JUSTID", "*3 $3 4-0 *3 $3 1-0 $3 2-0 $3 3-0 *0")
+	expectReply(t, e, c, "XAUTOCLAIM s g bob 0 4-0 COUNT 2", "*3 $3 6-0 *2 *2 $3 4-0 *2 $1 f $2 v4 *2 $3 5-0 *2 $1 f $2 v5 *0")
+	expectReply(t, e, c, "XAUTOCLAIM s g bob 0 11-0 COUNT 5 JUSTID", "*3 $3 0-0 *2 $4 11-0 $4 12-0 *0")
+	expectReply(t, e, c, "XAUTOCLAIM s g bob 3600000 0", "*3 $3 0-0 *0 *0")
+
+	// 每次最多尝试COUNT*10条，已删除的消息同样计入
+	for i := 1; i <= 10; i++ {
+		testExec(e, c, "XDEL s "+strconv.Itoa(i)+"-0")
+	}
+	expectReply(t, e, c, "XAUTOCLAIM s g carol 0 0 COUNT 1 JUSTID",
+		"*3 $4 11-0 *0 *10 $3 1-0 $3 2-0 $3 3-0 $3 4-0 $3 5-0 $3 6-0 $3 7-0 $3 8-0 $3 9-0 $4 10-0")
+	expectReply(t, e, c, "XAUTOCLAIM s g carol 0 11-0 COUNT 1 JUSTID", "*3 $4 12-0 *1 $4 11-0 *0")
+	expectReply(t, e, c, "XPENDING s g", "*4 :2 $4 11-0 $4 12-0 *2 *2 $3 bob $1 1 *2 $5 carol $1 1")
+
+	expectReply(t, e, c, "XAUTOCLAIM s g bob x 0", "-ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	expectReply(t, e, c, "XAUTOCLAIM s g bob 0 0 COUNT 0", "-ERR COUNT must be > 0")
+	expectReply(t, e, c, "XAUTOCLAIM s g bob 0 0 FOO", "-ERR syntax error")
+	expectReply(t, e, c, "XAUTOCLAIM s none bob 0 0", "-NOGROUP No such consumer group 'none' for key name 's'")
+}
+
+// 空闲时间与执行的时刻有关，比较前替换掉
+// 与Redis的aof一样，消费者的活跃时间不会被保存，重启之后同样替换掉
+var streamIdlePattern = regexp.MustCompile(`(\$4 idle :|\$8 inactive :|\$9 seen-time :|\$11 active-time :|\*4 \$\d+ \S+ \$\d+ \S+ :|\*3 \$\d+ \S+ :)-?\d+`)
+
+func expectStreamReply(t *testing.T, e *Engine, c *gedisconn.VirtualConn, line string, want string) {
+	t.Helper()
+	if actual := streamIdlePattern.ReplaceAllString(testExec(e, c, line), "${1}?"); actual != want {
+		t.Errorf("%s: expected %q, actual %q", line, want, actual)
+	}
+}
+
+func TestXReadGroup(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "XADD s 1-0 a 1", "$3 1-0")
+	expectReply(t, e, c, "XADD s 2-0 b 2", "$3 2-0")
+	expectReply(t, e, c, "XADD s 3-0 c 3", "$3 3-0")
+	expectReply(t, e, c, "XGROUP CREATE s g 0", "+ok")
+	expectReply(t, e, c, "XREADGROUP GROUP g alice COUNT 2 STREAMS s >",
+		"*1 *2 $1 s *2 *2 $3 1-0 *2 $1 a $1 1 *2 $3 2-0 *2 $1 b $1 2")
+	expectReply(t, e, c, "XREADGROUP GROUP g bob STREAMS s >", "*1 *2 $1 s *1 *2 $3 3-0 *2 $1 c $1 3")
+	expectReply(t, e, c, "XREADGROUP GROUP g bob STREAMS s >", "*-1")
+	// 指定ID时读取自己待确认列表中的消息，投递次数增加
+	expectReply(t, e, c, "XREADGROUP GROUP g alice STREAMS s 1-0", "*1 *2 $1 s *1 *2 $3 2-0 *2 $1 b $1 2")
+	expectReply(t, e, c, "XREADGROUP GROUP g carol STREAMS s 0", "*1 *2 $1 s *0")
+	expectStreamReply(t, e, c, "XPENDING s g", "*4 :3 $3 1-0 $3 3-0 *2 *2 $5 alice $1 2 *2 $3 bob $1 1")
+	expectStreamReply(t, e, c, "XPENDING s g - + 10",
+		"*3 *4 $3 1-0 $5 alice :? :1 *4 $3 2-0 $5 alice :? :2 *4 $3 3-0 $3 bob :? :1")
+	expectStreamReply(t, e, c, "XPENDING s g - + 10 bob", "*1 *4 $3 3-0 $3 bob :? :1")
+	expectStreamReply(t, e, c, "XPENDING s g IDLE 3600000 - + 10", "*0")
+	expectReply(t, e, c, "XINFO GROUPS s",
+		"*1 *12 $4 name $1 g $9 consumers :3 $7 pending :3 $17 last-delivered-id $3 3-0 $12 entries-read :3 $3 lag :0")
+
+	// NOACK不加入待确认列表
+	expectReply(t, e, c, "XADD s 4-0 d 4", "$3 4-0")
+	expectReply(t, e, c, "XREADGROUP GROUP g carol NOACK STREAMS s >", "*1 *2 $1 s *1 *2 $3 4-0 *2 $1 d $1 4")
+	expectStreamReply(t, e, c, "XINFO CONSUMERS s g",
+		"*3 *8 $4 name $5 alice $7 pending :2 $4 idle :? $8 inactive :? "+
+			"*8 $4 name $3 bob $7 pending :1 $4 idle :? $8 inactive :? "+
+			"*8 $4 name $5 carol $7 pending :0 $4 idle :? $8 inactive :?")
+
+	expectReply(t, e, c, "XACK s g 1-0 9-0", ":1")
+	expectReply(t, e, c, "XACK s g 1-0", ":0")
+	expectReply(t, e, c, "XACK s none 1-0", ":0")
+	expectReply(t, e, c, "XACK s g x", "-ERR Invalid stream ID specified as stream command argument")
+	expectStreamReply(t, e, c, "XPENDING s g", "*4 :2 $3 2-0 $3 3-0 *2 *2 $5 alice $1 1 *2 $3 bob $1 1")
+
+	expectReply(t, e, c, "XREADGROUP GROUP none a STREAMS s >",
+		"-NOGROUP No such key 's' or consumer group 'none' in XREADGROUP with GROUP option")
+	expectReply(t, e, c, "XREADGROUP GROUP g a STREAMS s t >", "-ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.")
+	expectReply(t, e, c, "XREAD STREAMS s >", "-ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+	expectReply(t, e, c, "SET str v", "+ok")
+	expectReply(t, e, c, "XREADGROUP GROUP g a STREAMS str >", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestXClaim(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "XADD s 1-0 a 1", "$3 1-0")
+	expectReply(t, e, c, "XADD s 2-0 b 2", "$3 2-0")
+	expectReply(t, e, c, "XADD s 3-0 c 3", "$3 3-0")
+	expectReply(t, e, c, "XGROUP CREATE s g 0", "+ok")
+	testExec(e, c, "XREADGROUP GROUP g alice STREAMS s >")
+
+	expectReply(t, e, c, "XCLAIM s g bob 3600000 1-0", "*0")
+	expectReply(t, e, c, "XCLAIM s g bob 0 1-0", "*1 *2 $3 1-0 *2 $1 a $1 1")
+	// JUSTID不增加投递次数
+	expectReply(t, e, c, "XCLAIM s g bob 0 2-0 JUSTID", "*1 $3 2-0")
+	expectReply(t, e, c, "XCLAIM s g carol 0 3-0 9-0 RETRYCOUNT 5 JUSTID", "*1 $3 3-0")
+	expectStreamReply(t, e, c, "XPENDING s g - + 10",
+		"*3 *4 $3 1-0 $3 bob :? :2 *4 $3 2-0 $3 bob :? :1 *4 $3 3-0 $5 carol :? :5")
+	expectStreamReply(t, e, c, "XPENDING s g", "*4 :3 $3 1-0 $3 3-0 *2 *2 $3 bob $1 2 *2 $5 carol $1 1")
+
+	// FORCE只能认领stream中存在的消息
+	expectReply(t, e, c, "XACK s g 1-0", ":1")
+	expectReply(t, e, c, "XCLAIM s g dave 0 1-0 9-0 FORCE JUSTID", "*1 $3 1-0")
+	expectReply(t, e, c, "XCLAIM s g dave 0 1-0 IDLE 3600000 JUSTID", "*1 $3 1-0")
+	expectStreamReply(t, e, c, "XPENDING s g IDLE 3000000 - + 10", "*1 *4 $3 1-0 $4 dave :? :1")
+	// 被删除的消息从待确认列表中移除
+	expectReply(t, e, c, "XDEL s 2-0", ":1")
+	expectReply(t, e, c, "XCLAIM s g dave 0 2-0", "*0")
+	expectStreamReply(t, e, c, "XPENDING s g", "*4 :2 $3 1-0 $3 3-0 *2 *2 $5 carol $1 1 *2 $4 dave $1 1")
+	// LASTID更新消费者组的读取位置
+	expectReply(t, e, c, "XCLAIM s g dave 0 3-0 JUSTID LASTID 5-0", "*1 $3 3-0")
+	expectReply(t, e, c, "XINFO GROUPS s",
+		"*1 *12 $4 name $1 g $9 consumers :4 $7 pending :2 $17 last-delivered-id $3 5-0 $12 entries-read :3 $3 lag :0")
+
+	expectReply(t, e, c, "XCLAIM s g dave x 1-0", "-ERR Invalid min-idle-time argument for XCLAIM")
+	expectReply(t, e, c, "XCLAIM s g dave 0 x", "-ERR Invalid stream ID specified as stream command argument")
+	expectReply(t, e, c, "XCLAIM s none dave 0 1-0", "-NOGROUP No such consumer group 'none' for key name 's'")
+}
+
+func TestXGroup(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "XGROUP CREATE s g $",
+		"-ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	expectReply(t, e, c, "XGROUP CREATE s g $ MKSTREAM", "+ok")
+	expectReply(t, e, c, "XGROUP CREATE s g $", "-BUSYGROUP Consumer Group name already exists")
+	expectReply(t, e, c, "XLEN s", ":0")
+	expectReply(t, e, c, "XADD s 1-0 a 1", "$3 1-0")
+	expectReply(t, e, c, "XADD s 2-0 b 2", "$3 2-0")
+	expectReply(t, e, c, "XGROUP CREATE s g2 0", "+ok")
+	expectReply(t, e, c, "XGROUP CREATE s g3 1-0 ENTRIESREAD 1", "+ok")
+	expectReply(t, e, c, "XINFO GROUPS s",
+		"*3 *12 $4 name $1 g $9 consumers :0 $7 pending :0 $17 last-delivered-id $3 0-0 $12 entries-read :0 $3 lag :2 "+
+			"*12 $4 name $2 g2 $9 consumers :0 $7 pending :0 $17 last-delivered-id $3 0-0 $12 entries-read :0 $3 lag :2 "+
+			"*12 $4 name $2 g3 $9 consumers :0 $7 pending :0 $17 last-delivered-id $3 1-0 $12 entries-read :1 $3 lag :1")
+
+	expectReply(t, e, c, "XGROUP CREATECONSUMER s g alice", ":1")
+	expectReply(t, e, c, "XGROUP CREATECONSUMER s g alice", ":0")
+	testExec(e, c, "XREADGROUP GROUP g bob STREAMS s >")
+	expectReply(t, e, c, "XGROUP DELCONSUMER s g bob", ":2")
+	expectReply(t, e, c, "XGROUP DELCONSUMER s g nobody", ":0")
+	expectStreamReply(t, e, c, "XPENDING s g", "*4 :0 $-1 $-1 *-1")
+	expectReply(t, e, c, "XGROUP SETID s g 1-0", "+ok")
+	expectReply(t, e, c, "XREADGROUP GROUP g alice STREAMS s >", "*1 *2 $1 s *1 *2 $3 2-0 *2 $1 b $1 2")
+	expectReply(t, e, c, "XGROUP SETID s g $ ENTRIESREAD 2", "+ok")
+	expectReply(t, e, c, "XINFO GROUPS s",
+		"*3 *12 $4 name $1 g $9 consumers :1 $7 pending :1 $17 last-delivered-id $3 2-0 $12 entries-read :2 $3 lag :0 "+
+			"*12 $4 name $2 g2 $9 consumers :0 $7 pending :0 $17 last-delivered-id $3 0-0 $12 entries-read :0 $3 lag :2 "+
+			"*12 $4 name $2 g3 $9 consumers :0 $7 pending :0 $17 last-delivered-id $3 1-0 $12 entries-read :1 $3 lag :1")
+	expectReply(t, e, c, "XGROUP DESTROY s g2", ":1")
+	expectReply(t, e, c, "XGROUP DESTROY s g2", ":0")
+
+	expectReply(t, e, c, "XGROUP SETID s none 0", "-NOGROUP No such consumer group 'none' for key name 's'")
+	expectReply(t, e, c, "XGROUP CREATECONSUMER s none a", "-NOGROUP No such consumer group 'none' for key name 's'")
+	expectReply(t, e, c, "XGROUP CREATE s g4 x", "-ERR Invalid stream ID specified as stream command argument")
+	expectReply(t, e, c, "XGROUP HELP", "-ERR unknown subcommand 'HELP'")
+	expectReply(t, e, c, "SET str v", "+ok")
+	expectReply(t, e, c, "XGROUP CREATE str g $", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestXReadBlock(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "XADD s 1-0 a 1", "$3 1-0")
+	expectReply(t, e, c, "XREAD COUNT 1 STREAMS s 0", "*1 *2 $1 s *1 *2 $3 1-0 *2 $1 a $1 1")
+	expectReply(t, e, c, "XREAD STREAMS s $", "*-1")
+
+	// $ 表示阻塞开始时的最后一条消息
+	ch := execBlocking(e, 0, "XREAD BLOCK 0 STREAMS s $")
+	expectReply(t, e, c, "XADD s 2-0 b 2", "$3 2-0")
+	expectBlockingReply(t, ch, "*1 *2 $1 s *1 *2 $3 2-0 *2 $1 b $1 2")
+	// 等待多个key时返回有新消息的key
+	ch = execBlocking(e, 0, "XREAD BLOCK 0 STREAMS s2 s $ $")
+	expectReply(t, e, c, "XADD s2 1-0 x y", "$3 1-0")
+	expectBlockingReply(t, ch, "*1 *2 $2 s2 *1 *2 $3 1-0 *2 $1 x $1 y")
+
+	start := time.Now()
+	expectReply(t, e, c, "XREAD BLOCK 100 STREAMS s $", "*-1")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("XREAD returns after %v before the timeout", elapsed)
+	}
+
+	expectReply(t, e, c, "XGROUP CREATE s g $", "+ok")
+	ch = execBlocking(e, 0, "XREADGROUP GROUP g alice BLOCK 0 STREAMS s >")
+	expectReply(t, e, c, "XADD s 3-0 c 3", "$3 3-0")
+	expectBlockingReply(t, ch, "*1 *2 $1 s *1 *2 $3 3-0 *2 $1 c $1 3")
+	expectStreamReply(t, e, c, "XPENDING s g", "*4 :1 $3 3-0 $3 3-0 *1 *2 $5 alice $1 1")
+
+	// 事务中不会阻塞
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "XREAD BLOCK 0 STREAMS s $", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "*1 *-1")
+	expectReply(t, e, c, "XREAD BLOCK -1 STREAMS s $", "-ERR timeout is negative")
+}
+
+// 消费者组、待确认列表以及消费者在重启之后保持不变
+func TestStreamGroupAof(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	for _, line := range []string{
+		"XADD s 1-0 a 1", "XADD s 2-0 b 2", "XADD s 3-0 c 3", "XADD s 4-0 d 4", "XADD s 5-0 e 5",
+		"XGROUP CREATE s g 0",
+		"XGROUP CREATE s g2 2-0",
+		"XGROUP CREATE s g3 $ ENTRIESREAD 5",
+		"XREADGROUP GROUP g alice COUNT 2 STREAMS s >",
+		"XREADGROUP GROUP g bob COUNT 1 STREAMS s >",
+		"XREADGROUP GROUP g alice STREAMS s 0",
+		"XREADGROUP GROUP g carol NOACK COUNT 1 STREAMS s >",
+		"XGROUP CREATECONSUMER s g dave",
+		"XACK s g 1-0",
+		"XCLAIM s g bob 0 2-0 RETRYCOUNT 7",
+		"XREADGROUP GROUP g2 erin STREAMS s >",
+		"XAUTOCLAIM s g2 frank 0 0 COUNT 2",
+		"XGROUP DELCONSUMER s g2 erin",
+		"XDEL s 5-0",
+		"XREADGROUP GROUP g3 gina STREAMS s >",
+	} {
+		if reply := testExec(e, c, line); strings.HasPrefix(reply, "-") {
+			t.Fatalf("%s: %s", line, reply)
+		}
+	}
+	checks := []string{
+		"XPENDING s g", "XPENDING s g - + 10", "XPENDING s g2 - + 10", "XPENDING s g3",
+		"XINFO GROUPS s", "XINFO CONSUMERS s g", "XINFO CONSUMERS s g2", "XINFO CONSUMERS s g3",
+		"XINFO STREAM s FULL",
+	}
+	expected := make([]string, len(checks))
+	for i, check := range checks {
+		expected[i] = streamIdlePattern.ReplaceAllString(testExec(e, c, check), "${1}?")
+	}
+	expectStreamReply(t, e, c, "XPENDING s g - + 10", "*2 *4 $3 2-0 $3 bob :? :7 *4 $3 3-0 $3 bob :? :1")
+	// 5-0被删除，g无法确定落后的消息数
+	expectReply(t, e, c, "XINFO GROUPS s",
+		"*3 *12 $4 name $1 g $9 consumers :4 $7 pending :2 $17 last-delivered-id $3 4-0 $12 entries-read :4 $3 lag $-1 "+
+			"*12 $4 name $2 g2 $9 consumers :1 $7 pending :2 $17 last-delivered-id $3 5-0 $12 entries-read :5 $3 lag :0 "+
+			"*12 $4 name $2 g3 $9 consumers :1 $7 pending :0 $17 last-delivered-id $3 5-0 $12 entries-read :5 $3 lag :0")
+
+	e = reloadTestEngine(t, e)
+	for i, check := range checks {
+		expectStreamReply(t, e, c, check, expected[i])
+	}
+	// 重启后继续从原来的位置读取
+	expectReply(t, e, c, "XADD s 6-0 f 6", "$3 6-0")
+	expectReply(t, e, c, "XREADGROUP GROUP g alice STREAMS s >", "*1 *2 $1 s *1 *2 $3 6-0 *2 $1 f $1 6")
+	expectReply(t, e, c, "XREADGROUP GROUP g2 frank STREAMS s 0",
+		"*1 *2 $1 s *2 *2 $3 3-0 *2 $1 c $1 3 *2 $3 4-0 *2 $1 d $1 4")
+}
@@ -2,35 +2,55 @@ package engine
 
 import (
 	"gedis/aof"
+	"gedis/datastruct/bitmap"
 	"gedis/engine/entity"
 	"gedis/gedis/proto"
+	"math"
 	"strconv"
 	"strings"
 	"time"
 )
 
-const (
-	noLimitedTTL int64 = 0
-)
+// 获取字符串，返回的切片在释放key的锁之后仍然可以使用
+func (d *DB) getStringObject(key string) ([]byte, proto.Reply) {
+	dataEntity, exist := d.GetEntity(key)
+	if !exist {
+		return nil, nil
+	}
+	switch obj := dataEntity.Object.(type) {
+	case []byte:
+		return obj, nil
+	case bitmap.BitMap:
+		// 位图会被SETBIT等命令原地修改，返回副本
+		return append([]byte(nil), obj...), nil
+	}
+	return nil, proto.NewWrongTypeErrReply()
+}
 
-func (d *DB) getStringObject(key string) ([]byte, proto.Reply, error) {
-	entity, exist := d.GetEntity(key)
+// 获取字符串但不复制，返回的切片只能在持有key的锁时读取
+func (d *DB) getStringView(key string) ([]byte, proto.Reply) {
+	dataEntity, exist := d.GetEntity(key)
 	if !exist {
-		return nil, proto.NewNullBulkReply(), nil
+		return nil, nil
 	}
-	bytes, ok := entity.Object.([]byte)
-	if !ok {
-		return nil, proto.NewWrongTypeErrReply(), nil
+	switch obj := dataEntity.Object.(type) {
+	case []byte:
+		return obj, nil
+	case bitmap.BitMap:
+		return obj, nil
 	}
-	return bytes, proto.NewBulkReply(bytes), nil
+	return nil, proto.NewWrongTypeErrReply()
 }
 
 func cmdGet(db *DB, args [][]byte) proto.Reply {
 	key := string(args[0])
-	bytes, reply, err := db.getStringObject(key)
-	if err != nil {
+	bytes, reply := db.getStringObject(key)
+	if reply != nil {
 		return reply
 	}
+	if bytes == nil {
+		return proto.NewNullBulkReply()
+	}
 	return proto.NewBulkReply(bytes)
 }
 
@@ -38,80 +58,666 @@ func cmdMGet(db *DB, args [][]byte) proto.Reply {
 	var res = make([][]byte, 0)
 	for _, kBytes := range args {
 		key := string(kBytes)
-		bytes, _, err := db.getStringObject(key)
-		if err != nil {
-			res = append(res, []byte(""))
-			continue
-		}
+		// 不存在或者不是字符串时返回nil
+		bytes, _ := db.getStringObject(key)
 		res = append(res, bytes)
 	}
 	return proto.NewMultiBulkReply(res)
 }
 
+const (
+	setPolicyDefault = iota
+	setPolicyNX
+	setPolicyXX
+)
+
+// SET命令的选项
+type setOptions struct {
+	policy  int
+	get     bool
+	keepTTL bool
+	// 零值表示不设置过期时间
+	expireAt time.Time
+}
+
+// 解析 [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+func parseSetOptions(args [][]byte) (*setOptions, proto.Reply) {
+	opts := &setOptions{}
+	hasExpire := false
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch arg {
+		case "NX", "XX":
+			if opts.policy != setPolicyDefault {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			if arg == "NX" {
+				opts.policy = setPolicyNX
+			} else {
+				opts.policy = setPolicyXX
+			}
+		case "GET":
+			opts.get = true
+		case "KEEPTTL":
+			if hasExpire || opts.keepTTL {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			opts.keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			// 过期参数只能出现一个
+			if hasExpire || opts.keepTTL || i+1 >= len(args) {
+				return nil, proto.NewSyntaxErrReply()
+			}
+			ttlArg, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, proto.NewGenericErrReply("value is not an integer or out of range")
+			}
+			if ttlArg <= 0 {
+				return nil, proto.NewGenericErrReply("invalid expire time in 'set' command")
+			}
+			expireAt, ok := parseExpireTime(arg, ttlArg)
+			if !ok {
+				return nil, proto.NewGenericErrReply("invalid expire time in 'set' command")
+			}
+			opts.expireAt = expireAt
+			hasExpire = true
+			// 跳过下一个参数
+			i++
+		default:
+			return nil, proto.NewSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// 把 EX/PX/EXAT/PXAT 参数转换为绝对过期时间
+func parseExpireTime(unit string, ttl int64) (time.Time, bool) {
+	const maxMilliseconds = math.MaxInt64 / int64(time.Millisecond)
+	switch unit {
+	case "EX":
+		if ttl > maxMilliseconds/1000 {
+			return time.Time{}, false
+		}
+		return time.Now().Add(time.Duration(ttl) * time.Second), true
+	case "PX":
+		if ttl > maxMilliseconds {
+			return time.Time{}, false
+		}
+		return time.Now().Add(time.Duration(ttl) * time.Millisecond), true
+	case "EXAT":
+		if ttl > math.MaxInt64/1000 {
+			return time.Time{}, false
+		}
+		return time.Unix(ttl, 0), true
+	case "PXAT":
+		return time.UnixMilli(ttl), true
+	}
+	return time.Time{}, false
+}
+
+// 写入SET命令，过期时间统一记录为毫秒级的绝对时间，保证回放结果一致
+func (d *DB) writeSetAof(key []byte, value []byte, expireAt time.Time, keepTTL bool) {
+	if !expireAt.IsZero() {
+		d.writeAof(aof.SetCmd(key, value, []byte("PXAT"), []byte(strconv.FormatInt(expireAt.UnixMilli(), 10))))
+	} else if keepTTL {
+		d.writeAof(aof.SetCmd(key, value, []byte("KEEPTTL")))
+	} else {
+		d.writeAof(aof.SetCmd(key, value))
+	}
+}
+
+// SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
 func cmdSet(db *DB, args [][]byte) proto.Reply {
 	key := string(args[0])
 	value := args[1]
 
-	var ttl = noLimitedTTL
+	opts, reply := parseSetOptions(args[2:])
+	if reply != nil {
+		return reply
+	}
 
-	if len(args) > 2 {
-		for i := 2; i < len(args); i++ {
-			arg := strings.ToUpper(string(args[i]))
-			// 支持过期设置
-			if arg == "EX" {
-				// 多个Ex
-				if ttl != noLimitedTTL {
-					return proto.NewSyntaxErrReply()
-				}
-				if i+1 > len(args) {
-					return proto.NewSyntaxErrReply()
-				}
-				ttlArg, err := strconv.ParseInt(string(args[i+1]), 10, 64)
-				if err != nil {
-					return proto.NewSyntaxErrReply()
-				}
-				if ttlArg < 0 {
-					return proto.NewGenericErrReply("过期时间不能是负数")
-				}
-				// 转换成毫秒
-				ttl = ttlArg
-				// 跳过下一个参数
-				i++
-			}
+	var oldValue []byte
+	var exist bool
+	if opts.get {
+		oldValue, reply = db.getStringObject(key)
+		if reply != nil {
+			return reply
 		}
+		exist = oldValue != nil
+	} else {
+		_, exist = db.GetEntity(key)
 	}
 
-	dataEntity := entity.DataEntity{Object: value}
-	result := db.PutEntity(key, &dataEntity)
-	if result > 0 {
-		if ttl != noLimitedTTL {
-			expireTime := time.Now().Add(time.Duration(ttl) * time.Second)
-			db.ExpireAt(key, expireTime)
-			db.writeAof(aof.SetCmd(aof.Command{args[0], args[1]}...))
-			db.writeAof(aof.ExpireAtCmd(string(args[0]), ttl))
-		} else {
-			db.Persist(key)
-			db.writeAof(aof.SetCmd(args...))
+	if (opts.policy == setPolicyNX && exist) || (opts.policy == setPolicyXX && !exist) {
+		if opts.get {
+			return proto.NewBulkReply(oldValue)
 		}
-		return proto.NewOkReply()
+		return proto.NewNullBulkReply()
 	}
-	return proto.NewNullBulkReply()
+
+	dataEntity := entity.DataEntity{Object: value}
+	db.PutEntity(key, &dataEntity)
+	if !opts.expireAt.IsZero() {
+		db.ExpireAt(key, opts.expireAt)
+	} else if !opts.keepTTL {
+		db.Persist(key)
+	}
+	db.writeSetAof(args[0], value, opts.expireAt, opts.keepTTL)
+
+	if opts.get {
+		return proto.NewBulkReply(oldValue)
+	}
+	return proto.NewOkReply()
 }
 
 func cmdMSet(db *DB, args [][]byte) proto.Reply {
+	if len(args)%2 != 0 {
+		return proto.NewArgNumErrReply("mset")
+	}
 	for i := 0; i < len(args); i = i + 2 {
 		key := string(args[i])
 		value := args[i+1]
 
 		dataEntity := entity.DataEntity{Object: value}
 		db.PutEntity(key, &dataEntity)
+		db.Persist(key)
 	}
+	db.writeAof(aof.MSetCmd(args...))
 	return proto.NewOkReply()
 }
 
+// MSETNX key value [key value ...]
+func cmdMSetNX(db *DB, args [][]byte) proto.Reply {
+	if len(args)%2 != 0 {
+		return proto.NewArgNumErrReply("msetnx")
+	}
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+
+	// 任意一个key存在就全部不设置
+	for _, key := range keys {
+		if _, exist := db.GetEntity(key); exist {
+			return proto.NewIntegerReply(0)
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		db.PutEntity(string(args[i]), &entity.DataEntity{Object: args[i+1]})
+	}
+	db.writeAof(aof.MSetCmd(args...))
+	return proto.NewIntegerReply(1)
+}
+
+// 对整数值加上delta，不存在的key视为0
+func incrBy(db *DB, key string, delta int64) proto.Reply {
+	bytes, reply := db.getStringObject(key)
+	if reply != nil {
+		return reply
+	}
+	var current int64
+	if bytes != nil {
+		var err error
+		current, err = strconv.ParseInt(string(bytes), 10, 64)
+		if err != nil {
+			return proto.NewGenericErrReply("value is not an integer or out of range")
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return proto.NewGenericErrReply("increment or decrement would overflow")
+	}
+	current += delta
+	// 只替换值，保留过期时间
+	db.PutEntity(key, &entity.DataEntity{Object: []byte(strconv.FormatInt(current, 10))})
+	return proto.NewIntegerReply(current)
+}
+
+// INCR key
+func cmdIncr(db *DB, args [][]byte) proto.Reply {
+	reply := incrBy(db, string(args[0]), 1)
+	if !proto.IsErrReply(reply) {
+		db.writeAof(aof.IncrCmd(args...))
+	}
+	return reply
+}
+
+// DECR key
+func cmdDecr(db *DB, args [][]byte) proto.Reply {
+	reply := incrBy(db, string(args[0]), -1)
+	if !proto.IsErrReply(reply) {
+		db.writeAof(aof.DecrCmd(args...))
+	}
+	return reply
+}
+
+// INCRBY key increment
+func cmdIncrBy(db *DB, args [][]byte) proto.Reply {
+	delta, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	reply := incrBy(db, string(args[0]), delta)
+	if !proto.IsErrReply(reply) {
+		db.writeAof(aof.IncrByCmd(args...))
+	}
+	return reply
+}
+
+// DECRBY key decrement
+func cmdDecrBy(db *DB, args [][]byte) proto.Reply {
+	delta, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	if delta == math.MinInt64 {
+		return proto.NewGenericErrReply("decrement would overflow")
+	}
+	reply := incrBy(db, string(args[0]), -delta)
+	if !proto.IsErrReply(reply) {
+		db.writeAof(aof.DecrByCmd(args...))
+	}
+	return reply
+}
+
+// INCRBYFLOAT key increment
+func cmdIncrByFloat(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	delta, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return proto.NewGenericErrReply("value is not a valid float")
+	}
+	bytes, reply := db.getStringObject(key)
+	if reply != nil {
+		return reply
+	}
+	var current float64
+	if bytes != nil {
+		current, err = strconv.ParseFloat(string(bytes), 64)
+		if err != nil {
+			return proto.NewGenericErrReply("value is not a valid float")
+		}
+	}
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return proto.NewGenericErrReply("increment would produce NaN or Infinity")
+	}
+	value := []byte(strconv.FormatFloat(current, 'f', -1, 64))
+	db.PutEntity(key, &entity.DataEntity{Object: value})
+	// 记录计算结果，回放时不受浮点格式影响
+	db.writeAof(aof.SetCmd(args[0], value, []byte("KEEPTTL")))
+	return proto.NewBulkReply(value)
+}
+
+// SETNX key value
+func cmdSetNX(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	if _, exist := db.GetEntity(key); exist {
+		return proto.NewIntegerReply(0)
+	}
+	db.PutEntity(key, &entity.DataEntity{Object: args[1]})
+	db.writeSetAof(args[0], args[1], time.Time{}, false)
+	return proto.NewIntegerReply(1)
+}
+
+func execSetWithTTL(db *DB, args [][]byte, unit string, cmdName string) proto.Reply {
+	key := string(args[0])
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	if ttl <= 0 {
+		return proto.NewGenericErrReply("invalid expire time in '" + cmdName + "' command")
+	}
+	expireAt, ok := parseExpireTime(unit, ttl)
+	if !ok {
+		return proto.NewGenericErrReply("invalid expire time in '" + cmdName + "' command")
+	}
+	db.PutEntity(key, &entity.DataEntity{Object: args[2]})
+	db.ExpireAt(key, expireAt)
+	db.writeSetAof(args[0], args[2], expireAt, false)
+	return proto.NewOkReply()
+}
+
+// SETEX key seconds value
+func cmdSetEX(db *DB, args [][]byte) proto.Reply {
+	return execSetWithTTL(db, args, "EX", "setex")
+}
+
+// PSETEX key milliseconds value
+func cmdPSetEX(db *DB, args [][]byte) proto.Reply {
+	return execSetWithTTL(db, args, "PX", "psetex")
+}
+
+// GETSET key value
+func cmdGetSet(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	oldValue, reply := db.getStringObject(key)
+	if reply != nil {
+		return reply
+	}
+	db.PutEntity(key, &entity.DataEntity{Object: args[1]})
+	db.Persist(key)
+	db.writeSetAof(args[0], args[1], time.Time{}, false)
+	return proto.NewBulkReply(oldValue)
+}
+
+// GETDEL key
+func cmdGetDel(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	value, reply := db.getStringObject(key)
+	if reply != nil {
+		return reply
+	}
+	if value == nil {
+		return proto.NewNullBulkReply()
+	}
+	db.Remove(key)
+	db.writeAof(aof.GetDelCmd(args...))
+	return proto.NewBulkReply(value)
+}
+
+// GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func cmdGetEX(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	var expireAt time.Time
+	persist := false
+	for i := 1; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch arg {
+		case "PERSIST":
+			if persist || !expireAt.IsZero() {
+				return proto.NewSyntaxErrReply()
+			}
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if persist || !expireAt.IsZero() || i+1 >= len(args) {
+				return proto.NewSyntaxErrReply()
+			}
+			ttl, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return proto.NewGenericErrReply("value is not an integer or out of range")
+			}
+			var ok bool
+			expireAt, ok = parseExpireTime(arg, ttl)
+			if ttl <= 0 || !ok {
+				return proto.NewGenericErrReply("invalid expire time in 'getex' command")
+			}
+			i++
+		default:
+			return proto.NewSyntaxErrReply()
+		}
+	}
+
+	value, reply := db.getStringObject(key)
+	if reply != nil {
+		return reply
+	}
+	if value == nil {
+		return proto.NewNullBulkReply()
+	}
+	if !expireAt.IsZero() {
+		db.ExpireAt(key, expireAt)
+		db.writeSetAof(args[0], value, expireAt, false)
+	} else if persist {
+		db.Persist(key)
+		db.writeSetAof(args[0], value, time.Time{}, false)
+	}
+	return proto.NewBulkReply(value)
+}
+
+// APPEND key value
+func cmdAppend(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	value, reply := db.getStringObject(key)
+	if reply != nil {
+		return reply
+	}
+	// 重新分配，避免修改到其他地方引用的切片
+	newValue := make([]byte, len(value)+len(args[1]))
+	copy(newValue, value)
+	copy(newValue[len(value):], args[1])
+	db.PutEntity(key, &entity.DataEntity{Object: newValue})
+	db.writeAof(aof.AppendCmd(args...))
+	return proto.NewIntegerReply(int64(len(newValue)))
+}
+
+// STRLEN key
+func cmdStrLen(db *DB, args [][]byte) proto.Reply {
+	value, reply := db.getStringView(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	return proto.NewIntegerReply(int64(len(value)))
+}
+
+// GETRANGE key start end
+func cmdGetRange(db *DB, args [][]byte) proto.Reply {
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	end, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	value, reply := db.getStringView(string(args[0]))
+	if reply != nil {
+		return reply
+	}
+	size := int64(len(value))
+	if start < 0 && end < 0 && start > end {
+		return proto.NewBulkReply([]byte{})
+	}
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if size == 0 || start > end {
+		return proto.NewBulkReply([]byte{})
+	}
+	return proto.NewBulkReply(append([]byte(nil), value[start:end+1]...))
+}
+
+// 字符串的最大长度 512MB
+const maxStringSize = 512 * 1024 * 1024
+
+// SETRANGE key offset value
+func cmdSetRange(db *DB, args [][]byte) proto.Reply {
+	key := string(args[0])
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return proto.NewGenericErrReply("value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return proto.NewGenericErrReply("offset is out of range")
+	}
+	value, reply := db.getStringObject(key)
+	if reply != nil {
+		return reply
+	}
+	patch := args[2]
+	if len(patch) == 0 {
+		return proto.NewIntegerReply(int64(len(value)))
+	}
+	if offset+int64(len(patch)) > maxStringSize {
+		return proto.NewGenericErrReply("string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	size := len(value)
+	if end := int(offset) + len(patch); end > size {
+		size = end
+	}
+	// 不足的部分用0填充
+	newValue := make([]byte, size)
+	copy(newValue, value)
+	copy(newValue[offset:], patch)
+	db.PutEntity(key, &entity.DataEntity{Object: newValue})
+	db.writeAof(aof.SetRangeCmd(args...))
+	return proto.NewIntegerReply(int64(len(newValue)))
+}
+
+// LCS key1 key2 [LEN] [IDX] [MINMATCHLEN min-match-len] [WITHMATCHLEN]
+func cmdLCS(db *DB, args [][]byte) proto.Reply {
+	var getLen, getIdx, withMatchLen bool
+	var minMatchLen int64
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 >= len(args) {
+				return proto.NewSyntaxErrReply()
+			}
+			var err error
+			minMatchLen, err = strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return proto.NewGenericErrReply("value is not an integer or out of range")
+			}
+			if minMatchLen < 0 {
+				minMatchLen = 0
+			}
+			i++
+		default:
+			return proto.NewSyntaxErrReply()
+		}
+	}
+	if getLen && getIdx {
+		return proto.NewGenericErrReply("If you want both the length and indexes, please just use IDX.")
+	}
+
+	a, reply := db.getStringObject(string(args[0]))
+	if reply != nil {
+		return proto.NewGenericErrReply("The specified keys must contain string values")
+	}
+	b, reply := db.getStringObject(string(args[1]))
+	if reply != nil {
+		return proto.NewGenericErrReply("The specified keys must contain string values")
+	}
+
+	// dp[i][j] 表示 a[:i] 和 b[:j] 的最长公共子序列长度
+	alen, blen := len(a), len(b)
+	// dp表的大小与两个字符串长度的乘积成正比，内存不足时Go会直接退出，无法recover，需要提前拒绝
+	cells := uint64(alen+1) * uint64(blen+1)
+	if cells >= math.MaxUint32 || cells*4 > maxStringSize {
+		return proto.NewGenericErrReply("Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	}
+	dp := make([]uint32, cells)
+	lcs := func(i, j int) uint32 {
+		return dp[i*(blen+1)+j]
+	}
+	for i := 1; i <= alen; i++ {
+		for j := 1; j <= blen; j++ {
+			if a[i-1] == b[j-1] {
+				dp[i*(blen+1)+j] = lcs(i-1, j-1) + 1
+			} else if lcs(i-1, j) > lcs(i, j-1) {
+				dp[i*(blen+1)+j] = lcs(i-1, j)
+			} else {
+				dp[i*(blen+1)+j] = lcs(i, j-1)
+			}
+		}
+	}
+	length := lcs(alen, blen)
+	if getLen {
+		return proto.NewIntegerReply(int64(length))
+	}
+
+	// 从后往前回溯，得到公共子序列以及匹配的区间
+	result := make([]byte, length)
+	idx := int(length)
+	matches := make([]proto.Reply, 0)
+	aStart, aEnd, bStart, bEnd := alen, 0, 0, 0
+	i, j := alen, blen
+	for i > 0 && j > 0 {
+		emitRange := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if aStart == alen {
+				aStart, aEnd = i-1, i-1
+				bStart, bEnd = j-1, j-1
+			} else if aStart == i && bStart == j {
+				// 区间连续，向前扩展
+				aStart--
+				bStart--
+			} else {
+				emitRange = true
+			}
+			// 已经匹配到其中一个字符串的开头
+			if aStart == 0 || bStart == 0 {
+				emitRange = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if lcs(i-1, j) > lcs(i, j-1) {
+				i--
+			} else {
+				j--
+			}
+			if aStart != alen {
+				emitRange = true
+			}
+		}
+
+		if emitRange {
+			matchLen := int64(aEnd - aStart + 1)
+			if getIdx && (minMatchLen == 0 || matchLen >= minMatchLen) {
+				match := []proto.Reply{
+					proto.NewMixReply(proto.NewIntegerReply(int64(aStart)), proto.NewIntegerReply(int64(aEnd))),
+					proto.NewMixReply(proto.NewIntegerReply(int64(bStart)), proto.NewIntegerReply(int64(bEnd))),
+				}
+				if withMatchLen {
+					match = append(match, proto.NewIntegerReply(matchLen))
+				}
+				matches = append(matches, proto.NewMixReply(match...))
+			}
+			// 开始寻找下一个区间
+			aStart = alen
+		}
+	}
+
+	if getIdx {
+		return proto.NewMixReply(
+			proto.NewBulkReply([]byte("matches")),
+			proto.NewMixReply(matches...),
+			proto.NewBulkReply([]byte("len")),
+			proto.NewIntegerReply(int64(length)),
+		)
+	}
+	return proto.NewBulkReply(result)
+}
+
 func init() {
-	registerCommand("Get", cmdGet, nil, 2)
-	registerCommand("MGet", cmdMGet, nil, -2)
-	registerCommand("Set", cmdSet, nil, -3)
-	registerCommand("MSet", cmdMSet, nil, -3)
+	registerCommand("Get", cmdGet, readFirstKey, 2)
+	registerCommand("MGet", cmdMGet, readAllKeys, -2)
+	registerCommand("Set", cmdSet, writeFirstKey, -3)
+	registerCommand("MSet", cmdMSet, writeEvenKeys, -3)
+	registerCommand("Incr", cmdIncr, writeFirstKey, 2)
+	registerCommand("Decr", cmdDecr, writeFirstKey, 2)
+	registerCommand("IncrBy", cmdIncrBy, writeFirstKey, 3)
+	registerCommand("DecrBy", cmdDecrBy, writeFirstKey, 3)
+	registerCommand("IncrByFloat", cmdIncrByFloat, writeFirstKey, 3)
+	registerCommand("MSetNX", cmdMSetNX, writeEvenKeys, -3)
+	registerCommand("SetNX", cmdSetNX, writeFirstKey, 3)
+	registerCommand("SetEX", cmdSetEX, writeFirstKey, 4)
+	registerCommand("PSetEX", cmdPSetEX, writeFirstKey, 4)
+	registerCommand("GetSet", cmdGetSet, writeFirstKey, 3)
+	registerCommand("GetDel", cmdGetDel, writeFirstKey, 2)
+	registerCommand("GetEX", cmdGetEX, writeFirstKey, -2)
+	registerCommand("Append", cmdAppend, writeFirstKey, 3)
+	registerCommand("StrLen", cmdStrLen, readFirstKey, 2)
+	registerCommand("GetRange", cmdGetRange, readFirstKey, 4)
+	registerCommand("SetRange", cmdSetRange, writeFirstKey, 4)
+	registerCommand("LCS", cmdLCS, readFirstTwoKeys, -3)
 }
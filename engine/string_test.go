@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"testing"
+
+	"gedis/gedis/conn"
+)
+
+func TestIncrDecr(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "INCR n", ":1")
+	expectReply(t, e, c, "INCRBY n 10", ":11")
+	expectReply(t, e, c, "DECR n", ":10")
+	expectReply(t, e, c, "DECRBY n 15", ":-5")
+	expectReply(t, e, c, "INCRBY n x", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "DECRBY n -9223372036854775808", "-ERR decrement would overflow")
+
+	expectReply(t, e, c, "SET max 9223372036854775807", "+ok")
+	expectReply(t, e, c, "INCR max", "-ERR increment or decrement would overflow")
+	expectReply(t, e, c, "SET min -9223372036854775808", "+ok")
+	expectReply(t, e, c, "DECR min", "-ERR increment or decrement would overflow")
+	expectReply(t, e, c, "SET s abc", "+ok")
+	expectReply(t, e, c, "INCR s", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "RPUSH l a", ":1")
+	expectReply(t, e, c, "INCR l", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	// 只修改值，保留过期时间
+	expectReply(t, e, c, "SET ttl 1 EX 100", "+ok")
+	expectReply(t, e, c, "INCR ttl", ":2")
+	expectTTL(t, e, c, "ttl", 100)
+
+	expectReply(t, e, c, "INCRBYFLOAT f 10.5", "$4 10.5")
+	expectReply(t, e, c, "INCRBYFLOAT f -0.25", "$5 10.25")
+	expectReply(t, e, c, "INCRBYFLOAT f 5.0e3", "$7 5010.25")
+	expectReply(t, e, c, "INCRBYFLOAT f nan", "-ERR value is not a valid float")
+	expectReply(t, e, c, "INCRBYFLOAT s 1", "-ERR value is not a valid float")
+	expectReply(t, e, c, "SET big 1.7e308", "+ok")
+	expectReply(t, e, c, "INCRBYFLOAT big 1.7e308", "-ERR increment would produce NaN or Infinity")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "MGET n max min ttl f", "*5 $2 -5 $19 9223372036854775807 $20 -9223372036854775808 $1 2 $7 5010.25")
+	expectTTL(t, e, c, "ttl", 100)
+}
+
+func TestSetOptions(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1 NX", "+ok")
+	expectReply(t, e, c, "SET a 2 NX", "$-1")
+	expectReply(t, e, c, "SET b 1 XX", "$-1")
+	expectReply(t, e, c, "EXISTS b", ":0")
+	expectReply(t, e, c, "SET a 2 XX GET", "$1 1")
+	expectReply(t, e, c, "SET a 3 NX GET", "$1 2")
+	expectReply(t, e, c, "SET b 1 GET", "$-1")
+
+	expectReply(t, e, c, "SET ex v EX 100", "+ok")
+	expectTTL(t, e, c, "ex", 100)
+	expectReply(t, e, c, "SET px v PX 100000", "+ok")
+	expectTTL(t, e, c, "px", 100)
+	expectReply(t, e, c, "SET exat v EXAT 32503680000", "+ok")
+	expectReply(t, e, c, "EXPIRETIME exat", ":32503680000")
+	expectReply(t, e, c, "SET pxat v PXAT 32503680000123", "+ok")
+	expectReply(t, e, c, "PEXPIRETIME pxat", ":32503680000123")
+	expectReply(t, e, c, "SET ex w KEEPTTL", "+ok")
+	expectTTL(t, e, c, "ex", 100)
+	// 不带过期参数时清除原来的过期时间
+	expectReply(t, e, c, "SET px w", "+ok")
+	expectReply(t, e, c, "TTL px", ":-1")
+	expectReply(t, e, c, "SET past v PXAT 1", "+ok")
+	expectReply(t, e, c, "EXISTS past", ":0")
+
+	expectReply(t, e, c, "SET a 1 NX XX", "-ERR syntax error")
+	expectReply(t, e, c, "SET a 1 EX 10 PX 10", "-ERR syntax error")
+	expectReply(t, e, c, "SET a 1 EX 10 KEEPTTL", "-ERR syntax error")
+	expectReply(t, e, c, "SET a 1 EX", "-ERR syntax error")
+	expectReply(t, e, c, "SET a 1 EX x", "-ERR value is not an integer or out of range")
+	expectReply(t, e, c, "SET a 1 EX 0", "-ERR invalid expire time in 'set' command")
+	expectReply(t, e, c, "SET a 1 PX -5", "-ERR invalid expire time in 'set' command")
+	expectReply(t, e, c, "SET a 1 EX 9223372036854775807", "-ERR invalid expire time in 'set' command")
+	expectReply(t, e, c, "SET a 1 FOREVER", "-ERR syntax error")
+	expectReply(t, e, c, "RPUSH l x", ":1")
+	expectReply(t, e, c, "SET l 1 GET", "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	expectReply(t, e, c, "LLEN l", ":1")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "MGET a b ex px", "*4 $1 2 $1 1 $1 w $1 w")
+	expectTTL(t, e, c, "ex", 100)
+	expectReply(t, e, c, "TTL px", ":-1")
+	expectReply(t, e, c, "PEXPIRETIME pxat", ":32503680000123")
+	expectReply(t, e, c, "EXISTS past", ":0")
+}
+
+func TestStringRangeCommands(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "APPEND s Hello", ":5")
+	expectReply(t, e, c, "APPEND s World", ":10")
+	expectReply(t, e, c, "STRLEN s", ":10")
+	expectReply(t, e, c, "STRLEN none", ":0")
+	expectReply(t, e, c, "GETRANGE s 0 4", "$5 Hello")
+	expectReply(t, e, c, "GETRANGE s -5 -1", "$5 World")
+	expectReply(t, e, c, "GETRANGE s 5 100", "$5 World")
+	expectReply(t, e, c, "GETRANGE s -1 -5", "$0")
+	expectReply(t, e, c, "GETRANGE s x 1", "-ERR value is not an integer or out of range")
+
+	expectReply(t, e, c, "SETRANGE s 5 Gedis", ":10")
+	expectReply(t, e, c, "GET s", "$10 HelloGedis")
+	// 不足的部分用0填充
+	expectReply(t, e, c, "SETRANGE pad 2 ab", ":4")
+	expectReply(t, e, c, "GETRANGE pad 0 1", "$2 \x00\x00")
+	expectReply(t, e, c, "SETRANGE s -1 x", "-ERR offset is out of range")
+	expectReply(t, e, c, "SETRANGE s 536870911 xx", "-ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+
+	expectReply(t, e, c, "GETSET s new", "$10 HelloGedis")
+	expectReply(t, e, c, "GETSET none v", "$-1")
+	expectReply(t, e, c, "GETDEL none", "$1 v")
+	expectReply(t, e, c, "GETDEL none", "$-1")
+	expectReply(t, e, c, "EXISTS none", ":0")
+
+	expectReply(t, e, c, "SETNX s x", ":0")
+	expectReply(t, e, c, "SETNX n x", ":1")
+	expectReply(t, e, c, "SETEX ex 100 v", "+ok")
+	expectTTL(t, e, c, "ex", 100)
+	expectReply(t, e, c, "PSETEX px 100000 v", "+ok")
+	expectReply(t, e, c, "PSETEX px 0 v", "-ERR invalid expire time in 'psetex' command")
+	expectReply(t, e, c, "SETEX ex x v", "-ERR value is not an integer or out of range")
+
+	expectReply(t, e, c, "GETEX ex PERSIST", "$1 v")
+	expectReply(t, e, c, "TTL ex", ":-1")
+	expectReply(t, e, c, "GETEX n EX 50", "$1 x")
+	expectTTL(t, e, c, "n", 50)
+	expectReply(t, e, c, "GETEX n", "$1 x")
+	expectTTL(t, e, c, "n", 50)
+	expectReply(t, e, c, "GETEX n EX 10 PERSIST", "-ERR syntax error")
+	expectReply(t, e, c, "GETEX n PX 0", "-ERR invalid expire time in 'getex' command")
+
+	expectReply(t, e, c, "MSETNX m1 a m2 b", ":1")
+	// 任意一个key存在就全部不设置
+	expectReply(t, e, c, "MSETNX m2 x m3 y", ":0")
+	expectReply(t, e, c, "MGET m1 m2 m3", "*3 $1 a $1 b $-1")
+	expectReply(t, e, c, "MSETNX m1 a m2", "-ERR wrong number of arguments for 'msetnx' command")
+
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "MGET s pad n ex m2 none", "*6 $3 new $4 \x00\x00ab $1 x $1 v $1 b $-1")
+	expectTTL(t, e, c, "n", 50)
+	expectReply(t, e, c, "TTL ex", ":-1")
+	expectTTL(t, e, c, "px", 100)
+}
+
+func TestLCS(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "MSET a ohmytext b mynewtext", "+ok")
+	expectReply(t, e, c, "LCS a b", "$6 mytext")
+	expectReply(t, e, c, "LCS a b LEN", ":6")
+	expectReply(t, e, c, "LCS a b IDX", "*4 $7 matches *2 *2 *2 :4 :7 *2 :5 :8 *2 *2 :2 :3 *2 :0 :1 $3 len :6")
+	expectReply(t, e, c, "LCS a b IDX MINMATCHLEN 4 WITHMATCHLEN", "*4 $7 matches *1 *3 *2 :4 :7 *2 :5 :8 :4 $3 len :6")
+	expectReply(t, e, c, "LCS a none", "$0")
+	expectReply(t, e, c, "LCS a b LEN IDX", "-ERR If you want both the length and indexes, please just use IDX.")
+	expectReply(t, e, c, "LCS a b MINMATCHLEN", "-ERR syntax error")
+	expectReply(t, e, c, "RPUSH l x", ":1")
+	expectReply(t, e, c, "LCS a l", "-ERR The specified keys must contain string values")
+	// dp表超过proto-max-bulk-len时在分配之前拒绝
+	expectReply(t, e, c, "SETRANGE big1 11999 x", ":12000")
+	expectReply(t, e, c, "SETRANGE big2 11999 y", ":12000")
+	expectReply(t, e, c, "LCS big1 big2 LEN", "-ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	expectReply(t, e, c, "SETRANGE huge 1048575 x", ":1048576")
+	expectReply(t, e, c, "LCS huge huge", "-ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	expectReply(t, e, c, "LCS huge a LEN", ":1")
+}
@@ -1,7 +1,10 @@
 package engine
 
 import (
+	"fmt"
 	"gedis/gedis/proto"
+	"strings"
+	"time"
 )
 
 func Ping(args [][]byte) proto.Reply {
@@ -22,3 +25,54 @@ func Auth(args [][]byte) proto.Reply {
 	// todo 先不验证密码，后续添加
 	return proto.NewOkReply()
 }
+
+type infoSection struct {
+	name string
+	gen  func(e *Engine) string
+}
+
+var infoSections = []infoSection{
+	{"stats", (*Engine).statsInfo},
+	{"keyspace", (*Engine).keyspaceInfo},
+}
+
+// INFO [section [section ...]]
+func (e *Engine) info(args [][]byte) proto.Reply {
+	sections := make(map[string]bool)
+	for _, arg := range args {
+		sections[strings.ToLower(string(arg))] = true
+	}
+	all := len(sections) == 0 || sections["all"] || sections["default"] || sections["everything"]
+
+	var builder strings.Builder
+	for _, section := range infoSections {
+		if !all && !sections[section.name] {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\r\n")
+		}
+		builder.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		builder.WriteString(section.gen(e))
+	}
+	return proto.NewBulkReply([]byte(builder.String()))
+}
+
+func (e *Engine) statsInfo() string {
+	stats := e.stats
+	return fmt.Sprintf("expired_keys:%d\r\n", stats.expiredKeys.Load()) +
+		fmt.Sprintf("expired_stale_perc:%.2f\r\n", stats.expiredStalePerc.Load().(float64)*100) +
+		fmt.Sprintf("expired_time_cap_reached_count:%d\r\n", stats.expireTimeCapReached.Load()) +
+		fmt.Sprintf("expire_cycle_cpu_milliseconds:%d\r\n", time.Duration(stats.expireCycleTime.Load()).Milliseconds())
+}
+
+func (e *Engine) keyspaceInfo() string {
+	var builder strings.Builder
+	for i := range e.dbSet {
+		db := e.selectDb(i)
+		if keys := db.dataDict.Count(); keys > 0 {
+			builder.WriteString(fmt.Sprintf("db%d:keys=%d,expires=%d\r\n", i, keys, db.ttlDict.Count()))
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,63 @@
+package engine
+
+import "gedis/gedis/proto"
+
+// 命令执行中途panic或者返回Abort时，撤销它已经做出的修改
+// 每一次修改只记录撤销它所需要的数据：被替换的对象、插入或弹出的元素、被移动的成员等，不会复制整个对象
+
+type abortReply struct {
+	reply proto.Reply
+}
+
+func (r *abortReply) Bytes() []byte {
+	return r.reply.Bytes()
+}
+
+// Abort 命令返回Abort(reply)时，命令已经做出的修改会被撤销并且不会写入aof，客户端收到的是reply
+// 事务中的命令返回Abort时整个事务都会被撤销
+func Abort(reply proto.Reply) proto.Reply {
+	return &abortReply{reply: reply}
+}
+
+// Modified 命令原地修改了key的数据后调用，undo用于撤销这次修改
+//
+// PutEntity、Remove、ExpireAt、Persist等替换或删除整个key的操作会自己记录撤销操作；
+// 直接修改key中已有对象的写操作（插入、弹出、改写部分字节等）必须调用Modified，
+// 否则命令被撤销时这部分修改会保留下来。undo只需要恢复这一次修改之前的状态，
+// 撤销时按照与修改相反的顺序执行。过期删除不属于命令的修改，不会被撤销
+//
+// 只有真正发生修改时才会让WATCH该key的事务失败，失败或者没有改变数据的写命令不影响其他客户端的事务
+func (d *DB) Modified(key string, undo func()) {
+	d.watched.touch(key)
+	d.addUndo(undo)
+}
+
+func (d *DB) addUndo(undo func()) {
+	if d.exec != nil {
+		d.exec.addUndo(undo)
+	}
+}
+
+// 在执行上下文中执行命令，命令panic或者返回Abort时撤销它做出的修改，panic会继续向上抛出
+func (d *DB) execWithUndo(command [][]byte) proto.Reply {
+	mark := d.exec.mark()
+	defer func() {
+		if err := recover(); err != nil {
+			d.exec.rollback(mark)
+			panic(err)
+		}
+	}()
+	reply := d.execNormalCommand(command)
+	if _, ok := reply.(*abortReply); ok {
+		d.exec.rollback(mark)
+	}
+	return reply
+}
+
+// 去掉Abort的包装，返回给客户端
+func unwrapAbort(reply proto.Reply) proto.Reply {
+	if abort, ok := reply.(*abortReply); ok {
+		return abort.reply
+	}
+	return reply
+}
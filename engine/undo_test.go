@@ -0,0 +1,233 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gedis/engine/entity"
+	"gedis/gedis/conn"
+	"gedis/gedis/proto"
+)
+
+// 命令执行完修改之后再panic
+func injectPanic(t *testing.T, name string) {
+	cmd := commandCenter[name]
+	exec := cmd.execFunc
+	cmd.execFunc = func(db *DB, args [][]byte) proto.Reply {
+		exec(db, args)
+		panic("injected panic")
+	}
+	t.Cleanup(func() {
+		cmd.execFunc = exec
+	})
+}
+
+func TestUndoMSetPanic(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1", "+ok")
+	expectReply(t, e, c, "EXPIRE a 1000", ":1")
+	injectPanic(t, "mset")
+	expectReply(t, e, c, "MSET a 2 b 3", "-ERR injected panic")
+
+	expectReply(t, e, c, "GET a", "$1 1")
+	expectReply(t, e, c, "EXISTS b", ":0")
+	if ttl := testExec(e, c, "TTL a"); ttl == ":-1" {
+		t.Error("ttl of a is lost")
+	}
+	if strings.Contains(readAof(t), "mset") {
+		t.Error("aof of failed command is written")
+	}
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "GET a", "$1 1")
+	expectReply(t, e, c, "EXISTS b", ":0")
+}
+
+func TestUndoLMovePanic(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "RPUSH src x y z", ":3")
+	expectReply(t, e, c, "RPUSH dest w", ":1")
+	expectReply(t, e, c, "RPUSH one v", ":1")
+	injectPanic(t, "lmove")
+	expectReply(t, e, c, "LMOVE src dest LEFT RIGHT", "-ERR injected panic")
+	// 源列表被清空并删除，目标列表是新建的
+	expectReply(t, e, c, "LMOVE one new RIGHT LEFT", "-ERR injected panic")
+
+	expectReply(t, e, c, "LRANGE src 0 -1", "*3 $1 x $1 y $1 z")
+	expectReply(t, e, c, "LRANGE dest 0 -1", "*1 $1 w")
+	expectReply(t, e, c, "LRANGE one 0 -1", "*1 $1 v")
+	expectReply(t, e, c, "EXISTS new", ":0")
+	if strings.Contains(readAof(t), "lmove") {
+		t.Error("aof of failed command is written")
+	}
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "LRANGE src 0 -1", "*3 $1 x $1 y $1 z")
+	expectReply(t, e, c, "LRANGE dest 0 -1", "*1 $1 w")
+}
+
+func TestUndoMultiPanic(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1", "+ok")
+	expectReply(t, e, c, "SADD s m", ":1")
+	injectPanic(t, "lmove")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "SET a 2", "+QUEUED")
+	expectReply(t, e, c, "SREM s m", "+QUEUED")
+	expectReply(t, e, c, "HSET h f v", "+QUEUED")
+	expectReply(t, e, c, "RPUSH l x", "+QUEUED")
+	expectReply(t, e, c, "LMOVE l l LEFT RIGHT", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "-ERR injected panic")
+
+	expectReply(t, e, c, "GET a", "$1 1")
+	expectReply(t, e, c, "SMEMBERS s", "*1 $1 m")
+	expectReply(t, e, c, "EXISTS h l", ":0")
+	if strings.Contains(readAof(t), "multi") {
+		t.Error("aof of failed transaction is written")
+	}
+	e = reloadTestEngine(t, e)
+	expectReply(t, e, c, "GET a", "$1 1")
+	expectReply(t, e, c, "SMEMBERS s", "*1 $1 m")
+}
+
+func TestAbort(t *testing.T) {
+	registerCommand("TestAbort", func(db *DB, args [][]byte) proto.Reply {
+		db.PutEntity(string(args[0]), &entity.DataEntity{Object: []byte("changed")})
+		db.writeAof([][]byte{[]byte("SET"), args[0], []byte("changed")})
+		return Abort(proto.NewGenericErrReply("aborted"))
+	}, writeFirstKey, 2)
+	t.Cleanup(func() {
+		delete(commandCenter, "testabort")
+	})
+
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1", "+ok")
+	expectReply(t, e, c, "TESTABORT a", "-ERR aborted")
+	expectReply(t, e, c, "GET a", "$1 1")
+
+	// 事务中的命令返回Abort时整个事务都被撤销
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "SET b 1", "+QUEUED")
+	expectReply(t, e, c, "TESTABORT a", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "-ERR aborted")
+	expectReply(t, e, c, "EXISTS a b", ":1")
+	expectReply(t, e, c, "GET a", "$1 1")
+	if strings.Contains(readAof(t), "changed") {
+		t.Error("aof of aborted command is written")
+	}
+}
+
+// 每种数据类型原地修改的命令panic后都能恢复到执行前的状态
+func TestUndoDataTypes(t *testing.T) {
+	tests := []struct {
+		setup   []string
+		command string
+		checks  []string
+	}{
+		// string
+		{[]string{"SET s1 abc EX 100"}, "APPEND s1 def", []string{"GET s1", "TTL s1"}},
+		{[]string{"SET s2 abc"}, "SETRANGE s2 1 zz", []string{"GET s2"}},
+		{[]string{"SET s3 10"}, "INCRBY s3 5", []string{"GET s3"}},
+		{[]string{"SET s4 a EX 100"}, "GETDEL s4", []string{"GET s4", "TTL s4"}},
+		{[]string{"SET s5 a EX 100"}, "GETEX s5 PERSIST", []string{"TTL s5"}},
+		{[]string{"SET s6 a EX 100"}, "SET s6 b KEEPTTL", []string{"GET s6", "TTL s6"}},
+		{[]string{"MSET s7 a s8 b"}, "RENAME s7 s8", []string{"MGET s7 s8"}},
+		{[]string{"SET s9 a"}, "EXPIRE s9 100", []string{"TTL s9"}},
+		{[]string{"SET s10 a EX 100"}, "PERSIST s10", []string{"TTL s10"}},
+		{[]string{"MSET s11 a s12 b"}, "DEL s11 s12 s13", []string{"MGET s11 s12"}},
+		// bitmap
+		{[]string{"SET b1 a"}, "SETBIT b1 20 1", []string{"GET b1"}},
+		{[]string{"SET b2 a"}, "BITFIELD b2 SET u8 8 255 INCRBY u4 0 1", []string{"GET b2"}},
+		{[]string{"MSET b3 a b4 zz"}, "BITOP NOT b4 b3", []string{"GET b4"}},
+		// hash
+		{[]string{"HSET h1 a 1 b 2"}, "HSET h1 a 3 c 4", []string{"HMGET h1 a b c", "HLEN h1"}},
+		{[]string{"HSET h2 a 1 b 2"}, "HDEL h2 a b", []string{"HMGET h2 a b", "EXISTS h2"}},
+		{[]string{"HSET h3 n 5"}, "HINCRBY h3 n 3", []string{"HGET h3 n"}},
+		{[]string{"HSET h4 n 1.5"}, "HINCRBYFLOAT h4 n 1", []string{"HGET h4 n"}},
+		{[]string{"HSET h5 a 1"}, "HSETNX h5 b 2", []string{"HMGET h5 a b"}},
+		// list
+		{[]string{"RPUSH l1 a b"}, "RPUSH l1 c d", []string{"LRANGE l1 0 -1"}},
+		{[]string{"RPUSH l2 a b c"}, "LPOP l2 2", []string{"LRANGE l2 0 -1"}},
+		{[]string{"RPUSH l3 a b c"}, "LSET l3 1 x", []string{"LRANGE l3 0 -1"}},
+		{[]string{"RPUSH l4 a b c"}, "LINSERT l4 BEFORE b x", []string{"LRANGE l4 0 -1"}},
+		{[]string{"RPUSH l5 a b a c a"}, "LREM l5 -2 a", []string{"LRANGE l5 0 -1"}},
+		{[]string{"RPUSH l6 a b c d"}, "LTRIM l6 1 2", []string{"LRANGE l6 0 -1"}},
+		{[]string{"RPUSH l7 a b c"}, "LMOVE l7 l7 RIGHT LEFT", []string{"LRANGE l7 0 -1"}},
+		{[]string{"RPUSH l8 a"}, "RPOP l8", []string{"LRANGE l8 0 -1"}},
+		// set
+		{[]string{"SADD t1 a b"}, "SADD t1 c d", []string{"SCARD t1", "SMISMEMBER t1 a b c d"}},
+		{[]string{"SADD t2 a b c"}, "SREM t2 a b", []string{"SCARD t2", "SMISMEMBER t2 a b c"}},
+		{[]string{"SADD t3 a b c"}, "SPOP t3 2", []string{"SCARD t3", "SMISMEMBER t3 a b c"}},
+		{[]string{"SADD t4 a b"}, "SMOVE t4 t5 a", []string{"SMISMEMBER t4 a b", "EXISTS t5"}},
+		{[]string{"SADD t6 1 2"}, "SADD t6 x", []string{"SCARD t6", "OBJECT ENCODING t6"}},
+		// sorted set
+		{[]string{"ZADD z1 1 a 2 b"}, "ZADD z1 3 a 4 c", []string{"ZRANGE z1 0 -1 WITHSCORES"}},
+		{[]string{"ZADD z2 1 a"}, "ZINCRBY z2 5 a", []string{"ZRANGE z2 0 -1 WITHSCORES"}},
+		{[]string{"ZADD z3 1 a 2 b 3 c"}, "ZREM z3 a c", []string{"ZRANGE z3 0 -1 WITHSCORES"}},
+		{[]string{"ZADD z4 1 a 2 b"}, "ZPOPMIN z4", []string{"ZRANGE z4 0 -1 WITHSCORES"}},
+		{[]string{"ZADD z5 1 a 2 b 3 c"}, "ZREMRANGEBYSCORE z5 1 2", []string{"ZRANGE z5 0 -1 WITHSCORES"}},
+		{[]string{"GEOADD g1 10 20 a"}, "GEOADD g1 30 40 b", []string{"ZRANGE g1 0 -1 WITHSCORES"}},
+		// hyperloglog
+		{[]string{"PFADD p1 a b"}, "PFADD p1 c d", []string{"PFCOUNT p1"}},
+		// stream
+		{[]string{"XADD x1 1-1 f v"}, "XADD x1 2-1 f w", []string{"XRANGE x1 - +", "XINFO STREAM x1"}},
+		{[]string{"XADD x2 1-1 f v", "XADD x2 2-1 f w"}, "XDEL x2 1-1", []string{"XRANGE x2 - +", "XINFO STREAM x2"}},
+		{[]string{"XADD x3 1-1 f v", "XADD x3 2-1 f w"}, "XTRIM x3 MAXLEN 1", []string{"XRANGE x3 - +", "XINFO STREAM x3"}},
+		{[]string{"XADD x4 1-1 f v"}, "XGROUP CREATE x4 g 0", []string{"XINFO GROUPS x4"}},
+		{[]string{"XADD x5 1-1 f v", "XGROUP CREATE x5 g 0"}, "XREADGROUP GROUP g c STREAMS x5 >",
+			[]string{"XPENDING x5 g", "XINFO GROUPS x5"}},
+		{[]string{"XADD x6 1-1 f v", "XGROUP CREATE x6 g 0", "XREADGROUP GROUP g c STREAMS x6 >"}, "XACK x6 g 1-1",
+			[]string{"XPENDING x6 g"}},
+	}
+
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expected := make([][]string, len(tests))
+	for i, tt := range tests {
+		for _, line := range tt.setup {
+			if reply := testExec(e, c, line); strings.HasPrefix(reply, "-") {
+				t.Fatalf("%s: %s", line, reply)
+			}
+		}
+		for _, check := range tt.checks {
+			expected[i] = append(expected[i], testExec(e, c, check))
+		}
+		t.Run(tt.command, func(t *testing.T) {
+			injectPanic(t, strings.ToLower(strings.Fields(tt.command)[0]))
+			expectReply(t, e, c, tt.command, "-ERR injected panic")
+		})
+		for j, check := range tt.checks {
+			expectReply(t, e, c, check, expected[i][j])
+		}
+	}
+
+	// 撤销的命令没有写入aof，重新加载后状态相同
+	e = reloadTestEngine(t, e)
+	for i, tt := range tests {
+		for j, check := range tt.checks {
+			expectReply(t, e, c, check, expected[i][j])
+		}
+	}
+}
+
+// 命令执行期间惰性删除的过期key，命令被撤销时不会重新出现
+func TestUndoLazyExpire(t *testing.T) {
+	e := newTestEngine(t)
+	c := gedisconn.NewVirtualConnection()
+	expectReply(t, e, c, "SET a 1 PX 1", "+ok")
+	expectReply(t, e, c, "RPUSH l x", ":1")
+	time.Sleep(5 * time.Millisecond)
+	injectPanic(t, "lmove")
+	expectReply(t, e, c, "MULTI", "+ok")
+	expectReply(t, e, c, "GET a", "+QUEUED")
+	expectReply(t, e, c, "LMOVE l l LEFT RIGHT", "+QUEUED")
+	expectReply(t, e, c, "EXEC", "-ERR injected panic")
+	expectReply(t, e, c, "DBSIZE", ":1")
+	// 被撤销的删除会让key重新出现，之后再次过期
+	if stats := testExec(e, c, "INFO stats"); !strings.Contains(stats, "expired_keys:1 ") {
+		t.Errorf("expired key is not counted once: %q", stats)
+	}
+}
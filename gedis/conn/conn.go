@@ -16,6 +16,12 @@ type Connection struct {
 	subs map[string]struct{}
 
 	closed atomic.Bool
+
+	// 事务状态
+	multiState bool
+	queue      [][][]byte
+	txErrors   []error
+	watching   map[string]uint64
 }
 
 func (c *Connection) UnSubscribe(key string) {
@@ -68,6 +74,49 @@ func (c *Connection) SetDbIndex(dbIndex int) {
 	c.dbIndex = dbIndex
 }
 
+func (c *Connection) InMultiState() bool {
+	return c.multiState
+}
+
+func (c *Connection) SetMultiState(state bool) {
+	if !state {
+		c.queue = nil
+		c.txErrors = nil
+	}
+	c.multiState = state
+}
+
+func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	return c.queue
+}
+
+func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.queue = append(c.queue, cmdLine)
+}
+
+func (c *Connection) ClearQueuedCmds() {
+	c.queue = nil
+}
+
+func (c *Connection) AddTxError(err error) {
+	c.txErrors = append(c.txErrors, err)
+}
+
+func (c *Connection) GetTxErrors() []error {
+	return c.txErrors
+}
+
+func (c *Connection) GetWatching() map[string]uint64 {
+	if c.watching == nil {
+		c.watching = make(map[string]uint64)
+	}
+	return c.watching
+}
+
+func (c *Connection) CancelWatching() {
+	c.watching = nil
+}
+
 func NewConnection(conn net.Conn) *Connection {
 	return &Connection{c: conn}
 }
@@ -31,6 +31,7 @@ func NewGedisHandler() *GedisHandler {
 func (g *GedisHandler) Handle(ctx context.Context, conn net.Conn) {
 	gconn := gedisconn.NewConnection(conn)
 	g.activeConn.Store(conn, struct{}{})
+	defer g.engine.CloseConn(gconn)
 	outChan := parser.ParseStream(conn)
 	for payload := range outChan {
 		if payload.Err != nil {
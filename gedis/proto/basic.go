@@ -26,7 +26,7 @@ func NewPongReply() Reply {
 	return pongReply
 }
 
-var queueReply = &SimpleStringReply{"queue"}
+var queueReply = &SimpleStringReply{"QUEUED"}
 
 func NewQueueReply() Reply {
 	return queueReply
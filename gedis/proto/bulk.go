@@ -17,6 +17,17 @@ func NewEmptyMultiBulkReply() Reply {
 	return &EmptyMultiBulkReply{}
 }
 
+type NullMultiBulkReply struct {
+}
+
+func (r *NullMultiBulkReply) Bytes() []byte {
+	return []byte("*-1" + util.CRLF)
+}
+
+func NewNullMultiBulkReply() Reply {
+	return &NullMultiBulkReply{}
+}
+
 type MultiBulkReply struct {
 	Command [][]byte
 }
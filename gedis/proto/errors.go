@@ -7,7 +7,7 @@ type SimpleErrReply struct {
 }
 
 func (r *SimpleErrReply) Bytes() []byte {
-	return []byte("-" + r.Status)
+	return []byte("-" + r.Status + util.CRLF)
 }
 
 func NewSimpleErrReply(status string) Reply {
@@ -1,3 +1,5 @@
 module gedis
 
 go 1.21.11
+
+require github.com/yuin/gopher-lua v1.1.1
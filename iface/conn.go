@@ -11,4 +11,16 @@ type Conn interface {
 	IsClosed() bool
 	GetChannels() []string
 	UnSubscribe(key string)
+
+	// 事务相关
+	InMultiState() bool
+	SetMultiState(state bool)
+	GetQueuedCmdLine() [][][]byte
+	EnqueueCmd(cmdLine [][]byte)
+	ClearQueuedCmds()
+	AddTxError(err error)
+	GetTxErrors() []error
+	// WATCH的key以及当时的版本
+	GetWatching() map[string]uint64
+	CancelWatching()
 }
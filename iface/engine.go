@@ -4,5 +4,7 @@ import "gedis/gedis/proto"
 
 type Engine interface {
 	Exec(conn Conn, command [][]byte) (result proto.Reply)
+	// 客户端断开连接时调用
+	CloseConn(conn Conn)
 	Close()
 }
@@ -106,9 +106,14 @@ func (l *Locker) RWUnlocks(wkeys []string, rkeys []string) {
 }
 
 func (l *Locker) toIndex(keys ...string) []uint32 {
-	var indexList = make([]uint32, 0, len(keys))
+	// 多个key可能落在同一把锁上，需要去重，否则会重复加锁导致死锁
+	indexMap := make(map[uint32]struct{}, len(keys))
 	for _, key := range keys {
-		indexList = append(indexList, util.Fnv32(key)&l.mask)
+		indexMap[util.Fnv32(key)&l.mask] = struct{}{}
+	}
+	var indexList = make([]uint32, 0, len(indexMap))
+	for index := range indexMap {
+		indexList = append(indexList, index)
 	}
 	sort.Slice(indexList, func(i, j int) bool {
 		return indexList[i] < indexList[j]
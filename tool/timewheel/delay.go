@@ -8,14 +8,15 @@ type Delay struct {
 
 func NewDelay() *Delay {
 	delay := &Delay{}
-	delay.tw = NewTimeWheel(time.Second, 3600)
+	// 毫秒 -> 秒 -> 分 -> 时
+	delay.tw = NewTimeWheel(time.Millisecond, []int{1000, 60, 60, 24})
 	delay.tw.Start()
 	return delay
 }
 
 // 添加绝对时间延迟任务
 func (d *Delay) AddAt(expireTime time.Time, key string, callback func()) {
-	d.Add(time.Until(expireTime), key, callback)
+	d.tw.AddTaskAt(expireTime, key, callback)
 }
 
 // 添加相对时间延迟任务
@@ -26,3 +27,7 @@ func (d *Delay) Add(delay time.Duration, key string, callback func()) {
 func (d *Delay) Cancel(key string) {
 	d.tw.CancelTask(key)
 }
+
+func (d *Delay) Stop() {
+	d.tw.Stop()
+}
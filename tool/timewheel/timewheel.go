@@ -8,48 +8,61 @@ import (
 )
 
 type taskPos struct {
-	pos int
-	ele *list.Element
+	level int
+	slot  int
+	ele   *list.Element
 }
 
 type task struct {
-	delay    time.Duration
+	// 到期时的刻度
+	deadline int64
 	key      string
-	circle   int
 	callback func()
 }
 
+// 一层时间轮，每个槽对应span个刻度
+type level struct {
+	span  int64
+	slots []*list.List
+}
+
+// TimeWheel 分层时间轮，第0层每个槽对应一个刻度，上一层的一个槽对应下一层转一圈
+// 任务按照到期刻度放到能容纳它的最低一层，上层的槽到期后把任务降级到下层
 type TimeWheel struct {
-	// 间隔
+	// 每个刻度的时长
 	interval time.Duration
 	// 定时器
 	ticker *time.Ticker
+	// 时间轮启动的时间
+	start time.Time
+	// 已经走过的刻度
+	now int64
 
-	// 游标
-	curSlotPos int
-	// 队列大小
-	slotNum int
-	// 圈的点的个数
-	slots []*list.List
-	m     map[string]*taskPos
+	levels []*level
+	m      map[string]*taskPos
 
 	addChan    chan *task
 	cancelChan chan string
 	stopChan   chan struct{}
 }
 
-func NewTimeWheel(interval time.Duration, slotNum int) *TimeWheel {
+// slotNums为从低到高每一层的槽数
+func NewTimeWheel(interval time.Duration, slotNums []int) *TimeWheel {
 	tw := &TimeWheel{
 		interval:   interval,
-		slotNum:    slotNum,
-		slots:      make([]*list.List, slotNum),
 		m:          make(map[string]*taskPos),
 		addChan:    make(chan *task),
 		cancelChan: make(chan string),
 		stopChan:   make(chan struct{}),
 	}
-	for i := 0; i < slotNum; i++ {
-		tw.slots[i] = list.New()
+	span := int64(1)
+	for _, slotNum := range slotNums {
+		l := &level{span: span, slots: make([]*list.List, slotNum)}
+		for i := range l.slots {
+			l.slots[i] = list.New()
+		}
+		tw.levels = append(tw.levels, l)
+		span *= int64(slotNum)
 	}
 	return tw
 }
@@ -58,7 +71,7 @@ func (tw *TimeWheel) doTask() {
 	for {
 		select {
 		case <-tw.ticker.C:
-			tw.execTask()
+			tw.advance()
 		case t := <-tw.addChan:
 			tw.addTask(t)
 		case key := <-tw.cancelChan:
@@ -70,68 +83,82 @@ func (tw *TimeWheel) doTask() {
 	}
 }
 
-func (tw *TimeWheel) execTask() {
-	// 获取要执行的链表
-	l := tw.slots[tw.curSlotPos]
-	//开启下一次循环
-	if tw.curSlotPos == tw.slotNum-1 {
-		tw.curSlotPos = 0
-	} else {
-		tw.curSlotPos++
-	}
-	go tw.scanList(l)
+// 当前时间对应的刻度
+func (tw *TimeWheel) elapsed() int64 {
+	return int64(time.Since(tw.start) / tw.interval)
 }
 
-func (tw *TimeWheel) scanList(l *list.List) {
-	e := l.Front()
-	for e != nil {
-		t := e.Value.(*task)
-		// 不属于该圈任务
-		if t.circle > 0 {
-			t.circle--
-			continue
-		}
-		go func() {
-			defer func() {
-				if err := recover(); err != nil {
-					logger.Error(err, string(debug.Stack()))
-				}
-			}()
-			if t.callback != nil {
-				t.callback()
+// 定时器可能丢失刻度，按照实际经过的时间逐个刻度推进
+func (tw *TimeWheel) advance() {
+	target := tw.elapsed()
+	for tw.now < target {
+		tw.now++
+		// 先从高层往低层降级，再执行第0层到期的任务
+		for i := len(tw.levels) - 1; i > 0; i-- {
+			l := tw.levels[i]
+			if tw.now%l.span == 0 {
+				tw.cascade(i, int(tw.now/l.span)%len(l.slots))
 			}
+		}
+		l := tw.levels[0]
+		tw.cascade(0, int(tw.now%int64(len(l.slots))))
+	}
+}
 
-		}()
-		next := e.Next()
-		l.Remove(e)
+// 取出槽中所有的任务重新放置，已经到期的任务会被执行
+func (tw *TimeWheel) cascade(level, slot int) {
+	l := tw.levels[level].slots[slot]
+	for e := l.Front(); e != nil; e = l.Front() {
+		t := l.Remove(e).(*task)
 		if t.key != "" {
 			delete(tw.m, t.key)
 		}
-		e = next
+		tw.addTask(t)
 	}
 }
 
+func (tw *TimeWheel) execTask(t *task) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error(err, string(debug.Stack()))
+			}
+		}()
+		if t.callback != nil {
+			t.callback()
+		}
+	}()
+}
+
 func (tw *TimeWheel) addTask(t *task) {
 	if t.key != "" {
 		if _, exist := tw.m[t.key]; exist {
 			return
 		}
 	}
-	pos, circle := tw.posAndCircle(t.delay)
-	t.circle = circle
-
-	ele := tw.slots[pos].PushBack(t)
-	tw.m[t.key] = &taskPos{pos: pos, ele: ele}
+	if t.deadline <= tw.now {
+		tw.execTask(t)
+		return
+	}
+	levelIdx, slot := tw.position(t.deadline)
+	ele := tw.levels[levelIdx].slots[slot].PushBack(t)
+	if t.key != "" {
+		tw.m[t.key] = &taskPos{level: levelIdx, slot: slot, ele: ele}
+	}
 }
 
-func (tw *TimeWheel) posAndCircle(delay time.Duration) (int, int) {
-	// 延迟
-	delaySecond := int(delay.Seconds())
-	// 间隔
-	intervalSecond := int(tw.interval.Seconds())
-	pos := (tw.curSlotPos + delaySecond/intervalSecond) % tw.slotNum
-	circle := (delaySecond / intervalSecond) / tw.slotNum
-	return pos, circle
+// 找到能容纳deadline的最低一层，超出最高层范围时放到最高层最远的槽，到时再重新放置
+func (tw *TimeWheel) position(deadline int64) (int, int) {
+	for i, l := range tw.levels {
+		slotNum := int64(len(l.slots))
+		if deadline/l.span-tw.now/l.span < slotNum {
+			return i, int(deadline / l.span % slotNum)
+		}
+	}
+	top := len(tw.levels) - 1
+	l := tw.levels[top]
+	slotNum := int64(len(l.slots))
+	return top, int((tw.now/l.span + slotNum - 1) % slotNum)
 }
 
 func (tw *TimeWheel) cancelTask(key string) {
@@ -139,28 +166,40 @@ func (tw *TimeWheel) cancelTask(key string) {
 	if !exist {
 		return
 	}
-	tw.slots[taskPos.pos].Remove(taskPos.ele)
+	tw.levels[taskPos.level].slots[taskPos.slot].Remove(taskPos.ele)
 	delete(tw.m, key)
 }
 
 /************外部调用的方法*****************/
 
 func (tw *TimeWheel) Start() {
+	tw.start = time.Now()
 	tw.ticker = time.NewTicker(tw.interval)
 	go tw.doTask()
 }
 
+// 停止之后添加和取消任务都不再生效，也不会阻塞调用者
 func (tw *TimeWheel) Stop() {
-	tw.stopChan <- struct{}{}
+	close(tw.stopChan)
 }
 
-func (tw *TimeWheel) AddTask(delay time.Duration, key string, callback func()) {
-	if delay < 0 {
-		return
+// 添加在expireTime执行的任务，已经过期的任务会在下一个刻度执行
+func (tw *TimeWheel) AddTaskAt(expireTime time.Time, key string, callback func()) {
+	// 向上取整，保证不会提前执行
+	deadline := int64((expireTime.Sub(tw.start) + tw.interval - 1) / tw.interval)
+	select {
+	case tw.addChan <- &task{deadline: deadline, key: key, callback: callback}:
+	case <-tw.stopChan:
 	}
-	tw.addChan <- &task{delay: delay, key: key, callback: callback}
+}
+
+func (tw *TimeWheel) AddTask(delay time.Duration, key string, callback func()) {
+	tw.AddTaskAt(time.Now().Add(delay), key, callback)
 }
 
 func (tw *TimeWheel) CancelTask(key string) {
-	tw.cancelChan <- key
+	select {
+	case tw.cancelChan <- key:
+	case <-tw.stopChan:
+	}
 }
@@ -0,0 +1,61 @@
+package timewheel
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTimeWheel(t *testing.T) {
+	// 每层10个槽，最高层只能覆盖1秒，更长的任务需要重新放置
+	tw := NewTimeWheel(time.Millisecond, []int{10, 10, 10})
+	tw.Start()
+	defer tw.Stop()
+
+	delays := []time.Duration{0, 5 * time.Millisecond, 50 * time.Millisecond, 250 * time.Millisecond, 1500 * time.Millisecond}
+	start := time.Now()
+	fired := make(chan int, len(delays))
+	for i, delay := range delays {
+		i := i
+		tw.AddTaskAt(start.Add(delay), strconv.Itoa(i), func() {
+			fired <- i
+		})
+	}
+	tw.AddTask(100*time.Millisecond, "cancel", func() {
+		t.Error("canceled task fired")
+	})
+	tw.CancelTask("cancel")
+
+	for range delays {
+		select {
+		case i := <-fired:
+			elapsed := time.Since(start)
+			if elapsed < delays[i] || elapsed > delays[i]+50*time.Millisecond {
+				t.Errorf("task %d fired after %v, want %v", i, elapsed, delays[i])
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("task not fired")
+		}
+	}
+}
+
+func TestTimeWheelStop(t *testing.T) {
+	tw := NewTimeWheel(time.Millisecond, []int{10, 10})
+	tw.Start()
+	tw.Stop()
+	done := make(chan struct{})
+	go func() {
+		// 停止之后的调用直接返回
+		tw.AddTask(time.Millisecond, "a", func() {
+			t.Error("task fired after stop")
+		})
+		tw.CancelTask("a")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("calls after stop are blocked")
+	}
+	time.Sleep(10 * time.Millisecond)
+}